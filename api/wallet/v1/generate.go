@@ -0,0 +1,8 @@
+// Package walletv1 holds the protobuf messages and gRPC services of the wallet
+// API. Regenerate them after editing wallet.proto with protoc,
+// protoc-gen-go v1.36.5 and protoc-gen-go-grpc v1.5.1 on the PATH:
+//
+//	go generate ./api/...
+package walletv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative wallet.proto
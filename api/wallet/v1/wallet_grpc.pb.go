@@ -0,0 +1,966 @@
+// Wallet API for internal services. It exposes the same operations as the
+// REST endpoints under /api/v1 with consistent snake_case fields.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: wallet.proto
+
+package walletv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UserService_GetUserByPhoneNumber_FullMethodName = "/wallet.v1.UserService/GetUserByPhoneNumber"
+	UserService_UpdateUser_FullMethodName           = "/wallet.v1.UserService/UpdateUser"
+	UserService_GetUserBalance_FullMethodName       = "/wallet.v1.UserService/GetUserBalance"
+	UserService_ListChargeCodeUsers_FullMethodName  = "/wallet.v1.UserService/ListChargeCodeUsers"
+)
+
+// UserServiceClient is the client API for UserService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type UserServiceClient interface {
+	GetUserByPhoneNumber(ctx context.Context, in *GetUserByPhoneNumberRequest, opts ...grpc.CallOption) (*User, error)
+	// UpdateUser replaces the phone number and balance of a user. The version
+	// of the user has to be the one the update is based on; when the user
+	// changed since, the call fails with ABORTED.
+	UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error)
+	GetUserBalance(ctx context.Context, in *GetUserBalanceRequest, opts ...grpc.CallOption) (*GetUserBalanceResponse, error)
+	// ListChargeCodeUsers lists the users who redeemed a charge code.
+	ListChargeCodeUsers(ctx context.Context, in *ListChargeCodeUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error)
+}
+
+type userServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUserServiceClient(cc grpc.ClientConnInterface) UserServiceClient {
+	return &userServiceClient{cc}
+}
+
+func (c *userServiceClient) GetUserByPhoneNumber(ctx context.Context, in *GetUserByPhoneNumberRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, UserService_GetUserByPhoneNumber_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UpdateUser(ctx context.Context, in *UpdateUserRequest, opts ...grpc.CallOption) (*User, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(User)
+	err := c.cc.Invoke(ctx, UserService_UpdateUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) GetUserBalance(ctx context.Context, in *GetUserBalanceRequest, opts ...grpc.CallOption) (*GetUserBalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserBalanceResponse)
+	err := c.cc.Invoke(ctx, UserService_GetUserBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ListChargeCodeUsers(ctx context.Context, in *ListChargeCodeUsersRequest, opts ...grpc.CallOption) (*ListUsersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListUsersResponse)
+	err := c.cc.Invoke(ctx, UserService_ListChargeCodeUsers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UserServiceServer is the server API for UserService service.
+// All implementations must embed UnimplementedUserServiceServer
+// for forward compatibility.
+type UserServiceServer interface {
+	GetUserByPhoneNumber(context.Context, *GetUserByPhoneNumberRequest) (*User, error)
+	// UpdateUser replaces the phone number and balance of a user. The version
+	// of the user has to be the one the update is based on; when the user
+	// changed since, the call fails with ABORTED.
+	UpdateUser(context.Context, *UpdateUserRequest) (*User, error)
+	GetUserBalance(context.Context, *GetUserBalanceRequest) (*GetUserBalanceResponse, error)
+	// ListChargeCodeUsers lists the users who redeemed a charge code.
+	ListChargeCodeUsers(context.Context, *ListChargeCodeUsersRequest) (*ListUsersResponse, error)
+	mustEmbedUnimplementedUserServiceServer()
+}
+
+// UnimplementedUserServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUserServiceServer struct{}
+
+func (UnimplementedUserServiceServer) GetUserByPhoneNumber(context.Context, *GetUserByPhoneNumberRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserByPhoneNumber not implemented")
+}
+func (UnimplementedUserServiceServer) UpdateUser(context.Context, *UpdateUserRequest) (*User, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateUser not implemented")
+}
+func (UnimplementedUserServiceServer) GetUserBalance(context.Context, *GetUserBalanceRequest) (*GetUserBalanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserBalance not implemented")
+}
+func (UnimplementedUserServiceServer) ListChargeCodeUsers(context.Context, *ListChargeCodeUsersRequest) (*ListUsersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChargeCodeUsers not implemented")
+}
+func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
+func (UnimplementedUserServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeUserServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UserServiceServer will
+// result in compilation errors.
+type UnsafeUserServiceServer interface {
+	mustEmbedUnimplementedUserServiceServer()
+}
+
+func RegisterUserServiceServer(s grpc.ServiceRegistrar, srv UserServiceServer) {
+	// If the following call pancis, it indicates UnimplementedUserServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UserService_ServiceDesc, srv)
+}
+
+func _UserService_GetUserByPhoneNumber_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserByPhoneNumberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).GetUserByPhoneNumber(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_GetUserByPhoneNumber_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).GetUserByPhoneNumber(ctx, req.(*GetUserByPhoneNumberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UpdateUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).UpdateUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_UpdateUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).UpdateUser(ctx, req.(*UpdateUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_GetUserBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).GetUserBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_GetUserBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).GetUserBalance(ctx, req.(*GetUserBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ListChargeCodeUsers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChargeCodeUsersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ListChargeCodeUsers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ListChargeCodeUsers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ListChargeCodeUsers(ctx, req.(*ListChargeCodeUsersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UserService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wallet.v1.UserService",
+	HandlerType: (*UserServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUserByPhoneNumber",
+			Handler:    _UserService_GetUserByPhoneNumber_Handler,
+		},
+		{
+			MethodName: "UpdateUser",
+			Handler:    _UserService_UpdateUser_Handler,
+		},
+		{
+			MethodName: "GetUserBalance",
+			Handler:    _UserService_GetUserBalance_Handler,
+		},
+		{
+			MethodName: "ListChargeCodeUsers",
+			Handler:    _UserService_ListChargeCodeUsers_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wallet.proto",
+}
+
+const (
+	ChargeCodeService_ListChargeCodes_FullMethodName     = "/wallet.v1.ChargeCodeService/ListChargeCodes"
+	ChargeCodeService_GetChargeCode_FullMethodName       = "/wallet.v1.ChargeCodeService/GetChargeCode"
+	ChargeCodeService_GetChargeCodeByCode_FullMethodName = "/wallet.v1.ChargeCodeService/GetChargeCodeByCode"
+	ChargeCodeService_CreateChargeCode_FullMethodName    = "/wallet.v1.ChargeCodeService/CreateChargeCode"
+	ChargeCodeService_UpdateChargeCode_FullMethodName    = "/wallet.v1.ChargeCodeService/UpdateChargeCode"
+	ChargeCodeService_DeleteChargeCode_FullMethodName    = "/wallet.v1.ChargeCodeService/DeleteChargeCode"
+	ChargeCodeService_PauseChargeCode_FullMethodName     = "/wallet.v1.ChargeCodeService/PauseChargeCode"
+	ChargeCodeService_RestoreChargeCode_FullMethodName   = "/wallet.v1.ChargeCodeService/RestoreChargeCode"
+	ChargeCodeService_ListUserChargeCodes_FullMethodName = "/wallet.v1.ChargeCodeService/ListUserChargeCodes"
+)
+
+// ChargeCodeServiceClient is the client API for ChargeCodeService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChargeCodeServiceClient interface {
+	ListChargeCodes(ctx context.Context, in *ListChargeCodesRequest, opts ...grpc.CallOption) (*ListChargeCodesResponse, error)
+	GetChargeCode(ctx context.Context, in *GetChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	GetChargeCodeByCode(ctx context.Context, in *GetChargeCodeByCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	CreateChargeCode(ctx context.Context, in *CreateChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	// UpdateChargeCode replaces a charge code. Like UpdateUser, it fails with
+	// ABORTED when the version is not the current one.
+	UpdateChargeCode(ctx context.Context, in *UpdateChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	// DeleteChargeCode archives a charge code. It is kept with its
+	// redemptions and can be restored.
+	DeleteChargeCode(ctx context.Context, in *DeleteChargeCodeRequest, opts ...grpc.CallOption) (*DeleteChargeCodeResponse, error)
+	// PauseChargeCode stops redemptions of an active charge code.
+	PauseChargeCode(ctx context.Context, in *PauseChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	// RestoreChargeCode makes a paused or archived charge code active again.
+	RestoreChargeCode(ctx context.Context, in *RestoreChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error)
+	// ListUserChargeCodes lists the charge codes a user redeemed.
+	ListUserChargeCodes(ctx context.Context, in *ListUserChargeCodesRequest, opts ...grpc.CallOption) (*ListChargeCodesResponse, error)
+}
+
+type chargeCodeServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChargeCodeServiceClient(cc grpc.ClientConnInterface) ChargeCodeServiceClient {
+	return &chargeCodeServiceClient{cc}
+}
+
+func (c *chargeCodeServiceClient) ListChargeCodes(ctx context.Context, in *ListChargeCodesRequest, opts ...grpc.CallOption) (*ListChargeCodesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListChargeCodesResponse)
+	err := c.cc.Invoke(ctx, ChargeCodeService_ListChargeCodes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) GetChargeCode(ctx context.Context, in *GetChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_GetChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) GetChargeCodeByCode(ctx context.Context, in *GetChargeCodeByCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_GetChargeCodeByCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) CreateChargeCode(ctx context.Context, in *CreateChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_CreateChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) UpdateChargeCode(ctx context.Context, in *UpdateChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_UpdateChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) DeleteChargeCode(ctx context.Context, in *DeleteChargeCodeRequest, opts ...grpc.CallOption) (*DeleteChargeCodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteChargeCodeResponse)
+	err := c.cc.Invoke(ctx, ChargeCodeService_DeleteChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) PauseChargeCode(ctx context.Context, in *PauseChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_PauseChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) RestoreChargeCode(ctx context.Context, in *RestoreChargeCodeRequest, opts ...grpc.CallOption) (*ChargeCode, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChargeCode)
+	err := c.cc.Invoke(ctx, ChargeCodeService_RestoreChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chargeCodeServiceClient) ListUserChargeCodes(ctx context.Context, in *ListUserChargeCodesRequest, opts ...grpc.CallOption) (*ListChargeCodesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListChargeCodesResponse)
+	err := c.cc.Invoke(ctx, ChargeCodeService_ListUserChargeCodes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChargeCodeServiceServer is the server API for ChargeCodeService service.
+// All implementations must embed UnimplementedChargeCodeServiceServer
+// for forward compatibility.
+type ChargeCodeServiceServer interface {
+	ListChargeCodes(context.Context, *ListChargeCodesRequest) (*ListChargeCodesResponse, error)
+	GetChargeCode(context.Context, *GetChargeCodeRequest) (*ChargeCode, error)
+	GetChargeCodeByCode(context.Context, *GetChargeCodeByCodeRequest) (*ChargeCode, error)
+	CreateChargeCode(context.Context, *CreateChargeCodeRequest) (*ChargeCode, error)
+	// UpdateChargeCode replaces a charge code. Like UpdateUser, it fails with
+	// ABORTED when the version is not the current one.
+	UpdateChargeCode(context.Context, *UpdateChargeCodeRequest) (*ChargeCode, error)
+	// DeleteChargeCode archives a charge code. It is kept with its
+	// redemptions and can be restored.
+	DeleteChargeCode(context.Context, *DeleteChargeCodeRequest) (*DeleteChargeCodeResponse, error)
+	// PauseChargeCode stops redemptions of an active charge code.
+	PauseChargeCode(context.Context, *PauseChargeCodeRequest) (*ChargeCode, error)
+	// RestoreChargeCode makes a paused or archived charge code active again.
+	RestoreChargeCode(context.Context, *RestoreChargeCodeRequest) (*ChargeCode, error)
+	// ListUserChargeCodes lists the charge codes a user redeemed.
+	ListUserChargeCodes(context.Context, *ListUserChargeCodesRequest) (*ListChargeCodesResponse, error)
+	mustEmbedUnimplementedChargeCodeServiceServer()
+}
+
+// UnimplementedChargeCodeServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChargeCodeServiceServer struct{}
+
+func (UnimplementedChargeCodeServiceServer) ListChargeCodes(context.Context, *ListChargeCodesRequest) (*ListChargeCodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChargeCodes not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) GetChargeCode(context.Context, *GetChargeCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) GetChargeCodeByCode(context.Context, *GetChargeCodeByCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChargeCodeByCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) CreateChargeCode(context.Context, *CreateChargeCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) UpdateChargeCode(context.Context, *UpdateChargeCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) DeleteChargeCode(context.Context, *DeleteChargeCodeRequest) (*DeleteChargeCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) PauseChargeCode(context.Context, *PauseChargeCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PauseChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) RestoreChargeCode(context.Context, *RestoreChargeCodeRequest) (*ChargeCode, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreChargeCode not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) ListUserChargeCodes(context.Context, *ListUserChargeCodesRequest) (*ListChargeCodesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUserChargeCodes not implemented")
+}
+func (UnimplementedChargeCodeServiceServer) mustEmbedUnimplementedChargeCodeServiceServer() {}
+func (UnimplementedChargeCodeServiceServer) testEmbeddedByValue()                           {}
+
+// UnsafeChargeCodeServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChargeCodeServiceServer will
+// result in compilation errors.
+type UnsafeChargeCodeServiceServer interface {
+	mustEmbedUnimplementedChargeCodeServiceServer()
+}
+
+func RegisterChargeCodeServiceServer(s grpc.ServiceRegistrar, srv ChargeCodeServiceServer) {
+	// If the following call pancis, it indicates UnimplementedChargeCodeServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChargeCodeService_ServiceDesc, srv)
+}
+
+func _ChargeCodeService_ListChargeCodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChargeCodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).ListChargeCodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_ListChargeCodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).ListChargeCodes(ctx, req.(*ListChargeCodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_GetChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).GetChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_GetChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).GetChargeCode(ctx, req.(*GetChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_GetChargeCodeByCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChargeCodeByCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).GetChargeCodeByCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_GetChargeCodeByCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).GetChargeCodeByCode(ctx, req.(*GetChargeCodeByCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_CreateChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).CreateChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_CreateChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).CreateChargeCode(ctx, req.(*CreateChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_UpdateChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).UpdateChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_UpdateChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).UpdateChargeCode(ctx, req.(*UpdateChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_DeleteChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).DeleteChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_DeleteChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).DeleteChargeCode(ctx, req.(*DeleteChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_PauseChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).PauseChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_PauseChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).PauseChargeCode(ctx, req.(*PauseChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_RestoreChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).RestoreChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_RestoreChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).RestoreChargeCode(ctx, req.(*RestoreChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChargeCodeService_ListUserChargeCodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUserChargeCodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChargeCodeServiceServer).ListUserChargeCodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChargeCodeService_ListUserChargeCodes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChargeCodeServiceServer).ListUserChargeCodes(ctx, req.(*ListUserChargeCodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ChargeCodeService_ServiceDesc is the grpc.ServiceDesc for ChargeCodeService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChargeCodeService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wallet.v1.ChargeCodeService",
+	HandlerType: (*ChargeCodeServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListChargeCodes",
+			Handler:    _ChargeCodeService_ListChargeCodes_Handler,
+		},
+		{
+			MethodName: "GetChargeCode",
+			Handler:    _ChargeCodeService_GetChargeCode_Handler,
+		},
+		{
+			MethodName: "GetChargeCodeByCode",
+			Handler:    _ChargeCodeService_GetChargeCodeByCode_Handler,
+		},
+		{
+			MethodName: "CreateChargeCode",
+			Handler:    _ChargeCodeService_CreateChargeCode_Handler,
+		},
+		{
+			MethodName: "UpdateChargeCode",
+			Handler:    _ChargeCodeService_UpdateChargeCode_Handler,
+		},
+		{
+			MethodName: "DeleteChargeCode",
+			Handler:    _ChargeCodeService_DeleteChargeCode_Handler,
+		},
+		{
+			MethodName: "PauseChargeCode",
+			Handler:    _ChargeCodeService_PauseChargeCode_Handler,
+		},
+		{
+			MethodName: "RestoreChargeCode",
+			Handler:    _ChargeCodeService_RestoreChargeCode_Handler,
+		},
+		{
+			MethodName: "ListUserChargeCodes",
+			Handler:    _ChargeCodeService_ListUserChargeCodes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wallet.proto",
+}
+
+const (
+	TransactionService_CreateTransaction_FullMethodName     = "/wallet.v1.TransactionService/CreateTransaction"
+	TransactionService_RedeemChargeCode_FullMethodName      = "/wallet.v1.TransactionService/RedeemChargeCode"
+	TransactionService_ListTransactions_FullMethodName      = "/wallet.v1.TransactionService/ListTransactions"
+	TransactionService_GetTransaction_FullMethodName        = "/wallet.v1.TransactionService/GetTransaction"
+	TransactionService_ListUserTransactions_FullMethodName  = "/wallet.v1.TransactionService/ListUserTransactions"
+	TransactionService_CountUserTransactions_FullMethodName = "/wallet.v1.TransactionService/CountUserTransactions"
+)
+
+// TransactionServiceClient is the client API for TransactionService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TransactionServiceClient interface {
+	// CreateTransaction credits a positive amount to a user or debits a
+	// negative one, subject to the per-user limits and fraud rules.
+	CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error)
+	// RedeemChargeCode credits the amount of a charge code to a user, creating
+	// the user if needed.
+	RedeemChargeCode(ctx context.Context, in *RedeemChargeCodeRequest, opts ...grpc.CallOption) (*RedeemChargeCodeResponse, error)
+	ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error)
+	GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*Transaction, error)
+	ListUserTransactions(ctx context.Context, in *ListUserTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error)
+	CountUserTransactions(ctx context.Context, in *CountUserTransactionsRequest, opts ...grpc.CallOption) (*CountUserTransactionsResponse, error)
+}
+
+type transactionServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTransactionServiceClient(cc grpc.ClientConnInterface) TransactionServiceClient {
+	return &transactionServiceClient{cc}
+}
+
+func (c *transactionServiceClient) CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*Transaction, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, TransactionService_CreateTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) RedeemChargeCode(ctx context.Context, in *RedeemChargeCodeRequest, opts ...grpc.CallOption) (*RedeemChargeCodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RedeemChargeCodeResponse)
+	err := c.cc.Invoke(ctx, TransactionService_RedeemChargeCode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) ListTransactions(ctx context.Context, in *ListTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTransactionsResponse)
+	err := c.cc.Invoke(ctx, TransactionService_ListTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) GetTransaction(ctx context.Context, in *GetTransactionRequest, opts ...grpc.CallOption) (*Transaction, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Transaction)
+	err := c.cc.Invoke(ctx, TransactionService_GetTransaction_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) ListUserTransactions(ctx context.Context, in *ListUserTransactionsRequest, opts ...grpc.CallOption) (*ListTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListTransactionsResponse)
+	err := c.cc.Invoke(ctx, TransactionService_ListUserTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *transactionServiceClient) CountUserTransactions(ctx context.Context, in *CountUserTransactionsRequest, opts ...grpc.CallOption) (*CountUserTransactionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountUserTransactionsResponse)
+	err := c.cc.Invoke(ctx, TransactionService_CountUserTransactions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TransactionServiceServer is the server API for TransactionService service.
+// All implementations must embed UnimplementedTransactionServiceServer
+// for forward compatibility.
+type TransactionServiceServer interface {
+	// CreateTransaction credits a positive amount to a user or debits a
+	// negative one, subject to the per-user limits and fraud rules.
+	CreateTransaction(context.Context, *CreateTransactionRequest) (*Transaction, error)
+	// RedeemChargeCode credits the amount of a charge code to a user, creating
+	// the user if needed.
+	RedeemChargeCode(context.Context, *RedeemChargeCodeRequest) (*RedeemChargeCodeResponse, error)
+	ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error)
+	GetTransaction(context.Context, *GetTransactionRequest) (*Transaction, error)
+	ListUserTransactions(context.Context, *ListUserTransactionsRequest) (*ListTransactionsResponse, error)
+	CountUserTransactions(context.Context, *CountUserTransactionsRequest) (*CountUserTransactionsResponse, error)
+	mustEmbedUnimplementedTransactionServiceServer()
+}
+
+// UnimplementedTransactionServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTransactionServiceServer struct{}
+
+func (UnimplementedTransactionServiceServer) CreateTransaction(context.Context, *CreateTransactionRequest) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTransaction not implemented")
+}
+func (UnimplementedTransactionServiceServer) RedeemChargeCode(context.Context, *RedeemChargeCodeRequest) (*RedeemChargeCodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RedeemChargeCode not implemented")
+}
+func (UnimplementedTransactionServiceServer) ListTransactions(context.Context, *ListTransactionsRequest) (*ListTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTransactions not implemented")
+}
+func (UnimplementedTransactionServiceServer) GetTransaction(context.Context, *GetTransactionRequest) (*Transaction, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTransaction not implemented")
+}
+func (UnimplementedTransactionServiceServer) ListUserTransactions(context.Context, *ListUserTransactionsRequest) (*ListTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUserTransactions not implemented")
+}
+func (UnimplementedTransactionServiceServer) CountUserTransactions(context.Context, *CountUserTransactionsRequest) (*CountUserTransactionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountUserTransactions not implemented")
+}
+func (UnimplementedTransactionServiceServer) mustEmbedUnimplementedTransactionServiceServer() {}
+func (UnimplementedTransactionServiceServer) testEmbeddedByValue()                            {}
+
+// UnsafeTransactionServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TransactionServiceServer will
+// result in compilation errors.
+type UnsafeTransactionServiceServer interface {
+	mustEmbedUnimplementedTransactionServiceServer()
+}
+
+func RegisterTransactionServiceServer(s grpc.ServiceRegistrar, srv TransactionServiceServer) {
+	// If the following call pancis, it indicates UnimplementedTransactionServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TransactionService_ServiceDesc, srv)
+}
+
+func _TransactionService_CreateTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).CreateTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_CreateTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).CreateTransaction(ctx, req.(*CreateTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_RedeemChargeCode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RedeemChargeCodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).RedeemChargeCode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_RedeemChargeCode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).RedeemChargeCode(ctx, req.(*RedeemChargeCodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_ListTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).ListTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_ListTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).ListTransactions(ctx, req.(*ListTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_GetTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTransactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).GetTransaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_GetTransaction_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).GetTransaction(ctx, req.(*GetTransactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_ListUserTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListUserTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).ListUserTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_ListUserTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).ListUserTransactions(ctx, req.(*ListUserTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TransactionService_CountUserTransactions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountUserTransactionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TransactionServiceServer).CountUserTransactions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TransactionService_CountUserTransactions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TransactionServiceServer).CountUserTransactions(ctx, req.(*CountUserTransactionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TransactionService_ServiceDesc is the grpc.ServiceDesc for TransactionService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TransactionService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wallet.v1.TransactionService",
+	HandlerType: (*TransactionServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTransaction",
+			Handler:    _TransactionService_CreateTransaction_Handler,
+		},
+		{
+			MethodName: "RedeemChargeCode",
+			Handler:    _TransactionService_RedeemChargeCode_Handler,
+		},
+		{
+			MethodName: "ListTransactions",
+			Handler:    _TransactionService_ListTransactions_Handler,
+		},
+		{
+			MethodName: "GetTransaction",
+			Handler:    _TransactionService_GetTransaction_Handler,
+		},
+		{
+			MethodName: "ListUserTransactions",
+			Handler:    _TransactionService_ListUserTransactions_Handler,
+		},
+		{
+			MethodName: "CountUserTransactions",
+			Handler:    _TransactionService_CountUserTransactions_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "wallet.proto",
+}
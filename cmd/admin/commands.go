@@ -0,0 +1,340 @@
+package main
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var pageFlags = []cli.Flag{
+	&cli.IntFlag{Name: "page", Value: 1, Usage: "page number, starting from 1"},
+	&cli.IntFlag{Name: "page-size", Value: 10, Usage: "number of items per page"},
+}
+
+func chargeCodeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "charge-code",
+		Usage: "create, list, disable, pause, archive and restore charge codes",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "create",
+				Usage: "create a charge code",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "code", Required: true},
+					&cli.Float64Flag{Name: "amount", Required: true},
+					&cli.IntFlag{Name: "max-uses", Required: true},
+				},
+				Action: withServices(func(c *cli.Context, s *services) error {
+					created, err := s.chargeCodes.CreateChargeCode(c.Context, &usecase.ChargeCode{
+						Code:    c.String("code"),
+						Amount:  c.Float64("amount"),
+						MaxUses: c.Int("max-uses"),
+					}, actor(c))
+					if err != nil {
+						return err
+					}
+					return printChargeCodes(c, created, []*usecase.ChargeCode{created})
+				}),
+			},
+			{
+				Name:  "list",
+				Usage: "list charge codes",
+				Flags: append([]cli.Flag{
+					&cli.StringSliceFlag{Name: "status", Usage: "only charge codes with this status: active, paused or archived (default active and paused)"},
+				}, pageFlags...),
+				Action: withServices(func(c *cli.Context, s *services) error {
+					chargeCodes, err := s.chargeCodes.GetChargeCodes(c.Context, c.StringSlice("status"), c.Int("page"), c.Int("page-size"))
+					if err != nil {
+						return err
+					}
+					return printChargeCodes(c, chargeCodes, chargeCodes)
+				}),
+			},
+			// Disabling pauses, which keeps max_uses and can be undone
+			chargeCodeStatusCommand("disable", "stop redemptions of a charge code, the same as pause", (*usecase.ChargeCodeUseCase).PauseChargeCode),
+			chargeCodeStatusCommand("pause", "stop redemptions of a charge code until it is restored", (*usecase.ChargeCodeUseCase).PauseChargeCode),
+			chargeCodeStatusCommand("archive", "retire a charge code, keeping its redemptions", (*usecase.ChargeCodeUseCase).ArchiveChargeCode),
+			chargeCodeStatusCommand("restore", "make a paused or archived charge code active again", (*usecase.ChargeCodeUseCase).RestoreChargeCode),
+		},
+	}
+}
+
+// chargeCodeStatusCommand makes a command that changes the status of the
+// charge code given by --id with change.
+func chargeCodeStatusCommand(name string, usage string, change func(uc *usecase.ChargeCodeUseCase, ctx context.Context, id int, actor *usecase.Actor) (*usecase.ChargeCode, error)) *cli.Command {
+	return &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: []cli.Flag{&cli.IntFlag{Name: "id", Required: true, Usage: "charge code ID"}},
+		Action: withServices(func(c *cli.Context, s *services) error {
+			chargeCode, err := change(s.chargeCodes, c.Context, c.Int("id"), actor(c))
+			if err != nil {
+				return err
+			}
+			return printChargeCodes(c, chargeCode, []*usecase.ChargeCode{chargeCode})
+		}),
+	}
+}
+
+func printChargeCodes(c *cli.Context, value interface{}, chargeCodes []*usecase.ChargeCode) error {
+	rows := make([][]string, 0, len(chargeCodes))
+	for _, chargeCode := range chargeCodes {
+		rows = append(rows, []string{strconv.Itoa(chargeCode.ChargeCodeID), chargeCode.Code, formatAmount(chargeCode.Amount),
+			strconv.Itoa(chargeCode.CurrentUses), strconv.Itoa(chargeCode.MaxUses), chargeCode.Status})
+	}
+	return newPrinter(c).print(value, []string{"ID", "CODE", "AMOUNT", "USES", "MAX USES", "STATUS"}, rows)
+}
+
+func userCommand() *cli.Command {
+	phoneFlag := &cli.StringFlag{Name: "phone", Required: true, Usage: "phone number of the user"}
+	return &cli.Command{
+		Name:  "user",
+		Usage: "look up users and adjust their balance",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "balance",
+				Usage: "show the balance of a user",
+				Flags: []cli.Flag{phoneFlag},
+				Action: withServices(func(c *cli.Context, s *services) error {
+					user, err := s.users.GetUserByPhoneNumber(c.Context, c.String("phone"))
+					if err != nil {
+						return err
+					}
+					return newPrinter(c).print(user, []string{"ID", "PHONE NUMBER", "BALANCE"},
+						[][]string{{strconv.Itoa(user.ID), user.PhoneNumber, formatAmount(user.Balance)}})
+				}),
+			},
+			{
+				Name:  "history",
+				Usage: "list the transactions of a user",
+				Flags: append([]cli.Flag{phoneFlag}, pageFlags...),
+				Action: withServices(func(c *cli.Context, s *services) error {
+					user, err := s.users.GetUserByPhoneNumber(c.Context, c.String("phone"))
+					if err != nil {
+						return err
+					}
+					transactions, err := s.transactions.GetUserTransactionsByUserID(c.Context, user.ID, c.Int("page"), c.Int("page-size"))
+					if err != nil {
+						return err
+					}
+					headers, rows := transactionRows(transactions)
+					return newPrinter(c).print(transactions, headers, rows)
+				}),
+			},
+			{
+				Name:  "adjust",
+				Usage: "post a manual adjustment to the balance of a user",
+				Description: "The adjustment is a transaction that skips the per-user limits and fraud rules. " +
+					"Use a negative amount to debit. The reason is kept in the audit log.",
+				Flags: []cli.Flag{
+					phoneFlag,
+					&cli.Float64Flag{Name: "amount", Required: true},
+					&cli.StringFlag{Name: "reason", Required: true},
+				},
+				Action: withServices(func(c *cli.Context, s *services) error {
+					adjustment, err := s.transactions.AdjustBalance(c.Context, &usecase.BalanceAdjustment{
+						PhoneNumber: c.String("phone"),
+						Amount:      c.Float64("amount"),
+						Reason:      c.String("reason"),
+					}, actor(c))
+					if err != nil {
+						return err
+					}
+					headers, rows := transactionRows([]*usecase.Transaction{adjustment.Transaction})
+					return newPrinter(c).print(adjustment, headers, rows)
+				}),
+			},
+		},
+	}
+}
+
+func transactionRows(transactions []*usecase.Transaction) ([]string, [][]string) {
+	rows := make([][]string, 0, len(transactions))
+	for _, transaction := range transactions {
+		rows = append(rows, []string{strconv.Itoa(transaction.TransactionID), transaction.PhoneNumber,
+			formatAmount(transaction.Amount), formatTime(transaction.Timestamp)})
+	}
+	return []string{"ID", "PHONE NUMBER", "AMOUNT", "TIMESTAMP"}, rows
+}
+
+func reconcileCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "reconcile",
+		Usage: "compare balances and charge code uses with their history",
+		Description: "A run only reports discrepancies. Pass --repair to repair them right after, " +
+			"or repair an earlier run with --run.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{Name: "repair", Usage: "repair the discrepancies that were found"},
+			&cli.IntFlag{Name: "run", Usage: "repair this earlier run instead of starting a new one"},
+		},
+		Action: withServices(func(c *cli.Context, s *services) error {
+			var (
+				run *usecase.ReconciliationRun
+				err error
+			)
+			if runID := c.Int("run"); runID != 0 {
+				run, err = s.reconciliation.Repair(c.Context, runID, actor(c))
+			} else {
+				run, err = s.reconciliation.Reconcile(c.Context, usecase.ReconciliationTriggerManual)
+				if err == nil && c.Bool("repair") {
+					run, err = s.reconciliation.Repair(c.Context, run.RunID, actor(c))
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			discrepancies, err := allPages(c.Context, s, func(ctx context.Context, page int, pageSize int) ([]*usecase.ReconciliationDiscrepancy, error) {
+				return s.reconciliation.GetDiscrepancies(ctx, run.RunID, page, pageSize)
+			})
+			if err != nil {
+				return err
+			}
+
+			p := newPrinter(c)
+			if p.format == "json" {
+				return writeJSON(p.w, map[string]interface{}{"run": run, "discrepancies": discrepancies})
+			}
+			fmt.Fprintf(p.w, "run %d %s: %d balance and %d charge code discrepancies, %d repaired\n\n",
+				run.RunID, run.Status, run.BalanceDiscrepancies, run.ChargeCodeDiscrepancies, run.Repaired)
+			headers, rows := discrepancyRows(discrepancies)
+			return p.print(discrepancies, headers, rows)
+		}),
+	}
+}
+
+func discrepancyRows(discrepancies []*usecase.ReconciliationDiscrepancy) ([]string, [][]string) {
+	rows := make([][]string, 0, len(discrepancies))
+	for _, discrepancy := range discrepancies {
+		rows = append(rows, []string{strconv.Itoa(discrepancy.DiscrepancyID), discrepancy.Kind, strconv.Itoa(discrepancy.EntityID),
+			formatAmount(discrepancy.Recorded), formatAmount(discrepancy.Expected), discrepancy.Status, discrepancy.Note})
+	}
+	return []string{"ID", "KIND", "ENTITY ID", "RECORDED", "EXPECTED", "STATUS", "NOTE"}, rows
+}
+
+func exportCommand() *cli.Command {
+	flags := []cli.Flag{
+		&cli.StringFlag{Name: "format", Value: "csv", Usage: "csv or json"},
+		&cli.StringFlag{Name: "file", Usage: "file to write, standard output by default"},
+	}
+	return &cli.Command{
+		Name:  "export",
+		Usage: "export reports as CSV or JSON",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "transactions",
+				Usage: "export every transaction",
+				Flags: flags,
+				Action: withServices(func(c *cli.Context, s *services) error {
+					transactions, err := allPages(c.Context, s, s.transactions.GetTransactions)
+					if err != nil {
+						return err
+					}
+					headers, rows := transactionRows(transactions)
+					return export(c, transactions, headers, rows)
+				}),
+			},
+			{
+				Name:  "audit",
+				Usage: "export the audit log",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{Name: "action", Usage: "only entries with this action"},
+					&cli.TimestampFlag{Name: "from", Layout: time.RFC3339, Usage: "only entries from this time"},
+					&cli.TimestampFlag{Name: "to", Layout: time.RFC3339, Usage: "only entries before this time"},
+				}, flags...),
+				Action: withServices(func(c *cli.Context, s *services) error {
+					filter := &usecase.AuditLogFilter{Action: c.String("action")}
+					if from := c.Timestamp("from"); from != nil {
+						filter.From = *from
+					}
+					if to := c.Timestamp("to"); to != nil {
+						filter.To = *to
+					}
+					auditLogs, err := allPages(c.Context, s, func(ctx context.Context, page int, pageSize int) ([]*usecase.AuditLog, error) {
+						return s.audit.GetAuditLogs(ctx, filter, page, pageSize)
+					})
+					if err != nil {
+						return err
+					}
+
+					rows := make([][]string, 0, len(auditLogs))
+					for _, auditLog := range auditLogs {
+						rows = append(rows, []string{strconv.Itoa(auditLog.AuditID), formatTime(auditLog.CreatedAt), auditLog.Actor, strconv.FormatBool(auditLog.ActorVerified), auditLog.Action,
+							auditLog.EntityType, strconv.Itoa(auditLog.EntityID), string(auditLog.Before), string(auditLog.After), auditLog.RequestID, auditLog.ClientIP})
+					}
+					return export(c, auditLogs, []string{"ID", "CREATED AT", "ACTOR", "ACTOR VERIFIED", "ACTION", "ENTITY TYPE", "ENTITY ID", "BEFORE", "AFTER", "REQUEST ID", "CLIENT IP"}, rows)
+				}),
+			},
+			{
+				Name:  "reconciliation",
+				Usage: "export the discrepancies of a reconciliation run",
+				Flags: append([]cli.Flag{&cli.IntFlag{Name: "run", Required: true, Usage: "reconciliation run ID"}}, flags...),
+				Action: withServices(func(c *cli.Context, s *services) error {
+					discrepancies, err := allPages(c.Context, s, func(ctx context.Context, page int, pageSize int) ([]*usecase.ReconciliationDiscrepancy, error) {
+						return s.reconciliation.GetDiscrepancies(ctx, c.Int("run"), page, pageSize)
+					})
+					if err != nil {
+						return err
+					}
+					headers, rows := discrepancyRows(discrepancies)
+					return export(c, discrepancies, headers, rows)
+				}),
+			},
+		},
+	}
+}
+
+// allPages reads every page of a list at the largest page size allowed. The
+// list repositories report an empty page as not found, which ends the list.
+func allPages[T any](ctx context.Context, s *services, get func(ctx context.Context, page int, pageSize int) ([]T, error)) ([]T, error) {
+	pageSize := s.config.Limits().MaxPageSize
+	items := []T{}
+	for page := 1; ; page++ {
+		pageItems, err := get(ctx, page, pageSize)
+		if errors.Is(err, usecase.ErrNotFound) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, pageItems...)
+		if len(pageItems) < pageSize {
+			return items, nil
+		}
+	}
+}
+
+// export writes value as JSON or headers and rows as CSV, following the
+// --format flag, to the --file file or standard output.
+func export(c *cli.Context, value interface{}, headers []string, rows [][]string) (err error) {
+	format := c.String("format")
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("--format most be csv or json, not %q", format)
+	}
+
+	var w io.Writer = c.App.Writer
+	if path := c.String("file"); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+		w = file
+	}
+
+	if format == "json" {
+		return writeJSON(w, value)
+	}
+	return writeCSV(w, headers, rows)
+}
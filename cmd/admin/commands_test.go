@@ -0,0 +1,63 @@
+package main
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// listOf pages through items like the list repositories do, reporting an
+// empty page as not found.
+func listOf(items []int, calls *int) func(ctx context.Context, page int, pageSize int) ([]int, error) {
+	return func(ctx context.Context, page int, pageSize int) ([]int, error) {
+		*calls++
+		start := (page - 1) * pageSize
+		if start >= len(items) {
+			return nil, usecase.NotFoundError("transaction not found")
+		}
+		return items[start:min(start+pageSize, len(items))], nil
+	}
+}
+
+func TestAllPages(t *testing.T) {
+	appConfig := &config.AppConfig{}
+	appConfig.SetLimits(&config.Limits{MaxPage: 2, MaxPageSize: 3})
+	s := &services{config: appConfig}
+
+	tests := []struct {
+		name      string
+		items     []int
+		wantCalls int
+	}{
+		{"no items", []int{}, 1},
+		{"a partial page", []int{1, 2}, 1},
+		{"an exact multiple of the page size", []int{1, 2, 3, 4, 5, 6}, 3},
+		{"more than MAX_PAGE pages", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			items, err := allPages(context.Background(), s, listOf(test.items, &calls))
+			if err != nil {
+				t.Fatalf("allPages: %v", err)
+			}
+			if !reflect.DeepEqual(items, test.items) {
+				t.Errorf("allPages = %v, want %v", items, test.items)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("%d pages read, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+
+	failure := usecase.InternalError("database query error", errors.New("connection reset"))
+	_, err := allPages(context.Background(), s, func(ctx context.Context, page int, pageSize int) ([]int, error) {
+		return nil, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Errorf("allPages of a failing list: err = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,167 @@
+// Command admin operates the service directly on its database, without the
+// HTTP API, for incident work and maintenance.
+package main
+
+import (
+	"chargeCode/internal/cache"
+	"chargeCode/internal/config"
+	"chargeCode/internal/database"
+	"chargeCode/internal/logging"
+	"chargeCode/internal/repository"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli/v2"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := newApp().RunContext(ctx, os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+func newApp() *cli.App {
+	return &cli.App{
+		Name:  "admin",
+		Usage: "operate the charge code service directly on its database",
+		Description: "admin reads the same .env file, CONFIG_FILE and environment variables as the server. " +
+			"Changes are written to the audit log with the --actor name.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Value: "table", Usage: "output format: table or json"},
+			&cli.StringFlag{Name: "actor", Value: defaultActor(), Usage: "name recorded in the audit log"},
+		},
+		Before: func(c *cli.Context) error {
+			if format := c.String("output"); format != "table" && format != "json" {
+				return fmt.Errorf("--output most be table or json, not %q", format)
+			}
+			return nil
+		},
+		Commands: []*cli.Command{
+			migrateCommand(),
+			chargeCodeCommand(),
+			userCommand(),
+			reconcileCommand(),
+			exportCommand(),
+		},
+	}
+}
+
+// defaultActor names the operator running the command.
+func defaultActor() string {
+	if current, err := user.Current(); err == nil {
+		return "admin:" + current.Username
+	}
+	return "admin"
+}
+
+// actor is verified when it is the operator's OS user, which the command runs
+// as, rather than a name given with --actor.
+func actor(c *cli.Context) *usecase.Actor {
+	return &usecase.Actor{Name: c.String("actor"), Verified: !c.IsSet("actor")}
+}
+
+// services are the usecases the commands run on.
+type services struct {
+	config         *config.AppConfig
+	users          *usecase.UserUseCase
+	chargeCodes    *usecase.ChargeCodeUseCase
+	transactions   *usecase.TransactionUseCase
+	audit          *usecase.AuditUseCase
+	reconciliation *usecase.ReconciliationUseCase
+	// cache is only set with the redis backend, whose entries the server
+	// shares; it is nil otherwise
+	cache *cache.Cache
+}
+
+// connect loads the configuration and opens the database, creating or
+// upgrading the schema like the server does. The caller closes the returned
+// database.
+func connect(ctx context.Context) (*services, *sql.DB, error) {
+	// Logs go to stderr so they do not mix with the output
+	slog.SetDefault(logging.New(os.Stderr, slog.LevelWarn))
+
+	if err := godotenv.Load(); err != nil {
+		slog.Debug("no .env file", "error", err)
+	}
+
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading app config file: %w", err)
+	}
+
+	// Exports read whole lists, which the API caps at MAX_PAGE pages
+	limits := *appConfig.Limits()
+	limits.MaxPage = math.MaxInt
+	appConfig.SetLimits(&limits)
+
+	db, err := database.NewDBConnection(ctx, appConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	// Changes made here drop the entries of a shared cache. An in-process
+	// cache of the server only expires.
+	var (
+		store    usecase.Transactor = repository.NewStore(db, appConfig)
+		appCache *cache.Cache
+	)
+	if appConfig.CacheBackend == "redis" {
+		appCache, err = cache.Open(appConfig, nil)
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("setting up cache: %w", err)
+		}
+		store = cache.NewTransactor(store, appCache)
+	}
+
+	return &services{
+		config:      appConfig,
+		users:       usecase.NewUserUseCase(repository.NewUserRepository(db, appConfig), store),
+		chargeCodes: usecase.NewChargeCodeUseCase(repository.NewChargeCodeRepository(db, appConfig), store),
+		// Only adjustments and lookups are made here, which use neither the
+		// redemption guard, the limits nor the fraud rules
+		transactions:   usecase.NewTransactionUseCase(repository.NewTransactionRepository(db, appConfig), store, nil, nil, nil, usecase.NopBusinessMetrics{}),
+		audit:          usecase.NewAuditUseCase(repository.NewAuditRepository(db, appConfig)),
+		reconciliation: usecase.NewReconciliationUseCase(repository.NewReconciliationRepository(db, appConfig), store, usecase.ReconciliationConfig{}),
+		cache:          appCache,
+	}, db, nil
+}
+
+// withServices connects for a command and closes the database afterwards.
+func withServices(action func(c *cli.Context, s *services) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		s, db, err := connect(c.Context)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		defer s.cache.Close()
+		return action(c, s)
+	}
+}
+
+func migrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: "create or upgrade the database schema",
+		Action: withServices(func(c *cli.Context, s *services) error {
+			// connect has already applied the schema
+			return newPrinter(c).print(map[string]int{"schema_version": database.SchemaVersion},
+				[]string{"SCHEMA VERSION"}, [][]string{{fmt.Sprint(database.SchemaVersion)}})
+		}),
+	}
+}
@@ -16,6 +16,110 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/api/v1/audit": {
+            "get": {
+                "description": "Get the audit log of mutating operations, newest first, with filters and pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Audit"
+                ],
+                "summary": "Get audit logs",
+                "operationId": "get-audit-logs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Actor name",
+                        "name": "actor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, e.g. user.update",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity type: user, charge_code or transaction",
+                        "name": "entityType",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Entity ID",
+                        "name": "entityId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Request ID",
+                        "name": "requestId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries at or after this RFC 3339 time",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only entries before this RFC 3339 time",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
         "/api/v1/chargeCode": {
             "get": {
                 "description": "Get charge codes with pagination.",
@@ -28,6 +132,12 @@ const docTemplate = `{
                 "summary": "Get chargeCodes",
                 "operationId": "get-paginated-chargeCodes",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Comma separated statuses: active, paused, archived. Defaults to active,paused",
+                        "name": "status",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
                         "description": "Page number most start from 1",
@@ -47,11 +157,35 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
                     }
                 }
             },
             "put": {
-                "description": "Update a chargeCode using the provided data.",
+                "description": "Update a chargeCode using the provided data. If-Match has to hold the ETag of the charge code as last read; when the charge code changed since, for example by a redemption, the update fails with 412 and the charge code has to be read again. As with PATCH, max_uses cannot go below current_uses, and current_uses is kept.",
                 "consumes": [
                     "application/json"
                 ],
@@ -63,6 +197,13 @@ const docTemplate = `{
                 ],
                 "summary": "Update a chargeCode",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag of the charge code being updated",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
                     {
                         "description": "ChargeCode object to update",
                         "name": "chargeCode",
@@ -78,6 +219,60 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the charge code"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
@@ -111,13 +306,37 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
                     }
                 }
             }
         },
         "/api/v1/chargeCode/code/{code}": {
             "get": {
-                "description": "Get a chargeCode by their unique Code.",
+                "description": "Get a chargeCode by their unique Code. The ETag header holds the version of the charge code, to send as If-Match when updating it.",
                 "produces": [
                     "application/json"
                 ],
@@ -133,6 +352,12 @@ const docTemplate = `{
                         "name": "code",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a version the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -140,6 +365,27 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the charge code"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "The charge code did not change"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
@@ -147,7 +393,7 @@ const docTemplate = `{
         },
         "/api/v1/chargeCode/user/{userId}": {
             "get": {
-                "description": "Get a user chargeCode by their unique userId with pagination support.",
+                "description": "Get the chargeCodes a user redeemed with pagination support, including archived ones unless filtered by status.",
                 "produces": [
                     "application/json"
                 ],
@@ -164,6 +410,12 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "type": "string",
+                        "description": "Comma separated statuses: active, paused, archived. Defaults to all",
+                        "name": "status",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
                         "description": "Page number most start from 1",
@@ -183,13 +435,37 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
                     }
                 }
             }
         },
         "/api/v1/chargeCode/{id}": {
             "get": {
-                "description": "Get a chargeCode by their unique ID.",
+                "description": "Get a chargeCode by their unique ID. The ETag header holds the version of the charge code, to send as If-Match when updating it.",
                 "produces": [
                     "application/json"
                 ],
@@ -205,6 +481,12 @@ const docTemplate = `{
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a version the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -212,19 +494,40 @@ const docTemplate = `{
                         "description": "OK",
                         "schema": {
                             "$ref": "#/definitions/delivery.ChargeCode"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the charge code"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "The charge code did not change"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             },
             "delete": {
-                "description": "Delete a chargeCode by their unique ID.",
+                "description": "Archive a chargeCode by their unique ID. The charge code and its redemptions are kept, but it can no longer be redeemed or changed and is only listed when asked for by status. Restore it to make it active again.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "ChargeCode"
                 ],
-                "summary": "Delete chargeCode by ID",
+                "summary": "Archive chargeCode by ID",
                 "operationId": "delete-chargeCode-by-id",
                 "parameters": [
                     {
@@ -241,64 +544,62 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
-                    }
-                }
-            }
-        },
-        "/api/v1/transaction": {
-            "get": {
-                "description": "Get transactions with pagination.",
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "Transaction"
-                ],
-                "summary": "Get transactions with pagination",
-                "operationId": "get-paginated-transactions",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Page number most start from 1",
-                        "name": "page",
-                        "in": "query"
                     },
-                    {
-                        "type": "integer",
-                        "description": "Number of items per page",
-                        "name": "pageSize",
-                        "in": "query"
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "OK",
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             },
-            "post": {
-                "description": "Create a new Transaction using the provided data.",
+            "patch": {
+                "description": "Change some fields of a chargeCode with a JSON merge patch (RFC 7396). Only code, max_uses and amount can be changed; max_uses cannot go below current_uses, which only redemptions change. Only the fields that differ are written. If-Match has to hold the ETag of the charge code as last read, as for PUT.",
                 "consumes": [
-                    "application/json"
+                    "application/merge-patch+json"
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "ChargeCode"
                 ],
-                "summary": "Create a new Transaction",
+                "summary": "Partially update a chargeCode",
+                "operationId": "patch-chargeCode-by-id",
                 "parameters": [
                     {
-                        "description": "Transaction object to create",
-                        "name": "Transaction",
+                        "type": "integer",
+                        "description": "chargeCode ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the charge code being updated",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "patch",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "$ref": "#/definitions/delivery.ChargeCodePatch"
                         }
                     }
                 ],
@@ -306,62 +607,142 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "$ref": "#/definitions/delivery.ChargeCode"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the charge code"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/transaction/charge": {
+        "/api/v1/chargeCode/{id}/pause": {
             "post": {
-                "description": "Create a new ChargeCodeTransaction using the provided data.",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Stop redemptions of an active chargeCode until it is restored.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "ChargeCode"
                 ],
-                "summary": "Create a new ChargeCodeTransaction",
+                "summary": "Pause a chargeCode",
+                "operationId": "pause-chargeCode-by-id",
                 "parameters": [
                     {
-                        "description": "ChargeCodeTransaction object to create",
-                        "name": "ChargeCodeTransaction",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/delivery.ChargeCodeTransaction"
-                        }
+                        "type": "integer",
+                        "description": "chargeCode ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.ChargeCodeTransaction"
+                            "$ref": "#/definitions/delivery.ChargeCode"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/transaction/user/totalNumber/{userId}": {
-            "get": {
-                "description": "Get Total a Transaction by their unique user ID.",
+        "/api/v1/chargeCode/{id}/restore": {
+            "post": {
+                "description": "Make a paused or archived chargeCode active again.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "ChargeCode"
                 ],
-                "summary": "Get Total Transaction by user ID",
-                "operationId": "get-total-transaction-by-user-id",
+                "summary": "Restore a chargeCode",
+                "operationId": "restore-chargeCode-by-id",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "user ID",
-                        "name": "userId",
+                        "description": "chargeCode ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -370,167 +751,307 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "$ref": "#/definitions/delivery.ChargeCode"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/transaction/user/{userId}": {
+        "/api/v1/events/stream": {
             "get": {
-                "description": "Get transactions for a user by their unique user ID with pagination.",
+                "description": "Stream transaction, redemption and user events as Server-Sent Events. Every event has its type as the SSE event name, the JSON event as data, and a sequence number as ID. A client that reconnects with the Last-Event-ID header, or the lastEventId parameter, first receives the buffered events it missed; when some are no longer buffered a ` + "`" + `reset` + "`" + ` event is sent first. A comment is sent every heartbeat interval. Clients that do not keep up are disconnected and can resume the same way.",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "Transaction"
+                    "Events"
                 ],
-                "summary": "Get Transactions by user ID",
-                "operationId": "get-transactions-by-user-id",
+                "summary": "Stream events",
+                "operationId": "stream-events",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "userId",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "Comma separated event types, e.g. transaction.created",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events of this user",
+                        "name": "phoneNumber",
+                        "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Page number most start from 1",
-                        "name": "page",
+                        "description": "Only events of this charge code",
+                        "name": "chargeCodeId",
                         "in": "query"
                     },
                     {
                         "type": "integer",
-                        "description": "Number of items per page",
-                        "name": "pageSize",
+                        "description": "Resume after this event ID",
+                        "name": "lastEventId",
                         "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resume after this event ID",
+                        "name": "Last-Event-ID",
+                        "in": "header"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "$ref": "#/definitions/usecase.Event"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/transaction/{id}": {
+        "/api/v1/fraud/decisions": {
             "get": {
-                "description": "Get a Transaction by their unique ID.",
+                "description": "Get the fraud decisions on transactions and redemptions, newest first, with filters and pagination. Decisions to review or deny start out pending review.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Transaction"
+                    "Fraud"
                 ],
-                "summary": "Get Transaction by ID",
-                "operationId": "get-transaction-by-id",
+                "summary": "Get fraud decisions",
+                "operationId": "get-fraud-decisions",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "allow, review or deny",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "none, pending, approved or rejected",
+                        "name": "reviewStatus",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "transaction ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.Transaction"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.FraudDecision"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/user": {
-            "put": {
-                "description": "Update a User using the provided data.",
-                "consumes": [
-                    "application/json"
-                ],
+        "/api/v1/fraud/decisions/{id}": {
+            "get": {
+                "description": "Get a fraud decision with the result of every rule that matched.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Fraud"
                 ],
-                "summary": "Update a User",
+                "summary": "Get fraud decision by ID",
+                "operationId": "get-fraud-decision-by-id",
                 "parameters": [
                     {
-                        "description": "User object to update",
-                        "name": "User",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/delivery.User"
-                        }
+                        "type": "integer",
+                        "description": "Decision ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.User"
+                            "$ref": "#/definitions/usecase.FraudDecision"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/user/balance/{userId}": {
-            "get": {
-                "description": "Get a user balance by their unique id.",
+        "/api/v1/fraud/decisions/{id}/review": {
+            "post": {
+                "description": "Approve or reject a decision that is pending review. The review is recorded; a rejected transaction is not reversed.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Fraud"
                 ],
-                "summary": "Get user balance by id",
-                "operationId": "get-user-balance-by-id",
+                "summary": "Review a fraud decision",
+                "operationId": "review-fraud-decision",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User id",
-                        "name": "userId",
+                        "description": "Decision ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "description": "Review",
+                        "name": "review",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/usecase.FraudReview"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "number"
+                            "$ref": "#/definitions/usecase.FraudDecision"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/user/chargeCode/{chargeCodeId}": {
+        "/api/v1/reconciliation/runs": {
             "get": {
-                "description": "Get a list of users who use a specific ChargeCode with pagination.",
+                "description": "Get the reconciliation runs, newest first, with pagination.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Reconciliation"
                 ],
-                "summary": "Get List Of Users Use ChargeCode",
-                "operationId": "get-list-of-users-use-chargecode",
+                "summary": "Get reconciliation runs",
+                "operationId": "get-reconciliation-runs",
                 "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "ChargeCode ID",
-                        "name": "chargeCodeId",
-                        "in": "path",
-                        "required": true
-                    },
                     {
                         "type": "integer",
                         "description": "Page number most start from 1",
@@ -548,28 +1069,74 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.ChargeCode"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.ReconciliationRun"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Compare every balance with the sum of its transactions and every charge code's current uses with its redemptions, and store the discrepancies in a new run. Nothing is repaired.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reconciliation"
+                ],
+                "summary": "Run a reconciliation",
+                "operationId": "create-reconciliation-run",
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.ReconciliationRun"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
         },
-        "/api/v1/user/{phoneNumber}": {
+        "/api/v1/reconciliation/runs/{id}": {
             "get": {
-                "description": "Get a user by their unique phoneNumber.",
+                "description": "Get a reconciliation run with the number of discrepancies it found and repaired.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Reconciliation"
                 ],
-                "summary": "Get user by phoneNumber",
-                "operationId": "get-user-by-phoneNumber",
+                "summary": "Get reconciliation run by ID",
+                "operationId": "get-reconciliation-run-by-id",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "User phoneNumber",
-                        "name": "phoneNumber",
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     }
@@ -578,108 +1145,2331 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/delivery.User"
+                            "$ref": "#/definitions/usecase.ReconciliationRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "delivery.ChargeCode": {
-            "type": "object",
-            "required": [
-                "amount",
-                "code",
-                "current_uses",
-                "max_uses"
-            ],
-            "properties": {
+        },
+        "/api/v1/reconciliation/runs/{id}/discrepancies": {
+            "get": {
+                "description": "Get the discrepancies a run found with the recorded and expected values, and whether each was repaired.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reconciliation"
+                ],
+                "summary": "Get the discrepancies of a reconciliation run",
+                "operationId": "get-reconciliation-discrepancies",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.ReconciliationDiscrepancy"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/reconciliation/runs/{id}/repair": {
+            "post": {
+                "description": "Set each balance to the sum of its transactions and each charge code's current uses to its redemptions. Discrepancies that changed since the run are skipped. Every repair is written to the audit log.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Reconciliation"
+                ],
+                "summary": "Repair the discrepancies of a reconciliation run",
+                "operationId": "repair-reconciliation-run",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.ReconciliationRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction": {
+            "get": {
+                "description": "Get transactions with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Get transactions with pagination",
+                "operationId": "get-paginated-transactions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new Transaction using the provided data.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Create a new Transaction",
+                "parameters": [
+                    {
+                        "description": "Transaction object to create",
+                        "name": "Transaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/charge": {
+            "post": {
+                "description": "Create a new ChargeCodeTransaction using the provided data.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Create a new ChargeCodeTransaction",
+                "parameters": [
+                    {
+                        "description": "ChargeCodeTransaction object to create",
+                        "name": "ChargeCodeTransaction",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/delivery.ChargeCodeTransaction"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.ChargeCodeTransaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/charge/failures": {
+            "get": {
+                "description": "Get failed redemption counters and lockouts per phone number and client IP with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Get failed charge code redemptions",
+                "operationId": "get-redemption-failure-stats",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.RedemptionFailureStat"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/import": {
+            "post": {
+                "description": "Post a batch of adjustments from a CSV file, sent as the request body with Content-Type text/csv or as the ` + "`" + `file` + "`" + ` field of a multipart form. The header names the columns phone, amount, type and reference in any order. Amounts are positive; type is credit or debit. Every row is checked for its format, the amount range and the balance left by the rows before it. An atomic import applies every row or none; a best_effort import applies the rows that passed. Rows skip the per-user limits and fraud rules and are audited with their reference. A row whose reference was imported before is skipped, so a file can be sent again after a failure. The report gives the result of every row.",
+                "consumes": [
+                    "text/csv",
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Import transactions from CSV",
+                "operationId": "import-transactions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "atomic (default) or best_effort",
+                        "name": "mode",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Only validate the rows",
+                        "name": "dryRun",
+                        "in": "query"
+                    },
+                    {
+                        "type": "file",
+                        "description": "CSV file, when sent as a multipart form",
+                        "name": "file",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.TransactionImportReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/user/totalNumber/{userId}": {
+            "get": {
+                "description": "Get Total a Transaction by their unique user ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Get Total Transaction by user ID",
+                "operationId": "get-total-transaction-by-user-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "user ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/user/{userId}": {
+            "get": {
+                "description": "Get transactions for a user by their unique user ID with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Get Transactions by user ID",
+                "operationId": "get-transactions-by-user-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/transaction/{id}": {
+            "get": {
+                "description": "Get a Transaction by their unique ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Transaction"
+                ],
+                "summary": "Get Transaction by ID",
+                "operationId": "get-transaction-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "transaction ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Transaction"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user": {
+            "put": {
+                "description": "Update a User using the provided data. If-Match has to hold the ETag of the user as last read; when the user changed since, for example by a transaction, the update fails with 412 and the user has to be read again.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update a User",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag of the user being updated",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "User object to update",
+                        "name": "User",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/delivery.User"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/balance/{userId}": {
+            "get": {
+                "description": "Get a user balance by their unique id.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user balance by id",
+                "operationId": "get-user-balance-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "number"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/chargeCode/{chargeCodeId}": {
+            "get": {
+                "description": "Get a list of users who use a specific ChargeCode with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get List Of Users Use ChargeCode",
+                "operationId": "get-list-of-users-use-chargecode",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ChargeCode ID",
+                        "name": "chargeCodeId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.ChargeCode"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/limits/{userId}": {
+            "get": {
+                "description": "Get the daily and monthly transaction limits of a user, the overrides they come from and how much of each is used. Limits are rolling: a transaction counts for 24 hours towards the daily limits and for 30 days towards the monthly ones. A limit of 0 means no limit.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get the transaction limits of a user",
+                "operationId": "get-user-limits",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.UserTransactionLimits"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace the limit overrides of a user. Omitted limits use the defaults and 0 removes a limit.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Override the transaction limits of a user",
+                "operationId": "set-user-limits",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Limit overrides",
+                        "name": "limits",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/usecase.TransactionLimitOverrides"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.UserTransactionLimits"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove the limit overrides of a user so that the defaults apply.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Remove the transaction limit overrides of a user",
+                "operationId": "delete-user-limits",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/{phoneNumber}": {
+            "get": {
+                "description": "Get a user by their unique phoneNumber. The ETag header holds the version of the user, to send as If-Match when updating it.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get user by phoneNumber",
+                "operationId": "get-user-by-phoneNumber",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "User phoneNumber",
+                        "name": "phoneNumber",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a version the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "The user did not change"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/user/{userId}": {
+            "patch": {
+                "description": "Change some fields of a User with a JSON merge patch (RFC 7396). Only PhoneNumber can be changed; the balance is only changed by transactions. Only the fields that differ are written. If-Match has to hold the ETag of the user as last read, as for PUT.",
+                "consumes": [
+                    "application/merge-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Partially update a User",
+                "operationId": "patch-user-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User id",
+                        "name": "userId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the user being updated",
+                        "name": "If-Match",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/delivery.UserPatch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "New version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "428": {
+                        "description": "Precondition Required",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks": {
+            "get": {
+                "description": "Get webhook subscriptions with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Get webhook subscriptions",
+                "operationId": "get-webhook-subscriptions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.WebhookSubscription"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register a URL for a set of event types: transaction.created, charge_code.redeemed, charge_code.exhausted and user.created. Deliveries carry an X-Webhook-Signature header \"t=\u003cunix time\u003e,v1=\u003chex HMAC-SHA256 of \"\u003cunix time\u003e.\u003cbody\u003e\"\u003e\" keyed with the secret. The secret is generated when omitted and only returned by this call.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Create a webhook subscription",
+                "parameters": [
+                    {
+                        "description": "Subscription to create",
+                        "name": "subscription",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/delivery.CreateWebhookSubscriptionModel"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/deliveries/{deliveryId}": {
+            "get": {
+                "description": "Get a webhook delivery with the log of every attempt.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Get webhook delivery by ID",
+                "operationId": "get-webhook-delivery-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "deliveryId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/deliveries/{deliveryId}/redeliver": {
+            "post": {
+                "description": "Queue a delivery again, including dead-lettered ones, with a fresh set of attempts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Redeliver a webhook delivery",
+                "operationId": "redeliver-webhook-delivery",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Delivery ID",
+                        "name": "deliveryId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.WebhookDelivery"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/{id}": {
+            "get": {
+                "description": "Get a webhook subscription by its unique ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Get webhook subscription by ID",
+                "operationId": "get-webhook-subscription-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop delivering events to a subscription. Its delivery log is kept.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Deactivate a webhook subscription",
+                "operationId": "delete-webhook-subscription-by-id",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/v1/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Get the deliveries of a subscription, newest first, with pagination.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Webhook"
+                ],
+                "summary": "Get webhook deliveries",
+                "operationId": "get-webhook-deliveries",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "pending, succeeded or dead",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number most start from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of items per page",
+                        "name": "pageSize",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/usecase.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/delivery.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/healthz": {
+            "get": {
+                "description": "Reports that the process is up. It checks no dependencies, so a database outage does not get the service restarted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Liveness probe",
+                "operationId": "liveness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Checks that the database is reachable, the schema version is current and the background workers are healthy. Results are cached briefly.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Health"
+                ],
+                "summary": "Readiness probe",
+                "operationId": "readiness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/usecase.HealthReport"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "delivery.ChargeCode": {
+            "type": "object",
+            "required": [
+                "amount",
+                "code",
+                "current_uses",
+                "max_uses"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "charge_code_id": {
+                    "type": "integer"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "current_uses": {
+                    "type": "integer"
+                },
+                "max_uses": {
+                    "type": "integer"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "active",
+                        "paused",
+                        "archived"
+                    ]
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "delivery.ChargeCodePatch": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "max_uses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "delivery.ChargeCodeTransaction": {
+            "type": "object",
+            "required": [
+                "ChargeCodeID",
+                "phoneNumber"
+            ],
+            "properties": {
+                "ChargeCodeID": {
+                    "type": "integer"
+                },
+                "phoneNumber": {
+                    "description": "TransactionID int ` + "`" + `json:\"transaction_id\"` + "`" + `",
+                    "type": "string"
+                }
+            }
+        },
+        "delivery.CreateChargeCodeMode": {
+            "type": "object",
+            "required": [
+                "amount",
+                "code",
+                "current_uses",
+                "max_uses"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "code": {
+                    "type": "string"
+                },
+                "current_uses": {
+                    "type": "integer"
+                },
+                "max_uses": {
+                    "type": "integer"
+                }
+            }
+        },
+        "delivery.CreateWebhookSubscriptionModel": {
+            "type": "object",
+            "required": [
+                "event_types",
+                "url"
+            ],
+            "properties": {
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "transaction.created",
+                        "charge_code.redeemed"
+                    ]
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://example.com/hooks/wallet"
+                }
+            }
+        },
+        "delivery.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string",
+                    "example": "phoneNumber"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "is required"
+                }
+            }
+        },
+        "delivery.Problem": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "not_found"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "user not found"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/delivery.FieldError"
+                    }
+                },
+                "instance": {
+                    "type": "string",
+                    "example": "4f1c2b7e9a0d4c3e8b5a6f7e8d9c0b1a"
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 404
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Not Found"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "urn:usermanager:problem:not_found"
+                }
+            }
+        },
+        "delivery.Transaction": {
+            "type": "object",
+            "required": [
+                "phoneNumber"
+            ],
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "phoneNumber": {
+                    "description": "TransactionID int     ` + "`" + `json:\"transaction_id\"` + "`" + `",
+                    "type": "string"
+                }
+            }
+        },
+        "delivery.User": {
+            "type": "object",
+            "required": [
+                "PhoneNumber"
+            ],
+            "properties": {
+                "Balance": {
+                    "type": "number"
+                },
+                "PhoneNumber": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "delivery.UserPatch": {
+            "type": "object",
+            "properties": {
+                "PhoneNumber": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.AuditLog": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "actor_verified": {
+                    "type": "boolean"
+                },
+                "after": {
+                    "type": "object"
+                },
+                "audit_id": {
+                    "type": "integer"
+                },
+                "before": {
+                    "type": "object"
+                },
+                "client_ip": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "entity_id": {
+                    "type": "integer"
+                },
+                "entity_type": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.Event": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "object"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "occurred_at": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.FraudDecision": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
                 "amount": {
                     "type": "number"
                 },
-                "charge_code_id": {
+                "charge_code_id": {
+                    "type": "integer"
+                },
+                "client_ip": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "decision_id": {
                     "type": "integer"
                 },
-                "code": {
+                "entity_id": {
+                    "type": "integer"
+                },
+                "kind": {
                     "type": "string"
                 },
-                "current_uses": {
+                "phone_number": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/usecase.FraudRuleResult"
+                    }
+                },
+                "review_note": {
+                    "type": "string"
+                },
+                "review_status": {
+                    "type": "string"
+                },
+                "reviewed_at": {
+                    "type": "string"
+                },
+                "reviewed_by": {
+                    "type": "string"
+                },
+                "score": {
                     "type": "integer"
                 },
-                "max_uses": {
+                "user_id": {
                     "type": "integer"
                 }
             }
         },
-        "delivery.ChargeCodeTransaction": {
+        "usecase.FraudReview": {
             "type": "object",
             "required": [
-                "ChargeCodeID",
-                "phoneNumber"
+                "status"
             ],
             "properties": {
-                "ChargeCodeID": {
+                "note": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "approved",
+                        "rejected"
+                    ],
+                    "example": "approved"
+                }
+            }
+        },
+        "usecase.FraudRuleResult": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "rule": {
+                    "type": "string"
+                },
+                "score": {
+                    "type": "integer"
+                }
+            }
+        },
+        "usecase.HealthCheckResult": {
+            "type": "object",
+            "properties": {
+                "duration_ms": {
                     "type": "integer"
                 },
-                "phoneNumber": {
-                    "description": "TransactionID int ` + "`" + `json:\"transaction_id\"` + "`" + `",
+                "error": {
+                    "type": "string"
+                },
+                "status": {
                     "type": "string"
                 }
             }
         },
-        "delivery.CreateChargeCodeMode": {
+        "usecase.HealthReport": {
             "type": "object",
-            "required": [
-                "amount",
-                "code",
-                "current_uses",
-                "max_uses"
-            ],
             "properties": {
-                "amount": {
+                "checked_at": {
+                    "type": "string"
+                },
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/usecase.HealthCheckResult"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.LimitUsage": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "string"
+                },
+                "max": {
                     "type": "number"
                 },
-                "code": {
+                "resets_at": {
                     "type": "string"
                 },
-                "current_uses": {
+                "used": {
+                    "type": "number"
+                }
+            }
+        },
+        "usecase.ReconciliationDiscrepancy": {
+            "type": "object",
+            "properties": {
+                "discrepancy_id": {
                     "type": "integer"
                 },
-                "max_uses": {
+                "entity_id": {
+                    "type": "integer"
+                },
+                "expected": {
+                    "type": "number"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "note": {
+                    "type": "string"
+                },
+                "recorded": {
+                    "type": "number"
+                },
+                "run_id": {
                     "type": "integer"
+                },
+                "status": {
+                    "type": "string"
                 }
             }
         },
-        "delivery.Transaction": {
+        "usecase.ReconciliationRun": {
+            "type": "object",
+            "properties": {
+                "balance_discrepancies": {
+                    "type": "integer"
+                },
+                "charge_code_discrepancies": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "repaired": {
+                    "type": "integer"
+                },
+                "repaired_at": {
+                    "type": "string"
+                },
+                "run_id": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "trigger": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.RedemptionFailureStat": {
+            "type": "object",
+            "properties": {
+                "failures": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_failure_at": {
+                    "type": "string"
+                },
+                "locked_until": {
+                    "type": "string"
+                },
+                "total_failures": {
+                    "type": "integer"
+                },
+                "window_started": {
+                    "type": "string"
+                }
+            }
+        },
+        "usecase.TransactionImportReport": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "type": "integer"
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "failed": {
+                    "type": "integer"
+                },
+                "mode": {
+                    "type": "string"
+                },
+                "rows": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/usecase.TransactionImportRow"
+                    }
+                },
+                "skipped": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "usecase.TransactionImportRow": {
             "type": "object",
-            "required": [
-                "phoneNumber"
-            ],
             "properties": {
                 "amount": {
                     "type": "number"
                 },
+                "code": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                },
                 "phoneNumber": {
-                    "description": "TransactionID int     ` + "`" + `json:\"transaction_id\"` + "`" + `",
+                    "type": "string"
+                },
+                "reference": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "transaction_id": {
+                    "type": "integer"
+                },
+                "type": {
                     "type": "string"
                 }
             }
         },
-        "delivery.User": {
+        "usecase.TransactionLimitOverrides": {
+            "type": "object",
+            "properties": {
+                "daily_count": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "daily_credit": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "daily_debit": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "monthly_count": {
+                    "type": "integer",
+                    "minimum": 0
+                },
+                "monthly_credit": {
+                    "type": "number",
+                    "minimum": 0
+                },
+                "monthly_debit": {
+                    "type": "number",
+                    "minimum": 0
+                }
+            }
+        },
+        "usecase.TransactionLimits": {
+            "type": "object",
+            "properties": {
+                "daily_count": {
+                    "type": "integer"
+                },
+                "daily_credit": {
+                    "type": "number"
+                },
+                "daily_debit": {
+                    "type": "number"
+                },
+                "monthly_count": {
+                    "type": "integer"
+                },
+                "monthly_credit": {
+                    "type": "number"
+                },
+                "monthly_debit": {
+                    "type": "number"
+                }
+            }
+        },
+        "usecase.UserTransactionLimits": {
+            "type": "object",
+            "properties": {
+                "effective": {
+                    "$ref": "#/definitions/usecase.TransactionLimits"
+                },
+                "overrides": {
+                    "$ref": "#/definitions/usecase.TransactionLimitOverrides"
+                },
+                "usage": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/usecase.LimitUsage"
+                    }
+                },
+                "user_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "usecase.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempt_log": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/usecase.WebhookDeliveryAttempt"
+                    }
+                },
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivery_id": {
+                    "type": "integer"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "type": "integer"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "usecase.WebhookDeliveryAttempt": {
+            "type": "object",
+            "properties": {
+                "attempt_id": {
+                    "type": "integer"
+                },
+                "attempted_at": {
+                    "type": "string"
+                },
+                "duration_ms": {
+                    "type": "integer"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "usecase.WebhookSubscription": {
             "type": "object",
             "required": [
-                "PhoneNumber"
+                "event_types",
+                "url"
             ],
             "properties": {
-                "Balance": {
-                    "type": "number"
+                "active": {
+                    "type": "boolean"
                 },
-                "PhoneNumber": {
+                "created_at": {
                     "type": "string"
                 },
-                "id": {
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "subscription_id": {
                     "type": "integer"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         }
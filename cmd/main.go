@@ -1,52 +1,319 @@
 package main
 
 import (
+	"chargeCode/internal/cache"
 	"chargeCode/internal/config"
 	"chargeCode/internal/database"
 	"chargeCode/internal/delivery"
+	"chargeCode/internal/delivery/grpcdelivery"
+	"chargeCode/internal/logging"
+	"chargeCode/internal/metrics"
+	"chargeCode/internal/publisher"
 	"chargeCode/internal/repository"
+	"chargeCode/internal/tracing"
 	"chargeCode/internal/usecase"
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the application and blocks until it has shut down. Resources are
+// released by deferred calls, so errors are returned instead of exiting.
+func run() error {
+	// Log JSON at info level until the configured level is known
+	slog.SetDefault(logging.New(os.Stdout, slog.LevelInfo))
+
 	// Load environment variables from the .env file
 	if err := godotenv.Load(); err != nil {
-		log.Printf("If you are loading the .env file within a Docker environment, you can safely ignore this error message: %v", err)
+		slog.Info("If you are loading the .env file within a Docker environment, you can safely ignore this error message", "error", err)
+	}
+
+	appConfig, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("loading app config file: %w", err)
 	}
 
 	// Initialize the logger
-	logger := log.New(os.Stdout, "", log.LstdFlags)
+	slog.SetDefault(logging.New(os.Stdout, appConfig.LogLevel))
 
-	appConfig, err := config.LoadConfig()
+	// Initialize tracing before the database so that its spans are exported
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    appConfig.TracingExporter,
+		ServiceName: appConfig.TracingServiceName,
+		FilePath:    appConfig.TracingFilePath,
+		SampleRatio: appConfig.TracingSampleRatio,
+	})
 	if err != nil {
-		logger.Fatalf("Error loading app config file: %v", err)
+		return fmt.Errorf("setting up tracing: %w", err)
 	}
+	defer func() {
+		// Bound the final export so an unreachable collector cannot block the exit
+		ctx, cancel := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Error flushing traces", "error", err)
+		}
+	}()
 
-	// Initialize the database connection
-	db, err := database.NewDBConnection(appConfig)
+	// Bound the connection and schema setup so a missing database fails fast
+	setupCtx, cancelSetup := context.WithTimeout(context.Background(), time.Minute)
+	db, err := database.NewDBConnection(setupCtx, appConfig)
+	cancelSetup()
 	if err != nil {
-		logger.Fatalf("Error connecting to database: %v", err)
+		return fmt.Errorf("connecting to database: %w", err)
 	}
 	defer db.Close() // Close the database connection when done
 
+	// Metrics are served by the router and recorded by the usecases
+	appMetrics := metrics.New(db)
+
+	// Charge code and user lookups are cached unless CACHE_BACKEND is none
+	appCache, err := cache.Open(appConfig, appMetrics)
+	if err != nil {
+		return fmt.Errorf("setting up cache: %w", err)
+	}
+	defer appCache.Close()
+
 	// Initialize dependencies
-	userRepo := repository.NewUserRepository(db, appConfig)
-	userUC := usecase.NewUserUseCase(userRepo)
+	var store usecase.Transactor = repository.NewStore(db, appConfig)
+	var userRepo usecase.UserRepository = repository.NewUserRepository(db, appConfig)
+	var chargeCodeRepo usecase.ChargeCodeRepository = repository.NewChargeCodeRepository(db, appConfig)
+	if appCache != nil {
+		// Transactions drop the entries they change
+		store = cache.NewTransactor(store, appCache)
+		userRepo = cache.NewUserRepository(userRepo, appCache)
+		chargeCodeRepo = cache.NewChargeCodeRepository(chargeCodeRepo, appCache)
+	}
+
+	userUC := usecase.NewUserUseCase(userRepo, store)
+	chargeCodeUC := usecase.NewChargeCodeUseCase(chargeCodeRepo, store)
+
+	// Redemption attempts are shared between instances only with the mysql store
+	var redemptionAttemptStore usecase.RedemptionAttemptStore
+	if appConfig.RedemptionRateLimitStore == "mysql" {
+		redemptionAttemptStore = repository.NewRedemptionAttemptRepository(db, appConfig)
+	} else {
+		redemptionAttemptStore = repository.NewMemoryRedemptionAttemptStore(appConfig)
+	}
+	redemptionGuard := usecase.NewRedemptionGuard(redemptionAttemptStore, usecase.RedemptionGuardConfig{
+		PhoneLimit:      usecase.RateLimit{PerMinute: appConfig.RedemptionPhoneRatePerMinute, Burst: appConfig.RedemptionPhoneBurst},
+		IPLimit:         usecase.RateLimit{PerMinute: appConfig.RedemptionIPRatePerMinute, Burst: appConfig.RedemptionIPBurst},
+		MaxFailures:     appConfig.RedemptionMaxFailures,
+		FailureWindow:   appConfig.RedemptionFailureWindow,
+		LockoutDuration: appConfig.RedemptionLockoutDuration,
+	})
 
-	chargeCodeRepo := repository.NewChargeCodeRepository(db, appConfig)
-	chargeCodeUC := usecase.NewChargeCodeUseCase(chargeCodeRepo)
+	webhookRepo := repository.NewWebhookRepository(db, appConfig)
+	webhookUC := usecase.NewWebhookUseCase(webhookRepo, store, usecase.WebhookConfig{
+		MaxAttempts:  appConfig.WebhookMaxAttempts,
+		BackoffBase:  appConfig.WebhookBackoffBase,
+		BackoffMax:   appConfig.WebhookBackoffMax,
+		Timeout:      appConfig.WebhookTimeout,
+		PollInterval: appConfig.WebhookPollInterval,
+	})
+
+	// The default per-user limits are read for every check, so reloading
+	// the config changes them
+	transactionLimiter := usecase.NewTransactionLimiter(store, func() usecase.TransactionLimits {
+		limits := appConfig.Limits()
+		return usecase.TransactionLimits{
+			DailyDebit:    limits.UserDailyDebitLimit,
+			DailyCredit:   limits.UserDailyCreditLimit,
+			DailyCount:    limits.UserDailyTransactionLimit,
+			MonthlyDebit:  limits.UserMonthlyDebitLimit,
+			MonthlyCredit: limits.UserMonthlyCreditLimit,
+			MonthlyCount:  limits.UserMonthlyTransactionLimit,
+		}
+	})
+
+	// Every rule is listed; the ones whose threshold is zero never match
+	fraudRule := func(rule config.FraudRuleConfig) usecase.FraudRuleAction {
+		return usecase.FraudRuleAction{Action: rule.Action, Score: rule.Score}
+	}
+	fraudRepo := repository.NewFraudRepository(db, appConfig)
+	fraudEngine := usecase.NewFraudEngine([]usecase.FraudRule{
+		&usecase.VelocityRule{MaxTransactions: appConfig.FraudVelocityMaxTransactions, Window: appConfig.FraudVelocityWindow, FraudRuleAction: fraudRule(appConfig.FraudVelocity)},
+		&usecase.AmountRule{Threshold: appConfig.FraudAmountThreshold, FraudRuleAction: fraudRule(appConfig.FraudAmount)},
+		&usecase.NewAccountRule{MaxAge: appConfig.FraudNewAccountMaxAge, MinDebit: appConfig.FraudNewAccountMinDebit, FraudRuleAction: fraudRule(appConfig.FraudNewAccount)},
+		&usecase.IPFanOutRule{MaxPhoneNumbers: appConfig.FraudIPFanOutMaxPhoneNumbers, Window: appConfig.FraudIPFanOutWindow, FraudRuleAction: fraudRule(appConfig.FraudIPFanOut)},
+		&usecase.CreditDrainRule{Ratio: appConfig.FraudCreditDrainRatio, Window: appConfig.FraudCreditDrainWindow, FraudRuleAction: fraudRule(appConfig.FraudCreditDrain)},
+	}, fraudRepo, store, usecase.FraudConfig{
+		ReviewScore: appConfig.FraudReviewScore,
+		DenyScore:   appConfig.FraudDenyScore,
+	}, appMetrics)
 
 	transactionRepo := repository.NewTransactionRepository(db, appConfig)
-	transactionUC := usecase.NewTransactionUseCase(transactionRepo)
+	transactionUC := usecase.NewTransactionUseCase(transactionRepo, store, redemptionGuard, transactionLimiter, fraudEngine, appMetrics)
+
+	auditRepo := repository.NewAuditRepository(db, appConfig)
+	auditUC := usecase.NewAuditUseCase(auditRepo)
+
+	reconciliationRepo := repository.NewReconciliationRepository(db, appConfig)
+	reconciliationUC := usecase.NewReconciliationUseCase(reconciliationRepo, store, usecase.ReconciliationConfig{
+		Enabled:    appConfig.ReconciliationEnabled,
+		At:         appConfig.ReconciliationTime,
+		AutoRepair: appConfig.ReconciliationAutoRepair,
+	})
+
+	// Events are written to the outbox and relayed to the configured publishers
+	eventStream := usecase.NewEventStream(usecase.EventStreamConfig{
+		BufferSize:       appConfig.EventStreamBufferSize,
+		ClientBufferSize: appConfig.EventStreamClientBufferSize,
+		MaxClients:       appConfig.EventStreamMaxClients,
+	})
+	var publishers []usecase.EventPublisher
+	for _, name := range appConfig.OutboxPublishers {
+		switch name {
+		case "webhook":
+			publishers = append(publishers, webhookUC)
+		case "stream":
+			// Only the instance holding the relay lock feeds its stream
+			publishers = append(publishers, eventStream)
+		case "ndjson":
+			ndjsonPublisher, err := publisher.NewNDJSONPublisher(appConfig.OutboxNDJSONPath)
+			if err != nil {
+				return fmt.Errorf("opening event file: %w", err)
+			}
+			defer ndjsonPublisher.Close()
+			publishers = append(publishers, ndjsonPublisher)
+		case "memory":
+			publishers = append(publishers, publisher.NewMemoryPublisher())
+		}
+	}
+	outboxRepo := repository.NewOutboxRepository(db, appConfig)
+	outboxRelay := usecase.NewOutboxRelay(outboxRepo, publisher.NewMultiPublisher(publishers...), usecase.OutboxRelayConfig{
+		PollInterval: appConfig.OutboxPollInterval,
+		BatchSize:    appConfig.OutboxBatchSize,
+		MaxAttempts:  appConfig.OutboxMaxAttempts,
+	})
+
+	// Readiness covers the database, the schema and the background workers
+	healthRepo := repository.NewHealthRepository(db, appConfig)
+	healthUC := usecase.NewHealthUseCase(healthRepo, map[string]*usecase.Heartbeat{
+		"outbox_relay":    outboxRelay.Heartbeat,
+		"webhook_workers": webhookUC.Heartbeat,
+	}, usecase.HealthConfig{
+		SchemaVersion:    database.SchemaVersion,
+		WorkerStaleAfter: appConfig.HealthWorkerStaleAfter,
+		CacheTTL:         appConfig.HealthCacheTTL,
+	})
 
 	// Pass the UserUseCase instance, not a pointer, to SetupRouter
-	router := delivery.SetupRouter(userUC, chargeCodeUC, transactionUC) // Pass userUC, not &userUC
+	router, err := delivery.SetupRouter(appConfig, appMetrics, userUC, chargeCodeUC, transactionUC, auditUC, webhookUC, healthUC, transactionLimiter, fraudEngine, reconciliationUC, eventStream) // Pass userUC, not &userUC
+	if err != nil {
+		return fmt.Errorf("setting up router: %w", err)
+	}
+
+	// The gRPC API serves the same usecases on its own port
+	grpcServer := grpcdelivery.NewServer(grpcdelivery.Config{
+		DBTimeout:      appConfig.DBTimeout,
+		HealthInterval: appConfig.HealthCacheTTL,
+	}, healthUC, userUC, chargeCodeUC, transactionUC)
+	grpcListener, err := net.Listen("tcp", ":"+appConfig.GRPCPort)
+	if err != nil {
+		return fmt.Errorf("listening for gRPC: %w", err)
+	}
+
+	// SIGINT and SIGTERM start a graceful shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// SIGHUP and edits of the config file reload the business limits
+	go config.WatchLimits(ctx, appConfig)
+
+	// Relay events, deliver webhooks and reconcile in the background. The
+	// workers get their own context so they keep running while requests are
+	// drained.
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	for _, worker := range []func(context.Context){outboxRelay.Run, webhookUC.Run, reconciliationUC.Run, grpcServer.WatchReadiness} {
+		workers.Add(1)
+		go func(worker func(context.Context)) {
+			defer workers.Done()
+			worker(workerCtx)
+		}(worker)
+	}
+
+	server := &http.Server{
+		Addr:              ":" + appConfig.ApplicationPort,
+		Handler:           router,
+		ReadTimeout:       appConfig.HTTPReadTimeout,
+		ReadHeaderTimeout: appConfig.HTTPReadHeaderTimeout,
+		WriteTimeout:      appConfig.HTTPWriteTimeout,
+		IdleTimeout:       appConfig.HTTPIdleTimeout,
+		MaxHeaderBytes:    appConfig.HTTPMaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	// Shutdown waits for idle connections, so the event streams are ended
+	// first
+	server.RegisterOnShutdown(eventStream.Close)
+
+	// Start the servers
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serverErr <- fmt.Errorf("gRPC: %w", err)
+		}
+	}()
+	slog.Info("Server started", "port", appConfig.ApplicationPort, "grpc_port", appConfig.GRPCPort)
+
+	var runErr error
+	select {
+	case err := <-serverErr:
+		runErr = fmt.Errorf("running server: %w", err)
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", appConfig.ShutdownTimeout)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), appConfig.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// Stop accepting connections and wait for in-flight requests and calls
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.Shutdown(shutdownCtx)
+		close(grpcStopped)
+	}()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error draining requests", "error", err)
+	}
+	<-grpcStopped
+
+	// Stop the workers; undelivered events stay in the database and are
+	// picked up again after the restart
+	stopWorkers()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		slog.Error("Error stopping background workers", "error", shutdownCtx.Err())
+	}
 
-	// Start the server
-	logger.Printf("Server started on port %s", appConfig.ApplicationPort)
-	router.Run(":" + appConfig.ApplicationPort)
+	// The deferred calls flush the event file, close the database and flush traces
+	slog.Info("Server stopped")
+	return runErr
 }
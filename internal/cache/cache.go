@@ -0,0 +1,233 @@
+// Package cache puts a read-through cache in front of the charge code and
+// user lookups. Entries are dropped when a transaction changes them and
+// expire after a TTL, which bounds how long a change made elsewhere, for
+// example by another instance with the in-process store, can go unnoticed.
+package cache
+
+import (
+	"chargeCode/internal/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix keeps the keys of the service apart from other users of a
+// shared Redis.
+const redisKeyPrefix = "usermanager:"
+
+// Names of the caches, as reported to Metrics.
+const (
+	chargeCodeCache = "charge_code"
+	userCache       = "user"
+)
+
+// Store keeps cached values. A value that was not found is reported with
+// ok false and a nil error. Implementations must be safe for concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Metrics records cache hits and misses. It is implemented by
+// metrics.Metrics.
+type Metrics interface {
+	CacheLookup(cache string, hit bool)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) CacheLookup(cache string, hit bool) {}
+
+// Config holds how long entries are kept.
+type Config struct {
+	ChargeCodeTTL time.Duration
+	UserTTL       time.Duration
+}
+
+// Cache reads and writes JSON encoded entries in a Store. Errors of the
+// store are logged and treated as misses, so an unavailable cache only
+// makes lookups slower.
+type Cache struct {
+	store   Store
+	config  Config
+	metrics Metrics
+}
+
+func New(store Store, config Config, metrics Metrics) *Cache {
+	if metrics == nil {
+		metrics = nopMetrics{}
+	}
+	return &Cache{store: store, config: config, metrics: metrics}
+}
+
+// Open creates the cache selected by CACHE_BACKEND. It returns nil when
+// caching is disabled.
+func Open(appConfig *config.AppConfig, metrics Metrics) (*Cache, error) {
+	var store Store
+	switch appConfig.CacheBackend {
+	case "none":
+		return nil, nil
+	case "redis":
+		options, err := redis.ParseURL(appConfig.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("parsing REDIS_URL: %w", err)
+		}
+		store = NewRedisStore(redis.NewClient(options), redisKeyPrefix)
+	default:
+		lruStore, err := NewLRUStore(appConfig.CacheSize)
+		if err != nil {
+			return nil, err
+		}
+		store = lruStore
+	}
+	return New(store, Config{ChargeCodeTTL: appConfig.CacheChargeCodeTTL, UserTTL: appConfig.CacheUserTTL}, metrics), nil
+}
+
+// Close releases the store. It may be called on a nil Cache.
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	if closer, ok := c.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func chargeCodeKey(id int) string {
+	return "chargeCode:" + strconv.Itoa(id)
+}
+
+// chargeCodeCodeKey maps a code to the id of its charge code. The code of
+// the entry is checked on read, so the mapping outlives a changed code
+// harmlessly.
+func chargeCodeCodeKey(code string) string {
+	return "chargeCode:code:" + code
+}
+
+func userKey(id int) string {
+	return "user:" + strconv.Itoa(id)
+}
+
+// userPhoneKey maps a phone number to the id of its user. Deleting it makes
+// the next lookup by phone number reload the user.
+func userPhoneKey(phoneNumber string) string {
+	return "user:phone:" + phoneNumber
+}
+
+// generationTTL is how long the generation of a key is kept. A lookup after
+// it expired starts a new generation, which only costs a miss.
+const generationTTL = 24 * time.Hour
+
+// generationKey holds the generation of the entry at key. Every
+// invalidation starts a new generation, and an entry is only read in the
+// generation that was current before its value was read from the database.
+// A lookup that read the database before a change committed thus cannot put
+// the old value back for the rest of its TTL.
+func generationKey(key string) string {
+	return key + ":generation"
+}
+
+func newGeneration() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+// generation returns the current generation of key, starting one when there
+// is none. It returns "" when the store failed, which makes the lookup a
+// miss that is not cached.
+func (c *Cache) generation(ctx context.Context, key string) string {
+	generation, ok, err := c.store.Get(ctx, generationKey(key))
+	if err != nil {
+		slog.WarnContext(ctx, "error reading cache", "error", err, "key", generationKey(key))
+		return ""
+	}
+	if ok {
+		return string(generation)
+	}
+	// Nothing cached before this generation can match it
+	generation = []byte(newGeneration())
+	if err := c.store.Set(ctx, generationKey(key), generation, generationTTL); err != nil {
+		slog.WarnContext(ctx, "error writing cache", "error", err, "key", generationKey(key))
+		return ""
+	}
+	return string(generation)
+}
+
+// entry is a cached value with the generation it was read in.
+type entry struct {
+	Generation string          `json:"generation"`
+	Value      json.RawMessage `json:"value"`
+}
+
+// get decodes the entry at key into v and reports whether there was one in
+// generation.
+func (c *Cache) get(ctx context.Context, key string, generation string, v any) bool {
+	if generation == "" {
+		return false
+	}
+	value, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "error reading cache", "error", err, "key", key)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	var cached entry
+	if err := json.Unmarshal(value, &cached); err != nil {
+		slog.WarnContext(ctx, "error decoding cache entry", "error", err, "key", key)
+		return false
+	}
+	if cached.Generation != generation {
+		return false
+	}
+	if err := json.Unmarshal(cached.Value, v); err != nil {
+		slog.WarnContext(ctx, "error decoding cache entry", "error", err, "key", key)
+		return false
+	}
+	return true
+}
+
+// set writes v at key in generation, which must have been taken before v
+// was read from the database.
+func (c *Cache) set(ctx context.Context, key string, v any, generation string, ttl time.Duration) {
+	if generation == "" {
+		return
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		slog.WarnContext(ctx, "error encoding cache entry", "error", err, "key", key)
+		return
+	}
+	value, err = json.Marshal(entry{Generation: generation, Value: value})
+	if err != nil {
+		slog.WarnContext(ctx, "error encoding cache entry", "error", err, "key", key)
+		return
+	}
+	if err := c.store.Set(ctx, key, value, ttl); err != nil {
+		slog.WarnContext(ctx, "error writing cache", "error", err, "key", key)
+	}
+}
+
+// invalidate starts a new generation of keys and drops their entries.
+func (c *Cache) invalidate(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	for _, key := range keys {
+		if err := c.store.Set(ctx, generationKey(key), []byte(newGeneration()), generationTTL); err != nil {
+			slog.WarnContext(ctx, "error invalidating cache", "error", err, "key", key)
+		}
+	}
+	if err := c.store.Delete(ctx, keys...); err != nil {
+		slog.WarnContext(ctx, "error invalidating cache", "error", err, "keys", keys)
+	}
+}
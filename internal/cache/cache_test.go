@@ -0,0 +1,461 @@
+package cache
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeDB stands in for the database behind the cached repositories and
+// counts the lookups that reach it.
+type fakeDB struct {
+	users       map[int]*usecase.User
+	chargeCodes map[int]*usecase.ChargeCode
+	reads       int
+	// afterRead runs inside every lookup, after the row was read
+	afterRead func()
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		users:       map[int]*usecase.User{1: {ID: 1, PhoneNumber: "09120000001", Balance: 100, Version: 1}},
+		chargeCodes: map[int]*usecase.ChargeCode{1: {ChargeCodeID: 1, Code: "SPRING", MaxUses: 10, Amount: 50, Version: 1, Status: usecase.ChargeCodeActive}},
+	}
+}
+
+func (db *fakeDB) read() {
+	db.reads++
+	if db.afterRead != nil {
+		db.afterRead()
+	}
+}
+
+func (db *fakeDB) userByPhoneNumber(phoneNumber string) *usecase.User {
+	for _, user := range db.users {
+		if user.PhoneNumber == phoneNumber {
+			return user
+		}
+	}
+	return nil
+}
+
+type fakeUsers struct {
+	usecase.UserRepository
+	db *fakeDB
+}
+
+func (r *fakeUsers) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*usecase.User, error) {
+	user := r.db.userByPhoneNumber(phoneNumber)
+	defer r.db.read()
+	if user == nil {
+		return nil, usecase.NotFoundError("user not found")
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *fakeUsers) UpdateUser(ctx context.Context, user *usecase.User) (*usecase.User, error) {
+	updated := *user
+	updated.Version++
+	r.db.users[user.ID] = &updated
+	return &updated, nil
+}
+
+func (r *fakeUsers) PatchUser(ctx context.Context, id int, version int, patch *usecase.UserPatch) (*usecase.User, error) {
+	patched := *r.db.users[id]
+	patched.PhoneNumber = *patch.PhoneNumber
+	patched.Version++
+	r.db.users[id] = &patched
+	return &patched, nil
+}
+
+type fakeChargeCodes struct {
+	usecase.ChargeCodeRepository
+	db *fakeDB
+}
+
+func (r *fakeChargeCodes) GetChargeCodeByID(ctx context.Context, id int) (*usecase.ChargeCode, error) {
+	chargeCode, ok := r.db.chargeCodes[id]
+	defer r.db.read()
+	if !ok {
+		return nil, usecase.NotFoundError("charge code not found")
+	}
+	found := *chargeCode
+	return &found, nil
+}
+
+func (r *fakeChargeCodes) GetChargeCodeByCode(ctx context.Context, code string) (*usecase.ChargeCode, error) {
+	defer r.db.read()
+	for _, chargeCode := range r.db.chargeCodes {
+		if chargeCode.Code == code {
+			found := *chargeCode
+			return &found, nil
+		}
+	}
+	return nil, usecase.NotFoundError("charge code not found")
+}
+
+func (r *fakeChargeCodes) change(id int, change func(chargeCode *usecase.ChargeCode)) *usecase.ChargeCode {
+	changed := *r.db.chargeCodes[id]
+	change(&changed)
+	changed.Version++
+	r.db.chargeCodes[id] = &changed
+	return &changed
+}
+
+func (r *fakeChargeCodes) SetChargeCodeStatus(ctx context.Context, id int, status string) (*usecase.ChargeCode, error) {
+	return r.change(id, func(chargeCode *usecase.ChargeCode) { chargeCode.Status = status }), nil
+}
+
+func (r *fakeChargeCodes) UpdateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+	return r.change(chargeCode.ChargeCodeID, func(changed *usecase.ChargeCode) { changed.MaxUses = chargeCode.MaxUses }), nil
+}
+
+func (r *fakeChargeCodes) PatchChargeCode(ctx context.Context, id int, version int, patch *usecase.ChargeCodePatch) (*usecase.ChargeCode, error) {
+	return r.change(id, func(chargeCode *usecase.ChargeCode) { chargeCode.Amount = *patch.Amount }), nil
+}
+
+type fakeTransactions struct {
+	usecase.TransactionRepository
+	db *fakeDB
+}
+
+func (r *fakeTransactions) CreateTransaction(ctx context.Context, transaction *usecase.Transaction) (*usecase.Transaction, error) {
+	user := r.db.userByPhoneNumber(transaction.PhoneNumber)
+	if user.Balance+transaction.Amount < 0 {
+		return nil, usecase.ErrInsufficientFunds
+	}
+	user.Balance += transaction.Amount
+	user.Version++
+	return transaction, nil
+}
+
+func (r *fakeTransactions) CreateChargeTransaction(ctx context.Context, chargeCodeTransaction *usecase.ChargeCodeTransaction) (*usecase.ChargeCodeTransaction, error) {
+	chargeCode := r.db.chargeCodes[chargeCodeTransaction.ChargeCodeID]
+	chargeCode.CurrentUses++
+	chargeCode.Version++
+	user := r.db.userByPhoneNumber(chargeCodeTransaction.PhoneNumber)
+	user.Balance += chargeCode.Amount
+	user.Version++
+	return chargeCodeTransaction, nil
+}
+
+type fakeReconciliation struct {
+	usecase.ReconciliationRepository
+	db *fakeDB
+}
+
+func (r *fakeReconciliation) SetBalance(ctx context.Context, userID int, balance float64) error {
+	r.db.users[userID].Balance = balance
+	return nil
+}
+
+func (r *fakeReconciliation) SetChargeCodeUses(ctx context.Context, chargeCodeID int, uses int) error {
+	r.db.chargeCodes[chargeCodeID].CurrentUses = uses
+	return nil
+}
+
+// fakeTransactor runs transactions on a fakeDB. Changes are not rolled back,
+// which the invalidations do not depend on.
+type fakeTransactor struct {
+	db *fakeDB
+}
+
+func (t *fakeTransactor) WithinTransaction(ctx context.Context, fn func(repos *usecase.Repositories) error) error {
+	return fn(&usecase.Repositories{
+		Users:          &fakeUsers{db: t.db},
+		ChargeCodes:    &fakeChargeCodes{db: t.db},
+		Transactions:   &fakeTransactions{db: t.db},
+		Reconciliation: &fakeReconciliation{db: t.db},
+	})
+}
+
+type fakeMetrics struct {
+	hits, misses int
+}
+
+func (m *fakeMetrics) CacheLookup(cache string, hit bool) {
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+// cached is a database with the cached repositories in front of it.
+type cached struct {
+	db          *fakeDB
+	store       testStore
+	metrics     *fakeMetrics
+	users       *UserRepository
+	chargeCodes *ChargeCodeRepository
+	transactor  *Transactor
+}
+
+func newCached(store testStore) *cached {
+	db := newFakeDB()
+	metrics := &fakeMetrics{}
+	cache := New(store, Config{ChargeCodeTTL: time.Minute, UserTTL: time.Minute}, metrics)
+	return &cached{
+		db:          db,
+		store:       store,
+		metrics:     metrics,
+		users:       NewUserRepository(&fakeUsers{db: db}, cache),
+		chargeCodes: NewChargeCodeRepository(&fakeChargeCodes{db: db}, cache),
+		transactor:  NewTransactor(&fakeTransactor{db: db}, cache),
+	}
+}
+
+// lookups are the cached lookups of the user and the charge code of a
+// fakeDB.
+var lookups = map[string]func(ctx context.Context, c *cached) (any, error){
+	"user by phone number": func(ctx context.Context, c *cached) (any, error) {
+		user, err := c.users.GetUserByPhoneNumber(ctx, "09120000001")
+		if err != nil {
+			return nil, err
+		}
+		return *user, nil
+	},
+	"charge code by id": func(ctx context.Context, c *cached) (any, error) {
+		chargeCode, err := c.chargeCodes.GetChargeCodeByID(ctx, 1)
+		if err != nil {
+			return nil, err
+		}
+		return *chargeCode, nil
+	},
+	"charge code by code": func(ctx context.Context, c *cached) (any, error) {
+		chargeCode, err := c.chargeCodes.GetChargeCodeByCode(ctx, "SPRING")
+		if err != nil {
+			return nil, err
+		}
+		return *chargeCode, nil
+	},
+}
+
+// warm looks up until the entry is cached. A lookup through a mapping
+// caches the entry on its second miss.
+func warm(t *testing.T, ctx context.Context, c *cached, lookup func(ctx context.Context, c *cached) (any, error)) any {
+	t.Helper()
+	var found any
+	for range 2 {
+		var err error
+		if found, err = lookup(ctx, c); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+	}
+	return found
+}
+
+func TestLookupsHitAfterMiss(t *testing.T) {
+	ctx := context.Background()
+	for backend, newStore := range backends {
+		for name, lookup := range lookups {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				c := newCached(newStore(t))
+				want := warm(t, ctx, c, lookup)
+				reads, hits := c.db.reads, c.metrics.hits
+
+				found, err := lookup(ctx, c)
+				if err != nil {
+					t.Fatalf("lookup: %v", err)
+				}
+				if c.db.reads != reads || c.metrics.hits != hits+1 {
+					t.Errorf("lookup of a cached entry read the database")
+				}
+				if found != want {
+					t.Errorf("cached = %+v, want %+v", found, want)
+				}
+
+				// An entry expires after its TTL
+				c.store.advance(time.Minute)
+				if _, err := lookup(ctx, c); err != nil {
+					t.Fatalf("lookup: %v", err)
+				}
+				if c.db.reads == reads {
+					t.Errorf("lookup after the TTL did not read the database")
+				}
+			})
+		}
+	}
+}
+
+func TestLookupsDoNotCacheNotFound(t *testing.T) {
+	ctx := context.Background()
+	c := newCached(newTestLRUStore(t, 100))
+	for range 2 {
+		if _, err := c.chargeCodes.GetChargeCodeByCode(ctx, "MISSING"); !errors.Is(err, usecase.ErrNotFound) {
+			t.Fatalf("GetChargeCodeByCode: err = %v, want not found", err)
+		}
+	}
+	if c.db.reads != 2 {
+		t.Errorf("%d lookups read the database, want both", c.db.reads)
+	}
+}
+
+func TestTransactorInvalidatesWrites(t *testing.T) {
+	writes := []struct {
+		name  string
+		write func(ctx context.Context, repos *usecase.Repositories) error
+		// changes are the lookups whose result the write changes
+		changes []string
+	}{
+		{"update user", func(ctx context.Context, repos *usecase.Repositories) error {
+			_, err := repos.Users.UpdateUser(ctx, &usecase.User{ID: 1, PhoneNumber: "09120000001", Balance: 100, Version: 2})
+			return err
+		}, []string{"user by phone number"}},
+		{"patch user", func(ctx context.Context, repos *usecase.Repositories) error {
+			phoneNumber := "09120000001"
+			_, err := repos.Users.PatchUser(ctx, 1, 1, &usecase.UserPatch{PhoneNumber: &phoneNumber})
+			return err
+		}, []string{"user by phone number"}},
+		{"status change", func(ctx context.Context, repos *usecase.Repositories) error {
+			_, err := repos.ChargeCodes.SetChargeCodeStatus(ctx, 1, usecase.ChargeCodePaused)
+			return err
+		}, []string{"charge code by id", "charge code by code"}},
+		{"update charge code", func(ctx context.Context, repos *usecase.Repositories) error {
+			_, err := repos.ChargeCodes.UpdateChargeCode(ctx, &usecase.ChargeCode{ChargeCodeID: 1, MaxUses: 20})
+			return err
+		}, []string{"charge code by id", "charge code by code"}},
+		{"patch charge code", func(ctx context.Context, repos *usecase.Repositories) error {
+			amount := 75.0
+			_, err := repos.ChargeCodes.PatchChargeCode(ctx, 1, 1, &usecase.ChargeCodePatch{Amount: &amount})
+			return err
+		}, []string{"charge code by id", "charge code by code"}},
+		{"redemption", func(ctx context.Context, repos *usecase.Repositories) error {
+			_, err := repos.Transactions.CreateChargeTransaction(ctx, &usecase.ChargeCodeTransaction{PhoneNumber: "09120000001", ChargeCodeID: 1})
+			return err
+		}, []string{"user by phone number", "charge code by id", "charge code by code"}},
+		{"adjustment", func(ctx context.Context, repos *usecase.Repositories) error {
+			_, err := repos.Transactions.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: -30})
+			return err
+		}, []string{"user by phone number"}},
+		{"balance repair", func(ctx context.Context, repos *usecase.Repositories) error {
+			return repos.Reconciliation.SetBalance(ctx, 1, 90)
+		}, []string{"user by phone number"}},
+		{"charge code uses repair", func(ctx context.Context, repos *usecase.Repositories) error {
+			return repos.Reconciliation.SetChargeCodeUses(ctx, 1, 3)
+		}, []string{"charge code by id", "charge code by code"}},
+	}
+	ctx := context.Background()
+	for backend, newStore := range backends {
+		for _, write := range writes {
+			for _, lookup := range write.changes {
+				t.Run(backend+"/"+write.name+"/"+lookup, func(t *testing.T) {
+					c := newCached(newStore(t))
+					before := warm(t, ctx, c, lookups[lookup])
+
+					errFailed := errors.New("failed after the write")
+					err := c.transactor.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+						if err := write.write(ctx, repos); err != nil {
+							return err
+						}
+						// The write may have committed anyway
+						return errFailed
+					})
+					if !errors.Is(err, errFailed) {
+						t.Fatalf("WithinTransaction: err = %v, want %v", err, errFailed)
+					}
+
+					after, err := lookups[lookup](ctx, c)
+					if err != nil {
+						t.Fatalf("lookup: %v", err)
+					}
+					if after == before {
+						t.Errorf("lookup after the write = %+v, want the change", after)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestTransactorKeepsEntriesOfFailedWrites(t *testing.T) {
+	ctx := context.Background()
+	c := newCached(newTestLRUStore(t, 100))
+	warm(t, ctx, c, lookups["user by phone number"])
+	reads := c.db.reads
+
+	err := c.transactor.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		_, err := repos.Transactions.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: -1000})
+		return err
+	})
+	if !errors.Is(err, usecase.ErrInsufficientFunds) {
+		t.Fatalf("WithinTransaction: err = %v, want insufficient funds", err)
+	}
+	lookups["user by phone number"](ctx, c)
+	if c.db.reads != reads {
+		t.Errorf("a write that failed dropped the cached user")
+	}
+}
+
+func TestRepositoriesInvalidateWrites(t *testing.T) {
+	ctx := context.Background()
+	c := newCached(newTestLRUStore(t, 100))
+	warm(t, ctx, c, lookups["charge code by id"])
+	warm(t, ctx, c, lookups["user by phone number"])
+
+	if _, err := c.chargeCodes.SetChargeCodeStatus(ctx, 1, usecase.ChargeCodeArchived); err != nil {
+		t.Fatalf("SetChargeCodeStatus: %v", err)
+	}
+	if chargeCode, _ := c.chargeCodes.GetChargeCodeByID(ctx, 1); chargeCode.Status != usecase.ChargeCodeArchived {
+		t.Errorf("status = %s, want archived", chargeCode.Status)
+	}
+
+	phoneNumber := "09120000002"
+	if _, err := c.users.PatchUser(ctx, 1, 1, &usecase.UserPatch{PhoneNumber: &phoneNumber}); err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	if _, err := c.users.GetUserByPhoneNumber(ctx, "09120000001"); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("lookup of the old phone number: err = %v, want not found", err)
+	}
+	if user, err := c.users.GetUserByPhoneNumber(ctx, phoneNumber); err != nil || user.ID != 1 {
+		t.Errorf("lookup of the new phone number = %+v, %v, want the user", user, err)
+	}
+}
+
+// A lookup that read a row before a change to it committed must not cache
+// the old row once the change has been invalidated.
+func TestLookupRacingInvalidation(t *testing.T) {
+	ctx := context.Background()
+	repair := func(c *cached, uses int, balance float64) {
+		err := c.transactor.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+			if err := repos.Reconciliation.SetChargeCodeUses(ctx, 1, uses); err != nil {
+				return err
+			}
+			return repos.Reconciliation.SetBalance(ctx, 1, balance)
+		})
+		if err != nil {
+			t.Fatalf("WithinTransaction: %v", err)
+		}
+	}
+	for backend, newStore := range backends {
+		for name, lookup := range lookups {
+			t.Run(backend+"/"+name, func(t *testing.T) {
+				c := newCached(newStore(t))
+				// Cache the mappings, then drop the entries so that the next
+				// lookup reads the rows
+				warm(t, ctx, c, lookup)
+				repair(c, 0, 100)
+
+				c.db.afterRead = func() {
+					c.db.afterRead = nil
+					repair(c, 7, 7)
+				}
+				stale, err := lookup(ctx, c)
+				if err != nil {
+					t.Fatalf("lookup: %v", err)
+				}
+
+				fresh, err := lookup(ctx, c)
+				if err != nil {
+					t.Fatalf("lookup: %v", err)
+				}
+				if fresh == stale {
+					t.Errorf("lookup after the change = %+v, want the changed row", fresh)
+				}
+			})
+		}
+	}
+}
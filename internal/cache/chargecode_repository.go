@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+)
+
+// ChargeCodeRepository caches the charge code lookups of a
+// usecase.ChargeCodeRepository. Lists are not cached.
+type ChargeCodeRepository struct {
+	usecase.ChargeCodeRepository
+	cache *Cache
+}
+
+func NewChargeCodeRepository(repo usecase.ChargeCodeRepository, cache *Cache) *ChargeCodeRepository {
+	return &ChargeCodeRepository{ChargeCodeRepository: repo, cache: cache}
+}
+
+func (r *ChargeCodeRepository) GetChargeCodeByID(ctx context.Context, id int) (*usecase.ChargeCode, error) {
+	var chargeCode usecase.ChargeCode
+	generation := r.cache.generation(ctx, chargeCodeKey(id))
+	if r.cache.get(ctx, chargeCodeKey(id), generation, &chargeCode) {
+		r.cache.metrics.CacheLookup(chargeCodeCache, true)
+		return &chargeCode, nil
+	}
+	r.cache.metrics.CacheLookup(chargeCodeCache, false)
+
+	found, err := r.ChargeCodeRepository.GetChargeCodeByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, chargeCodeKey(id), found, generation, r.cache.config.ChargeCodeTTL)
+	return found, nil
+}
+
+func (r *ChargeCodeRepository) GetChargeCodeByCode(ctx context.Context, code string) (*usecase.ChargeCode, error) {
+	var (
+		id         int
+		chargeCode usecase.ChargeCode
+		generation string
+	)
+	codeGeneration := r.cache.generation(ctx, chargeCodeCodeKey(code))
+	mapped := r.cache.get(ctx, chargeCodeCodeKey(code), codeGeneration, &id)
+	if mapped {
+		generation = r.cache.generation(ctx, chargeCodeKey(id))
+		if r.cache.get(ctx, chargeCodeKey(id), generation, &chargeCode) && chargeCode.Code == code {
+			r.cache.metrics.CacheLookup(chargeCodeCache, true)
+			return &chargeCode, nil
+		}
+	}
+	r.cache.metrics.CacheLookup(chargeCodeCache, false)
+
+	found, err := r.ChargeCodeRepository.GetChargeCodeByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, chargeCodeCodeKey(code), found.ChargeCodeID, codeGeneration, r.cache.config.ChargeCodeTTL)
+	// Without the mapping the generation of the charge code was not known
+	// before the read, so the charge code is cached by the next lookup
+	if mapped && found.ChargeCodeID == id {
+		r.cache.set(ctx, chargeCodeKey(id), found, generation, r.cache.config.ChargeCodeTTL)
+	}
+	return found, nil
+}
+
+func (r *ChargeCodeRepository) SetChargeCodeStatus(ctx context.Context, id int, status string) (*usecase.ChargeCode, error) {
+	defer r.cache.invalidate(ctx, chargeCodeKey(id))
+	return r.ChargeCodeRepository.SetChargeCodeStatus(ctx, id, status)
+}
+
+func (r *ChargeCodeRepository) UpdateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+	defer r.cache.invalidate(ctx, chargeCodeKey(chargeCode.ChargeCodeID))
+	return r.ChargeCodeRepository.UpdateChargeCode(ctx, chargeCode)
+}
+
+func (r *ChargeCodeRepository) PatchChargeCode(ctx context.Context, id int, version int, patch *usecase.ChargeCodePatch) (*usecase.ChargeCode, error) {
+	defer r.cache.invalidate(ctx, chargeCodeKey(id))
+	return r.ChargeCodeRepository.PatchChargeCode(ctx, id, version, patch)
+}
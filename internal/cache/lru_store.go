@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+type lruEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRUStore keeps up to a fixed number of entries in process memory and
+// evicts the least recently used one when it is full. Invalidations only
+// reach the instance that made them.
+type LRUStore struct {
+	entries *lru.Cache[string, lruEntry]
+	now     func() time.Time
+}
+
+func NewLRUStore(size int) (*LRUStore, error) {
+	entries, err := lru.New[string, lruEntry](size)
+	if err != nil {
+		return nil, err
+	}
+	return &LRUStore{entries: entries, now: time.Now}, nil
+}
+
+func (s *LRUStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	entry, ok := s.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !s.now().Before(entry.expiresAt) {
+		s.entries.Remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (s *LRUStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.entries.Add(key, lruEntry{value: value, expiresAt: s.now().Add(ttl)})
+	return nil
+}
+
+func (s *LRUStore) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		s.entries.Remove(key)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones that have not
+// been read since.
+func (s *LRUStore) Len() int {
+	return s.entries.Len()
+}
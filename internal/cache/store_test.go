@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testStore is a store whose clock a test can move forward.
+type testStore struct {
+	Store
+	advance func(d time.Duration)
+}
+
+func newTestLRUStore(t *testing.T, size int) testStore {
+	store, err := NewLRUStore(size)
+	if err != nil {
+		t.Fatalf("NewLRUStore: %v", err)
+	}
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	return testStore{Store: store, advance: func(d time.Duration) { now = now.Add(d) }}
+}
+
+// newTestRedisStore returns a store in an in-memory Redis.
+func newTestRedisStore(t *testing.T) (testStore, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), redisKeyPrefix)
+	t.Cleanup(func() { store.Close() })
+	return testStore{Store: store, advance: server.FastForward}, server
+}
+
+// backends create an empty store of every backend.
+var backends = map[string]func(t *testing.T) testStore{
+	"lru": func(t *testing.T) testStore { return newTestLRUStore(t, 100) },
+	"redis": func(t *testing.T) testStore {
+		store, _ := newTestRedisStore(t)
+		return store
+	},
+}
+
+func TestStores(t *testing.T) {
+	ctx := context.Background()
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if _, ok, err := store.Get(ctx, "a"); ok || err != nil {
+				t.Fatalf("Get of a missing key = %v, %v, want a miss", ok, err)
+			}
+
+			if err := store.Set(ctx, "a", []byte("1"), time.Minute); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if err := store.Set(ctx, "b", []byte("2"), time.Hour); err != nil {
+				t.Fatalf("Set: %v", err)
+			}
+			if value, ok, err := store.Get(ctx, "a"); !ok || err != nil || string(value) != "1" {
+				t.Fatalf("Get = %q, %v, %v, want 1", value, ok, err)
+			}
+
+			store.advance(time.Minute)
+			if _, ok, err := store.Get(ctx, "a"); ok || err != nil {
+				t.Errorf("Get after the TTL = %v, %v, want a miss", ok, err)
+			}
+			if _, ok, _ := store.Get(ctx, "b"); !ok {
+				t.Errorf("Get of a key with a longer TTL missed")
+			}
+
+			if err := store.Delete(ctx, "b", "c"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if _, ok, _ := store.Get(ctx, "b"); ok {
+				t.Errorf("Get after Delete hit")
+			}
+		})
+	}
+}
+
+func TestLRUStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLRUStore(t, 2)
+	store.Set(ctx, "a", []byte("1"), time.Hour)
+	store.Set(ctx, "b", []byte("2"), time.Hour)
+	store.Get(ctx, "a")
+	store.Set(ctx, "c", []byte("3"), time.Hour)
+
+	if n := store.Store.(*LRUStore).Len(); n != 2 {
+		t.Errorf("Len = %d, want the size of 2", n)
+	}
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok, _ := store.Get(ctx, key); ok != want {
+			t.Errorf("Get(%s) hit = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+func TestRedisStorePrefixesKeys(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisStore(t)
+	if err := store.Set(ctx, "user:1", []byte("1"), time.Hour); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !server.Exists(redisKeyPrefix + "user:1") {
+		t.Errorf("keys = %v, want %s", server.Keys(), redisKeyPrefix+"user:1")
+	}
+	if ttl := server.TTL(redisKeyPrefix + "user:1"); ttl != time.Hour {
+		t.Errorf("TTL = %v, want 1h", ttl)
+	}
+}
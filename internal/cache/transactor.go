@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+)
+
+// Transactor wraps a usecase.Transactor and drops the cached charge codes
+// and users a transaction changed once it has finished. Reads inside a
+// transaction are not cached, so they see its own changes and its locks.
+type Transactor struct {
+	transactor usecase.Transactor
+	cache      *Cache
+}
+
+func NewTransactor(transactor usecase.Transactor, cache *Cache) *Transactor {
+	return &Transactor{transactor: transactor, cache: cache}
+}
+
+// invalidations collects the keys changed by one transaction.
+type invalidations struct {
+	keys []string
+}
+
+func (i *invalidations) add(err error, keys ...string) {
+	if err == nil {
+		i.keys = append(i.keys, keys...)
+	}
+}
+
+func (t *Transactor) WithinTransaction(ctx context.Context, fn func(repos *usecase.Repositories) error) error {
+	changed := &invalidations{}
+	err := t.transactor.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		wrapped := *repos
+		wrapped.Users = &txUserRepository{UserRepository: repos.Users, changed: changed}
+		wrapped.ChargeCodes = &txChargeCodeRepository{ChargeCodeRepository: repos.ChargeCodes, changed: changed}
+		wrapped.Transactions = &txTransactionRepository{TransactionRepository: repos.Transactions, changed: changed}
+		wrapped.Reconciliation = &txReconciliationRepository{ReconciliationRepository: repos.Reconciliation, changed: changed}
+		return fn(&wrapped)
+	})
+	// A failed commit may still have been applied, so the keys are dropped
+	// whatever the outcome
+	t.cache.invalidate(ctx, changed.keys...)
+	return err
+}
+
+type txUserRepository struct {
+	usecase.UserRepository
+	changed *invalidations
+}
+
+func (r *txUserRepository) UpdateUser(ctx context.Context, user *usecase.User) (*usecase.User, error) {
+	updated, err := r.UserRepository.UpdateUser(ctx, user)
+	r.changed.add(err, userKey(user.ID))
+	return updated, err
+}
+
+func (r *txUserRepository) PatchUser(ctx context.Context, id int, version int, patch *usecase.UserPatch) (*usecase.User, error) {
+	patched, err := r.UserRepository.PatchUser(ctx, id, version, patch)
+	r.changed.add(err, userKey(id))
+	return patched, err
+}
+
+type txChargeCodeRepository struct {
+	usecase.ChargeCodeRepository
+	changed *invalidations
+}
+
+func (r *txChargeCodeRepository) SetChargeCodeStatus(ctx context.Context, id int, status string) (*usecase.ChargeCode, error) {
+	updated, err := r.ChargeCodeRepository.SetChargeCodeStatus(ctx, id, status)
+	r.changed.add(err, chargeCodeKey(id))
+	return updated, err
+}
+
+func (r *txChargeCodeRepository) UpdateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+	updated, err := r.ChargeCodeRepository.UpdateChargeCode(ctx, chargeCode)
+	r.changed.add(err, chargeCodeKey(chargeCode.ChargeCodeID))
+	return updated, err
+}
+
+func (r *txChargeCodeRepository) PatchChargeCode(ctx context.Context, id int, version int, patch *usecase.ChargeCodePatch) (*usecase.ChargeCode, error) {
+	patched, err := r.ChargeCodeRepository.PatchChargeCode(ctx, id, version, patch)
+	r.changed.add(err, chargeCodeKey(id))
+	return patched, err
+}
+
+// txTransactionRepository drops the users whose balance a transaction
+// changed and the charge codes that were redeemed. The user is only known
+// by phone number here, so its phone number mapping is dropped, which makes
+// the next lookup reload it.
+type txTransactionRepository struct {
+	usecase.TransactionRepository
+	changed *invalidations
+}
+
+func (r *txTransactionRepository) CreateTransaction(ctx context.Context, transaction *usecase.Transaction) (*usecase.Transaction, error) {
+	created, err := r.TransactionRepository.CreateTransaction(ctx, transaction)
+	r.changed.add(err, userPhoneKey(transaction.PhoneNumber))
+	return created, err
+}
+
+func (r *txTransactionRepository) CreateChargeTransaction(ctx context.Context, chargeCodeTransaction *usecase.ChargeCodeTransaction) (*usecase.ChargeCodeTransaction, error) {
+	created, err := r.TransactionRepository.CreateChargeTransaction(ctx, chargeCodeTransaction)
+	r.changed.add(err, userPhoneKey(chargeCodeTransaction.PhoneNumber), chargeCodeKey(chargeCodeTransaction.ChargeCodeID))
+	return created, err
+}
+
+type txReconciliationRepository struct {
+	usecase.ReconciliationRepository
+	changed *invalidations
+}
+
+func (r *txReconciliationRepository) SetBalance(ctx context.Context, userID int, balance float64) error {
+	err := r.ReconciliationRepository.SetBalance(ctx, userID, balance)
+	r.changed.add(err, userKey(userID))
+	return err
+}
+
+func (r *txReconciliationRepository) SetChargeCodeUses(ctx context.Context, chargeCodeID int, uses int) error {
+	err := r.ReconciliationRepository.SetChargeCodeUses(ctx, chargeCodeID, uses)
+	r.changed.add(err, chargeCodeKey(chargeCodeID))
+	return err
+}
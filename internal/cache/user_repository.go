@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+)
+
+// UserRepository caches the phone number lookups of a
+// usecase.UserRepository. Lookups by id are not cached.
+type UserRepository struct {
+	usecase.UserRepository
+	cache *Cache
+}
+
+func NewUserRepository(repo usecase.UserRepository, cache *Cache) *UserRepository {
+	return &UserRepository{UserRepository: repo, cache: cache}
+}
+
+func (r *UserRepository) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*usecase.User, error) {
+	// The user entry is read in the generations of both keys, as a
+	// transaction only knows the phone number of the users it changes
+	var (
+		id             int
+		user           usecase.User
+		userGeneration string
+	)
+	phoneGeneration := r.cache.generation(ctx, userPhoneKey(phoneNumber))
+	mapped := r.cache.get(ctx, userPhoneKey(phoneNumber), phoneGeneration, &id)
+	if mapped {
+		userGeneration = r.cache.generation(ctx, userKey(id))
+		if userGeneration != "" {
+			userGeneration = phoneGeneration + "/" + userGeneration
+		}
+		if r.cache.get(ctx, userKey(id), userGeneration, &user) && user.PhoneNumber == phoneNumber {
+			r.cache.metrics.CacheLookup(userCache, true)
+			return &user, nil
+		}
+	}
+	r.cache.metrics.CacheLookup(userCache, false)
+
+	found, err := r.UserRepository.GetUserByPhoneNumber(ctx, phoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.set(ctx, userPhoneKey(phoneNumber), found.ID, phoneGeneration, r.cache.config.UserTTL)
+	// Without the mapping the generation of the user was not known before
+	// the read, so the user is cached by the next lookup
+	if mapped && found.ID == id {
+		r.cache.set(ctx, userKey(id), found, userGeneration, r.cache.config.UserTTL)
+	}
+	return found, nil
+}
+
+func (r *UserRepository) UpdateUser(ctx context.Context, user *usecase.User) (*usecase.User, error) {
+	defer r.cache.invalidate(ctx, userKey(user.ID))
+	return r.UserRepository.UpdateUser(ctx, user)
+}
+
+func (r *UserRepository) PatchUser(ctx context.Context, id int, version int, patch *usecase.UserPatch) (*usecase.User, error) {
+	defer r.cache.invalidate(ctx, userKey(id))
+	return r.UserRepository.PatchUser(ctx, id, version, patch)
+}
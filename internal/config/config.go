@@ -3,124 +3,479 @@ package config
 
 import (
 	"errors"
-	"os"
+	"fmt"
+	"log/slog"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-type AppConfig struct {
+// Limits are the business limits. Unlike the rest of AppConfig they can be
+// changed while the server runs, see WatchLimits.
+type Limits struct {
 	MaxPage              int
 	MaxPageSize          int
-	ApplicationPort      string
-	MysqlUrl             string
 	MaxChargeCodeAmount  float64
 	MinChargeCodeAmount  float64
 	MaxTransactionAmount float64
 	MinTransactionAmount float64
+
+	// Default per-user transaction limits, zero means no limit
+	UserDailyDebitLimit         float64
+	UserDailyCreditLimit        float64
+	UserDailyTransactionLimit   int
+	UserMonthlyDebitLimit       float64
+	UserMonthlyCreditLimit      float64
+	UserMonthlyTransactionLimit int
 }
 
-func LoadConfig() (*AppConfig, error) {
-	maxPageStr := os.Getenv("MAX_PAGE")
-	if maxPageStr == "" {
-		return nil, errors.New("MAX_PAGE environment variable is not set")
-	}
+// FraudRuleConfig is the action, allow, review or deny, and the score a fraud
+// rule returns when it matches.
+type FraudRuleConfig struct {
+	Action string
+	Score  int
+}
 
-	maxPageSizeStr := os.Getenv("MAX_PAGE_SIZE")
-	if maxPageSizeStr == "" {
-		return nil, errors.New("MAX_PAGE_SIZE environment variable is not set")
-	}
+type AppConfig struct {
+	ApplicationPort string
+	// GRPCPort serves the gRPC API next to the REST API on ApplicationPort
+	GRPCPort string
+	MysqlUrl string
+
+	// ConfigFile is the YAML or TOML file the configuration was read from,
+	// empty when it came only from environment variables
+	ConfigFile string
+
+	// limits is swapped as a whole on reload, see Limits and SetLimits
+	limits atomic.Pointer[Limits]
+
+	// DBTimeout bounds the database work of a single request
+	DBTimeout time.Duration
+
+	// HTTP server limits. ShutdownTimeout bounds how long in-flight requests
+	// and background workers are given to finish on SIGINT or SIGTERM.
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+	HTTPMaxBodyBytes      int64
+	ShutdownTimeout       time.Duration
+
+	// Transaction imports have their own body limit and timeout
+	ImportMaxBodyBytes int64
+	ImportMaxRows      int
+	ImportTimeout      time.Duration
 
-	applicationPortStr := os.Getenv("APPLICATION_PORT")
-	if applicationPortStr == "" {
-		return nil, errors.New("APPLICATION_PORT environment variable is not set")
+	// Readiness checks. HealthCacheTTL is how long a readiness report is
+	// reused; a worker is unhealthy after HealthWorkerStaleAfter without a
+	// successful round.
+	HealthCacheTTL         time.Duration
+	HealthWorkerStaleAfter time.Duration
+
+	// LogLevel is the lowest level that is logged
+	LogLevel slog.Level
+
+	// Tracing. TracingExporter is none, stdout, file or otlp.
+	TracingExporter    string
+	TracingServiceName string
+	TracingFilePath    string
+	TracingSampleRatio float64
+
+	// TrustedProxies lists the proxy addresses allowed to set X-Forwarded-For.
+	// When empty the client IP is always taken from the TCP connection.
+	TrustedProxies []string
+
+	// Charge code redemption brute-force protection
+	RedemptionRateLimitStore     string
+	RedemptionPhoneRatePerMinute float64
+	RedemptionPhoneBurst         int
+	RedemptionIPRatePerMinute    float64
+	RedemptionIPBurst            int
+	RedemptionMaxFailures        int
+	RedemptionFailureWindow      time.Duration
+	RedemptionLockoutDuration    time.Duration
+
+	// Fraud rules. A rule with a zero threshold is disabled. A decision is
+	// escalated to review or deny when the scores of the matching rules add
+	// up to FraudReviewScore or FraudDenyScore.
+	FraudReviewScore             int
+	FraudDenyScore               int
+	FraudVelocityMaxTransactions int
+	FraudVelocityWindow          time.Duration
+	FraudVelocity                FraudRuleConfig
+	FraudAmountThreshold         float64
+	FraudAmount                  FraudRuleConfig
+	FraudNewAccountMaxAge        time.Duration
+	FraudNewAccountMinDebit      float64
+	FraudNewAccount              FraudRuleConfig
+	FraudIPFanOutMaxPhoneNumbers int
+	FraudIPFanOutWindow          time.Duration
+	FraudIPFanOut                FraudRuleConfig
+	FraudCreditDrainRatio        float64
+	FraudCreditDrainWindow       time.Duration
+	FraudCreditDrain             FraudRuleConfig
+
+	// Webhook delivery
+	WebhookMaxAttempts  int
+	WebhookBackoffBase  time.Duration
+	WebhookBackoffMax   time.Duration
+	WebhookTimeout      time.Duration
+	WebhookPollInterval time.Duration
+
+	// Outbox relay. OutboxPublishers lists the sinks events are published to:
+	// webhook, stream, ndjson and memory.
+	OutboxPublishers   []string
+	OutboxNDJSONPath   string
+	OutboxPollInterval time.Duration
+	OutboxBatchSize    int
+	OutboxMaxAttempts  int
+
+	// Server-Sent Events stream. EventStreamBufferSize events are kept for
+	// clients that resume; a client is disconnected once
+	// EventStreamClientBufferSize events are waiting for it.
+	EventStreamBufferSize        int
+	EventStreamClientBufferSize  int
+	EventStreamMaxClients        int
+	EventStreamHeartbeatInterval time.Duration
+	EventStreamWriteTimeout      time.Duration
+
+	// Reconciliation of balances and charge code uses, once a day at
+	// ReconciliationTime after midnight UTC. Scheduled runs only report
+	// discrepancies unless ReconciliationAutoRepair is set.
+	ReconciliationEnabled    bool
+	ReconciliationTime       time.Duration
+	ReconciliationAutoRepair bool
+
+	// Read-through cache of charge code and user lookups. CacheBackend is
+	// lru, redis or none; CacheSize only bounds the lru backend.
+	CacheBackend       string
+	CacheSize          int
+	CacheChargeCodeTTL time.Duration
+	CacheUserTTL       time.Duration
+	RedisURL           string
+}
+
+// Limits returns the current business limits. The result must not be
+// modified; use SetLimits to change them.
+func (c *AppConfig) Limits() *Limits {
+	if limits := c.limits.Load(); limits != nil {
+		return limits
 	}
+	return &Limits{}
+}
+
+// SetLimits replaces the business limits.
+func (c *AppConfig) SetLimits(limits *Limits) {
+	c.limits.Store(limits)
+}
 
-	mysqlURL := os.Getenv("MYSQL_URL")
-	if mysqlURL == "" {
-		return nil, errors.New("MYSQL_URL environment variable is not set")
+// LoadConfig reads the configuration from the file named by the CONFIG_FILE
+// environment variable, if set, and from environment variables, which take
+// precedence over the file. Every invalid or missing setting is reported in
+// the returned error, not just the first one.
+func LoadConfig() (*AppConfig, error) {
+	values, configFile, err := readSources()
+	if err != nil {
+		return nil, err
 	}
+	l := &loader{values: values}
+
+	limits := &Limits{
+		MaxPage:              l.requiredInt("MAX_PAGE"),
+		MaxPageSize:          l.requiredInt("MAX_PAGE_SIZE"),
+		MaxChargeCodeAmount:  l.requiredFloat("MAX_CHARGE_CODE_AMOUNT"),
+		MinChargeCodeAmount:  l.requiredFloat("MIN_CHARGE_CODE_AMOUNT"),
+		MaxTransactionAmount: l.requiredFloat("MAX_TRANSACTION_AMOUNT"),
+		MinTransactionAmount: l.requiredFloat("MIN_TRANSACTION_AMOUNT"),
 
-	maxChargeCodeAmountStr := os.Getenv("MAX_CHARGE_CODE_AMOUNT")
-	if maxChargeCodeAmountStr == "" {
-		return nil, errors.New("MAX_CHARGE_CODE_AMOUNT environment variable is not set")
+		UserDailyDebitLimit:         l.float("USER_DAILY_DEBIT_LIMIT", 0),
+		UserDailyCreditLimit:        l.float("USER_DAILY_CREDIT_LIMIT", 0),
+		UserDailyTransactionLimit:   l.int("USER_DAILY_TRANSACTION_LIMIT", 0),
+		UserMonthlyDebitLimit:       l.float("USER_MONTHLY_DEBIT_LIMIT", 0),
+		UserMonthlyCreditLimit:      l.float("USER_MONTHLY_CREDIT_LIMIT", 0),
+		UserMonthlyTransactionLimit: l.int("USER_MONTHLY_TRANSACTION_LIMIT", 0),
 	}
 
-	minChargeCodeAmountStr := os.Getenv("MIN_CHARGE_CODE_AMOUNT")
-	if maxChargeCodeAmountStr == "" {
-		return nil, errors.New("MIN_CHARGE_CODE_AMOUNT environment variable is not set")
+	l.check(!l.has("MAX_PAGE") || limits.MaxPage > 0, "MAX_PAGE most bigger than zero")
+	l.check(!l.has("MAX_PAGE_SIZE") || limits.MaxPageSize > 0, "MAX_PAGE_SIZE most bigger than zero")
+	l.check(!l.has("MAX_CHARGE_CODE_AMOUNT") || limits.MaxChargeCodeAmount > 0, "MAX_CHARGE_CODE_AMOUNT most bigger than zero")
+	l.check(!l.has("MIN_CHARGE_CODE_AMOUNT") || limits.MinChargeCodeAmount > 0, "MIN_CHARGE_CODE_AMOUNT most bigger than zero")
+	l.check(!l.has("MIN_CHARGE_CODE_AMOUNT") || !l.has("MAX_CHARGE_CODE_AMOUNT") || limits.MinChargeCodeAmount <= limits.MaxChargeCodeAmount,
+		"MIN_CHARGE_CODE_AMOUNT most not be bigger than MAX_CHARGE_CODE_AMOUNT")
+	l.check(!l.has("MIN_TRANSACTION_AMOUNT") || !l.has("MAX_TRANSACTION_AMOUNT") || limits.MinTransactionAmount <= limits.MaxTransactionAmount,
+		"MIN_TRANSACTION_AMOUNT most not be bigger than MAX_TRANSACTION_AMOUNT")
+	l.check(limits.UserDailyDebitLimit >= 0 && limits.UserDailyCreditLimit >= 0 && limits.UserDailyTransactionLimit >= 0 &&
+		limits.UserMonthlyDebitLimit >= 0 && limits.UserMonthlyCreditLimit >= 0 && limits.UserMonthlyTransactionLimit >= 0,
+		"USER_*_LIMIT settings most not be negative")
+
+	appConfig := &AppConfig{
+		ApplicationPort: l.requiredString("APPLICATION_PORT"),
+		GRPCPort:        l.string("GRPC_PORT", "4239"),
+		MysqlUrl:        l.requiredString("MYSQL_URL"),
+		ConfigFile:      configFile,
+
+		DBTimeout: l.duration("DB_TIMEOUT", 5*time.Second),
+
+		HTTPReadTimeout:       l.duration("HTTP_READ_TIMEOUT", 15*time.Second),
+		HTTPReadHeaderTimeout: l.duration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		HTTPWriteTimeout:      l.duration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		HTTPIdleTimeout:       l.duration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		HTTPMaxHeaderBytes:    l.int("HTTP_MAX_HEADER_BYTES", 1<<20),
+		HTTPMaxBodyBytes:      int64(l.int("HTTP_MAX_BODY_BYTES", 1<<20)),
+		ShutdownTimeout:       l.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		ImportMaxBodyBytes: int64(l.int("IMPORT_MAX_BODY_BYTES", 32<<20)),
+		ImportMaxRows:      l.int("IMPORT_MAX_ROWS", 10000),
+		ImportTimeout:      l.duration("IMPORT_TIMEOUT", 2*time.Minute),
+
+		HealthCacheTTL:         l.duration("HEALTH_CACHE_TTL", 2*time.Second),
+		HealthWorkerStaleAfter: l.duration("HEALTH_WORKER_STALE_AFTER", 10*time.Minute),
+
+		TracingExporter:    l.string("TRACING_EXPORTER", "none"),
+		TracingServiceName: l.string("TRACING_SERVICE_NAME", "usermanager"),
+		TracingFilePath:    l.string("TRACING_FILE_PATH", "traces.json"),
+		TracingSampleRatio: l.float("TRACING_SAMPLE_RATIO", 1),
+
+		TrustedProxies: l.list("TRUSTED_PROXIES", ""),
+
+		RedemptionRateLimitStore:     l.string("REDEMPTION_RATE_LIMIT_STORE", "memory"),
+		RedemptionPhoneRatePerMinute: l.float("REDEMPTION_PHONE_RATE_PER_MINUTE", 5),
+		RedemptionPhoneBurst:         l.int("REDEMPTION_PHONE_BURST", 5),
+		RedemptionIPRatePerMinute:    l.float("REDEMPTION_IP_RATE_PER_MINUTE", 30),
+		RedemptionIPBurst:            l.int("REDEMPTION_IP_BURST", 30),
+		RedemptionMaxFailures:        l.int("REDEMPTION_MAX_FAILURES", 5),
+		RedemptionFailureWindow:      l.duration("REDEMPTION_FAILURE_WINDOW", 15*time.Minute),
+		RedemptionLockoutDuration:    l.duration("REDEMPTION_LOCKOUT_DURATION", 30*time.Minute),
+
+		FraudReviewScore:             l.int("FRAUD_REVIEW_SCORE", 50),
+		FraudDenyScore:               l.int("FRAUD_DENY_SCORE", 100),
+		FraudVelocityMaxTransactions: l.int("FRAUD_VELOCITY_MAX_TRANSACTIONS", 0),
+		FraudVelocityWindow:          l.duration("FRAUD_VELOCITY_WINDOW", 10*time.Minute),
+		FraudVelocity:                l.fraudRule("FRAUD_VELOCITY", "review", 40),
+		FraudAmountThreshold:         l.float("FRAUD_AMOUNT_THRESHOLD", 0),
+		FraudAmount:                  l.fraudRule("FRAUD_AMOUNT", "review", 30),
+		FraudNewAccountMaxAge:        l.duration("FRAUD_NEW_ACCOUNT_MAX_AGE", 24*time.Hour),
+		FraudNewAccountMinDebit:      l.float("FRAUD_NEW_ACCOUNT_MIN_DEBIT", 0),
+		FraudNewAccount:              l.fraudRule("FRAUD_NEW_ACCOUNT", "review", 40),
+		FraudIPFanOutMaxPhoneNumbers: l.int("FRAUD_IP_FAN_OUT_MAX_PHONE_NUMBERS", 0),
+		FraudIPFanOutWindow:          l.duration("FRAUD_IP_FAN_OUT_WINDOW", 10*time.Minute),
+		FraudIPFanOut:                l.fraudRule("FRAUD_IP_FAN_OUT", "deny", 100),
+		FraudCreditDrainRatio:        l.float("FRAUD_CREDIT_DRAIN_RATIO", 0),
+		FraudCreditDrainWindow:       l.duration("FRAUD_CREDIT_DRAIN_WINDOW", time.Hour),
+		FraudCreditDrain:             l.fraudRule("FRAUD_CREDIT_DRAIN", "review", 40),
+
+		WebhookMaxAttempts:  l.int("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookBackoffBase:  l.duration("WEBHOOK_BACKOFF_BASE", 30*time.Second),
+		WebhookBackoffMax:   l.duration("WEBHOOK_BACKOFF_MAX", time.Hour),
+		WebhookTimeout:      l.duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookPollInterval: l.duration("WEBHOOK_POLL_INTERVAL", 5*time.Second),
+
+		OutboxPublishers:   l.list("OUTBOX_PUBLISHERS", "webhook,stream"),
+		OutboxNDJSONPath:   l.string("OUTBOX_NDJSON_PATH", "events.ndjson"),
+		OutboxPollInterval: l.duration("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxBatchSize:    l.int("OUTBOX_BATCH_SIZE", 100),
+		OutboxMaxAttempts:  l.int("OUTBOX_MAX_ATTEMPTS", 10),
+
+		EventStreamBufferSize:        l.int("EVENT_STREAM_BUFFER_SIZE", 1000),
+		EventStreamClientBufferSize:  l.int("EVENT_STREAM_CLIENT_BUFFER_SIZE", 100),
+		EventStreamMaxClients:        l.int("EVENT_STREAM_MAX_CLIENTS", 1000),
+		EventStreamHeartbeatInterval: l.duration("EVENT_STREAM_HEARTBEAT_INTERVAL", 15*time.Second),
+		EventStreamWriteTimeout:      l.duration("EVENT_STREAM_WRITE_TIMEOUT", 10*time.Second),
+
+		ReconciliationEnabled:    l.bool("RECONCILIATION_ENABLED", true),
+		ReconciliationTime:       l.timeOfDay("RECONCILIATION_TIME", 3*time.Hour),
+		ReconciliationAutoRepair: l.bool("RECONCILIATION_AUTO_REPAIR", false),
+
+		CacheBackend:       l.string("CACHE_BACKEND", "lru"),
+		CacheSize:          l.int("CACHE_SIZE", 10000),
+		CacheChargeCodeTTL: l.duration("CACHE_CHARGE_CODE_TTL", time.Minute),
+		CacheUserTTL:       l.duration("CACHE_USER_TTL", 30*time.Second),
+		RedisURL:           l.string("REDIS_URL", "redis://localhost:6379/0"),
 	}
+	appConfig.SetLimits(limits)
 
-	maxTransactionAmountStr := os.Getenv("MAX_TRANSACTION_AMOUNT")
-	if maxTransactionAmountStr == "" {
-		return nil, errors.New("MAX_TRANSACTION_AMOUNT environment variable is not set")
+	if err := appConfig.LogLevel.UnmarshalText([]byte(l.string("LOG_LEVEL", "info"))); err != nil {
+		l.check(false, "LOG_LEVEL most be debug, info, warn or error")
 	}
 
-	minTransactionAmountStr := os.Getenv("MIN_TRANSACTION_AMOUNT")
-	if minTransactionAmountStr == "" {
-		return nil, errors.New("MIN_TRANSACTION_AMOUNT environment variable is not set")
+	l.check(appConfig.HTTPMaxHeaderBytes > 0, "HTTP_MAX_HEADER_BYTES most bigger than zero")
+	l.check(appConfig.HTTPMaxBodyBytes > 0, "HTTP_MAX_BODY_BYTES most bigger than zero")
+	l.check(appConfig.ImportMaxBodyBytes > 0, "IMPORT_MAX_BODY_BYTES most bigger than zero")
+	l.check(appConfig.ImportMaxRows > 0, "IMPORT_MAX_ROWS most bigger than zero")
+	l.check(appConfig.ImportTimeout > 0, "IMPORT_TIMEOUT most bigger than zero")
+
+	switch appConfig.TracingExporter {
+	case "none", "stdout", "file", "otlp":
+	default:
+		l.check(false, "TRACING_EXPORTER most be none, stdout, file or otlp")
 	}
+	l.check(appConfig.TracingSampleRatio >= 0 && appConfig.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO most be between 0 and 1")
 
-	// Convert environment variables to their respective types
-	maxPage, err := strconv.Atoi(maxPageStr)
-	if err != nil {
-		return nil, err
+	l.check(appConfig.RedemptionRateLimitStore == "memory" || appConfig.RedemptionRateLimitStore == "mysql", "REDEMPTION_RATE_LIMIT_STORE most be memory or mysql")
+	l.check(appConfig.RedemptionPhoneRatePerMinute > 0 && appConfig.RedemptionIPRatePerMinute > 0 && appConfig.RedemptionPhoneBurst > 0 && appConfig.RedemptionIPBurst > 0,
+		"redemption rate limits most bigger than zero")
+	l.check(appConfig.RedemptionMaxFailures > 0, "REDEMPTION_MAX_FAILURES most bigger than zero")
+
+	l.check(appConfig.FraudReviewScore >= 0 && appConfig.FraudDenyScore >= 0, "FRAUD_REVIEW_SCORE and FRAUD_DENY_SCORE most not be negative")
+	l.check(appConfig.FraudVelocityMaxTransactions >= 0 && appConfig.FraudAmountThreshold >= 0 && appConfig.FraudNewAccountMinDebit >= 0 &&
+		appConfig.FraudIPFanOutMaxPhoneNumbers >= 0 && appConfig.FraudCreditDrainRatio >= 0,
+		"fraud rule thresholds most not be negative")
+
+	l.check(appConfig.WebhookMaxAttempts > 0, "WEBHOOK_MAX_ATTEMPTS most bigger than zero")
+
+	for _, publisher := range appConfig.OutboxPublishers {
+		switch publisher {
+		case "webhook", "stream", "ndjson", "memory":
+		default:
+			l.check(false, fmt.Sprintf("unknown OUTBOX_PUBLISHERS entry %q", publisher))
+		}
 	}
+	l.check(appConfig.OutboxBatchSize > 0, "OUTBOX_BATCH_SIZE most bigger than zero")
+	l.check(appConfig.OutboxMaxAttempts > 0, "OUTBOX_MAX_ATTEMPTS most bigger than zero")
+	l.check(appConfig.EventStreamBufferSize >= 0, "EVENT_STREAM_BUFFER_SIZE most not be negative")
+	l.check(appConfig.EventStreamClientBufferSize > 0, "EVENT_STREAM_CLIENT_BUFFER_SIZE most bigger than zero")
+	l.check(appConfig.EventStreamMaxClients >= 0, "EVENT_STREAM_MAX_CLIENTS most not be negative")
+	l.check(appConfig.EventStreamHeartbeatInterval > 0, "EVENT_STREAM_HEARTBEAT_INTERVAL most bigger than zero")
+	l.check(appConfig.EventStreamWriteTimeout > 0, "EVENT_STREAM_WRITE_TIMEOUT most bigger than zero")
 
-	if maxPage <= 0 {
-		return nil, errors.New("maxPage most bigger than zero")
+	switch appConfig.CacheBackend {
+	case "lru", "redis", "none":
+	default:
+		l.check(false, "CACHE_BACKEND most be lru, redis or none")
 	}
+	l.check(appConfig.CacheSize > 0, "CACHE_SIZE most bigger than zero")
+	l.check(appConfig.CacheChargeCodeTTL > 0, "CACHE_CHARGE_CODE_TTL most bigger than zero")
+	l.check(appConfig.CacheUserTTL > 0, "CACHE_USER_TTL most bigger than zero")
 
-	maxPageSize, err := strconv.Atoi(maxPageSizeStr)
-	if err != nil {
+	if err := l.err(); err != nil {
 		return nil, err
 	}
+	return appConfig, nil
+}
+
+// loader reads typed settings from the merged file and environment values
+// and collects every problem instead of stopping at the first one.
+type loader struct {
+	values map[string]string
+	errs   []error
+}
+
+func (l *loader) err() error {
+	return errors.Join(l.errs...)
+}
 
-	if maxPageSize <= 0 {
-		return nil, errors.New("maxPageSize most bigger than zero")
+// check records message as a problem unless ok.
+func (l *loader) check(ok bool, message string) {
+	if !ok {
+		l.errs = append(l.errs, errors.New(message))
 	}
+}
 
-	max_charge_code_amount, err := strconv.ParseFloat(maxChargeCodeAmountStr, 64)
-	if err != nil {
-		return nil, err
+func (l *loader) has(name string) bool {
+	return l.values[name] != ""
+}
+
+// string returns an optional setting, or defaultValue when it is not set.
+func (l *loader) string(name string, defaultValue string) string {
+	if value := l.values[name]; value != "" {
+		return value
 	}
+	return defaultValue
+}
 
-	if max_charge_code_amount <= 0 {
-		return nil, errors.New("max_charge_code_amount most bigger than zero")
+func (l *loader) requiredString(name string) string {
+	value := l.values[name]
+	if value == "" {
+		l.errs = append(l.errs, fmt.Errorf("%s is not set", name))
 	}
+	return value
+}
 
-	min_charge_code_amount, err := strconv.ParseFloat(minChargeCodeAmountStr, 64)
-	if err != nil {
-		return nil, err
+// list parses an optional comma separated setting.
+func (l *loader) list(name string, defaultValue string) []string {
+	var items []string
+	for _, item := range strings.Split(l.string(name, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	if min_charge_code_amount <= 0 {
-		return nil, errors.New("min_charge_code_amount most bigger than zero")
+func (l *loader) int(name string, defaultValue int) int {
+	return parse(l, name, l.string(name, ""), defaultValue, strconv.Atoi)
+}
+
+func (l *loader) requiredInt(name string) int {
+	return parse(l, name, l.requiredString(name), 0, strconv.Atoi)
+}
+
+func (l *loader) float(name string, defaultValue float64) float64 {
+	return parse(l, name, l.string(name, ""), defaultValue, parseFloat)
+}
+
+func (l *loader) requiredFloat(name string) float64 {
+	return parse(l, name, l.requiredString(name), 0, parseFloat)
+}
+
+func (l *loader) bool(name string, defaultValue bool) bool {
+	return parse(l, name, l.string(name, ""), defaultValue, strconv.ParseBool)
+}
+
+// timeOfDay parses an optional "15:04" setting into the time after midnight.
+func (l *loader) timeOfDay(name string, defaultValue time.Duration) time.Duration {
+	return parse(l, name, l.string(name, ""), defaultValue, func(value string) (time.Duration, error) {
+		parsed, err := time.Parse("15:04", value)
+		if err != nil {
+			return 0, fmt.Errorf("most be a time such as 03:00")
+		}
+		return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+	})
+}
+
+// duration parses an optional duration setting such as "15m". Durations
+// must be positive.
+func (l *loader) duration(name string, defaultValue time.Duration) time.Duration {
+	value := l.string(name, "")
+	parsed := parse(l, name, value, defaultValue, time.ParseDuration)
+	if value != "" && parsed <= 0 {
+		l.errs = append(l.errs, fmt.Errorf("%s most bigger than zero", name))
 	}
+	return parsed
+}
 
-	max_TRANSACTION_AMOUNT, err := strconv.ParseFloat(maxTransactionAmountStr, 64)
-	if err != nil {
-		return nil, err
+// fraudRule reads the <prefix>_ACTION and <prefix>_SCORE settings of a fraud
+// rule.
+func (l *loader) fraudRule(prefix string, defaultAction string, defaultScore int) FraudRuleConfig {
+	rule := FraudRuleConfig{
+		Action: l.string(prefix+"_ACTION", defaultAction),
+		Score:  l.int(prefix+"_SCORE", defaultScore),
+	}
+	switch rule.Action {
+	case "allow", "review", "deny":
+	default:
+		l.check(false, prefix+"_ACTION most be allow, review or deny")
 	}
+	l.check(rule.Score >= 0, prefix+"_SCORE most not be negative")
+	return rule
+}
 
-	min_TRANSACTION_AMOUNT, err := strconv.ParseFloat(minTransactionAmountStr, 64)
+// parse converts value with fn. An empty value yields defaultValue and a
+// value that does not parse is recorded as a problem.
+func parse[T any](l *loader, name string, value string, defaultValue T, fn func(string) (T, error)) T {
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := fn(value)
 	if err != nil {
-		return nil, err
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return defaultValue
 	}
+	return parsed
+}
 
-	// if min_TRANSACTION_AMOUNT <= 0 {
-	// 	return nil, errors.New("min_TRANSACTION_AMOUNT most bigger than zero")
-	// }
-
-	//
-
-	//
-	return &AppConfig{
-		MaxPage:              maxPage,
-		MaxPageSize:          maxPageSize,
-		ApplicationPort:      applicationPortStr,
-		MysqlUrl:             mysqlURL,
-		MaxChargeCodeAmount:  max_charge_code_amount,
-		MinChargeCodeAmount:  min_charge_code_amount,
-		MaxTransactionAmount: max_TRANSACTION_AMOUNT,
-		MinTransactionAmount: min_TRANSACTION_AMOUNT,
-	}, nil
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
 }
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// requiredSettings is the smallest valid configuration.
+var requiredSettings = map[string]string{
+	"APPLICATION_PORT":       "4238",
+	"MYSQL_URL":              "root@tcp(127.0.0.1:3306)/",
+	"MAX_PAGE":               "40",
+	"MAX_PAGE_SIZE":          "30",
+	"MAX_CHARGE_CODE_AMOUNT": "1000000",
+	"MIN_CHARGE_CODE_AMOUNT": "1000",
+	"MAX_TRANSACTION_AMOUNT": "2000000",
+	"MIN_TRANSACTION_AMOUNT": "-200000",
+}
+
+// setEnv sets the required settings, overridden by settings, as environment
+// variables. An empty value unsets a setting.
+func setEnv(t *testing.T, settings map[string]string) {
+	t.Helper()
+	t.Setenv("CONFIG_FILE", "")
+	for name, value := range requiredSettings {
+		t.Setenv(name, value)
+	}
+	for name, value := range settings {
+		t.Setenv(name, value)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setEnv(t, nil)
+
+	appConfig, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	limits := appConfig.Limits()
+	if limits.MaxPage != 40 || limits.MaxPageSize != 30 || limits.MinChargeCodeAmount != 1000 || limits.MinTransactionAmount != -200000 {
+		t.Errorf("Limits = %+v, want the required settings", limits)
+	}
+	if appConfig.GRPCPort != "4239" || appConfig.DBTimeout != 5*time.Second || appConfig.OutboxMaxAttempts != 10 || appConfig.CacheBackend != "lru" {
+		t.Errorf("LoadConfig = %+v, want the defaults", appConfig)
+	}
+	if want := []string{"webhook", "stream"}; strings.Join(appConfig.OutboxPublishers, ",") != strings.Join(want, ",") {
+		t.Errorf("OutboxPublishers = %v, want %v", appConfig.OutboxPublishers, want)
+	}
+	if appConfig.ConfigFile != "" {
+		t.Errorf("ConfigFile = %q, want none", appConfig.ConfigFile)
+	}
+}
+
+func TestLoadConfigParses(t *testing.T) {
+	setEnv(t, map[string]string{
+		"DB_TIMEOUT":          "750ms",
+		"TRUSTED_PROXIES":     " 10.0.0.1, ,10.0.1.0/24 ",
+		"RECONCILIATION_TIME": "23:45",
+		"LOG_LEVEL":           "debug",
+		"FRAUD_AMOUNT_ACTION": "deny",
+		"FRAUD_AMOUNT_SCORE":  "70",
+	})
+
+	appConfig, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if appConfig.DBTimeout != 750*time.Millisecond {
+		t.Errorf("DBTimeout = %s, want 750ms", appConfig.DBTimeout)
+	}
+	if strings.Join(appConfig.TrustedProxies, ",") != "10.0.0.1,10.0.1.0/24" {
+		t.Errorf("TrustedProxies = %q, want the trimmed non-empty entries", appConfig.TrustedProxies)
+	}
+	if appConfig.ReconciliationTime != 23*time.Hour+45*time.Minute {
+		t.Errorf("ReconciliationTime = %s, want 23h45m", appConfig.ReconciliationTime)
+	}
+	if appConfig.LogLevel.String() != "DEBUG" {
+		t.Errorf("LogLevel = %s, want DEBUG", appConfig.LogLevel)
+	}
+	if appConfig.FraudAmount != (FraudRuleConfig{Action: "deny", Score: 70}) {
+		t.Errorf("FraudAmount = %+v, want deny with 70", appConfig.FraudAmount)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		errs     []string
+	}{
+		{
+			name:     "missing required setting",
+			settings: map[string]string{"MYSQL_URL": ""},
+			errs:     []string{"MYSQL_URL is not set"},
+		},
+		{
+			name:     "unparsable number",
+			settings: map[string]string{"USER_DAILY_TRANSACTION_LIMIT": "ten"},
+			errs:     []string{`USER_DAILY_TRANSACTION_LIMIT: strconv.Atoi: parsing "ten"`},
+		},
+		{
+			name:     "zero maximum",
+			settings: map[string]string{"MAX_PAGE_SIZE": "0"},
+			errs:     []string{"MAX_PAGE_SIZE most bigger than zero"},
+		},
+		{
+			name:     "minimum above maximum",
+			settings: map[string]string{"MIN_CHARGE_CODE_AMOUNT": "2000000", "MIN_TRANSACTION_AMOUNT": "3000000"},
+			errs: []string{
+				"MIN_CHARGE_CODE_AMOUNT most not be bigger than MAX_CHARGE_CODE_AMOUNT",
+				"MIN_TRANSACTION_AMOUNT most not be bigger than MAX_TRANSACTION_AMOUNT",
+			},
+		},
+		{
+			name:     "negative user limit",
+			settings: map[string]string{"USER_DAILY_DEBIT_LIMIT": "-1"},
+			errs:     []string{"USER_*_LIMIT settings most not be negative"},
+		},
+		{
+			name:     "negative duration",
+			settings: map[string]string{"DB_TIMEOUT": "-5s"},
+			errs:     []string{"DB_TIMEOUT most bigger than zero"},
+		},
+		{
+			name:     "unknown choice",
+			settings: map[string]string{"CACHE_BACKEND": "memcached", "OUTBOX_PUBLISHERS": "webhook,kafka", "FRAUD_VELOCITY_ACTION": "block"},
+			errs: []string{
+				"CACHE_BACKEND most be lru, redis or none",
+				`unknown OUTBOX_PUBLISHERS entry "kafka"`,
+				"FRAUD_VELOCITY_ACTION most be allow, review or deny",
+			},
+		},
+		{
+			name:     "out of range",
+			settings: map[string]string{"TRACING_SAMPLE_RATIO": "1.5", "OUTBOX_MAX_ATTEMPTS": "0"},
+			errs: []string{
+				"TRACING_SAMPLE_RATIO most be between 0 and 1",
+				"OUTBOX_MAX_ATTEMPTS most bigger than zero",
+			},
+		},
+		{
+			name: "every problem at once",
+			settings: map[string]string{
+				"APPLICATION_PORT":    "",
+				"MAX_PAGE":            "0",
+				"RECONCILIATION_TIME": "3am",
+				"LOG_LEVEL":           "loud",
+			},
+			errs: []string{
+				"APPLICATION_PORT is not set",
+				"MAX_PAGE most bigger than zero",
+				"RECONCILIATION_TIME: most be a time such as 03:00",
+				"LOG_LEVEL most be debug, info, warn or error",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, test.settings)
+
+			appConfig, err := LoadConfig()
+			if err == nil {
+				t.Fatalf("LoadConfig = %+v, want an error", appConfig)
+			}
+			joined, ok := err.(interface{ Unwrap() []error })
+			if !ok || len(joined.Unwrap()) != len(test.errs) {
+				t.Errorf("LoadConfig: err = %q, want %d problems", err, len(test.errs))
+			}
+			for _, message := range test.errs {
+				if !strings.Contains(err.Error(), message) {
+					t.Errorf("LoadConfig: err = %q, want it to report %q", err, message)
+				}
+			}
+		})
+	}
+}
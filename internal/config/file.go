@@ -0,0 +1,79 @@
+// internal/config/file.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// readSources merges the config file named by CONFIG_FILE with the
+// environment. File keys are the environment variable names in lower case,
+// e.g. max_page for MAX_PAGE; environment variables override them.
+func readSources() (map[string]string, string, error) {
+	values := map[string]string{}
+
+	configFile := os.Getenv("CONFIG_FILE")
+	if configFile != "" {
+		fileValues, err := readFile(configFile)
+		if err != nil {
+			return nil, "", err
+		}
+		for key, value := range fileValues {
+			values[strings.ToUpper(key)] = value
+		}
+	}
+
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if value != "" {
+			values[key] = value
+		}
+	}
+	return values, configFile, nil
+}
+
+// readFile reads a flat YAML or TOML file, chosen by extension, into strings
+// so that file and environment values are parsed the same way. Lists are
+// joined with commas.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s most be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("config file %s: %s most not be a table", path, key)
+		default:
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a config file named name in a temporary directory and
+// returns its path.
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.yaml", `
+max_page: 20
+max_page_size: 10
+trusted_proxies: [10.0.0.1, 10.0.1.0/24]
+db_timeout: 2s
+tracing_exporter:
+`},
+		{"config.toml", `
+max_page = 20
+max_page_size = 10
+trusted_proxies = ["10.0.0.1", "10.0.1.0/24"]
+db_timeout = "2s"
+`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, map[string]string{"MAX_PAGE": "", "MAX_PAGE_SIZE": "15"})
+			path := writeFile(t, test.name, test.content)
+			t.Setenv("CONFIG_FILE", path)
+
+			appConfig, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if appConfig.ConfigFile != path {
+				t.Errorf("ConfigFile = %q, want %q", appConfig.ConfigFile, path)
+			}
+			// The environment overrides the file
+			if limits := appConfig.Limits(); limits.MaxPage != 20 || limits.MaxPageSize != 15 {
+				t.Errorf("MaxPage, MaxPageSize = %d, %d, want 20 from the file and 15 from the environment", limits.MaxPage, limits.MaxPageSize)
+			}
+			if strings.Join(appConfig.TrustedProxies, ",") != "10.0.0.1,10.0.1.0/24" {
+				t.Errorf("TrustedProxies = %q, want the list from the file", appConfig.TrustedProxies)
+			}
+			if appConfig.DBTimeout.String() != "2s" || appConfig.TracingExporter != "none" {
+				t.Errorf("DBTimeout, TracingExporter = %s, %q, want 2s and the default for the empty key", appConfig.DBTimeout, appConfig.TracingExporter)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSampleFile(t *testing.T) {
+	setEnv(t, nil)
+	for name := range requiredSettings {
+		t.Setenv(name, "")
+	}
+	t.Setenv("CONFIG_FILE", filepath.Join("..", "..", "cmd", "config.sample.yaml"))
+
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("LoadConfig of the sample config: %v", err)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"config.json", `{"max_page": 20}`, "most be .yaml, .yml or .toml"},
+		{"config.yaml", "max_page: [20", "parsing config file"},
+		{"config.yaml", "limits:\n  max_page: 20\n", "limits most not be a table"},
+		{"config.toml", "[limits]\nmax_page = 20\n", "limits most not be a table"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, nil)
+			t.Setenv("CONFIG_FILE", writeFile(t, test.name, test.content))
+
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("LoadConfig: err = %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	setEnv(t, nil)
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "reading config file") {
+		t.Errorf("LoadConfig of a missing file: err = %v, want a read error", err)
+	}
+}
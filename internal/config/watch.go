@@ -0,0 +1,89 @@
+// internal/config/watch.go
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay groups the several events an editor produces when it saves a
+// file into one reload.
+const reloadDelay = 200 * time.Millisecond
+
+// WatchLimits reloads the configuration on SIGHUP and, when it was read from
+// a file, whenever that file changes, until ctx is cancelled. Only the Limits
+// are applied; the other settings need a restart. An invalid configuration is
+// logged and the current limits are kept.
+func WatchLimits(ctx context.Context, appConfig *AppConfig) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var fileEvents chan fsnotify.Event
+	if appConfig.ConfigFile != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			slog.Error("error watching config file", "error", err)
+		} else {
+			defer watcher.Close()
+			// Watch the directory: editors and config maps replace the file
+			// instead of writing to it
+			if err := watcher.Add(filepath.Dir(appConfig.ConfigFile)); err != nil {
+				slog.Error("error watching config file", "error", err, "path", appConfig.ConfigFile)
+			}
+			fileEvents = watcher.Events
+		}
+	}
+
+	reload := time.NewTimer(0)
+	if !reload.Stop() {
+		<-reload.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			reload.Reset(0)
+		case event := <-fileEvents:
+			if filepath.Clean(event.Name) == filepath.Clean(appConfig.ConfigFile) {
+				reload.Reset(reloadDelay)
+			}
+		case <-reload.C:
+			reloadLimits(appConfig)
+		}
+	}
+}
+
+func reloadLimits(appConfig *AppConfig) {
+	reloaded, err := LoadConfig()
+	if err != nil {
+		slog.Error("error reloading config, keeping the current limits", "error", err)
+		return
+	}
+
+	limits := reloaded.Limits()
+	appConfig.SetLimits(limits)
+	slog.Info("limits reloaded",
+		"max_page", limits.MaxPage,
+		"max_page_size", limits.MaxPageSize,
+		"min_charge_code_amount", limits.MinChargeCodeAmount,
+		"max_charge_code_amount", limits.MaxChargeCodeAmount,
+		"min_transaction_amount", limits.MinTransactionAmount,
+		"max_transaction_amount", limits.MaxTransactionAmount,
+		"user_daily_debit_limit", limits.UserDailyDebitLimit,
+		"user_daily_credit_limit", limits.UserDailyCreditLimit,
+		"user_daily_transaction_limit", limits.UserDailyTransactionLimit,
+		"user_monthly_debit_limit", limits.UserMonthlyDebitLimit,
+		"user_monthly_credit_limit", limits.UserMonthlyCreditLimit,
+		"user_monthly_transaction_limit", limits.UserMonthlyTransactionLimit,
+	)
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// setWatchedFile points CONFIG_FILE at a YAML file holding the limits the
+// tests change, with the other settings in the environment.
+func setWatchedFile(t *testing.T) string {
+	t.Helper()
+	setEnv(t, map[string]string{"MAX_PAGE": "", "MIN_CHARGE_CODE_AMOUNT": ""})
+	path := writeFile(t, "config.yaml", "")
+	writeLimits(t, path, 40, 1000)
+	t.Setenv("CONFIG_FILE", path)
+	return path
+}
+
+func writeLimits(t *testing.T, path string, maxPage int, minChargeCodeAmount int) {
+	t.Helper()
+	content := fmt.Sprintf("max_page: %d\nmin_charge_code_amount: %d\n", maxPage, minChargeCodeAmount)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("writing the config file: %v", err)
+	}
+}
+
+func TestReloadLimits(t *testing.T) {
+	path := setWatchedFile(t)
+	appConfig, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	before := appConfig.Limits()
+
+	tests := []struct {
+		name                string
+		maxPage             int
+		minChargeCodeAmount int
+		wantMaxPage         int
+		wantMinAmount       float64
+	}{
+		{"valid limits are applied", 50, 2000, 50, 2000},
+		{"an invalid maximum keeps the current limits", 0, 3000, 50, 2000},
+		{"a minimum above the maximum keeps the current limits", 60, 5000000, 50, 2000},
+		{"limits apply again once valid", 60, 3000, 60, 3000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeLimits(t, path, test.maxPage, test.minChargeCodeAmount)
+			reloadLimits(appConfig)
+
+			if limits := appConfig.Limits(); limits.MaxPage != test.wantMaxPage || limits.MinChargeCodeAmount != test.wantMinAmount {
+				t.Errorf("Limits = %d, %v, want %d, %v", limits.MaxPage, limits.MinChargeCodeAmount, test.wantMaxPage, test.wantMinAmount)
+			}
+		})
+	}
+
+	// Limits are swapped as a whole, so a caller holding the old ones keeps a
+	// consistent view
+	if before.MaxPage != 40 || before.MinChargeCodeAmount != 1000 {
+		t.Errorf("earlier Limits = %d, %v, want them unchanged by the reloads", before.MaxPage, before.MinChargeCodeAmount)
+	}
+	// Only the limits are reloaded
+	t.Setenv("DB_TIMEOUT", "1s")
+	reloadLimits(appConfig)
+	if appConfig.DBTimeout != 5*time.Second {
+		t.Errorf("DBTimeout = %s after a reload, want it kept until a restart", appConfig.DBTimeout)
+	}
+}
+
+func TestWatchLimitsReloadsChangedFile(t *testing.T) {
+	path := setWatchedFile(t)
+	appConfig, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchLimits(ctx, appConfig)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// The watcher starts in the background, so keep changing the file until
+	// a change is seen
+	deadline := time.Now().Add(5 * time.Second)
+	for appConfig.Limits().MaxPage != 70 {
+		if time.Now().After(deadline) {
+			t.Fatalf("MaxPage = %d, want the 70 written to the file to be reloaded", appConfig.Limits().MaxPage)
+		}
+		writeLimits(t, path, 70, 1000)
+		time.Sleep(2 * reloadDelay)
+	}
+}
@@ -2,42 +2,76 @@ package database
 
 import (
 	"chargeCode/internal/config"
+	"chargeCode/internal/tracing"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql" // Import the MySQL driver
+	"github.com/XSAM/otelsql"
+	"github.com/go-sql-driver/mysql"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+// DatabaseName is the database that holds the application tables.
+const DatabaseName = "userManager"
+
+// SchemaVersion is the version of the schema created by NewDBConnection. It is
+// recorded in the schema_version table and checked by the readiness probe, so
+// bump it whenever a table, trigger or procedure changes.
+const SchemaVersion = 10
+
 // NewDBConnection initializes a new database connection and returns it.
-func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
+func NewDBConnection(ctx context.Context, config *config.AppConfig) (*sql.DB, error) {
 
-	db, err := sql.Open("mysql", config.MysqlUrl)
+	// Create the database if it doesn't exist, using a connection without a
+	// default database
+	bootstrap, err := open(config.MysqlUrl)
+	if err != nil {
+		return nil, err
+	}
+	_, err = bootstrap.ExecContext(ctx, "CREATE DATABASE IF NOT EXISTS "+DatabaseName)
+	bootstrap.Close()
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the maximum number of open connections
-	db.SetMaxOpenConns(30)
-
-	// Create the database if it doesn't exist
-	_, err = db.Exec("CREATE DATABASE IF NOT EXISTS userManager")
+	// Every pooled connection has to use the database. A USE statement would
+	// only switch the one connection it happens to run on.
+	dsn, err := mysql.ParseDSN(config.MysqlUrl)
 	if err != nil {
-		db.Close() // Close the connection if database creation fails
 		return nil, err
 	}
+	dsn.DBName = DatabaseName
+	// Times are computed in Go and compared with CURRENT_TIMESTAMP and
+	// TIMESTAMP columns, which are read in the session time zone, so every
+	// connection sends and reads times in UTC whatever the server uses
+	dsn.Loc = time.UTC
+	if dsn.Params == nil {
+		dsn.Params = map[string]string{}
+	}
+	dsn.Params["time_zone"] = "'+00:00'"
 
-	// Switch to the newly created database
-	_, err = db.Exec("USE userManager")
+	db, err := open(dsn.FormatDSN())
 	if err != nil {
-		db.Close() // Close the connection if database switching fails
 		return nil, err
 	}
 
+	// Set the maximum number of open connections
+	db.SetMaxOpenConns(30)
+
 	// Create tables if they don't exist
 	createTableQueries := []string{
+		`CREATE TABLE IF NOT EXISTS schema_version (
+            version INT PRIMARY KEY,
+            applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
 		`CREATE TABLE IF NOT EXISTS user (
 			user_id INT PRIMARY KEY AUTO_INCREMENT,
 			phoneNumber VARCHAR(20) UNIQUE, -- Add phoneNumber column
 			balance DECIMAL(10, 2) DEFAULT 0.00,
+			version INT NOT NULL DEFAULT 1,
 			CONSTRAINT check_balance_non_negative CHECK (balance >= 0)
 		)`,
 		`CREATE TABLE IF NOT EXISTS charge_code (
@@ -45,7 +79,9 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
             code VARCHAR(255) NOT NULL UNIQUE,
             max_uses INT NOT NULL,
             current_uses INT NOT NULL DEFAULT 0,
-            amount DECIMAL(10, 2) NOT NULL CHECK (amount >= 0)
+            amount DECIMAL(10, 2) NOT NULL CHECK (amount >= 0),
+            version INT NOT NULL DEFAULT 1,
+            status VARCHAR(20) NOT NULL DEFAULT 'active'
             -- Add other charge code-related columns as needed
         )`,
 		`CREATE TABLE IF NOT EXISTS user_charge_code (
@@ -62,19 +98,171 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
             amount DECIMAL(10, 2) NOT NULL,
             timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
             FOREIGN KEY (user_id) REFERENCES user(user_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS transaction_import (
+            reference VARCHAR(255) PRIMARY KEY,
+            transaction_id INT NOT NULL,
+            imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (transaction_id) REFERENCES transaction(transaction_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS user_transaction_limit (
+            user_id INT PRIMARY KEY,
+            daily_debit DECIMAL(10, 2) NULL,
+            daily_credit DECIMAL(10, 2) NULL,
+            daily_count INT NULL,
+            monthly_debit DECIMAL(10, 2) NULL,
+            monthly_credit DECIMAL(10, 2) NULL,
+            monthly_count INT NULL,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            FOREIGN KEY (user_id) REFERENCES user(user_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS fraud_decision (
+            decision_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            kind VARCHAR(20) NOT NULL,
+            entity_id INT NULL,
+            user_id INT NOT NULL, -- no foreign key: denied redemptions roll their user back
+            phone_number VARCHAR(20) NOT NULL,
+            client_ip VARCHAR(45) NULL,
+            charge_code_id INT NULL,
+            amount DECIMAL(10, 2) NOT NULL,
+            action VARCHAR(10) NOT NULL,
+            score INT NOT NULL,
+            results JSON NOT NULL,
+            review_status VARCHAR(20) NOT NULL,
+            reviewed_by VARCHAR(255) NULL,
+            review_note TEXT NULL,
+            reviewed_at DATETIME NULL,
+            request_id VARCHAR(100) NULL,
+            created_at DATETIME NOT NULL,
+            INDEX idx_fraud_decision_review (review_status, decision_id),
+            INDEX idx_fraud_decision_ip (client_ip, kind, created_at)
+        )`,
+		`CREATE TABLE IF NOT EXISTS reconciliation_run (
+            run_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            trigger_type VARCHAR(20) NOT NULL,
+            status VARCHAR(20) NOT NULL,
+            balance_discrepancies INT NOT NULL DEFAULT 0,
+            charge_code_discrepancies INT NOT NULL DEFAULT 0,
+            repaired INT NOT NULL DEFAULT 0,
+            error TEXT NULL,
+            started_at DATETIME NOT NULL,
+            finished_at DATETIME NULL,
+            repaired_at DATETIME NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS reconciliation_discrepancy (
+            discrepancy_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            run_id BIGINT NOT NULL,
+            kind VARCHAR(30) NOT NULL,
+            entity_id INT NOT NULL,
+            recorded DECIMAL(12, 2) NOT NULL,
+            expected DECIMAL(12, 2) NOT NULL,
+            status VARCHAR(20) NOT NULL,
+            note TEXT NULL,
+            INDEX idx_reconciliation_discrepancy_run (run_id, status),
+            FOREIGN KEY (run_id) REFERENCES reconciliation_run(run_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+            bucket_key VARCHAR(100) PRIMARY KEY,
+            tokens DOUBLE NOT NULL,
+            updated_at_ms BIGINT NOT NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS redemption_attempt (
+            attempt_key VARCHAR(100) PRIMARY KEY,
+            failures INT NOT NULL DEFAULT 0,
+            total_failures INT NOT NULL DEFAULT 0,
+            window_started DATETIME NULL,
+            last_failure_at DATETIME NULL,
+            locked_until DATETIME NULL
+        )`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+            audit_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            actor VARCHAR(255) NOT NULL,
+            actor_verified BOOLEAN NOT NULL DEFAULT FALSE,
+            action VARCHAR(100) NOT NULL,
+            entity_type VARCHAR(50) NOT NULL,
+            entity_id INT NOT NULL,
+            before_data JSON NULL,
+            after_data JSON NULL,
+            request_id VARCHAR(100) NULL,
+            client_ip VARCHAR(45) NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_audit_log_entity (entity_type, entity_id),
+            INDEX idx_audit_log_actor (actor),
+            INDEX idx_audit_log_created_at (created_at)
+        )`,
+		`CREATE TABLE IF NOT EXISTS webhook_subscription (
+            subscription_id INT PRIMARY KEY AUTO_INCREMENT,
+            url VARCHAR(2048) NOT NULL,
+            secret VARCHAR(128) NOT NULL,
+            event_types VARCHAR(255) NOT NULL,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        )`,
+		`CREATE TABLE IF NOT EXISTS webhook_delivery (
+            delivery_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            subscription_id INT NOT NULL,
+            event_id VARCHAR(64) NOT NULL,
+            event_type VARCHAR(100) NOT NULL,
+            payload JSON NOT NULL,
+            status VARCHAR(20) NOT NULL DEFAULT 'pending',
+            attempts INT NOT NULL DEFAULT 0,
+            next_attempt_at DATETIME NOT NULL,
+            last_status_code INT NULL,
+            last_error TEXT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (subscription_id) REFERENCES webhook_subscription(subscription_id),
+            UNIQUE KEY uq_webhook_delivery_event (subscription_id, event_id),
+            INDEX idx_webhook_delivery_due (status, next_attempt_at)
+        )`,
+		`CREATE TABLE IF NOT EXISTS webhook_delivery_attempt (
+            attempt_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            delivery_id BIGINT NOT NULL,
+            status_code INT NULL,
+            error TEXT NULL,
+            duration_ms INT NOT NULL,
+            attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            FOREIGN KEY (delivery_id) REFERENCES webhook_delivery(delivery_id)
+        )`,
+		`CREATE TABLE IF NOT EXISTS outbox (
+            outbox_id BIGINT PRIMARY KEY AUTO_INCREMENT,
+            event_id VARCHAR(64) NOT NULL,
+            event_type VARCHAR(64) NOT NULL,
+            event_key VARCHAR(100) NOT NULL,
+            payload JSON NOT NULL,
+            occurred_at DATETIME(6) NOT NULL,
+            attempts INT NOT NULL DEFAULT 0,
+            last_error TEXT NULL,
+            status VARCHAR(20) NOT NULL DEFAULT 'pending',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
         )`,
 	}
 
 	for _, query := range createTableQueries {
-		_, err = db.Exec(query)
+		_, err = db.ExecContext(ctx, query)
 		if err != nil {
 			db.Close() // Close the connection if table creation fails
 			return nil, err
 		}
 	}
 
+	// Tables created before a column was added do not get it from CREATE
+	// TABLE IF NOT EXISTS
+	addedColumns := []struct{ table, column, definition string }{
+		{"user", "version", "INT NOT NULL DEFAULT 1"},
+		{"charge_code", "version", "INT NOT NULL DEFAULT 1"},
+		{"charge_code", "status", "VARCHAR(20) NOT NULL DEFAULT 'active'"},
+		{"outbox", "status", "VARCHAR(20) NOT NULL DEFAULT 'pending'"},
+		{"audit_log", "actor_verified", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	}
+	for _, added := range addedColumns {
+		if err = addColumn(ctx, db, added.table, added.column, added.definition); err != nil {
+			db.Close() // Close the connection if adding the column fails
+			return nil, err
+		}
+	}
+
 	// Drop the trigger if it exists (ignore errors if it doesn't exist)
-	_, err = db.Exec("DROP TRIGGER IF EXISTS update_user_balance")
+	_, err = db.ExecContext(ctx, "DROP TRIGGER IF EXISTS update_user_balance")
 
 	if err != nil {
 		db.Close() // Close the connection if trigger creation fails
@@ -82,12 +270,12 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
 	}
 
 	// Create the trigger to update user balance after inserting a transaction
-	_, err = db.Exec(`
+	_, err = db.ExecContext(ctx, `
 	  CREATE TRIGGER update_user_balance AFTER INSERT ON transaction
 	  FOR EACH ROW
 	  BEGIN
 		  UPDATE user
-		  SET balance = balance + NEW.amount
+		  SET balance = balance + NEW.amount, version = version + 1
 		  WHERE user_id = NEW.user_id;
 	  END;
   `)
@@ -96,24 +284,51 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// The audit log is append-only: reject every UPDATE and DELETE on it. The
+	// body is a compound statement, which every MySQL-compatible server
+	// parses, not only MySQL itself.
+	auditLogTriggers := map[string]string{
+		"audit_log_no_update": "BEFORE UPDATE",
+		"audit_log_no_delete": "BEFORE DELETE",
+	}
+	for name, event := range auditLogTriggers {
+		_, err = db.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name)
+		if err != nil {
+			db.Close() // Close the connection if trigger deletion fails
+			return nil, err
+		}
+
+		_, err = db.ExecContext(ctx, `
+		CREATE TRIGGER `+name+` `+event+` ON audit_log
+		FOR EACH ROW
+		BEGIN
+			SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'audit_log is append-only';
+		END
+	`)
+		if err != nil {
+			db.Close() // Close the connection if trigger creation fails
+			return nil, err
+		}
+	}
+
 	// Drop the RedeemChargeCode procedure if it exists (ignore errors if it doesn't exist)
-	_, err = db.Exec("DROP PROCEDURE IF EXISTS RedeemChargeCode")
+	_, err = db.ExecContext(ctx, "DROP PROCEDURE IF EXISTS RedeemChargeCode")
 	if err != nil {
 		db.Close() // Close the connection if procedure deletion fails
 		return nil, err
 	}
 
-	// Create the RedeemChargeCode stored procedure
-	_, err = db.Exec(`
+	// Create the RedeemChargeCode stored procedure. It does not start its own
+	// transaction: the caller runs it inside one so that the redemption and
+	// its audit log entry are committed together.
+	_, err = db.ExecContext(ctx, `
 	CREATE PROCEDURE RedeemChargeCode(IN in_user_id INT, IN in_charge_code_id INT)
 	BEGIN
 		DECLARE charge_amount DECIMAL(10, 2);
 	
-		START TRANSACTION;
-	
 		-- Update charge_code
 		UPDATE charge_code
-		SET current_uses = current_uses + 1
+		SET current_uses = current_uses + 1, version = version + 1
 		WHERE charge_code_id = in_charge_code_id;
 	
 		-- Insert into user_charge_code
@@ -128,8 +343,6 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
 		-- Insert into transaction
 		INSERT INTO transaction (user_id, amount)
 		VALUES (in_user_id, charge_amount);
-	
-		COMMIT;
 	END;
   `)
 
@@ -138,5 +351,42 @@ func NewDBConnection(config *config.AppConfig) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// Record the schema version once everything above is in place
+	_, err = db.ExecContext(ctx, "INSERT IGNORE INTO schema_version (version) VALUES (?)", SchemaVersion)
+	if err != nil {
+		db.Close() // Close the connection if recording the version fails
+		return nil, err
+	}
+
 	return db, nil
 }
+
+// addColumn adds a column to an existing table unless it already has it.
+func addColumn(ctx context.Context, db *sql.DB, table, column, definition string) error {
+	var count int
+	err := db.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM information_schema.COLUMNS
+	WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`, DatabaseName, table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, "ALTER TABLE `"+table+"` ADD COLUMN `"+column+"` "+definition)
+	return err
+}
+
+// open opens a connection pool for dsn. Every statement gets a span carrying
+// its sanitized text.
+func open(dsn string) (*sql.DB, error) {
+	return otelsql.Open("mysql", dsn,
+		otelsql.WithAttributes(semconv.DBSystemMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableQuery: true, OmitRows: true, OmitConnResetSession: true}),
+		otelsql.WithAttributesGetter(func(ctx context.Context, method otelsql.Method, query string, args []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+			return []attribute.KeyValue{tracing.StatementAttribute(query)}
+		}),
+	)
+}
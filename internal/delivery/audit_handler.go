@@ -0,0 +1,101 @@
+// internal/delivery/audit_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/logging"
+	"chargeCode/internal/usecase"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// actorFromRequest identifies the caller of a mutating request for the audit
+// log. The actor name is taken from the X-Actor header and is only verified
+// when ActorVerification found that a trusted proxy set it.
+func actorFromRequest(c *gin.Context) *usecase.Actor {
+	name := c.GetHeader("X-Actor")
+	if name == "" {
+		name = "anonymous"
+	}
+	return &usecase.Actor{
+		Name:      name,
+		Verified:  c.GetBool(actorVerifiedKey),
+		RequestID: logging.RequestID(c.Request.Context()),
+		ClientIP:  c.ClientIP(),
+	}
+}
+
+type AuditHandler struct {
+	AuditUseCase *usecase.AuditUseCase `json:"AuditUseCase"`
+}
+
+func NewAuditHandler(auditUC *usecase.AuditUseCase) *AuditHandler {
+	return &AuditHandler{AuditUseCase: auditUC}
+}
+
+// GetAuditLogs godoc
+// @Summary Get audit logs
+// @Description Get the audit log of mutating operations, newest first, with filters and pagination.
+// @Tags Audit
+// @ID get-audit-logs
+// @Produce json
+// @Param actor query string false "Actor name"
+// @Param action query string false "Action, e.g. user.update"
+// @Param entityType query string false "Entity type: user, charge_code or transaction"
+// @Param entityId query int false "Entity ID"
+// @Param requestId query string false "Request ID"
+// @Param from query string false "Only entries at or after this RFC 3339 time"
+// @Param to query string false "Only entries before this RFC 3339 time"
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.AuditLog
+// @Failure 400,404,422,500 {object} Problem
+// @Router /api/v1/audit [get]
+func (aH *AuditHandler) GetAuditLogs(c *gin.Context) {
+	filter := &usecase.AuditLogFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		EntityType: c.Query("entityType"),
+		RequestID:  c.Query("requestId"),
+	}
+
+	var err error
+	if entityID := c.Query("entityId"); entityID != "" {
+		if filter.EntityID, err = strconv.Atoi(entityID); err != nil {
+			c.Error(invalidParameter("entityId", "must be an integer"))
+			return
+		}
+	}
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.Error(invalidParameter("from", "must be an RFC 3339 time"))
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.Error(invalidParameter("to", "must be an RFC 3339 time"))
+			return
+		}
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+
+	auditLogs, err := aH.AuditUseCase.GetAuditLogs(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, auditLogs)
+}
@@ -4,6 +4,7 @@ import (
 	"chargeCode/internal/usecase"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,6 +15,16 @@ type ChargeCode struct {
 	MaxUses      int     `json:"max_uses" binding:"required"`
 	CurrentUses  int     `json:"current_uses" binding:"required"`
 	Amount       float64 `json:"amount" binding:"required"`
+	Version      int     `json:"version"`
+	Status       string  `json:"status" enums:"active,paused,archived"`
+}
+
+// ChargeCodePatch documents the fields a merge patch of a charge code can
+// set.
+type ChargeCodePatch struct {
+	Code    string  `json:"code,omitempty"`
+	MaxUses int     `json:"max_uses,omitempty"`
+	Amount  float64 `json:"amount,omitempty"`
 }
 
 type CreateChargeCodeMode struct {
@@ -40,22 +51,23 @@ func NewChargeCodeHandler(chargeCodeUC *usecase.ChargeCodeUseCase) *ChargeCodeHa
 // @Produce json
 // @Param CreateChargeCodeMode body CreateChargeCodeMode true "ChargeCode object to create"
 // @Success 200 {object} ChargeCode
+// @Failure 400,413,422,500 {object} Problem
 // @Router /api/v1/chargeCode [post]
 func (cH *ChargeCodeHandler) CreateChargeCode(c *gin.Context) {
 	var chargeCode usecase.ChargeCode
 
 	// Parse the request body into a ChargeCode struct
 	if err := c.ShouldBindJSON(&chargeCode); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	// At this point, chargeCode contains the data from the request body
 	// You can use it as needed, such as passing it to your use case for creation
 
-	_, err := cH.ChargeCodeUseCase.CreateChargeCode(&chargeCode)
+	_, err := cH.ChargeCodeUseCase.CreateChargeCode(c.Request.Context(), &chargeCode, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	//c.JSON(http.StatusOK, createdChargeCode)
@@ -68,25 +80,27 @@ func (cH *ChargeCodeHandler) CreateChargeCode(c *gin.Context) {
 // @Tags ChargeCode
 // @ID get-paginated-chargeCodes
 // @Produce json
+// @Param status query string false "Comma separated statuses: active, paused, archived. Defaults to active,paused"
 // @Param page query integer false "Page number most start from 1"
 // @Param pageSize query integer false "Number of items per page"
 // @Success 200 {object} ChargeCode
+// @Failure 400,404,422,500 {object} Problem
 // @Router /api/v1/chargeCode [get]
 func (cH *ChargeCodeHandler) GetChargeCodes(c *gin.Context) {
 	// Parse the page and pageSize query parameters with default values
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("page", "must be an integer"))
 		return
 	}
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("pageSize", "must be an integer"))
 		return
 	}
-	chargeCodes, err := cH.ChargeCodeUseCase.GetChargeCodes(page, pageSize)
+	chargeCodes, err := cH.ChargeCodeUseCase.GetChargeCodes(c.Request.Context(), statusQuery(c), page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, chargeCodes)
@@ -94,124 +108,245 @@ func (cH *ChargeCodeHandler) GetChargeCodes(c *gin.Context) {
 
 // GetChargeCodeByID godoc
 // @Summary Get chargeCode by ID
-// @Description Get a chargeCode by their unique ID.
+// @Description Get a chargeCode by their unique ID. The ETag header holds the version of the charge code, to send as If-Match when updating it.
 // @Tags ChargeCode
 // @ID get-chargeCode-by-id
 // @Produce json
 // @Param id path int true "chargeCode ID" Example: 123
+// @Param If-None-Match header string false "ETag of a version the client has"
 // @Success 200 {object} ChargeCode
+// @Success 304 "The charge code did not change"
+// @Header 200 {string} ETag "Version of the charge code"
+// @Failure 404,500 {object} Problem
 // @Router /api/v1/chargeCode/{id} [get]
 func (cH *ChargeCodeHandler) GetChargeCodeByID(c *gin.Context) {
 	chargeCodeID, _ := strconv.Atoi(c.Param("id"))
-	chargeCode, err := cH.ChargeCodeUseCase.GetChargeCodeByID(chargeCodeID)
+	chargeCode, err := cH.ChargeCodeUseCase.GetChargeCodeByID(c.Request.Context(), chargeCodeID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, chargeCode)
+	writeWithETag(c, chargeCode.Version, chargeCode)
 }
 
 // GetChargeCodeByCode godoc
 // @Summary Get chargeCode by Code
-// @Description Get a chargeCode by their unique Code.
+// @Description Get a chargeCode by their unique Code. The ETag header holds the version of the charge code, to send as If-Match when updating it.
 // @Tags ChargeCode
 // @ID get-chargeCode-by-code
 // @Produce json
 // @Param code path string true "chargeCode Code" Example: c216
+// @Param If-None-Match header string false "ETag of a version the client has"
 // @Success 200 {object} ChargeCode
+// @Success 304 "The charge code did not change"
+// @Header 200 {string} ETag "Version of the charge code"
+// @Failure 404,500 {object} Problem
 // @Router /api/v1/chargeCode/code/{code} [get]
 func (cH *ChargeCodeHandler) GetChargeCodeByCode(c *gin.Context) {
 	chargeCodeParams := c.Param("code")
-	chargeCode, err := cH.ChargeCodeUseCase.GetChargeCodeByCode(chargeCodeParams)
+	chargeCode, err := cH.ChargeCodeUseCase.GetChargeCodeByCode(c.Request.Context(), chargeCodeParams)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, chargeCode)
+	writeWithETag(c, chargeCode.Version, chargeCode)
 }
 
 // DeleteChargeCode godoc
-// @Summary Delete chargeCode by ID
-// @Description Delete a chargeCode by their unique ID.
+// @Summary Archive chargeCode by ID
+// @Description Archive a chargeCode by their unique ID. The charge code and its redemptions are kept, but it can no longer be redeemed or changed and is only listed when asked for by status. Restore it to make it active again.
 // @Tags ChargeCode
 // @ID delete-chargeCode-by-id
 // @Produce json
 // @Param id path int true "chargeCode ID" Example: 123
 // @Success 200 {object} string "OK"
+// @Failure 404,409,500 {object} Problem
 // @Router /api/v1/chargeCode/{id} [delete]
 func (cH *ChargeCodeHandler) DeleteChargeCodeByID(c *gin.Context) {
 	chargeCodeID, _ := strconv.Atoi(c.Param("id"))
-	err := cH.ChargeCodeUseCase.DeleteChargeCode(chargeCodeID)
+	_, err := cH.ChargeCodeUseCase.ArchiveChargeCode(c.Request.Context(), chargeCodeID, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, "OK")
 }
 
+// PauseChargeCode godoc
+// @Summary Pause a chargeCode
+// @Description Stop redemptions of an active chargeCode until it is restored.
+// @Tags ChargeCode
+// @ID pause-chargeCode-by-id
+// @Produce json
+// @Param id path int true "chargeCode ID" Example: 123
+// @Success 200 {object} ChargeCode
+// @Failure 400,404,409,500 {object} Problem
+// @Router /api/v1/chargeCode/{id}/pause [post]
+func (cH *ChargeCodeHandler) PauseChargeCode(c *gin.Context) {
+	chargeCodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	paused, err := cH.ChargeCodeUseCase.PauseChargeCode(c.Request.Context(), chargeCodeID, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, paused)
+}
+
+// RestoreChargeCode godoc
+// @Summary Restore a chargeCode
+// @Description Make a paused or archived chargeCode active again.
+// @Tags ChargeCode
+// @ID restore-chargeCode-by-id
+// @Produce json
+// @Param id path int true "chargeCode ID" Example: 123
+// @Success 200 {object} ChargeCode
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/chargeCode/{id}/restore [post]
+func (cH *ChargeCodeHandler) RestoreChargeCode(c *gin.Context) {
+	chargeCodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	restored, err := cH.ChargeCodeUseCase.RestoreChargeCode(c.Request.Context(), chargeCodeID, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, restored)
+}
+
 // UpdateChargeCode godoc
 // @Summary Update a chargeCode
-// @Description Update a chargeCode using the provided data.
+// @Description Update a chargeCode using the provided data. If-Match has to hold the ETag of the charge code as last read; when the charge code changed since, for example by a redemption, the update fails with 412 and the charge code has to be read again. As with PATCH, max_uses cannot go below current_uses, and current_uses is kept.
 // @Tags ChargeCode
 // @Accept json
 // @Produce json
+// @Param If-Match header string true "ETag of the charge code being updated"
 // @Param chargeCode body ChargeCode true "ChargeCode object to update"
 // @Success 200 {object} ChargeCode
+// @Header 200 {string} ETag "New version of the charge code"
+// @Failure 400,404,409,412,413,422,428,500 {object} Problem
 // @Router /api/v1/chargeCode [put]
 func (cH *ChargeCodeHandler) UpdateChargeCode(c *gin.Context) {
 	var chargeCode usecase.ChargeCode
 
 	// Parse the request body into a ChargeCode struct
 	if err := c.ShouldBindJSON(&chargeCode); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	// At this point, chargeCode contains the data from the request body
-	// You can use it as needed, such as passing it to your use case for update
+	// The version comes from If-Match rather than the body
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	chargeCode.Version = version
 
-	_, err := cH.ChargeCodeUseCase.UpdateChargeCode(&chargeCode)
+	updated, err := cH.ChargeCodeUseCase.UpdateChargeCode(c.Request.Context(), &chargeCode, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	//c.JSON(http.StatusOK, updatedChargeCode)
+	c.Header("ETag", etag(updated.Version))
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// statusQuery returns the statuses of the status query parameter.
+func statusQuery(c *gin.Context) []string {
+	if status := c.Query("status"); status != "" {
+		return strings.Split(status, ",")
+	}
+	return nil
+}
+
+// PatchChargeCode godoc
+// @Summary Partially update a chargeCode
+// @Description Change some fields of a chargeCode with a JSON merge patch (RFC 7396). Only code, max_uses and amount can be changed; max_uses cannot go below current_uses, which only redemptions change. Only the fields that differ are written. If-Match has to hold the ETag of the charge code as last read, as for PUT.
+// @Tags ChargeCode
+// @ID patch-chargeCode-by-id
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path int true "chargeCode ID" Example: 123
+// @Param If-Match header string true "ETag of the charge code being updated"
+// @Param patch body ChargeCodePatch true "Fields to change"
+// @Success 200 {object} ChargeCode
+// @Header 200 {string} ETag "New version of the charge code"
+// @Failure 400,404,409,412,413,415,422,428,500 {object} Problem
+// @Router /api/v1/chargeCode/{id} [patch]
+func (cH *ChargeCodeHandler) PatchChargeCode(c *gin.Context) {
+	chargeCodeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var patch usecase.ChargeCodePatch
+	err = readMergePatch(c, map[string]patchField{
+		"code":     stringField(&patch.Code),
+		"max_uses": intField(&patch.MaxUses),
+		"amount":   floatField(&patch.Amount),
+	}, "charge_code_id", "current_uses", "version", "status")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	patched, err := cH.ChargeCodeUseCase.PatchChargeCode(c.Request.Context(), chargeCodeID, version, &patch, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("ETag", etag(patched.Version))
+	c.JSON(http.StatusOK, patched)
+}
+
 // GetUserChargeCodes godoc
 // @Summary Get user chargeCodes with pagination
-// @Description Get a user chargeCode by their unique userId with pagination support.
+// @Description Get the chargeCodes a user redeemed with pagination support, including archived ones unless filtered by status.
 // @Tags ChargeCode
 // @ID get-chargeCode-by-userId
 // @Produce json
 // @Param userId path int true "user id" Example: 123
+// @Param status query string false "Comma separated statuses: active, paused, archived. Defaults to all"
 // @Param page query int false "Page number most start from 1" Default: 1 Example: 1
 // @Param pageSize query int false "page size" Default: 10 Example: 20
 // @Success 200 {object} ChargeCode
+// @Failure 400,404,422,500 {object} Problem
 // @Router /api/v1/chargeCode/user/{userId} [get]
 func (cH *ChargeCodeHandler) GetUserChargeCodes(c *gin.Context) {
 	userId, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		c.Error(invalidParameter("userId", "must be an integer"))
 		return
 	}
 
 	// Parse the page and pageSize query parameters with default values
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("page", "must be an integer"))
 		return
 	}
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("pageSize", "must be an integer"))
 		return
 	}
 
-	chargeCodes, err := cH.ChargeCodeUseCase.GetUserChargeCodes(userId, page, pageSize)
+	chargeCodes, err := cH.ChargeCodeUseCase.GetUserChargeCodes(c.Request.Context(), userId, statusQuery(c), page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, chargeCodes)
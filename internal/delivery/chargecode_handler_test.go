@@ -0,0 +1,210 @@
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeChargeCodes holds one charge code and is its own Transactor, so that
+// the handlers run the real usecase.
+type fakeChargeCodes struct {
+	usecase.ChargeCodeRepository
+	chargeCode usecase.ChargeCode
+	writes     int
+}
+
+func (f *fakeChargeCodes) WithinTransaction(ctx context.Context, fn func(repos *usecase.Repositories) error) error {
+	return fn(&usecase.Repositories{ChargeCodes: f, Audit: fakeAudit{}})
+}
+
+func (f *fakeChargeCodes) GetChargeCodeByID(ctx context.Context, id int) (*usecase.ChargeCode, error) {
+	if id != f.chargeCode.ChargeCodeID {
+		return nil, usecase.NotFoundError("charge code not found")
+	}
+	found := f.chargeCode
+	return &found, nil
+}
+
+func (f *fakeChargeCodes) UpdateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+	f.writes++
+	f.chargeCode.Code, f.chargeCode.MaxUses, f.chargeCode.Amount = chargeCode.Code, chargeCode.MaxUses, chargeCode.Amount
+	f.chargeCode.Version++
+	return f.GetChargeCodeByID(ctx, chargeCode.ChargeCodeID)
+}
+
+func (f *fakeChargeCodes) PatchChargeCode(ctx context.Context, id int, version int, patch *usecase.ChargeCodePatch) (*usecase.ChargeCode, error) {
+	f.writes++
+	if patch.Code != nil {
+		f.chargeCode.Code = *patch.Code
+	}
+	if patch.MaxUses != nil {
+		f.chargeCode.MaxUses = *patch.MaxUses
+	}
+	if patch.Amount != nil {
+		f.chargeCode.Amount = *patch.Amount
+	}
+	f.chargeCode.Version++
+	return f.GetChargeCodeByID(ctx, id)
+}
+
+type fakeAudit struct {
+	usecase.AuditRepository
+}
+
+func (fakeAudit) CreateAuditLog(ctx context.Context, auditLog *usecase.AuditLog) error {
+	return nil
+}
+
+// newTestChargeCodeRouter serves the charge code updates of a charge code
+// at version 1 with 12 of its 100 uses redeemed.
+func newTestChargeCodeRouter() (*gin.Engine, *fakeChargeCodes) {
+	gin.SetMode(gin.TestMode)
+	chargeCodes := &fakeChargeCodes{chargeCode: usecase.ChargeCode{ChargeCodeID: 7, Code: "c216", MaxUses: 100, CurrentUses: 12, Amount: 50,
+		Version: 1, Status: usecase.ChargeCodeActive}}
+	handler := NewChargeCodeHandler(usecase.NewChargeCodeUseCase(chargeCodes, chargeCodes))
+
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.PUT("/api/v1/chargeCode/", handler.UpdateChargeCode)
+	router.PATCH("/api/v1/chargeCode/:id", handler.PatchChargeCode)
+	return router, chargeCodes
+}
+
+type updateRequest struct {
+	name        string
+	contentType string
+	ifMatch     string
+	body        string
+	status      int
+	code        string
+	errors      []FieldError
+	etag        string
+}
+
+func (test updateRequest) run(t *testing.T, router *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(test.body))
+	req.Header.Set("Content-Type", test.contentType)
+	if test.ifMatch != "" {
+		req.Header.Set("If-Match", test.ifMatch)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != test.status {
+		t.Fatalf("status = %d with %s, want %d", recorder.Code, recorder.Body, test.status)
+	}
+	if test.code != "" {
+		var problem Problem
+		if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+			t.Fatalf("decoding the problem: %v", err)
+		}
+		if problem.Code != test.code || !reflect.DeepEqual(problem.Errors, test.errors) {
+			t.Errorf("problem = %s %+v, want %s %+v", problem.Code, problem.Errors, test.code, test.errors)
+		}
+	}
+	if etag := recorder.Header().Get("ETag"); etag != test.etag {
+		t.Errorf("ETag = %q, want %q", etag, test.etag)
+	}
+	return recorder
+}
+
+func TestUpdateChargeCodePreconditions(t *testing.T) {
+	const body = `{"charge_code_id": 7, "code": "c217", "max_uses": 200, "current_uses": 0, "amount": 60}`
+	tests := []updateRequest{
+		{name: "current version", ifMatch: `"1"`, body: body, status: http.StatusOK, etag: `"2"`},
+		{name: "weak tag", ifMatch: `W/"1"`, body: body, status: http.StatusOK, etag: `"2"`},
+		{name: "missing If-Match", body: body, status: http.StatusPreconditionRequired, code: CodePreconditionRequired},
+		{name: "stale If-Match", ifMatch: `"2"`, body: body, status: http.StatusPreconditionFailed, code: "version_mismatch"},
+		{name: "unquoted If-Match", ifMatch: `1`, body: body, status: http.StatusBadRequest, code: CodeInvalidParameter,
+			errors: []FieldError{{Field: "If-Match", Message: "must be a single ETag returned for the resource"}}},
+		{name: "If-Match of every version", ifMatch: `*`, body: body, status: http.StatusBadRequest, code: CodeInvalidParameter,
+			errors: []FieldError{{Field: "If-Match", Message: "must be a single ETag returned for the resource"}}},
+		{name: "max uses below the current uses", ifMatch: `"1"`, body: `{"charge_code_id": 7, "code": "c216", "max_uses": 11, "amount": 50}`,
+			status: http.StatusUnprocessableEntity, code: usecase.CodeValidationFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, chargeCodes := newTestChargeCodeRouter()
+			test.contentType = "application/json"
+			test.run(t, router, http.MethodPut, "/api/v1/chargeCode/")
+
+			if written := chargeCodes.writes == 1; written != (test.status == http.StatusOK) {
+				t.Errorf("%d writes, want one only for a successful update", chargeCodes.writes)
+			}
+			// The uses only change with redemptions
+			if chargeCodes.chargeCode.CurrentUses != 12 {
+				t.Errorf("current uses = %d, want 12", chargeCodes.chargeCode.CurrentUses)
+			}
+		})
+	}
+}
+
+func TestPatchChargeCode(t *testing.T) {
+	const mergePatch = mergePatchContentType
+	tests := []updateRequest{
+		{name: "patch", contentType: mergePatch, ifMatch: `"1"`, body: `{"amount": 60, "max_uses": 12}`, status: http.StatusOK, etag: `"2"`},
+		{name: "JSON content type", contentType: "application/json; charset=utf-8", ifMatch: `"1"`, body: `{"amount": 60}`, status: http.StatusOK, etag: `"2"`},
+		// Nothing changes, so the version stays
+		{name: "same values", contentType: mergePatch, ifMatch: `"1"`, body: `{"code": "c216", "amount": 50}`, status: http.StatusOK, etag: `"1"`},
+		{name: "empty patch", contentType: mergePatch, ifMatch: `"1"`, body: `{}`, status: http.StatusOK, etag: `"1"`},
+
+		{name: "missing If-Match", contentType: mergePatch, body: `{"amount": 60}`, status: http.StatusPreconditionRequired, code: CodePreconditionRequired},
+		{name: "stale If-Match", contentType: mergePatch, ifMatch: `"2"`, body: `{"amount": 60}`, status: http.StatusPreconditionFailed, code: "version_mismatch"},
+		{name: "null", contentType: mergePatch, ifMatch: `"1"`, body: `{"max_uses": null}`, status: http.StatusUnprocessableEntity,
+			code: usecase.CodeValidationFailed, errors: []FieldError{{Field: "max_uses", Message: "cannot be removed"}}},
+		{name: "read-only fields", contentType: mergePatch, ifMatch: `"1"`, body: `{"current_uses": 0, "status": "archived", "version": 5}`,
+			status: http.StatusUnprocessableEntity, code: usecase.CodeValidationFailed, errors: []FieldError{
+				{Field: "current_uses", Message: "cannot be changed"},
+				{Field: "status", Message: "cannot be changed"},
+				{Field: "version", Message: "cannot be changed"},
+			}},
+		// A read-only field set to null is still read-only
+		{name: "read-only null", contentType: mergePatch, ifMatch: `"1"`, body: `{"charge_code_id": null}`, status: http.StatusUnprocessableEntity,
+			code: usecase.CodeValidationFailed, errors: []FieldError{{Field: "charge_code_id", Message: "cannot be changed"}}},
+		{name: "unknown field", contentType: mergePatch, ifMatch: `"1"`, body: `{"amount": 60, "Amount": 70}`, status: http.StatusUnprocessableEntity,
+			code: usecase.CodeValidationFailed, errors: []FieldError{{Field: "Amount", Message: "is not a field that can be changed"}}},
+		{name: "every invalid member", contentType: mergePatch, ifMatch: `"1"`, body: `{"code": 216, "max_uses": 1.5, "amount": "60", "owner": "ops"}`,
+			status: http.StatusUnprocessableEntity, code: usecase.CodeValidationFailed, errors: []FieldError{
+				{Field: "amount", Message: "must be a number"},
+				{Field: "code", Message: "must be a string"},
+				{Field: "max_uses", Message: "must be an integer"},
+				{Field: "owner", Message: "is not a field that can be changed"},
+			}},
+		{name: "max uses below the current uses", contentType: mergePatch, ifMatch: `"1"`, body: `{"max_uses": 11}`,
+			status: http.StatusUnprocessableEntity, code: usecase.CodeValidationFailed},
+		{name: "not an object", contentType: mergePatch, ifMatch: `"1"`, body: `[{"amount": 60}]`, status: http.StatusBadRequest, code: CodeMalformedBody},
+		{name: "null patch", contentType: mergePatch, ifMatch: `"1"`, body: `null`, status: http.StatusBadRequest, code: CodeMalformedBody},
+		{name: "invalid JSON", contentType: mergePatch, ifMatch: `"1"`, body: `{"amount": `, status: http.StatusBadRequest, code: CodeMalformedBody},
+		{name: "other content type", contentType: "text/plain", ifMatch: `"1"`, body: `{"amount": 60}`, status: http.StatusUnsupportedMediaType, code: CodeUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router, chargeCodes := newTestChargeCodeRouter()
+			before := chargeCodes.chargeCode
+			recorder := test.run(t, router, http.MethodPatch, "/api/v1/chargeCode/7")
+
+			if test.status != http.StatusOK {
+				if chargeCodes.writes != 0 || chargeCodes.chargeCode != before {
+					t.Errorf("charge code = %+v after %d writes, want it unchanged", chargeCodes.chargeCode, chargeCodes.writes)
+				}
+				return
+			}
+			var patched usecase.ChargeCode
+			if err := json.Unmarshal(recorder.Body.Bytes(), &patched); err != nil {
+				t.Fatalf("decoding the charge code: %v", err)
+			}
+			if patched != chargeCodes.chargeCode {
+				t.Errorf("response = %+v, want the stored %+v", patched, chargeCodes.chargeCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// internal/delivery/errors.go
+package delivery
+
+import (
+	"chargeCode/internal/logging"
+	"chargeCode/internal/usecase"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes of the errors detected by the delivery layer. The codes of
+// domain errors are defined in the usecase package.
+const (
+	CodeInvalidParameter     = "invalid_parameter"
+	CodeMalformedBody        = "malformed_body"
+	CodeBodyTooLarge         = "body_too_large"
+	CodePreconditionRequired = "precondition_required"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeRedemptionLocked     = "redemption_locked"
+	CodeRouteNotFound        = "route_not_found"
+)
+
+const problemContentType = "application/problem+json"
+
+// problemTypePrefix makes a problem type URI from an error code.
+const problemTypePrefix = "urn:usermanager:problem:"
+
+// Problem is an RFC 7807 problem details response. Code repeats the last
+// segment of Type for clients that prefer a short identifier.
+type Problem struct {
+	Type     string       `json:"type" example:"urn:usermanager:problem:not_found"`
+	Title    string       `json:"title" example:"Not Found"`
+	Status   int          `json:"status" example:"404"`
+	Detail   string       `json:"detail,omitempty" example:"user not found"`
+	Instance string       `json:"instance,omitempty" example:"4f1c2b7e9a0d4c3e8b5a6f7e8d9c0b1a"`
+	Code     string       `json:"code" example:"not_found"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of the request body or one invalid
+// path or query parameter.
+type FieldError struct {
+	Field   string `json:"field" example:"phoneNumber"`
+	Message string `json:"message" example:"is required"`
+}
+
+// parameterError reports a path or query parameter that could not be parsed.
+type parameterError struct {
+	FieldError
+}
+
+func (e *parameterError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+func invalidParameter(name string, message string) error {
+	return &parameterError{FieldError{Field: name, Message: message}}
+}
+
+// fieldErrors reports invalid fields of a request body found by a handler
+// rather than by binding.
+type fieldErrors []FieldError
+
+func (e fieldErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Field+" "+fieldErr.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+func init() {
+	// Report binding failures with the JSON names of the fields
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// ErrorHandler writes a problem response for the error a handler added with
+// c.Error, so that every handler reports the same kind of error with the same
+// status and code. It runs innermost, so the logger and metrics see the final
+// status.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		err := c.Errors.Last().Err
+
+		var (
+			limitErr   *usecase.RedemptionLimitError
+			txLimitErr *usecase.TransactionLimitError
+		)
+		switch {
+		case errors.As(err, &limitErr):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limitErr.RetryAfter.Seconds()))))
+		case errors.As(err, &txLimitErr) && !txLimitErr.ResetsAt.IsZero():
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(time.Until(txLimitErr.ResetsAt).Seconds())))))
+		}
+
+		writeProblem(c, problemFor(err))
+	}
+}
+
+// NoRoute answers requests for unknown routes with a problem response.
+func NoRoute(c *gin.Context) {
+	writeProblem(c, &Problem{Status: http.StatusNotFound, Code: CodeRouteNotFound, Detail: "no route for " + c.Request.Method + " " + c.Request.URL.Path})
+}
+
+// abortWithProblem writes a problem response from a middleware and stops the
+// handler chain.
+func abortWithProblem(c *gin.Context, status int, code string, detail string) {
+	writeProblem(c, &Problem{Status: status, Code: code, Detail: detail})
+	c.Abort()
+}
+
+// writeProblem fills in the type, title and instance of problem and writes it.
+func writeProblem(c *gin.Context, problem *Problem) {
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Title = http.StatusText(problem.Status)
+	problem.Instance = logging.RequestID(c.Request.Context())
+
+	body, err := json.Marshal(problem)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Data(problem.Status, problemContentType, body)
+}
+
+// problemFor maps err to a problem. Domain errors keep their code and
+// message; unexpected errors are reported without details because they may
+// carry driver or system information.
+func problemFor(err error) *Problem {
+	var (
+		paramErr    *parameterError
+		fieldErrs   fieldErrors
+		validErrs   validator.ValidationErrors
+		typeErr     *json.UnmarshalTypeError
+		syntaxErr   *json.SyntaxError
+		maxBytesErr *http.MaxBytesError
+		limitErr    *usecase.RedemptionLimitError
+		txLimitErr  *usecase.TransactionLimitError
+		domainErr   *usecase.Error
+	)
+	switch {
+	case errors.As(err, &paramErr):
+		return &Problem{Status: http.StatusBadRequest, Code: CodeInvalidParameter, Detail: "invalid parameter " + paramErr.Field, Errors: []FieldError{paramErr.FieldError}}
+	case errors.As(err, &fieldErrs):
+		return &Problem{Status: http.StatusUnprocessableEntity, Code: usecase.CodeValidationFailed, Detail: "the request body is invalid", Errors: fieldErrs}
+	case errors.As(err, &validErrs):
+		problem := &Problem{Status: http.StatusUnprocessableEntity, Code: usecase.CodeValidationFailed, Detail: "the request body is invalid"}
+		for _, fieldErr := range validErrs {
+			problem.Errors = append(problem.Errors, FieldError{Field: fieldErr.Field(), Message: validationMessage(fieldErr)})
+		}
+		return problem
+	case errors.As(err, &typeErr):
+		return &Problem{Status: http.StatusBadRequest, Code: CodeMalformedBody, Detail: "the request body is not valid JSON for this operation", Errors: []FieldError{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}}
+	case errors.As(err, &maxBytesErr):
+		return &Problem{Status: http.StatusRequestEntityTooLarge, Code: CodeBodyTooLarge, Detail: "the request body is larger than " + strconv.FormatInt(maxBytesErr.Limit, 10) + " bytes"}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &Problem{Status: http.StatusBadRequest, Code: CodeMalformedBody, Detail: "the request body is not valid JSON"}
+	case errors.Is(err, errPatchNotObject):
+		return &Problem{Status: http.StatusBadRequest, Code: CodeMalformedBody, Detail: err.Error()}
+	case errors.Is(err, errUnsupportedMediaType):
+		return &Problem{Status: http.StatusUnsupportedMediaType, Code: CodeUnsupportedMediaType, Detail: err.Error()}
+	case errors.Is(err, errPreconditionRequired):
+		return &Problem{Status: http.StatusPreconditionRequired, Code: CodePreconditionRequired, Detail: err.Error()}
+	case errors.As(err, &limitErr) && limitErr.Locked:
+		return &Problem{Status: http.StatusTooManyRequests, Code: CodeRedemptionLocked, Detail: err.Error()}
+	case errors.As(err, &limitErr):
+		return &Problem{Status: http.StatusTooManyRequests, Code: CodeRateLimited, Detail: err.Error()}
+	case errors.As(err, &txLimitErr):
+		return &Problem{Status: http.StatusTooManyRequests, Code: usecase.CodeTransactionLimitExceeded, Detail: err.Error()}
+	case errors.Is(err, usecase.ErrInsufficientFunds):
+		return &Problem{Status: http.StatusUnprocessableEntity, Code: usecase.CodeInsufficientFunds, Detail: err.Error()}
+	case errors.As(err, &domainErr):
+		return &Problem{Status: errorStatus(err), Code: domainErr.Code, Detail: err.Error()}
+	default:
+		return &Problem{Status: http.StatusInternalServerError, Code: usecase.CodeInternal, Detail: "internal server error"}
+	}
+}
+
+// errorStatus maps the kind of err to an HTTP status.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, usecase.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, usecase.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, usecase.ErrValidation), errors.Is(err, usecase.ErrInsufficientFunds):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, usecase.ErrLimitExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, usecase.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// validationMessage describes a failed binding rule.
+func validationMessage(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	default:
+		if fieldErr.Param() != "" {
+			return "must satisfy " + fieldErr.Tag() + "=" + fieldErr.Param()
+		}
+		return "must satisfy " + fieldErr.Tag()
+	}
+}
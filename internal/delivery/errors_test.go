@@ -0,0 +1,158 @@
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveError returns the response of a handler that failed with err.
+func serveError(t *testing.T, err error) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.GET("/", func(c *gin.Context) { c.Error(err) })
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	return recorder
+}
+
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) *Problem {
+	t.Helper()
+	if contentType := recorder.Header().Get("Content-Type"); contentType != problemContentType {
+		t.Errorf("Content-Type = %q, want %q", contentType, problemContentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decoding %s: %v", recorder.Body, err)
+	}
+	if problem.Status != recorder.Code || problem.Type != problemTypePrefix+problem.Code || problem.Title != http.StatusText(recorder.Code) {
+		t.Errorf("problem = %+v, want the status, type and title of the response %d", problem, recorder.Code)
+	}
+	return &problem
+}
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{"not found", usecase.NotFoundError("user not found"), http.StatusNotFound, usecase.CodeNotFound, "user not found"},
+		{"conflict with a code", usecase.ErrPhoneNumberRegistered, http.StatusConflict, "phone_number_registered", usecase.ErrPhoneNumberRegistered.Message},
+		{"validation", usecase.ValidationError("amount most be bigger than zero"), http.StatusUnprocessableEntity, usecase.CodeValidationFailed, "amount most be bigger than zero"},
+		{"insufficient funds", usecase.ErrInsufficientFunds, http.StatusUnprocessableEntity, usecase.CodeInsufficientFunds, usecase.ErrInsufficientFunds.Error()},
+		{"rate limited", &usecase.RedemptionLimitError{RetryAfter: time.Minute}, http.StatusTooManyRequests, CodeRateLimited, "too many redemption attempts, try again in 1m0s"},
+		{"locked", &usecase.RedemptionLimitError{Locked: true, RetryAfter: time.Minute}, http.StatusTooManyRequests, CodeRedemptionLocked, "too many failed redemptions, try again in 1m0s"},
+		{"wrapped", fmt.Errorf("importing: %w", usecase.NotFoundError("user not found")), http.StatusNotFound, usecase.CodeNotFound, "importing: user not found"},
+		{"body too large", &http.MaxBytesError{Limit: 8}, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "the request body is larger than 8 bytes"},
+		// The cause of an internal error is never returned
+		{"internal", usecase.InternalError("database query error", errors.New("dial tcp 10.0.0.5:3306: connection refused")), http.StatusInternalServerError, usecase.CodeInternal, "database query error"},
+		{"unexpected", errors.New("dial tcp 10.0.0.5:3306: connection refused"), http.StatusInternalServerError, usecase.CodeInternal, "internal server error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serveError(t, test.err)
+			problem := decodeProblem(t, recorder)
+			if recorder.Code != test.status || problem.Code != test.code || problem.Detail != test.detail {
+				t.Errorf("problem = %d %s %q, want %d %s %q", recorder.Code, problem.Code, problem.Detail, test.status, test.code, test.detail)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerRequestErrors(t *testing.T) {
+	type request struct {
+		PhoneNumber string  `json:"phoneNumber" binding:"required"`
+		Amount      float64 `json:"amount" binding:"gt=0"`
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	router.POST("/:id", func(c *gin.Context) {
+		if c.Param("id") != "1" {
+			c.Error(invalidParameter("id", "must be an integer"))
+			return
+		}
+		var body request
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Error(err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		code   string
+		errors []FieldError
+	}{
+		{"invalid parameter", "/x", `{}`, http.StatusBadRequest, CodeInvalidParameter, []FieldError{{Field: "id", Message: "must be an integer"}}},
+		{"invalid fields", "/1", `{"amount": 0}`, http.StatusUnprocessableEntity, usecase.CodeValidationFailed, []FieldError{
+			{Field: "phoneNumber", Message: "is required"},
+			{Field: "amount", Message: "must satisfy gt=0"},
+		}},
+		{"wrong type", "/1", `{"phoneNumber": "09121234567", "amount": "50"}`, http.StatusBadRequest, CodeMalformedBody, []FieldError{{Field: "amount", Message: "must be of type float64"}}},
+		{"invalid JSON", "/1", `{"amount": `, http.StatusBadRequest, CodeMalformedBody, nil},
+		{"empty body", "/1", ``, http.StatusBadRequest, CodeMalformedBody, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body)))
+			problem := decodeProblem(t, recorder)
+			if recorder.Code != test.status || problem.Code != test.code || !reflect.DeepEqual(problem.Errors, test.errors) {
+				t.Errorf("problem = %d %s %+v, want %d %s %+v", recorder.Code, problem.Code, problem.Errors, test.status, test.code, test.errors)
+			}
+		})
+	}
+}
+
+func TestErrorHandlerRetryAfter(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		header     string
+	}{
+		{30 * time.Second, "30"},
+		// Waiting less than the time left would only fail again
+		{1500 * time.Millisecond, "2"},
+	}
+	for _, test := range tests {
+		recorder := serveError(t, &usecase.RedemptionLimitError{Locked: true, RetryAfter: test.retryAfter})
+		if header := recorder.Header().Get("Retry-After"); header != test.header {
+			t.Errorf("Retry-After for %s = %q, want %q", test.retryAfter, header, test.header)
+		}
+	}
+
+	if header := serveError(t, usecase.NotFoundError("user not found")).Header().Get("Retry-After"); header != "" {
+		t.Errorf("Retry-After = %q for an error without a retry", header)
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.NoRoute(NoRoute)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/missing", nil))
+	if problem := decodeProblem(t, recorder); recorder.Code != http.StatusNotFound || problem.Code != CodeRouteNotFound || problem.Detail != "no route for GET /api/v1/missing" {
+		t.Errorf("problem = %d %s %q, want a route not found", recorder.Code, problem.Code, problem.Detail)
+	}
+}
@@ -0,0 +1,54 @@
+// internal/delivery/etag.go
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errPreconditionRequired reports an update sent without If-Match. Updates
+// have to name the version they were based on, so that they do not overwrite
+// a change made since.
+var errPreconditionRequired = errors.New("the If-Match header is required, send the ETag of the resource")
+
+// etag formats a resource version as a strong entity tag.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// writeWithETag writes body with the ETag of version, or 304 Not Modified
+// when the client already has that version.
+func writeWithETag(c *gin.Context, version int, body interface{}) {
+	tag := etag(version)
+	c.Header("ETag", tag)
+	for _, match := range strings.Split(c.GetHeader("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == tag || match == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// ifMatchVersion returns the version named by the If-Match header of an
+// update. A weak tag is accepted, since the tags are only compared.
+func ifMatchVersion(c *gin.Context) (int, error) {
+	match := strings.TrimSpace(c.GetHeader("If-Match"))
+	if match == "" {
+		return 0, errPreconditionRequired
+	}
+	match = strings.TrimPrefix(match, "W/")
+	if len(match) < 2 || match[0] != '"' || match[len(match)-1] != '"' {
+		return 0, invalidParameter("If-Match", "must be a single ETag returned for the resource")
+	}
+	version, err := strconv.Atoi(match[1 : len(match)-1])
+	if err != nil || version <= 0 {
+		return 0, invalidParameter("If-Match", "must be a single ETag returned for the resource")
+	}
+	return version, nil
+}
@@ -0,0 +1,151 @@
+// internal/delivery/event_stream_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// eventStreamPath is exempt from the request timeouts, since a stream stays
+// open until the client leaves.
+const eventStreamPath = "/api/v1/events/stream"
+
+type EventStreamConfig struct {
+	HeartbeatInterval time.Duration
+	// WriteTimeout bounds every write to a client, replacing the write
+	// timeout of the server
+	WriteTimeout time.Duration
+}
+
+type EventStreamHandler struct {
+	EventStream *usecase.EventStream `json:"EventStream"`
+	Config      EventStreamConfig
+}
+
+func NewEventStreamHandler(eventStream *usecase.EventStream, config EventStreamConfig) *EventStreamHandler {
+	return &EventStreamHandler{EventStream: eventStream, Config: config}
+}
+
+// StreamEvents godoc
+// @Summary Stream events
+// @Description Stream transaction, redemption and user events as Server-Sent Events. Every event has its type as the SSE event name, the JSON event as data, and a sequence number as ID. A client that reconnects with the Last-Event-ID header, or the lastEventId parameter, first receives the buffered events it missed; when some are no longer buffered a `reset` event is sent first. A comment is sent every heartbeat interval. Clients that do not keep up are disconnected and can resume the same way.
+// @Tags Events
+// @ID stream-events
+// @Produce text/event-stream
+// @Param type query string false "Comma separated event types, e.g. transaction.created"
+// @Param phoneNumber query string false "Only events of this user"
+// @Param chargeCodeId query integer false "Only events of this charge code"
+// @Param lastEventId query integer false "Resume after this event ID"
+// @Param Last-Event-ID header integer false "Resume after this event ID"
+// @Success 200 {object} usecase.Event
+// @Failure 400,422,429 {object} Problem
+// @Router /api/v1/events/stream [get]
+func (eH *EventStreamHandler) StreamEvents(c *gin.Context) {
+	filter := usecase.EventFilter{PhoneNumber: c.Query("phoneNumber")}
+	if types := c.Query("type"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	if chargeCodeID := c.Query("chargeCodeId"); chargeCodeID != "" {
+		id, err := strconv.Atoi(chargeCodeID)
+		if err != nil {
+			c.Error(invalidParameter("chargeCodeId", "must be an integer"))
+			return
+		}
+		filter.ChargeCodeID = id
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var lastSeq uint64
+	if lastEventID != "" {
+		var err error
+		if lastSeq, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			c.Error(invalidParameter("lastEventId", "must be a non-negative integer"))
+			return
+		}
+	}
+
+	subscription, err := eH.EventStream.Subscribe(filter, lastSeq, lastEventID != "")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer eH.EventStream.Unsubscribe(subscription)
+
+	controller := http.NewResponseController(c.Writer)
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Proxies such as nginx would otherwise buffer the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// write sends one message and flushes it. A client that cannot take it
+	// within WriteTimeout is disconnected.
+	write := func(send func(w io.Writer) error) bool {
+		if err := controller.SetWriteDeadline(time.Now().Add(eH.Config.WriteTimeout)); err != nil {
+			slog.WarnContext(c.Request.Context(), "setting stream write deadline", "error", err)
+		}
+		if err := send(c.Writer); err != nil {
+			return false
+		}
+		return controller.Flush() == nil
+	}
+	writeMessage := func(message sse.Event) bool {
+		return write(func(w io.Writer) error { return sse.Encode(w, message) })
+	}
+	writeEvent := func(event *usecase.StreamEvent) bool {
+		return writeMessage(sse.Event{Id: strconv.FormatUint(event.Seq, 10), Event: event.Event.Type, Data: event.Event})
+	}
+	writeComment := func(comment string) bool {
+		return write(func(w io.Writer) error {
+			_, err := io.WriteString(w, ": "+comment+"\n\n")
+			return err
+		})
+	}
+
+	if !writeComment("connected") {
+		return
+	}
+	if subscription.Gap && !writeMessage(sse.Event{Event: "reset", Data: "some events were missed"}) {
+		return
+	}
+	for _, event := range subscription.Replay {
+		if !writeEvent(event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eH.Config.HeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-subscription.Events:
+			if !ok {
+				if eH.EventStream.Slow(subscription) {
+					writeComment("disconnected because events were not read fast enough, reconnect to resume")
+				}
+				return
+			}
+			if !writeEvent(event) {
+				return
+			}
+		case <-heartbeat.C:
+			if !writeComment("heartbeat") {
+				return
+			}
+		}
+	}
+}
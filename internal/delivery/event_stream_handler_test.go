@@ -0,0 +1,208 @@
+package delivery
+
+import (
+	"bufio"
+	"chargeCode/internal/usecase"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestEventStreamServer serves the event stream of stream.
+func newTestEventStreamServer(t *testing.T, stream *usecase.EventStream) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ErrorHandler())
+	handler := NewEventStreamHandler(stream, EventStreamConfig{HeartbeatInterval: time.Hour, WriteTimeout: 10 * time.Second})
+	router.GET(eventStreamPath, handler.StreamEvents)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		stream.Close()
+		server.Close()
+	})
+	return server
+}
+
+// sseClient reads the messages of one event stream.
+type sseClient struct {
+	resp   *http.Response
+	reader *bufio.Reader
+}
+
+func connectEventStream(t *testing.T, server *httptest.Server, query string, lastEventID string) *sseClient {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+eventStreamPath+query, nil)
+	if err != nil {
+		t.Fatalf("creating the request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return &sseClient{resp: resp, reader: bufio.NewReaderSize(resp.Body, 1<<20)}
+}
+
+// next returns the next message as its lines, without the data of events.
+func (c *sseClient) next(t *testing.T) []string {
+	t.Helper()
+	lines := []string{}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream after %v: %v", lines, err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		if strings.HasPrefix(line, "data:") && len(lines) > 0 && strings.HasPrefix(lines[0], "id:") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+}
+
+func publishEvent(t *testing.T, stream *usecase.EventStream, n int, data string) {
+	t.Helper()
+	event := &usecase.Event{ID: fmt.Sprintf("event-%d", n), Type: usecase.EventUserCreated, Data: json.RawMessage(data)}
+	if err := stream.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func eventMessage(seq int) []string {
+	return []string{fmt.Sprintf("id:%d", seq), "event:" + usecase.EventUserCreated}
+}
+
+func TestStreamEventsResumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+		messages    [][]string
+	}{
+		{"new client", "", "", nil},
+		{"Last-Event-ID", "", "2", [][]string{eventMessage(3)}},
+		{"lastEventId parameter", "?lastEventId=2", "", [][]string{eventMessage(3)}},
+		{"header before the parameter", "?lastEventId=0", "2", [][]string{eventMessage(3)}},
+		// Event 1 is no longer buffered
+		{"overrun buffer", "", "0", [][]string{{"event:reset", "data:some events were missed"}, eventMessage(2), eventMessage(3)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := usecase.NewEventStream(usecase.EventStreamConfig{BufferSize: 2, ClientBufferSize: 10})
+			server := newTestEventStreamServer(t, stream)
+			for n := 1; n <= 3; n++ {
+				publishEvent(t, stream, n, `{}`)
+			}
+
+			client := connectEventStream(t, server, test.query, test.lastEventID)
+			if client.resp.StatusCode != http.StatusOK || !strings.HasPrefix(client.resp.Header.Get("Content-Type"), "text/event-stream") {
+				t.Fatalf("response = %d %s, want an event stream", client.resp.StatusCode, client.resp.Header.Get("Content-Type"))
+			}
+			if message := client.next(t); strings.Join(message, "\n") != ": connected" {
+				t.Fatalf("first message = %q, want the connected comment", message)
+			}
+			for _, want := range test.messages {
+				if message := client.next(t); strings.Join(message, "\n") != strings.Join(want, "\n") {
+					t.Errorf("message = %q, want %q", message, want)
+				}
+			}
+
+			// Live events follow the replay
+			publishEvent(t, stream, 4, `{}`)
+			if message := client.next(t); strings.Join(message, "\n") != strings.Join(eventMessage(4), "\n") {
+				t.Errorf("live message = %q, want event 4", message)
+			}
+		})
+	}
+}
+
+func TestStreamEventsRejectsRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		lastEventID string
+		status      int
+		code        string
+	}{
+		{"invalid Last-Event-ID", "", "-1", http.StatusBadRequest, CodeInvalidParameter},
+		{"invalid lastEventId", "?lastEventId=abc", "", http.StatusBadRequest, CodeInvalidParameter},
+		{"invalid chargeCodeId", "?chargeCodeId=abc", "", http.StatusBadRequest, CodeInvalidParameter},
+		{"unknown type", "?type=user.created,user.deleted", "", http.StatusUnprocessableEntity, usecase.CodeValidationFailed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestEventStreamServer(t, usecase.NewEventStream(usecase.EventStreamConfig{ClientBufferSize: 1}))
+			client := connectEventStream(t, server, test.query, test.lastEventID)
+			var problem Problem
+			if err := json.NewDecoder(client.resp.Body).Decode(&problem); err != nil {
+				t.Fatalf("decoding the problem: %v", err)
+			}
+			if client.resp.StatusCode != test.status || problem.Code != test.code {
+				t.Errorf("response = %d %s, want %d %s", client.resp.StatusCode, problem.Code, test.status, test.code)
+			}
+		})
+	}
+}
+
+func TestStreamEventsMaxClients(t *testing.T) {
+	stream := usecase.NewEventStream(usecase.EventStreamConfig{ClientBufferSize: 1, MaxClients: 1})
+	server := newTestEventStreamServer(t, stream)
+
+	first := connectEventStream(t, server, "", "")
+	first.next(t)
+
+	second := connectEventStream(t, server, "", "")
+	var problem Problem
+	if err := json.NewDecoder(second.resp.Body).Decode(&problem); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	if second.resp.StatusCode != http.StatusTooManyRequests || problem.Code != usecase.CodeLimitExceeded {
+		t.Errorf("response = %d %s, want 429 %s", second.resp.StatusCode, problem.Code, usecase.CodeLimitExceeded)
+	}
+}
+
+func TestStreamEventsDropsSlowClients(t *testing.T) {
+	stream := usecase.NewEventStream(usecase.EventStreamConfig{BufferSize: 10, ClientBufferSize: 1})
+	server := newTestEventStreamServer(t, stream)
+	client := connectEventStream(t, server, "", "")
+	client.next(t)
+
+	// The client does not read the first event, which is too large for the
+	// connection to take, so the handler cannot keep up with the next ones
+	large := `{"note":"` + strings.Repeat("x", 16<<20) + `"}`
+	publishEvent(t, stream, 1, large)
+	for n := 2; n <= 3; n++ {
+		publishEvent(t, stream, n, `{}`)
+	}
+
+	var messages []string
+	for {
+		message := strings.Join(client.next(t), "\n")
+		messages = append(messages, message)
+		if strings.HasPrefix(message, ":") {
+			break
+		}
+	}
+	last := messages[len(messages)-1]
+	if last != ": disconnected because events were not read fast enough, reconnect to resume" {
+		t.Errorf("messages = %q, want the slow client disconnected", messages)
+	}
+	if _, err := client.reader.ReadString('\n'); err == nil {
+		t.Errorf("stream still open after the disconnect")
+	}
+}
@@ -0,0 +1,111 @@
+// internal/delivery/fraud_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FraudHandler struct {
+	FraudEngine *usecase.FraudEngine `json:"FraudEngine"`
+}
+
+func NewFraudHandler(fraudEngine *usecase.FraudEngine) *FraudHandler {
+	return &FraudHandler{FraudEngine: fraudEngine}
+}
+
+// GetDecisions godoc
+// @Summary Get fraud decisions
+// @Description Get the fraud decisions on transactions and redemptions, newest first, with filters and pagination. Decisions to review or deny start out pending review.
+// @Tags Fraud
+// @ID get-fraud-decisions
+// @Produce json
+// @Param action query string false "allow, review or deny"
+// @Param reviewStatus query string false "none, pending, approved or rejected"
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.FraudDecision
+// @Failure 400,422,500 {object} Problem
+// @Router /api/v1/fraud/decisions [get]
+func (fH *FraudHandler) GetDecisions(c *gin.Context) {
+	filter := &usecase.FraudDecisionFilter{
+		Action:       c.Query("action"),
+		ReviewStatus: c.Query("reviewStatus"),
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	decisions, err := fH.FraudEngine.GetDecisions(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, decisions)
+}
+
+// GetDecisionByID godoc
+// @Summary Get fraud decision by ID
+// @Description Get a fraud decision with the result of every rule that matched.
+// @Tags Fraud
+// @ID get-fraud-decision-by-id
+// @Produce json
+// @Param id path int true "Decision ID" Example: 1
+// @Success 200 {object} usecase.FraudDecision
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/fraud/decisions/{id} [get]
+func (fH *FraudHandler) GetDecisionByID(c *gin.Context) {
+	decisionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	decision, err := fH.FraudEngine.GetDecisionByID(c.Request.Context(), decisionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, decision)
+}
+
+// ReviewDecision godoc
+// @Summary Review a fraud decision
+// @Description Approve or reject a decision that is pending review. The review is recorded; a rejected transaction is not reversed.
+// @Tags Fraud
+// @ID review-fraud-decision
+// @Accept json
+// @Produce json
+// @Param id path int true "Decision ID" Example: 1
+// @Param review body usecase.FraudReview true "Review"
+// @Success 200 {object} usecase.FraudDecision
+// @Failure 400,404,409,413,422,500 {object} Problem
+// @Router /api/v1/fraud/decisions/{id}/review [post]
+func (fH *FraudHandler) ReviewDecision(c *gin.Context) {
+	decisionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+
+	var review usecase.FraudReview
+	if err := c.ShouldBindJSON(&review); err != nil {
+		c.Error(err)
+		return
+	}
+
+	decision, err := fH.FraudEngine.ReviewDecision(c.Request.Context(), decisionID, &review, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, decision)
+}
@@ -0,0 +1,126 @@
+package grpcdelivery
+
+import (
+	walletv1 "chargeCode/api/wallet/v1"
+	"chargeCode/internal/usecase"
+	"context"
+)
+
+type chargeCodeService struct {
+	walletv1.UnimplementedChargeCodeServiceServer
+	ChargeCodeUseCase *usecase.ChargeCodeUseCase
+}
+
+func (s *chargeCodeService) ListChargeCodes(ctx context.Context, req *walletv1.ListChargeCodesRequest) (*walletv1.ListChargeCodesResponse, error) {
+	page, pageSize := pageOf(req.GetPage())
+	chargeCodes, err := s.ChargeCodeUseCase.GetChargeCodes(ctx, req.GetStatuses(), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodesToProto(chargeCodes), nil
+}
+
+func (s *chargeCodeService) GetChargeCode(ctx context.Context, req *walletv1.GetChargeCodeRequest) (*walletv1.ChargeCode, error) {
+	chargeCode, err := s.ChargeCodeUseCase.GetChargeCodeByID(ctx, int(req.GetChargeCodeId()))
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(chargeCode), nil
+}
+
+func (s *chargeCodeService) GetChargeCodeByCode(ctx context.Context, req *walletv1.GetChargeCodeByCodeRequest) (*walletv1.ChargeCode, error) {
+	chargeCode, err := s.ChargeCodeUseCase.GetChargeCodeByCode(ctx, req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(chargeCode), nil
+}
+
+func (s *chargeCodeService) CreateChargeCode(ctx context.Context, req *walletv1.CreateChargeCodeRequest) (*walletv1.ChargeCode, error) {
+	if req.GetCode() == "" || req.GetMaxUses() == 0 || req.GetAmount() == 0 {
+		return nil, usecase.ValidationError("code, max_uses and amount are required")
+	}
+	created, err := s.ChargeCodeUseCase.CreateChargeCode(ctx, &usecase.ChargeCode{
+		Code:    req.GetCode(),
+		MaxUses: int(req.GetMaxUses()),
+		Amount:  req.GetAmount(),
+	}, actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(created), nil
+}
+
+func (s *chargeCodeService) UpdateChargeCode(ctx context.Context, req *walletv1.UpdateChargeCodeRequest) (*walletv1.ChargeCode, error) {
+	chargeCode := req.GetChargeCode()
+	if chargeCode == nil {
+		return nil, usecase.ValidationError("charge_code is required")
+	}
+	if chargeCode.GetVersion() <= 0 {
+		return nil, usecase.ValidationError("charge_code.version is required")
+	}
+	updated, err := s.ChargeCodeUseCase.UpdateChargeCode(ctx, &usecase.ChargeCode{
+		ChargeCodeID: int(chargeCode.GetChargeCodeId()),
+		Code:         chargeCode.GetCode(),
+		MaxUses:      int(chargeCode.GetMaxUses()),
+		CurrentUses:  int(chargeCode.GetCurrentUses()),
+		Amount:       chargeCode.GetAmount(),
+		Version:      int(chargeCode.GetVersion()),
+	}, actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(updated), nil
+}
+
+func (s *chargeCodeService) DeleteChargeCode(ctx context.Context, req *walletv1.DeleteChargeCodeRequest) (*walletv1.DeleteChargeCodeResponse, error) {
+	if _, err := s.ChargeCodeUseCase.ArchiveChargeCode(ctx, int(req.GetChargeCodeId()), actorFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return &walletv1.DeleteChargeCodeResponse{}, nil
+}
+
+func (s *chargeCodeService) PauseChargeCode(ctx context.Context, req *walletv1.PauseChargeCodeRequest) (*walletv1.ChargeCode, error) {
+	paused, err := s.ChargeCodeUseCase.PauseChargeCode(ctx, int(req.GetChargeCodeId()), actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(paused), nil
+}
+
+func (s *chargeCodeService) RestoreChargeCode(ctx context.Context, req *walletv1.RestoreChargeCodeRequest) (*walletv1.ChargeCode, error) {
+	restored, err := s.ChargeCodeUseCase.RestoreChargeCode(ctx, int(req.GetChargeCodeId()), actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodeToProto(restored), nil
+}
+
+func (s *chargeCodeService) ListUserChargeCodes(ctx context.Context, req *walletv1.ListUserChargeCodesRequest) (*walletv1.ListChargeCodesResponse, error) {
+	page, pageSize := pageOf(req.GetPage())
+	chargeCodes, err := s.ChargeCodeUseCase.GetUserChargeCodes(ctx, int(req.GetUserId()), req.GetStatuses(), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return chargeCodesToProto(chargeCodes), nil
+}
+
+func chargeCodeToProto(chargeCode *usecase.ChargeCode) *walletv1.ChargeCode {
+	return &walletv1.ChargeCode{
+		ChargeCodeId: int64(chargeCode.ChargeCodeID),
+		Code:         chargeCode.Code,
+		MaxUses:      int64(chargeCode.MaxUses),
+		CurrentUses:  int64(chargeCode.CurrentUses),
+		Amount:       chargeCode.Amount,
+		Version:      int64(chargeCode.Version),
+		Status:       chargeCode.Status,
+	}
+}
+
+func chargeCodesToProto(chargeCodes []*usecase.ChargeCode) *walletv1.ListChargeCodesResponse {
+	resp := &walletv1.ListChargeCodesResponse{ChargeCodes: make([]*walletv1.ChargeCode, 0, len(chargeCodes))}
+	for _, chargeCode := range chargeCodes {
+		resp.ChargeCodes = append(resp.ChargeCodes, chargeCodeToProto(chargeCode))
+	}
+	return resp
+}
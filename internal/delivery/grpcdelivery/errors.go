@@ -0,0 +1,101 @@
+package grpcdelivery
+
+import (
+	"chargeCode/internal/usecase"
+	"errors"
+	"math"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// errorDomain is the domain of the ErrorInfo details. Their reason is the
+// same stable error code as in the REST problem responses.
+const errorDomain = "usermanager"
+
+// Error codes of the errors detected by the delivery layer, as in the REST
+// API.
+const (
+	codeRateLimited      = "rate_limited"
+	codeRedemptionLocked = "redemption_locked"
+)
+
+// statusFor maps err to a gRPC status with an ErrorInfo detail, and a
+// RetryInfo detail for limits that reset. Domain errors keep their message;
+// unexpected errors are reported without details because they may carry
+// driver or system information.
+func statusFor(err error) *status.Status {
+	if s, ok := status.FromError(err); ok {
+		return s
+	}
+
+	var (
+		limitErr   *usecase.RedemptionLimitError
+		txLimitErr *usecase.TransactionLimitError
+		domainErr  *usecase.Error
+	)
+	var (
+		code       codes.Code
+		reason     string
+		message    = err.Error()
+		retryAfter time.Duration
+	)
+	switch {
+	case errors.As(err, &limitErr):
+		code, reason, retryAfter = codes.ResourceExhausted, codeRateLimited, limitErr.RetryAfter
+		if limitErr.Locked {
+			reason = codeRedemptionLocked
+		}
+	case errors.As(err, &txLimitErr):
+		code, reason = codes.ResourceExhausted, usecase.CodeTransactionLimitExceeded
+		if !txLimitErr.ResetsAt.IsZero() {
+			retryAfter = time.Duration(math.Max(float64(time.Second), float64(time.Until(txLimitErr.ResetsAt))))
+		}
+	case errors.Is(err, usecase.ErrInsufficientFunds):
+		code, reason = codes.FailedPrecondition, usecase.CodeInsufficientFunds
+	case errors.As(err, &domainErr):
+		code, reason = errorCode(err), domainErr.Code
+	default:
+		code, reason, message = codes.Internal, usecase.CodeInternal, "internal server error"
+	}
+
+	s := status.New(code, message)
+	withDetails, detailErr := s.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain})
+	if detailErr != nil {
+		return s
+	}
+	if retryAfter > 0 {
+		if withRetry, err := withDetails.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter.Round(time.Second))}); err == nil {
+			return withRetry
+		}
+	}
+	return withDetails
+}
+
+// errorCode maps the kind of err to a gRPC code, like errorStatus does to
+// an HTTP status.
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, usecase.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, usecase.ErrPhoneNumberRegistered):
+		return codes.AlreadyExists
+	case errors.Is(err, usecase.ErrConflict):
+		return codes.FailedPrecondition
+	case errors.Is(err, usecase.ErrForbidden):
+		return codes.PermissionDenied
+	case errors.Is(err, usecase.ErrValidation):
+		return codes.InvalidArgument
+	case errors.Is(err, usecase.ErrInsufficientFunds):
+		return codes.FailedPrecondition
+	case errors.Is(err, usecase.ErrLimitExceeded):
+		return codes.ResourceExhausted
+	case errors.Is(err, usecase.ErrPreconditionFailed):
+		return codes.Aborted
+	default:
+		return codes.Internal
+	}
+}
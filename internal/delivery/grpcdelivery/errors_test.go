@@ -0,0 +1,185 @@
+package grpcdelivery
+
+import (
+	walletv1 "chargeCode/api/wallet/v1"
+	"chargeCode/internal/delivery"
+	"chargeCode/internal/usecase"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDetails returns the ErrorInfo and RetryInfo details of s.
+func errorDetails(s *status.Status) (*errdetails.ErrorInfo, *errdetails.RetryInfo) {
+	var (
+		info  *errdetails.ErrorInfo
+		retry *errdetails.RetryInfo
+	)
+	for _, detail := range s.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			info = detail
+		case *errdetails.RetryInfo:
+			retry = detail
+		}
+	}
+	return info, retry
+}
+
+// restProblem returns the problem and Retry-After header the REST API
+// answers with when a handler fails with err.
+func restProblem(t *testing.T, err error) (*delivery.Problem, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(delivery.ErrorHandler())
+	router.GET("/", func(c *gin.Context) { c.Error(err) })
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	var problem delivery.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decoding the problem: %v", err)
+	}
+	if problem.Status != recorder.Code {
+		t.Fatalf("problem status = %d, response status %d", problem.Status, recorder.Code)
+	}
+	return &problem, recorder.Header().Get("Retry-After")
+}
+
+func TestStatusFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		code    codes.Code
+		status  int
+		reason  string
+		message string
+	}{
+		{"not found", usecase.NotFoundError("user not found"), codes.NotFound, http.StatusNotFound, usecase.CodeNotFound, "user not found"},
+		{"conflict", usecase.ConflictError("only completed reconciliation runs can be repaired"), codes.FailedPrecondition, http.StatusConflict, usecase.CodeConflict, "only completed reconciliation runs can be repaired"},
+		{"already exists", usecase.ErrPhoneNumberRegistered, codes.AlreadyExists, http.StatusConflict, "phone_number_registered", usecase.ErrPhoneNumberRegistered.Message},
+		{"conflict with a code", usecase.ErrChargeCodeAlreadyRedeemed, codes.FailedPrecondition, http.StatusConflict, "charge_code_already_redeemed", usecase.ErrChargeCodeAlreadyRedeemed.Message},
+		{"validation", usecase.ValidationError("amount most be bigger than zero"), codes.InvalidArgument, http.StatusUnprocessableEntity, usecase.CodeValidationFailed, "amount most be bigger than zero"},
+		{"validation with a code", usecase.ErrInvalidPhoneNumber, codes.InvalidArgument, http.StatusUnprocessableEntity, "invalid_phone_number", usecase.ErrInvalidPhoneNumber.Message},
+		{"forbidden", usecase.ErrTransactionDenied, codes.PermissionDenied, http.StatusForbidden, usecase.ErrTransactionDenied.Code, usecase.ErrTransactionDenied.Message},
+		{"insufficient funds", usecase.ErrInsufficientFunds, codes.FailedPrecondition, http.StatusUnprocessableEntity, usecase.CodeInsufficientFunds, usecase.ErrInsufficientFunds.Error()},
+		{"limit exceeded", usecase.LimitExceededError("the import file has more than 1 rows"), codes.ResourceExhausted, http.StatusTooManyRequests, usecase.CodeLimitExceeded, "the import file has more than 1 rows"},
+		{"version mismatch", usecase.ErrVersionMismatch, codes.Aborted, http.StatusPreconditionFailed, "version_mismatch", usecase.ErrVersionMismatch.Message},
+		{"wrapped", fmt.Errorf("importing: %w", usecase.NotFoundError("user not found")), codes.NotFound, http.StatusNotFound, usecase.CodeNotFound, "importing: user not found"},
+		// The cause of an internal error is never returned
+		{"internal", usecase.InternalError("database query error", errors.New("dial tcp 10.0.0.5:3306: connection refused")), codes.Internal, http.StatusInternalServerError, usecase.CodeInternal, "database query error"},
+		{"unexpected", errors.New("dial tcp 10.0.0.5:3306: connection refused"), codes.Internal, http.StatusInternalServerError, usecase.CodeInternal, "internal server error"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := statusFor(test.err)
+			if s.Code() != test.code || s.Message() != test.message {
+				t.Errorf("status = %s %q, want %s %q", s.Code(), s.Message(), test.code, test.message)
+			}
+			info, retry := errorDetails(s)
+			if info == nil || info.Reason != test.reason || info.Domain != errorDomain {
+				t.Errorf("error info = %v, want the reason %s", info, test.reason)
+			}
+			if retry != nil {
+				t.Errorf("retry info = %v, want none", retry)
+			}
+
+			// The REST API reports the same error with the same code and
+			// message
+			problem, _ := restProblem(t, test.err)
+			if problem.Status != test.status || problem.Code != test.reason || problem.Detail != test.message {
+				t.Errorf("problem = %d %s %q, want %d %s %q", problem.Status, problem.Code, problem.Detail, test.status, test.reason, test.message)
+			}
+		})
+	}
+}
+
+func TestStatusForLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		reason     string
+		retryAfter time.Duration
+	}{
+		{"rate limited", &usecase.RedemptionLimitError{RetryAfter: 30 * time.Second}, "rate_limited", 30 * time.Second},
+		{"locked", &usecase.RedemptionLimitError{Locked: true, RetryAfter: 15 * time.Minute}, "redemption_locked", 15 * time.Minute},
+		{"transaction limit", &usecase.TransactionLimitError{Limit: usecase.LimitDailyDebit, Max: 100, ResetsAt: time.Now().Add(2 * time.Hour)},
+			usecase.CodeTransactionLimitExceeded, 2 * time.Hour},
+		// A transaction over a limit on its own never fits, so there is
+		// nothing to wait for
+		{"transaction limit on its own", &usecase.TransactionLimitError{Limit: usecase.LimitDailyDebit, Max: 100},
+			usecase.CodeTransactionLimitExceeded, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := statusFor(test.err)
+			if s.Code() != codes.ResourceExhausted || s.Message() != test.err.Error() {
+				t.Errorf("status = %s %q, want ResourceExhausted %q", s.Code(), s.Message(), test.err.Error())
+			}
+			info, retry := errorDetails(s)
+			if info == nil || info.Reason != test.reason {
+				t.Errorf("error info = %v, want the reason %s", info, test.reason)
+			}
+
+			problem, retryAfterHeader := restProblem(t, test.err)
+			if problem.Status != http.StatusTooManyRequests || problem.Code != test.reason || problem.Detail != test.err.Error() {
+				t.Errorf("problem = %d %s %q, want 429 %s", problem.Status, problem.Code, problem.Detail, test.reason)
+			}
+
+			if test.retryAfter == 0 {
+				if retry != nil || retryAfterHeader != "" {
+					t.Errorf("retry info %v and Retry-After %q, want neither", retry, retryAfterHeader)
+				}
+				return
+			}
+			if retry == nil {
+				t.Fatalf("no retry info, want %s", test.retryAfter)
+			}
+			// Both count the time left in whole seconds
+			if delay := retry.RetryDelay.AsDuration(); delay < test.retryAfter-time.Second || delay > test.retryAfter {
+				t.Errorf("retry delay = %s, want %s", delay, test.retryAfter)
+			}
+			seconds, err := strconv.Atoi(retryAfterHeader)
+			if diff := time.Duration(seconds)*time.Second - retry.RetryDelay.AsDuration(); err != nil || diff < -time.Second || diff > time.Second {
+				t.Errorf("Retry-After = %q, want the retry delay %s", retryAfterHeader, retry.RetryDelay.AsDuration())
+			}
+		})
+	}
+}
+
+func TestErrorInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &walletv1.User{}, usecase.NotFoundError("user not found")
+	}
+	resp, err := errorInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	if resp != nil {
+		t.Errorf("response = %v, want none with an error", resp)
+	}
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.NotFound {
+		t.Fatalf("err = %v, want a NotFound status", err)
+	}
+	if info, _ := errorDetails(s); info == nil || info.Reason != usecase.CodeNotFound {
+		t.Errorf("error info = %v, want the reason %s", info, usecase.CodeNotFound)
+	}
+}
+
+func TestStatusForKeepsStatuses(t *testing.T) {
+	err := status.Error(codes.DeadlineExceeded, "context deadline exceeded")
+	if s := statusFor(err); s.Code() != codes.DeadlineExceeded || len(s.Details()) != 0 {
+		t.Errorf("status = %s with %v, want the status unchanged", s.Code(), s.Details())
+	}
+}
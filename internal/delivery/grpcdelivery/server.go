@@ -0,0 +1,236 @@
+// Package grpcdelivery serves the wallet API over gRPC on top of the same
+// usecases as the REST endpoints.
+package grpcdelivery
+
+import (
+	walletv1 "chargeCode/api/wallet/v1"
+	"chargeCode/internal/logging"
+	"chargeCode/internal/usecase"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"regexp"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys read from and written to calls.
+const (
+	actorKey     = "x-actor"
+	requestIDKey = "x-request-id"
+)
+
+// validRequestID limits the request IDs accepted from clients, as for the
+// X-Request-ID header of the REST API.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type Config struct {
+	// DBTimeout cancels a call's context, as for REST requests
+	DBTimeout time.Duration
+	// HealthInterval is how often the readiness checks update the health
+	// service
+	HealthInterval time.Duration
+}
+
+// Server is the gRPC server with the wallet, health and reflection services.
+type Server struct {
+	*grpc.Server
+	health   *health.Server
+	healthUC *usecase.HealthUseCase
+	config   Config
+}
+
+func NewServer(config Config, healthUC *usecase.HealthUseCase, userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUseCase, transactionUC *usecase.TransactionUseCase) *Server {
+	s := &Server{
+		Server: grpc.NewServer(grpc.ChainUnaryInterceptor(
+			requestIDInterceptor,
+			loggingInterceptor,
+			recoveryInterceptor,
+			timeoutInterceptor(config.DBTimeout),
+			errorInterceptor,
+		)),
+		health:   health.NewServer(),
+		healthUC: healthUC,
+		config:   config,
+	}
+
+	walletv1.RegisterUserServiceServer(s.Server, &userService{UserUseCase: userUC})
+	walletv1.RegisterChargeCodeServiceServer(s.Server, &chargeCodeService{ChargeCodeUseCase: chargeCodeUC})
+	walletv1.RegisterTransactionServiceServer(s.Server, &transactionService{TransactionUseCase: transactionUC})
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	reflection.Register(s.Server)
+
+	// Callers see NOT_SERVING until the first readiness check has passed
+	s.setServingStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	return s
+}
+
+// services lists the names the health service answers for; the empty name is
+// the server as a whole.
+var services = []string{
+	"",
+	walletv1.UserService_ServiceDesc.ServiceName,
+	walletv1.ChargeCodeService_ServiceDesc.ServiceName,
+	walletv1.TransactionService_ServiceDesc.ServiceName,
+}
+
+func (s *Server) setServingStatus(servingStatus healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range services {
+		s.health.SetServingStatus(service, servingStatus)
+	}
+}
+
+// WatchReadiness reports the readiness checks of the REST /readyz endpoint
+// through the health service until ctx is cancelled.
+func (s *Server) WatchReadiness(ctx context.Context) {
+	ticker := time.NewTicker(s.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+		if s.healthUC.Readiness(ctx).Status == usecase.HealthStatusOK {
+			servingStatus = healthpb.HealthCheckResponse_SERVING
+		}
+		s.setServingStatus(servingStatus)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Shutdown marks every service NOT_SERVING and waits for in-flight calls to
+// finish, or stops them when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Server.Stop()
+	}
+}
+
+// requestIDInterceptor keeps the x-request-id of the call, or generates one,
+// and carries it in the context and the response header.
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	requestID := firstMetadata(ctx, requestIDKey)
+	if !validRequestID.MatchString(requestID) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, status.Error(codes.Internal, "internal server error")
+		}
+		requestID = hex.EncodeToString(b)
+	}
+
+	ctx = logging.WithRequestID(ctx, requestID)
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, requestID))
+	return handler(ctx, req)
+}
+
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+
+	attrs := []slog.Attr{
+		slog.String("method", info.FullMethod),
+		slog.String("code", code.String()),
+		slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+		slog.String("client_ip", clientIP(ctx)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, "grpc call", attrs...)
+	return resp, err
+}
+
+// recoveryInterceptor turns a panic into an Internal status and logs it with
+// the request ID.
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.ErrorContext(ctx, "panic recovered", "error", recovered, "method", info.FullMethod)
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// errorInterceptor maps the errors of the services to gRPC statuses.
+func errorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, statusFor(err).Err()
+	}
+	return resp, nil
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// actorFromContext identifies the caller for the audit log, like
+// actorFromRequest does for REST requests. The gRPC server has no trusted
+// proxies, so the x-actor metadata is always recorded as unverified.
+func actorFromContext(ctx context.Context) *usecase.Actor {
+	name := firstMetadata(ctx, actorKey)
+	if name == "" {
+		name = "anonymous"
+	}
+	return &usecase.Actor{
+		Name:      name,
+		RequestID: logging.RequestID(ctx),
+		ClientIP:  clientIP(ctx),
+	}
+}
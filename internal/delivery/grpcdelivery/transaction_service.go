@@ -0,0 +1,97 @@
+package grpcdelivery
+
+import (
+	walletv1 "chargeCode/api/wallet/v1"
+	"chargeCode/internal/usecase"
+	"context"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type transactionService struct {
+	walletv1.UnimplementedTransactionServiceServer
+	TransactionUseCase *usecase.TransactionUseCase
+}
+
+func (s *transactionService) CreateTransaction(ctx context.Context, req *walletv1.CreateTransactionRequest) (*walletv1.Transaction, error) {
+	if req.GetPhoneNumber() == "" || req.GetAmount() == 0 {
+		return nil, usecase.ValidationError("phone_number and amount are required")
+	}
+	created, err := s.TransactionUseCase.CreateTransaction(ctx, &usecase.Transaction{
+		PhoneNumber: req.GetPhoneNumber(),
+		Amount:      req.GetAmount(),
+	}, actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return transactionToProto(created), nil
+}
+
+func (s *transactionService) RedeemChargeCode(ctx context.Context, req *walletv1.RedeemChargeCodeRequest) (*walletv1.RedeemChargeCodeResponse, error) {
+	if req.GetPhoneNumber() == "" || req.GetChargeCodeId() == 0 {
+		return nil, usecase.ValidationError("phone_number and charge_code_id are required")
+	}
+	// The actor's client IP is also used for per-IP rate limiting of redemptions
+	_, err := s.TransactionUseCase.CreateChargeTransaction(ctx, &usecase.ChargeCodeTransaction{
+		PhoneNumber:  req.GetPhoneNumber(),
+		ChargeCodeID: int(req.GetChargeCodeId()),
+	}, actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return &walletv1.RedeemChargeCodeResponse{}, nil
+}
+
+func (s *transactionService) ListTransactions(ctx context.Context, req *walletv1.ListTransactionsRequest) (*walletv1.ListTransactionsResponse, error) {
+	page, pageSize := pageOf(req.GetPage())
+	transactions, err := s.TransactionUseCase.GetTransactions(ctx, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return transactionsToProto(transactions), nil
+}
+
+func (s *transactionService) GetTransaction(ctx context.Context, req *walletv1.GetTransactionRequest) (*walletv1.Transaction, error) {
+	transaction, err := s.TransactionUseCase.GetTransactionByID(ctx, int(req.GetTransactionId()))
+	if err != nil {
+		return nil, err
+	}
+	return transactionToProto(transaction), nil
+}
+
+func (s *transactionService) ListUserTransactions(ctx context.Context, req *walletv1.ListUserTransactionsRequest) (*walletv1.ListTransactionsResponse, error) {
+	page, pageSize := pageOf(req.GetPage())
+	transactions, err := s.TransactionUseCase.GetUserTransactionsByUserID(ctx, int(req.GetUserId()), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return transactionsToProto(transactions), nil
+}
+
+func (s *transactionService) CountUserTransactions(ctx context.Context, req *walletv1.CountUserTransactionsRequest) (*walletv1.CountUserTransactionsResponse, error) {
+	count, err := s.TransactionUseCase.GetUserTotalTransaction(ctx, int(req.GetUserId()))
+	if err != nil {
+		return nil, err
+	}
+	return &walletv1.CountUserTransactionsResponse{Count: int64(count)}, nil
+}
+
+func transactionToProto(transaction *usecase.Transaction) *walletv1.Transaction {
+	resp := &walletv1.Transaction{
+		TransactionId: int64(transaction.TransactionID),
+		PhoneNumber:   transaction.PhoneNumber,
+		Amount:        transaction.Amount,
+	}
+	if !transaction.Timestamp.IsZero() {
+		resp.Timestamp = timestamppb.New(transaction.Timestamp)
+	}
+	return resp
+}
+
+func transactionsToProto(transactions []*usecase.Transaction) *walletv1.ListTransactionsResponse {
+	resp := &walletv1.ListTransactionsResponse{Transactions: make([]*walletv1.Transaction, 0, len(transactions))}
+	for _, transaction := range transactions {
+		resp.Transactions = append(resp.Transactions, transactionToProto(transaction))
+	}
+	return resp
+}
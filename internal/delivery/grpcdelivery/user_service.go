@@ -0,0 +1,78 @@
+package grpcdelivery
+
+import (
+	walletv1 "chargeCode/api/wallet/v1"
+	"chargeCode/internal/usecase"
+	"context"
+)
+
+type userService struct {
+	walletv1.UnimplementedUserServiceServer
+	UserUseCase *usecase.UserUseCase
+}
+
+func (s *userService) GetUserByPhoneNumber(ctx context.Context, req *walletv1.GetUserByPhoneNumberRequest) (*walletv1.User, error) {
+	user, err := s.UserUseCase.GetUserByPhoneNumber(ctx, req.GetPhoneNumber())
+	if err != nil {
+		return nil, err
+	}
+	return userToProto(user), nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *walletv1.UpdateUserRequest) (*walletv1.User, error) {
+	if req.GetUser() == nil {
+		return nil, usecase.ValidationError("user is required")
+	}
+	if req.GetUser().GetVersion() <= 0 {
+		return nil, usecase.ValidationError("user.version is required")
+	}
+	updated, err := s.UserUseCase.UpdateUser(ctx, &usecase.User{
+		ID:          int(req.GetUser().GetId()),
+		PhoneNumber: req.GetUser().GetPhoneNumber(),
+		Balance:     req.GetUser().GetBalance(),
+		Version:     int(req.GetUser().GetVersion()),
+	}, actorFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return userToProto(updated), nil
+}
+
+func (s *userService) GetUserBalance(ctx context.Context, req *walletv1.GetUserBalanceRequest) (*walletv1.GetUserBalanceResponse, error) {
+	balance, err := s.UserUseCase.GetUserBalance(ctx, int(req.GetUserId()))
+	if err != nil {
+		return nil, err
+	}
+	return &walletv1.GetUserBalanceResponse{Balance: balance}, nil
+}
+
+func (s *userService) ListChargeCodeUsers(ctx context.Context, req *walletv1.ListChargeCodeUsersRequest) (*walletv1.ListUsersResponse, error) {
+	page, pageSize := pageOf(req.GetPage())
+	users, err := s.UserUseCase.ListOfUsersUseChargeCode(ctx, int(req.GetChargeCodeId()), page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &walletv1.ListUsersResponse{Users: make([]*walletv1.User, 0, len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, userToProto(user))
+	}
+	return resp, nil
+}
+
+func userToProto(user *usecase.User) *walletv1.User {
+	return &walletv1.User{Id: int64(user.ID), PhoneNumber: user.PhoneNumber, Balance: user.Balance, Version: int64(user.Version)}
+}
+
+// pageOf returns the page and page size of a list request, defaulting to
+// the first page of 10 items like the REST endpoints.
+func pageOf(p *walletv1.Page) (int, int) {
+	page, pageSize := int(p.GetPage()), int(p.GetPageSize())
+	if page == 0 {
+		page = 1
+	}
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	return page, pageSize
+}
@@ -0,0 +1,47 @@
+// internal/delivery/health_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	HealthUseCase *usecase.HealthUseCase `json:"HealthUseCase"`
+}
+
+func NewHealthHandler(healthUC *usecase.HealthUseCase) *HealthHandler {
+	return &HealthHandler{HealthUseCase: healthUC}
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Reports that the process is up. It checks no dependencies, so a database outage does not get the service restarted.
+// @Tags Health
+// @ID liveness
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func (hH *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": usecase.HealthStatusOK})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Checks that the database is reachable, the schema version is current and the background workers are healthy. Results are cached briefly.
+// @Tags Health
+// @ID readiness
+// @Produce json
+// @Success 200 {object} usecase.HealthReport
+// @Failure 503 {object} usecase.HealthReport
+// @Router /readyz [get]
+func (hH *HealthHandler) Readiness(c *gin.Context) {
+	report := hH.HealthUseCase.Readiness(c.Request.Context())
+	if report.Status != usecase.HealthStatusOK {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,118 @@
+// internal/delivery/merge_patch.go
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+var (
+	errUnsupportedMediaType = errors.New("the request body has to be a JSON merge patch sent as " + mergePatchContentType)
+	// A merge patch that is not an object would replace the whole resource
+	errPatchNotObject = errors.New("the merge patch has to be a JSON object")
+)
+
+// patchField decodes the value of a member of a merge patch into the patch.
+// The returned message describes an invalid value.
+type patchField func(value json.RawMessage) string
+
+// stringField, intField and floatField set *target to the value of a member.
+func stringField(target **string) patchField {
+	return func(value json.RawMessage) string {
+		var v string
+		if json.Unmarshal(value, &v) != nil {
+			return "must be a string"
+		}
+		*target = &v
+		return ""
+	}
+}
+
+func intField(target **int) patchField {
+	return func(value json.RawMessage) string {
+		var v int
+		if json.Unmarshal(value, &v) != nil {
+			return "must be an integer"
+		}
+		*target = &v
+		return ""
+	}
+}
+
+func floatField(target **float64) patchField {
+	return func(value json.RawMessage) string {
+		var v float64
+		if json.Unmarshal(value, &v) != nil {
+			return "must be a number"
+		}
+		*target = &v
+		return ""
+	}
+}
+
+// readMergePatch reads an RFC 7396 JSON merge patch from the request body
+// and decodes every member with its field. Members named in readOnly or not
+// in fields are rejected, and so is null, since no field can be removed.
+// Every invalid member is reported at once.
+func readMergePatch(c *gin.Context, fields map[string]patchField, readOnly ...string) error {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != mergePatchContentType && mediaType != "application/json" {
+		return errUnsupportedMediaType
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] != '{' {
+		return errPatchNotObject
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var invalid fieldErrors
+	for _, name := range names {
+		field, ok := fields[name]
+		switch {
+		case containsName(readOnly, name):
+			invalid = append(invalid, FieldError{Field: name, Message: "cannot be changed"})
+		case !ok:
+			invalid = append(invalid, FieldError{Field: name, Message: "is not a field that can be changed"})
+		case string(bytes.TrimSpace(members[name])) == "null":
+			invalid = append(invalid, FieldError{Field: name, Message: "cannot be removed"})
+		default:
+			if message := field(members[name]); message != "" {
+				invalid = append(invalid, FieldError{Field: name, Message: message})
+			}
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
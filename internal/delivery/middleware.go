@@ -0,0 +1,168 @@
+package delivery
+
+import (
+	"chargeCode/internal/logging"
+	"chargeCode/internal/usecase"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// validRequestID limits the request IDs accepted from clients to what is safe
+// to log and store in the audit log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID keeps the X-Request-ID of the request, or generates one, and
+// carries it in the request context and the response header.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				c.AbortWithStatus(http.StatusInternalServerError)
+				return
+			}
+			requestID = hex.EncodeToString(b)
+		}
+
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Header(requestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// actorVerifiedKey is set on requests whose X-Actor header was vouched for
+// by a trusted proxy.
+const actorVerifiedKey = "actorVerified"
+
+// ActorVerification marks the X-Actor header as verified when the request
+// comes straight from one of trustedProxies, IPs or CIDRs of the gateway that
+// authenticates callers and sets the header. Any other caller can send any
+// name, so its actor is recorded in the audit log as unverified.
+func ActorVerification(trustedProxies []string) (gin.HandlerFunc, error) {
+	prefixes := make([]netip.Prefix, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, addrErr)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	return func(c *gin.Context) {
+		remote, err := netip.ParseAddr(c.RemoteIP())
+		if err == nil && c.GetHeader("X-Actor") != "" {
+			for _, prefix := range prefixes {
+				if prefix.Contains(remote.Unmap()) {
+					c.Set(actorVerifiedKey, true)
+					break
+				}
+			}
+		}
+		c.Next()
+	}, nil
+}
+
+// DBTimeout cancels the request context after timeout. Every usecase and
+// repository call runs on that context, so a slow query is abandoned instead
+// of holding a connection after the client has given up. Requests to the
+// exempt routes, which stream or take long, set their own bounds.
+func DBTimeout(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isExempt(c, exempt) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func isExempt(c *gin.Context, routes []string) bool {
+	for _, route := range routes {
+		if c.FullPath() == route {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBodyBytes rejects request bodies larger than limit. Handlers reading
+// past the limit get an error and the connection is closed after the response.
+// The exempt routes set their own limit.
+func MaxBodyBytes(limit int64, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isExempt(c, exempt) {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			abortWithProblem(c, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "the request body is larger than "+strconv.FormatInt(limit, 10)+" bytes")
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// RequestLogger logs one record per request, replacing gin's text logger.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", c.FullPath()),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.Last().Err.Error()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it with the request ID.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "panic recovered", "error", err)
+		abortWithProblem(c, http.StatusInternalServerError, usecase.CodeInternal, "internal server error")
+	})
+}
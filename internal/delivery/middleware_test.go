@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDBTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(DBTimeout(20 * time.Millisecond))
+
+	var deadline time.Time
+	var err error
+	router.GET("/slow", func(c *gin.Context) {
+		deadline, _ = c.Request.Context().Deadline()
+		// A query that outlives the timeout is abandoned
+		select {
+		case <-c.Request.Context().Done():
+			err = c.Request.Context().Err()
+		case <-time.After(time.Second):
+		}
+		c.Status(http.StatusOK)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if deadline.IsZero() {
+		t.Errorf("request context without a deadline")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("request context err = %v, want the deadline exceeded", err)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxBodyBytes(8))
+	router.POST("/", func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{"at the limit", "12345678", 8, http.StatusOK},
+		{"declared over the limit", "123456789", 9, http.StatusRequestEntityTooLarge},
+		// A body of unknown length fails once the handler reads past the limit
+		{"read over the limit", "123456789", -1, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))
+			req.ContentLength = test.contentLength
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+			if recorder.Code != test.status {
+				t.Errorf("status = %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// internal/delivery/reconciliation_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReconciliationHandler struct {
+	ReconciliationUseCase *usecase.ReconciliationUseCase `json:"ReconciliationUseCase"`
+}
+
+func NewReconciliationHandler(reconciliationUC *usecase.ReconciliationUseCase) *ReconciliationHandler {
+	return &ReconciliationHandler{ReconciliationUseCase: reconciliationUC}
+}
+
+// CreateRun godoc
+// @Summary Run a reconciliation
+// @Description Compare every balance with the sum of its transactions and every charge code's current uses with its redemptions, and store the discrepancies in a new run. Nothing is repaired.
+// @Tags Reconciliation
+// @ID create-reconciliation-run
+// @Produce json
+// @Success 201 {object} usecase.ReconciliationRun
+// @Failure 500 {object} Problem
+// @Router /api/v1/reconciliation/runs [post]
+func (rH *ReconciliationHandler) CreateRun(c *gin.Context) {
+	run, err := rH.ReconciliationUseCase.Reconcile(c.Request.Context(), usecase.ReconciliationTriggerManual)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusCreated, run)
+}
+
+// GetRuns godoc
+// @Summary Get reconciliation runs
+// @Description Get the reconciliation runs, newest first, with pagination.
+// @Tags Reconciliation
+// @ID get-reconciliation-runs
+// @Produce json
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.ReconciliationRun
+// @Failure 400,422,500 {object} Problem
+// @Router /api/v1/reconciliation/runs [get]
+func (rH *ReconciliationHandler) GetRuns(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	runs, err := rH.ReconciliationUseCase.GetRuns(c.Request.Context(), page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetRunByID godoc
+// @Summary Get reconciliation run by ID
+// @Description Get a reconciliation run with the number of discrepancies it found and repaired.
+// @Tags Reconciliation
+// @ID get-reconciliation-run-by-id
+// @Produce json
+// @Param id path int true "Run ID" Example: 1
+// @Success 200 {object} usecase.ReconciliationRun
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/reconciliation/runs/{id} [get]
+func (rH *ReconciliationHandler) GetRunByID(c *gin.Context) {
+	runID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	run, err := rH.ReconciliationUseCase.GetRunByID(c.Request.Context(), runID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
+
+// GetDiscrepancies godoc
+// @Summary Get the discrepancies of a reconciliation run
+// @Description Get the discrepancies a run found with the recorded and expected values, and whether each was repaired.
+// @Tags Reconciliation
+// @ID get-reconciliation-discrepancies
+// @Produce json
+// @Param id path int true "Run ID" Example: 1
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.ReconciliationDiscrepancy
+// @Failure 400,404,422,500 {object} Problem
+// @Router /api/v1/reconciliation/runs/{id}/discrepancies [get]
+func (rH *ReconciliationHandler) GetDiscrepancies(c *gin.Context) {
+	runID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	discrepancies, err := rH.ReconciliationUseCase.GetDiscrepancies(c.Request.Context(), runID, page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, discrepancies)
+}
+
+// RepairRun godoc
+// @Summary Repair the discrepancies of a reconciliation run
+// @Description Set each balance to the sum of its transactions and each charge code's current uses to its redemptions. Discrepancies that changed since the run are skipped. Every repair is written to the audit log.
+// @Tags Reconciliation
+// @ID repair-reconciliation-run
+// @Produce json
+// @Param id path int true "Run ID" Example: 1
+// @Success 200 {object} usecase.ReconciliationRun
+// @Failure 400,404,409,500 {object} Problem
+// @Router /api/v1/reconciliation/runs/{id}/repair [post]
+func (rH *ReconciliationHandler) RepairRun(c *gin.Context) {
+	runID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	run, err := rH.ReconciliationUseCase.Repair(c.Request.Context(), runID, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -1,11 +1,14 @@
 package delivery
 
 import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/metrics"
 	"chargeCode/internal/usecase"
 
 	// docs "chargeCode/cmd/docs"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	// swaggerfiles "github.com/swaggo/files"
 	// ginSwagger "github.com/swaggo/gin-swagger"
 
@@ -15,12 +18,47 @@ import (
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
-func SetupRouter(userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUseCase, transactionUC *usecase.TransactionUseCase) *gin.Engine {
-	router := gin.Default()
+func SetupRouter(appConfig *config.AppConfig, appMetrics *metrics.Metrics, userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUseCase, transactionUC *usecase.TransactionUseCase, auditUC *usecase.AuditUseCase, webhookUC *usecase.WebhookUseCase, healthUC *usecase.HealthUseCase, transactionLimiter *usecase.TransactionLimiter, fraudEngine *usecase.FraudEngine, reconciliationUC *usecase.ReconciliationUseCase, eventStream *usecase.EventStream) (*gin.Engine, error) {
+	router := gin.New()
+	// Metrics wrap Recovery so that a request that panicked is observed with
+	// its 500
+	router.Use(otelgin.Middleware(appConfig.TracingServiceName), RequestID(), RequestLogger(), appMetrics.Middleware(), Recovery(), DBTimeout(appConfig.DBTimeout, eventStreamPath, transactionImportPath), MaxBodyBytes(appConfig.HTTPMaxBodyBytes, transactionImportPath), ErrorHandler())
+
+	// Client IPs are used for redemption rate limiting, so X-Forwarded-For is
+	// only honoured when it comes from a configured proxy
+	if err := router.SetTrustedProxies(appConfig.TrustedProxies); err != nil {
+		return nil, err
+	}
+	actorVerification, err := ActorVerification(appConfig.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	router.Use(actorVerification)
+	router.NoRoute(NoRoute)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+	router.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+
+	healthHandler := NewHealthHandler(healthUC)
+	router.GET("/healthz", healthHandler.Liveness)
+	router.GET("/readyz", healthHandler.Readiness)
+
 	userHandler := NewUserHandler(userUC)
 	ChargeCodeHandler := NewChargeCodeHandler(chargeCodeUC)
 	transactionandler := NewTransactionHandler(transactionUC)
+	transactionImportHandler := NewTransactionImportHandler(transactionUC, TransactionImportConfig{
+		MaxBodyBytes: appConfig.ImportMaxBodyBytes,
+		MaxRows:      appConfig.ImportMaxRows,
+		Timeout:      appConfig.ImportTimeout,
+	})
+	auditHandler := NewAuditHandler(auditUC)
+	webhookHandler := NewWebhookHandler(webhookUC)
+	transactionLimitHandler := NewTransactionLimitHandler(transactionLimiter)
+	fraudHandler := NewFraudHandler(fraudEngine)
+	reconciliationHandler := NewReconciliationHandler(reconciliationUC)
+	eventStreamHandler := NewEventStreamHandler(eventStream, EventStreamConfig{
+		HeartbeatInterval: appConfig.EventStreamHeartbeatInterval,
+		WriteTimeout:      appConfig.EventStreamWriteTimeout,
+	})
 
 	// router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
 	// // Specify the Swagger JSON file path
@@ -32,6 +70,10 @@ func SetupRouter(userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUs
 		user.GET("/chargeCode/:chargeCodeId", userHandler.ListOfUsersUseChargeCode)
 		user.GET("/balance/:userId", userHandler.GetUserBalance)
 		user.PUT("/", userHandler.UpdateUser)
+		user.PATCH("/:userId", userHandler.PatchUser)
+		user.GET("/limits/:userId", transactionLimitHandler.GetUserLimits)
+		user.PUT("/limits/:userId", transactionLimitHandler.SetUserLimits)
+		user.DELETE("/limits/:userId", transactionLimitHandler.DeleteUserLimits)
 	}
 
 	chargeCode := router.Group("/api/v1/chargeCode")
@@ -43,12 +85,17 @@ func SetupRouter(userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUs
 		chargeCode.GET("/user/:userId", ChargeCodeHandler.GetUserChargeCodes)
 		chargeCode.DELETE("/:id", ChargeCodeHandler.DeleteChargeCodeByID)
 		chargeCode.PUT("/", ChargeCodeHandler.UpdateChargeCode)
+		chargeCode.PATCH("/:id", ChargeCodeHandler.PatchChargeCode)
+		chargeCode.POST("/:id/pause", ChargeCodeHandler.PauseChargeCode)
+		chargeCode.POST("/:id/restore", ChargeCodeHandler.RestoreChargeCode)
 	}
 
 	transaction := router.Group("/api/v1/transaction")
 	{
 		transaction.POST("/", transactionandler.CreateTransaction)
 		transaction.POST("/charge", transactionandler.CreateChargeTransaction)
+		transaction.POST("/import", transactionImportHandler.ImportTransactions)
+		transaction.GET("/charge/failures", transactionandler.GetRedemptionFailureStats)
 		transaction.GET("", transactionandler.GetTransactions)
 		transaction.GET(":id", transactionandler.GetTransactionByID)
 		transaction.GET("user/:userId", transactionandler.GetUserTransactionsByUserID)
@@ -56,5 +103,39 @@ func SetupRouter(userUC *usecase.UserUseCase, chargeCodeUC *usecase.ChargeCodeUs
 
 	}
 
-	return router
+	audit := router.Group("/api/v1/audit")
+	{
+		audit.GET("", auditHandler.GetAuditLogs)
+	}
+
+	fraud := router.Group("/api/v1/fraud")
+	{
+		fraud.GET("/decisions", fraudHandler.GetDecisions)
+		fraud.GET("/decisions/:id", fraudHandler.GetDecisionByID)
+		fraud.POST("/decisions/:id/review", fraudHandler.ReviewDecision)
+	}
+
+	reconciliation := router.Group("/api/v1/reconciliation")
+	{
+		reconciliation.POST("/runs", reconciliationHandler.CreateRun)
+		reconciliation.GET("/runs", reconciliationHandler.GetRuns)
+		reconciliation.GET("/runs/:id", reconciliationHandler.GetRunByID)
+		reconciliation.GET("/runs/:id/discrepancies", reconciliationHandler.GetDiscrepancies)
+		reconciliation.POST("/runs/:id/repair", reconciliationHandler.RepairRun)
+	}
+
+	router.GET(eventStreamPath, eventStreamHandler.StreamEvents)
+
+	webhooks := router.Group("/api/v1/webhooks")
+	{
+		webhooks.POST("", webhookHandler.CreateSubscription)
+		webhooks.GET("", webhookHandler.GetSubscriptions)
+		webhooks.GET("/:id", webhookHandler.GetSubscriptionByID)
+		webhooks.DELETE("/:id", webhookHandler.DeactivateSubscription)
+		webhooks.GET("/:id/deliveries", webhookHandler.GetDeliveries)
+		webhooks.GET("/deliveries/:deliveryId", webhookHandler.GetDeliveryByID)
+		webhooks.POST("/deliveries/:deliveryId/redeliver", webhookHandler.Redeliver)
+	}
+
+	return router, nil
 }
@@ -0,0 +1,116 @@
+package delivery
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/metrics"
+	"chargeCode/internal/usecase"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(t *testing.T) (*gin.Engine, *metrics.Metrics) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	appMetrics := metrics.New(nil)
+	router, err := SetupRouter(&config.AppConfig{}, appMetrics, &usecase.UserUseCase{}, &usecase.ChargeCodeUseCase{}, &usecase.TransactionUseCase{}, &usecase.AuditUseCase{}, &usecase.WebhookUseCase{}, &usecase.HealthUseCase{}, &usecase.TransactionLimiter{}, &usecase.FraudEngine{}, &usecase.ReconciliationUseCase{}, usecase.NewEventStream(usecase.EventStreamConfig{ClientBufferSize: 1}))
+	if err != nil {
+		t.Fatalf("SetupRouter: %v", err)
+	}
+	return router, appMetrics
+}
+
+// requestCount returns how many requests the duration histogram observed
+// with the given labels.
+func requestCount(t *testing.T, appMetrics *metrics.Metrics, method, route, status string) uint64 {
+	t.Helper()
+	families, err := appMetrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "usermanager_http_request_duration_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["method"] == method && labels["route"] == route && labels["status"] == status {
+				return metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestRouterObservesRequests(t *testing.T) {
+	router, appMetrics := newTestRouter(t)
+	router.GET("/panic", func(c *gin.Context) { panic("handler failed") })
+
+	tests := []struct {
+		path   string
+		route  string
+		status int
+	}{
+		{"/healthz", "/healthz", http.StatusOK},
+		{"/missing", "unmatched", http.StatusNotFound},
+		// Recovery turns the panic into a 500 before the metrics see it
+		{"/panic", "/panic", http.StatusInternalServerError},
+	}
+	for _, test := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("GET %s = %d, want %d", test.path, recorder.Code, test.status)
+		}
+		if count := requestCount(t, appMetrics, http.MethodGet, test.route, strconv.Itoa(test.status)); count != 1 {
+			t.Errorf("GET %s observed %d times as route %s with status %d, want once", test.path, count, test.route, test.status)
+		}
+	}
+}
+
+func TestActorVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	verification, err := ActorVerification([]string{"10.0.0.1", "192.168.0.0/16"})
+	if err != nil {
+		t.Fatalf("ActorVerification: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		actor      string
+		verified   bool
+	}{
+		{"10.0.0.1:4000", "alice", true},
+		{"192.168.3.4:4000", "alice", true},
+		{"[::ffff:10.0.0.1]:4000", "alice", true},
+		{"10.0.0.2:4000", "alice", false},
+		{"10.0.0.1:4000", "", false},
+	}
+	for _, test := range tests {
+		router := gin.New()
+		var actor *usecase.Actor
+		router.POST("/", verification, func(c *gin.Context) { actor = actorFromRequest(c) })
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.actor != "" {
+			req.Header.Set("X-Actor", test.actor)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		if actor == nil || actor.Verified != test.verified {
+			t.Errorf("X-Actor %q from %s: actor = %+v, want verified %v", test.actor, test.remoteAddr, actor, test.verified)
+		}
+	}
+
+	if _, err := ActorVerification([]string{"gateway"}); err == nil {
+		t.Errorf("ActorVerification of an invalid proxy: err = nil, want an error")
+	}
+}
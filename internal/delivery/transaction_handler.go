@@ -38,22 +38,23 @@ func NewTransactionHandler(transactionUC *usecase.TransactionUseCase) *Transacti
 // @Produce json
 // @Param Transaction body Transaction true "Transaction object to create"
 // @Success 200 {object} Transaction
+// @Failure 400,404,413,422,500 {object} Problem
 // @Router /api/v1/transaction [post]
 func (tH *TransactionHandler) CreateTransaction(c *gin.Context) {
 	var transaction usecase.Transaction
 
 	// Parse the request body into a ChargeCode struct
 	if err := c.ShouldBindJSON(&transaction); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	// At this point, chargeCode contains the data from the request body
 	// You can use it as needed, such as passing it to your use case for creation
 
-	_, err := tH.TransactionUseCase.CreateTransaction(&transaction)
+	_, err := tH.TransactionUseCase.CreateTransaction(c.Request.Context(), &transaction, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	//c.JSON(http.StatusOK, createdTransaction)
@@ -68,27 +69,59 @@ func (tH *TransactionHandler) CreateTransaction(c *gin.Context) {
 // @Produce json
 // @Param ChargeCodeTransaction body ChargeCodeTransaction true "ChargeCodeTransaction object to create"
 // @Success 200 {object} ChargeCodeTransaction
+// @Failure 400,404,409,413,422,429,500 {object} Problem
 // @Router /api/v1/transaction/charge [post]
 func (tH *TransactionHandler) CreateChargeTransaction(c *gin.Context) {
 	var chargeCodeTransaction usecase.ChargeCodeTransaction
 
 	// Parse the request body into a ChargeCode struct
 	if err := c.ShouldBindJSON(&chargeCodeTransaction); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
 	// At this point, chargeCode contains the data from the request body
 	// You can use it as needed, such as passing it to your use case for creation
 
-	_, err := tH.TransactionUseCase.CreateChargeTransaction(&chargeCodeTransaction)
+	// The actor's client IP is also used for per-IP rate limiting of redemptions
+	_, err := tH.TransactionUseCase.CreateChargeTransaction(c.Request.Context(), &chargeCodeTransaction, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// GetRedemptionFailureStats godoc
+// @Summary Get failed charge code redemptions
+// @Description Get failed redemption counters and lockouts per phone number and client IP with pagination.
+// @Tags Transaction
+// @ID get-redemption-failure-stats
+// @Produce json
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.RedemptionFailureStat
+// @Failure 400,404,422,500 {object} Problem
+// @Router /api/v1/transaction/charge/failures [get]
+func (tH *TransactionHandler) GetRedemptionFailureStats(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	stats, err := tH.TransactionUseCase.GetRedemptionFailureStats(c.Request.Context(), page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
 // GetTransactions godoc
 // @Summary Get transactions with pagination
 // @Description Get transactions with pagination.
@@ -98,21 +131,22 @@ func (tH *TransactionHandler) CreateChargeTransaction(c *gin.Context) {
 // @Param page query integer false "Page number most start from 1"
 // @Param pageSize query integer false "Number of items per page"
 // @Success 200 {object} Transaction
+// @Failure 400,404,422,500 {object} Problem
 // @Router /api/v1/transaction [get]
 func (cH *TransactionHandler) GetTransactions(c *gin.Context) {
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("page", "must be an integer"))
 		return
 	}
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("pageSize", "must be an integer"))
 		return
 	}
-	transactions, err := cH.TransactionUseCase.GetTransactions(page, pageSize)
+	transactions, err := cH.TransactionUseCase.GetTransactions(c.Request.Context(), page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, transactions)
@@ -126,13 +160,13 @@ func (cH *TransactionHandler) GetTransactions(c *gin.Context) {
 // @Produce json
 // @Param id path int true "transaction ID" Example: 123
 // @Success 200 {object} Transaction
+// @Failure 404,500 {object} Problem
 // @Router /api/v1/transaction/{id} [get]
 func (tH *TransactionHandler) GetTransactionByID(c *gin.Context) {
 	transactionID, _ := strconv.Atoi(c.Param("id"))
-	println(transactionID)
-	transaction, err := tH.TransactionUseCase.GetTransactionByID(transactionID)
+	transaction, err := tH.TransactionUseCase.GetTransactionByID(c.Request.Context(), transactionID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, transaction)
@@ -148,22 +182,23 @@ func (tH *TransactionHandler) GetTransactionByID(c *gin.Context) {
 // @Param page query int false "Page number most start from 1"
 // @Param pageSize query int false "Number of items per page"
 // @Success 200 {object} Transaction
+// @Failure 400,404,422,500 {object} Problem
 // @Router /api/v1/transaction/user/{userId} [get]
 func (tH *TransactionHandler) GetUserTransactionsByUserID(c *gin.Context) {
 	userID, _ := strconv.Atoi(c.Param("userId"))
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("page", "must be an integer"))
 		return
 	}
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("pageSize", "must be an integer"))
 		return
 	}
-	transactions, err := tH.TransactionUseCase.GetUserTransactionsByUserID(userID, page, pageSize)
+	transactions, err := tH.TransactionUseCase.GetUserTransactionsByUserID(c.Request.Context(), userID, page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, transactions)
@@ -177,12 +212,13 @@ func (tH *TransactionHandler) GetUserTransactionsByUserID(c *gin.Context) {
 // @Produce json
 // @Param userId path int true "user ID" Example: 123
 // @Success 200 {object} Transaction
+// @Failure 404,500 {object} Problem
 // @Router /api/v1/transaction/user/totalNumber/{userId} [get]
 func (tH *TransactionHandler) GetUserTotalTransaction(c *gin.Context) {
 	userID, _ := strconv.Atoi(c.Param("userId"))
-	num, err := tH.TransactionUseCase.GetUserTotalTransaction(userID)
+	num, err := tH.TransactionUseCase.GetUserTotalTransaction(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, num)
@@ -0,0 +1,113 @@
+// internal/delivery/transaction_import_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// transactionImportPath has its own body limit and timeout instead of the
+// ones of the other routes, since an import file can be large.
+const transactionImportPath = "/api/v1/transaction/import"
+
+type TransactionImportConfig struct {
+	MaxBodyBytes int64
+	MaxRows      int
+	// Timeout bounds reading the file and posting its rows
+	Timeout time.Duration
+}
+
+type TransactionImportHandler struct {
+	TransactionUseCase *usecase.TransactionUseCase `json:"TransactionUseCase"`
+	Config             TransactionImportConfig
+}
+
+func NewTransactionImportHandler(transactionUC *usecase.TransactionUseCase, config TransactionImportConfig) *TransactionImportHandler {
+	return &TransactionImportHandler{TransactionUseCase: transactionUC, Config: config}
+}
+
+// ImportTransactions godoc
+// @Summary Import transactions from CSV
+// @Description Post a batch of adjustments from a CSV file, sent as the request body with Content-Type text/csv or as the `file` field of a multipart form. The header names the columns phone, amount, type and reference in any order. Amounts are positive; type is credit or debit. Every row is checked for its format, the amount range and the balance left by the rows before it. An atomic import applies every row or none; a best_effort import applies the rows that passed. Rows skip the per-user limits and fraud rules and are audited with their reference. A row whose reference was imported before is skipped, so a file can be sent again after a failure. The report gives the result of every row.
+// @Tags Transaction
+// @ID import-transactions
+// @Accept text/csv,mpfd
+// @Produce json
+// @Param mode query string false "atomic (default) or best_effort"
+// @Param dryRun query boolean false "Only validate the rows"
+// @Param file formData file false "CSV file, when sent as a multipart form"
+// @Success 200 {object} usecase.TransactionImportReport
+// @Failure 400,413,422,429,500 {object} Problem
+// @Router /api/v1/transaction/import [post]
+func (iH *TransactionImportHandler) ImportTransactions(c *gin.Context) {
+	options := usecase.TransactionImportOptions{Mode: c.DefaultQuery("mode", usecase.ImportModeAtomic), MaxRows: iH.Config.MaxRows}
+	var err error
+	if options.DryRun, err = strconv.ParseBool(c.DefaultQuery("dryRun", "false")); err != nil {
+		c.Error(invalidParameter("dryRun", "must be true or false"))
+		return
+	}
+
+	// The server timeouts are too short for a large file
+	deadline := time.Now().Add(iH.Config.Timeout)
+	controller := http.NewResponseController(c.Writer)
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		slog.WarnContext(c.Request.Context(), "setting import read deadline", "error", err)
+	}
+	if err := controller.SetWriteDeadline(deadline.Add(10 * time.Second)); err != nil {
+		slog.WarnContext(c.Request.Context(), "setting import write deadline", "error", err)
+	}
+	ctx, cancel := context.WithDeadline(c.Request.Context(), deadline)
+	defer cancel()
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, iH.Config.MaxBodyBytes)
+	file, err := importFile(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	report, err := iH.TransactionUseCase.ImportTransactions(ctx, file, options, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importFile returns the file of a multipart form without buffering it, or
+// the request body.
+func importFile(c *gin.Context) (io.Reader, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return c.Request.Body, nil
+	}
+
+	form, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, invalidParameter("file", "must be sent in a valid multipart form")
+	}
+	for {
+		part, err := form.NextPart()
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return nil, err
+		case err == io.EOF:
+			return nil, invalidParameter("file", "is required")
+		case err != nil:
+			return nil, invalidParameter("file", "must be sent in a valid multipart form")
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+	}
+}
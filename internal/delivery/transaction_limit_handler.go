@@ -0,0 +1,98 @@
+// internal/delivery/transaction_limit_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TransactionLimitHandler struct {
+	TransactionLimiter *usecase.TransactionLimiter `json:"TransactionLimiter"`
+}
+
+func NewTransactionLimitHandler(transactionLimiter *usecase.TransactionLimiter) *TransactionLimitHandler {
+	return &TransactionLimitHandler{TransactionLimiter: transactionLimiter}
+}
+
+// GetUserLimits godoc
+// @Summary Get the transaction limits of a user
+// @Description Get the daily and monthly transaction limits of a user, the overrides they come from and how much of each is used. Limits are rolling: a transaction counts for 24 hours towards the daily limits and for 30 days towards the monthly ones. A limit of 0 means no limit.
+// @Tags Users
+// @ID get-user-limits
+// @Produce json
+// @Param userId path int true "User ID" Example: 1
+// @Success 200 {object} usecase.UserTransactionLimits
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/user/limits/{userId} [get]
+func (lh *TransactionLimitHandler) GetUserLimits(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.Error(invalidParameter("userId", "must be an integer"))
+		return
+	}
+	limits, err := lh.TransactionLimiter.GetUserLimits(c.Request.Context(), userID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, limits)
+}
+
+// SetUserLimits godoc
+// @Summary Override the transaction limits of a user
+// @Description Replace the limit overrides of a user. Omitted limits use the defaults and 0 removes a limit.
+// @Tags Users
+// @ID set-user-limits
+// @Accept json
+// @Produce json
+// @Param userId path int true "User ID" Example: 1
+// @Param limits body usecase.TransactionLimitOverrides true "Limit overrides"
+// @Success 200 {object} usecase.UserTransactionLimits
+// @Failure 400,404,413,422,500 {object} Problem
+// @Router /api/v1/user/limits/{userId} [put]
+func (lh *TransactionLimitHandler) SetUserLimits(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.Error(invalidParameter("userId", "must be an integer"))
+		return
+	}
+
+	var overrides usecase.TransactionLimitOverrides
+	if err := c.ShouldBindJSON(&overrides); err != nil {
+		c.Error(err)
+		return
+	}
+
+	limits, err := lh.TransactionLimiter.SetUserLimits(c.Request.Context(), userID, &overrides, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, limits)
+}
+
+// DeleteUserLimits godoc
+// @Summary Remove the transaction limit overrides of a user
+// @Description Remove the limit overrides of a user so that the defaults apply.
+// @Tags Users
+// @ID delete-user-limits
+// @Produce json
+// @Param userId path int true "User ID" Example: 1
+// @Success 200 {object} string "OK"
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/user/limits/{userId} [delete]
+func (lh *TransactionLimitHandler) DeleteUserLimits(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.Error(invalidParameter("userId", "must be an integer"))
+		return
+	}
+	if err := lh.TransactionLimiter.DeleteUserLimits(c.Request.Context(), userID, actorFromRequest(c)); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
@@ -13,6 +13,12 @@ type User struct {
 	ID          int     `json:"id"`
 	PhoneNumber string  `json:"PhoneNumber" binding:"required"`
 	Balance     float64 `json:"Balance"`
+	Version     int     `json:"version"`
+}
+
+// UserPatch documents the fields a merge patch of a user can set.
+type UserPatch struct {
+	PhoneNumber string `json:"PhoneNumber,omitempty"`
 }
 
 type UserHandler struct {
@@ -26,53 +32,109 @@ func NewUserHandler(userUC *usecase.UserUseCase) *UserHandler {
 
 // GetUserByPhoneNumber godoc
 // @Summary Get user by phoneNumber
-// @Description Get a user by their unique phoneNumber.
+// @Description Get a user by their unique phoneNumber. The ETag header holds the version of the user, to send as If-Match when updating it.
 // @Tags Users
 // @ID get-user-by-phoneNumber
 // @Produce json
 // @Param phoneNumber path string true "User phoneNumber" Example: 09120000000
+// @Param If-None-Match header string false "ETag of a version the client has"
 // @Success 200 {object} User
+// @Success 304 "The user did not change"
+// @Header 200 {string} ETag "Version of the user"
+// @Failure 404,422,500 {object} Problem
 // @Router /api/v1/user/{phoneNumber} [get]
 func (uh *UserHandler) GetUserByPhoneNumber(c *gin.Context) {
 	userPhoneNumber := c.Param("phoneNumber")
-	user, err := uh.UserUseCase.GetUserByPhoneNumber(userPhoneNumber)
+	user, err := uh.UserUseCase.GetUserByPhoneNumber(c.Request.Context(), userPhoneNumber)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	writeWithETag(c, user.Version, user)
 }
 
 // Updateuser godoc
 // @Summary Update a User
-// @Description Update a User using the provided data.
+// @Description Update a User using the provided data. If-Match has to hold the ETag of the user as last read; when the user changed since, for example by a transaction, the update fails with 412 and the user has to be read again.
 // @Tags Users
 // @Accept json
 // @Produce json
+// @Param If-Match header string true "ETag of the user being updated"
 // @Param User body User true "User object to update"
 // @Success 200 {object} User
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400,404,412,413,422,428,500 {object} Problem
 // @Router /api/v1/user [put]
 func (uh *UserHandler) UpdateUser(c *gin.Context) {
 	var user usecase.User
 
 	// Parse the request body into a ChargeCode struct
 	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 
-	// At this point, user contains the data from the request body
-	// You can use it as needed, such as passing it to your use case for update
+	// The version comes from If-Match rather than the body
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	user.Version = version
 
-	_, err := uh.UserUseCase.UpdateUser(&user)
+	updated, err := uh.UserUseCase.UpdateUser(c.Request.Context(), &user, actorFromRequest(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
-	//c.JSON(http.StatusOK, updateduser)
+	c.Header("ETag", etag(updated.Version))
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// PatchUser godoc
+// @Summary Partially update a User
+// @Description Change some fields of a User with a JSON merge patch (RFC 7396). Only PhoneNumber can be changed; the balance is only changed by transactions. Only the fields that differ are written. If-Match has to hold the ETag of the user as last read, as for PUT.
+// @Tags Users
+// @ID patch-user-by-id
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param userId path int true "User id" Example: 1
+// @Param If-Match header string true "ETag of the user being updated"
+// @Param patch body UserPatch true "Fields to change"
+// @Success 200 {object} User
+// @Header 200 {string} ETag "New version of the user"
+// @Failure 400,404,409,412,413,415,422,428,500 {object} Problem
+// @Router /api/v1/user/{userId} [patch]
+func (uh *UserHandler) PatchUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.Error(invalidParameter("userId", "must be an integer"))
+		return
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var patch usecase.UserPatch
+	err = readMergePatch(c, map[string]patchField{
+		"PhoneNumber": stringField(&patch.PhoneNumber),
+	}, "id", "Balance", "version")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	patched, err := uh.UserUseCase.PatchUser(c.Request.Context(), userID, version, &patch, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Header("ETag", etag(patched.Version))
+	c.JSON(http.StatusOK, patched)
+}
+
 // ListOfUserUsesChargeCode godoc
 // @Summary Get List Of Users Use ChargeCode
 // @Description Get a list of users who use a specific ChargeCode with pagination.
@@ -83,26 +145,27 @@ func (uh *UserHandler) UpdateUser(c *gin.Context) {
 // @Param page query int false "Page number most start from 1"
 // @Param pageSize query int false "Number of items per page"
 // @Success 200 {object} ChargeCode
+// @Failure 400,404,422,500 {object} Problem
 // @Router /api/v1/user/chargeCode/{chargeCodeId} [get]
 func (uh *UserHandler) ListOfUsersUseChargeCode(c *gin.Context) {
 	chargeCodeID, err := strconv.Atoi(c.Param("chargeCodeId"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("chargeCodeId", "must be an integer"))
 		return
 	}
 	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("page", "must be an integer"))
 		return
 	}
 	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("pageSize", "must be an integer"))
 		return
 	}
-	chargeCodes, err := uh.UserUseCase.ListOfUsersUseChargeCode(chargeCodeID, page, pageSize)
+	chargeCodes, err := uh.UserUseCase.ListOfUsersUseChargeCode(c.Request.Context(), chargeCodeID, page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, chargeCodes)
@@ -116,16 +179,17 @@ func (uh *UserHandler) ListOfUsersUseChargeCode(c *gin.Context) {
 // @Produce json
 // @Param userId path int true "User id" Example: 1
 // @Success 200 {object} float64
+// @Failure 400,404,500 {object} Problem
 // @Router /api/v1/user/balance/{userId} [get]
 func (uh *UserHandler) GetUserBalance(c *gin.Context) {
 	userId, err := strconv.Atoi(c.Param("userId"))
 	if err != nil {
-		c.JSON(http.StatusNotAcceptable, gin.H{"error": "parsing error"})
+		c.Error(invalidParameter("userId", "must be an integer"))
 		return
 	}
-	user, err := uh.UserUseCase.GetUserBalance(userId)
+	user, err := uh.UserUseCase.GetUserBalance(c.Request.Context(), userId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(err)
 		return
 	}
 	c.JSON(http.StatusOK, user)
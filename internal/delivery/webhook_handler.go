@@ -0,0 +1,213 @@
+// internal/delivery/webhook_handler.go
+package delivery
+
+import (
+	"chargeCode/internal/usecase"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWebhookSubscriptionModel struct {
+	URL        string   `json:"url" binding:"required" example:"https://example.com/hooks/wallet"`
+	EventTypes []string `json:"event_types" binding:"required" example:"transaction.created,charge_code.redeemed"`
+	Secret     string   `json:"secret"`
+}
+
+type WebhookHandler struct {
+	WebhookUseCase *usecase.WebhookUseCase `json:"WebhookUseCase"`
+}
+
+func NewWebhookHandler(webhookUC *usecase.WebhookUseCase) *WebhookHandler {
+	return &WebhookHandler{WebhookUseCase: webhookUC}
+}
+
+// CreateSubscription godoc
+// @Summary Create a webhook subscription
+// @Description Register a URL for a set of event types: transaction.created, charge_code.redeemed, charge_code.exhausted and user.created. Deliveries carry an X-Webhook-Signature header "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">" keyed with the secret. The secret is generated when omitted and only returned by this call.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param subscription body CreateWebhookSubscriptionModel true "Subscription to create"
+// @Success 200 {object} usecase.WebhookSubscription
+// @Failure 400,413,422,500 {object} Problem
+// @Router /api/v1/webhooks [post]
+func (wH *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var subscription usecase.WebhookSubscription
+
+	// Parse the request body into a WebhookSubscription struct
+	if err := c.ShouldBindJSON(&subscription); err != nil {
+		c.Error(err)
+		return
+	}
+
+	created, err := wH.WebhookUseCase.CreateSubscription(c.Request.Context(), &subscription, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, created)
+}
+
+// GetSubscriptions godoc
+// @Summary Get webhook subscriptions
+// @Description Get webhook subscriptions with pagination.
+// @Tags Webhook
+// @ID get-webhook-subscriptions
+// @Produce json
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.WebhookSubscription
+// @Failure 400,404,422,500 {object} Problem
+// @Router /api/v1/webhooks [get]
+func (wH *WebhookHandler) GetSubscriptions(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	subscriptions, err := wH.WebhookUseCase.GetSubscriptions(c.Request.Context(), page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// GetSubscriptionByID godoc
+// @Summary Get webhook subscription by ID
+// @Description Get a webhook subscription by its unique ID.
+// @Tags Webhook
+// @ID get-webhook-subscription-by-id
+// @Produce json
+// @Param id path int true "Subscription ID" Example: 1
+// @Success 200 {object} usecase.WebhookSubscription
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/webhooks/{id} [get]
+func (wH *WebhookHandler) GetSubscriptionByID(c *gin.Context) {
+	subscriptionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	subscription, err := wH.WebhookUseCase.GetSubscriptionByID(c.Request.Context(), subscriptionID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, subscription)
+}
+
+// DeactivateSubscription godoc
+// @Summary Deactivate a webhook subscription
+// @Description Stop delivering events to a subscription. Its delivery log is kept.
+// @Tags Webhook
+// @ID delete-webhook-subscription-by-id
+// @Produce json
+// @Param id path int true "Subscription ID" Example: 1
+// @Success 200 {object} string "OK"
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/webhooks/{id} [delete]
+func (wH *WebhookHandler) DeactivateSubscription(c *gin.Context) {
+	subscriptionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	if err := wH.WebhookUseCase.DeactivateSubscription(c.Request.Context(), subscriptionID, actorFromRequest(c)); err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, "OK")
+}
+
+// GetDeliveries godoc
+// @Summary Get webhook deliveries
+// @Description Get the deliveries of a subscription, newest first, with pagination.
+// @Tags Webhook
+// @ID get-webhook-deliveries
+// @Produce json
+// @Param id path int true "Subscription ID" Example: 1
+// @Param status query string false "pending, succeeded or dead"
+// @Param page query integer false "Page number most start from 1"
+// @Param pageSize query integer false "Number of items per page"
+// @Success 200 {array} usecase.WebhookDelivery
+// @Failure 400,404,422,500 {object} Problem
+// @Router /api/v1/webhooks/{id}/deliveries [get]
+func (wH *WebhookHandler) GetDeliveries(c *gin.Context) {
+	subscriptionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(invalidParameter("id", "must be an integer"))
+		return
+	}
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		c.Error(invalidParameter("page", "must be an integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil {
+		c.Error(invalidParameter("pageSize", "must be an integer"))
+		return
+	}
+	deliveries, err := wH.WebhookUseCase.GetDeliveries(c.Request.Context(), subscriptionID, c.Query("status"), page, pageSize)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// GetDeliveryByID godoc
+// @Summary Get webhook delivery by ID
+// @Description Get a webhook delivery with the log of every attempt.
+// @Tags Webhook
+// @ID get-webhook-delivery-by-id
+// @Produce json
+// @Param deliveryId path int true "Delivery ID" Example: 1
+// @Success 200 {object} usecase.WebhookDelivery
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/webhooks/deliveries/{deliveryId} [get]
+func (wH *WebhookHandler) GetDeliveryByID(c *gin.Context) {
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.Error(invalidParameter("deliveryId", "must be an integer"))
+		return
+	}
+	delivery, err := wH.WebhookUseCase.GetDeliveryByID(c.Request.Context(), deliveryID)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook delivery
+// @Description Queue a delivery again, including dead-lettered ones, with a fresh set of attempts.
+// @Tags Webhook
+// @ID redeliver-webhook-delivery
+// @Produce json
+// @Param deliveryId path int true "Delivery ID" Example: 1
+// @Success 200 {object} usecase.WebhookDelivery
+// @Failure 400,404,500 {object} Problem
+// @Router /api/v1/webhooks/deliveries/{deliveryId}/redeliver [post]
+func (wH *WebhookHandler) Redeliver(c *gin.Context) {
+	deliveryID, err := strconv.ParseInt(c.Param("deliveryId"), 10, 64)
+	if err != nil {
+		c.Error(invalidParameter("deliveryId", "must be an integer"))
+		return
+	}
+	delivery, err := wH.WebhookUseCase.Redeliver(c.Request.Context(), deliveryID, actorFromRequest(c))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
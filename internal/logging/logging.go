@@ -0,0 +1,87 @@
+// Package logging configures the JSON logger of the service. Records carry the
+// request ID and trace of their context and never contain a full phone number.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID of ctx, or "" when there is none.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// New returns a JSON logger writing records of at least level to w.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: maskAttr,
+	})
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// contextHandler adds the request ID and trace of the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()), slog.String("span_id", spanContext.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// phoneNumberPattern matches Iranian mobile numbers, in local or
+// international form, wherever they appear in a string.
+var phoneNumberPattern = regexp.MustCompile(`(?:\+98|0098|0)?9\d{9}`)
+
+// MaskPhoneNumbers replaces the middle digits of every phone number in s,
+// e.g. 09121234567 becomes 0912*****67.
+func MaskPhoneNumbers(s string) string {
+	return phoneNumberPattern.ReplaceAllStringFunc(s, func(phoneNumber string) string {
+		masked := []byte(phoneNumber)
+		for i := len(masked) - 7; i < len(masked)-2; i++ {
+			masked[i] = '*'
+		}
+		return string(masked)
+	})
+}
+
+// maskAttr masks phone numbers in the message, string values and errors,
+// which often quote the failing value.
+func maskAttr(groups []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(MaskPhoneNumbers(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			attr.Value = slog.StringValue(MaskPhoneNumbers(err.Error()))
+		}
+	}
+	return attr
+}
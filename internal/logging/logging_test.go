@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMaskPhoneNumbers(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"09121234567", "0912*****67"},
+		{"+989121234567", "+98912*****67"},
+		{"00989121234567", "0098912*****67"},
+		{"9121234567", "912*****67"},
+		{"user 09121234567 paid 09351234567", "user 0912*****67 paid 0935*****67"},
+		// Not a mobile number
+		{"order 12345678901", "order 12345678901"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if masked := MaskPhoneNumbers(test.s); masked != test.want {
+			t.Errorf("MaskPhoneNumbers(%q) = %q, want %q", test.s, masked, test.want)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	ctx := WithRequestID(context.Background(), "req-1")
+
+	logger.DebugContext(ctx, "not logged")
+	logger.InfoContext(ctx, "redeemed by 09121234567", "phone_number", "09121234567", "amount", 50,
+		"error", errors.New(`user "09121234567" not found`))
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("decoding %s: %v", buf.Bytes(), err)
+	}
+	want := map[string]interface{}{
+		"msg":          "redeemed by 0912*****67",
+		"phone_number": "0912*****67",
+		"amount":       float64(50),
+		"error":        `user "0912*****67" not found`,
+		"request_id":   "req-1",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+
+	// A context without a request ID or trace adds neither
+	buf.Reset()
+	logger.Info("started")
+	if bytes.Contains(buf.Bytes(), []byte("request_id")) || bytes.Contains(buf.Bytes(), []byte("trace_id")) {
+		t.Errorf("record %s has a request ID or trace", buf.Bytes())
+	}
+}
+
+func TestLoggerTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+	})
+	logger.InfoContext(trace.ContextWithSpanContext(context.Background(), spanContext), "redeemed")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("decoding %s: %v", buf.Bytes(), err)
+	}
+	if record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || record["span_id"] != "00f067aa0ba902b7" {
+		t.Errorf("record = %v, want the trace and span ID", record)
+	}
+}
@@ -0,0 +1,154 @@
+// Package metrics exposes Prometheus metrics of the service. Every Metrics has
+// its own registry, so nothing is registered globally.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "usermanager"
+
+// Metrics holds the registry and the collectors of the service. It implements
+// usecase.BusinessMetrics and cache.Metrics.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	httpRequestDuration *prometheus.HistogramVec
+	redemptions         *prometheus.CounterVec
+	redemptionFailures  *prometheus.CounterVec
+	transactions        *prometheus.CounterVec
+	transactionVolume   *prometheus.CounterVec
+	insufficientFunds   prometheus.Counter
+	fraudDecisions      *prometheus.CounterVec
+	cacheRequests       *prometheus.CounterVec
+}
+
+// New creates the metrics of the service. When db is not nil its connection
+// pool statistics are exported as well.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by method, route and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		redemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "charge_code_redemptions_total",
+			Help:      "Successful charge code redemptions by charge code.",
+		}, []string{"charge_code_id"}),
+		redemptionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "charge_code_redemption_failures_total",
+			Help:      "Failed charge code redemptions by reason.",
+		}, []string{"reason"}),
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_total",
+			Help:      "Created transactions by sign of the amount.",
+		}, []string{"sign"}),
+		transactionVolume: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transaction_volume_total",
+			Help:      "Absolute amount of created transactions by sign of the amount.",
+		}, []string{"sign"}),
+		insufficientFunds: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transactions_insufficient_funds_total",
+			Help:      "Transactions rejected for insufficient funds.",
+		}),
+		fraudDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fraud_decisions_total",
+			Help:      "Fraud decisions on transactions and redemptions by kind and action.",
+		}, []string{"kind", "action"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_requests_total",
+			Help:      "Cache lookups by cache and result.",
+		}, []string{"cache", "result"}),
+	}
+
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.redemptions,
+		m.redemptionFailures,
+		m.transactions,
+		m.transactionVolume,
+		m.insufficientFunds,
+		m.fraudDecisions,
+		m.cacheRequests,
+	)
+	if db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+	return m
+}
+
+// Handler serves the metrics of the registry.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// Middleware observes the duration of every request. Requests that match no
+// route are labelled "unmatched" to keep the number of series bounded.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		m.httpRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+func (m *Metrics) ChargeCodeRedeemed(chargeCodeID int) {
+	m.redemptions.WithLabelValues(strconv.Itoa(chargeCodeID)).Inc()
+}
+
+func (m *Metrics) RedemptionFailed(reason string) {
+	m.redemptionFailures.WithLabelValues(reason).Inc()
+}
+
+func (m *Metrics) TransactionCreated(amount float64) {
+	sign := "credit"
+	if amount < 0 {
+		sign = "debit"
+		amount = -amount
+	}
+	m.transactions.WithLabelValues(sign).Inc()
+	m.transactionVolume.WithLabelValues(sign).Add(amount)
+}
+
+func (m *Metrics) InsufficientFunds() {
+	m.insufficientFunds.Inc()
+}
+
+func (m *Metrics) FraudDecision(kind string, action string) {
+	m.fraudDecisions.WithLabelValues(kind, action).Inc()
+}
+
+func (m *Metrics) CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheRequests.WithLabelValues(cache, result).Inc()
+}
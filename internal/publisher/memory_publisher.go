@@ -0,0 +1,34 @@
+package publisher
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"sync"
+)
+
+// MemoryPublisher keeps published events in memory. It is meant for local
+// development and tests.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []*usecase.Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (mp *MemoryPublisher) Publish(ctx context.Context, event *usecase.Event) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	mp.events = append(mp.events, event)
+	return nil
+}
+
+// Events returns the published events in the order they were published.
+func (mp *MemoryPublisher) Events() []*usecase.Event {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	events := make([]*usecase.Event, len(mp.events))
+	copy(events, mp.events)
+	return events
+}
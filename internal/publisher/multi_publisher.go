@@ -0,0 +1,28 @@
+package publisher
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+)
+
+// MultiPublisher publishes every event to all of its publishers. It fails
+// when any of them fails, so the relay retries the event on all of them;
+// publishers must therefore tolerate duplicates.
+type MultiPublisher struct {
+	publishers []usecase.EventPublisher
+}
+
+func NewMultiPublisher(publishers ...usecase.EventPublisher) *MultiPublisher {
+	return &MultiPublisher{publishers: publishers}
+}
+
+func (mp *MultiPublisher) Publish(ctx context.Context, event *usecase.Event) error {
+	var errs []error
+	for _, publisher := range mp.publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package publisher
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// NDJSONPublisher appends every event as one JSON line to a file. The file is
+// synced before Publish returns, so an acknowledged event survives a crash.
+type NDJSONPublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewNDJSONPublisher(path string) (*NDJSONPublisher, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONPublisher{file: file}, nil
+}
+
+func (np *NDJSONPublisher) Publish(ctx context.Context, event *usecase.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	np.mu.Lock()
+	defer np.mu.Unlock()
+
+	if _, err := np.file.Write(line); err != nil {
+		return err
+	}
+	return np.file.Sync()
+}
+
+func (np *NDJSONPublisher) Close() error {
+	np.mu.Lock()
+	defer np.mu.Unlock()
+	return np.file.Close()
+}
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// AuditRepository writes to the append-only audit_log table. Triggers on the
+// table reject every UPDATE and DELETE.
+type AuditRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewAuditRepository(db *sql.DB, config *config.AppConfig) *AuditRepository {
+	return &AuditRepository{db: db, config: config}
+}
+
+// nullableJSON stores an empty snapshot as NULL.
+func nullableJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+func (ar *AuditRepository) CreateAuditLog(ctx context.Context, auditLog *usecase.AuditLog) error {
+
+	result, err := ar.db.ExecContext(ctx, `
+		INSERT INTO audit_log (actor, actor_verified, action, entity_type, entity_id, before_data, after_data, request_id, client_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, auditLog.Actor, auditLog.ActorVerified, auditLog.Action, auditLog.EntityType, auditLog.EntityID,
+		nullableJSON(auditLog.Before), nullableJSON(auditLog.After), auditLog.RequestID, auditLog.ClientIP)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating audit log", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+
+	auditID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading audit log id", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+	auditLog.AuditID = int(auditID)
+	return nil
+}
+
+func (ar *AuditRepository) GetAuditLogs(ctx context.Context, filter *usecase.AuditLogFilter, page int, pageSize int) ([]*usecase.AuditLog, error) {
+
+	if page > ar.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > ar.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Build the WHERE clause from the filter fields that are set
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, filter.EntityID)
+	}
+	if filter.RequestID != "" {
+		conditions = append(conditions, "request_id = ?")
+		args = append(args, filter.RequestID)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	rows, err := ar.db.QueryContext(ctx, `
+		SELECT audit_id, actor, actor_verified, action, entity_type, entity_id, before_data, after_data, request_id, client_ip, created_at
+		FROM audit_log
+		`+where+`
+		ORDER BY audit_id DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying audit logs", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	auditLogs := []*usecase.AuditLog{}
+
+	for rows.Next() {
+		var auditLog usecase.AuditLog
+		var before, after, requestID, clientIP sql.NullString
+		var createdAt string
+
+		if err := rows.Scan(&auditLog.AuditID, &auditLog.Actor, &auditLog.ActorVerified, &auditLog.Action, &auditLog.EntityType, &auditLog.EntityID,
+			&before, &after, &requestID, &clientIP, &createdAt); err != nil {
+			slog.ErrorContext(ctx, "error scanning audit log row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+
+		if before.Valid {
+			auditLog.Before = []byte(before.String)
+		}
+		if after.Valid {
+			auditLog.After = []byte(after.String)
+		}
+		auditLog.RequestID = requestID.String
+		auditLog.ClientIP = clientIP.String
+
+		format := "2006-01-02 15:04:05"
+		parsedTime, err := time.Parse(format, createdAt)
+		if err != nil {
+			slog.ErrorContext(ctx, "error parsing time", "error", err)
+			return nil, usecase.InternalError("time parse error", err)
+		}
+		auditLog.CreatedAt = parsedTime
+
+		auditLogs = append(auditLogs, &auditLog)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+
+	if len(auditLogs) > 0 {
+		return auditLogs, nil
+	}
+	return nil, usecase.NotFoundError("audit logs not found")
+}
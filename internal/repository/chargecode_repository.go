@@ -4,14 +4,15 @@ package repository
 import (
 	"chargeCode/internal/config"
 	"chargeCode/internal/usecase"
+	"context"
 	"database/sql"
-	"errors"
-	"fmt"
+	"log/slog"
+	"strings"
 )
 
 type ChargeCodeRepository struct {
 	// Implement data storage and retrieval methods here
-	db     *sql.DB
+	db     executor
 	config *config.AppConfig
 }
 
@@ -21,35 +22,30 @@ func NewChargeCodeRepository(db *sql.DB, config *config.AppConfig) *ChargeCodeRe
 	return &ChargeCodeRepository{db: db, config: config}
 }
 
-func (cu *ChargeCodeRepository) GetChargeCodes(page int, pageSize int) ([]*usecase.ChargeCode, error) {
+func (cu *ChargeCodeRepository) GetChargeCodes(ctx context.Context, statuses []string, page int, pageSize int) ([]*usecase.ChargeCode, error) {
 
-	if page > cu.config.MaxPage {
-		return nil, errors.New("page exceeds the maximum allowed limit")
+	if page > cu.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
 	}
 
-	if pageSize > cu.config.MaxPageSize {
-		return nil, errors.New("page size exceeds the maximum allowed limit")
-	}
-
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	if pageSize > cu.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
 	}
 
 	// Calculate the OFFSET based on the page number and page size
 	offset := (page - 1) * pageSize
 	// Query all transactions from the 'transaction' table
 	query := `
-        SELECT charge_code_id, code, max_uses, current_uses, amount
+        SELECT charge_code_id, code, max_uses, current_uses, amount, version, status
         FROM charge_code
+        WHERE ` + statusCondition("status", statuses) + `
         LIMIT ? OFFSET ?
     `
 
-	rows, err := cu.db.Query(query, pageSize, offset)
+	rows, err := cu.db.QueryContext(ctx, query, append(statusArgs(statuses), pageSize, offset)...)
 	if err != nil {
-		fmt.Printf("Error querying charge codes: %v", err)
-		return nil, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying charge codes", "error", err)
+		return nil, usecase.InternalError("database query error", err)
 	}
 
 	defer rows.Close()
@@ -63,21 +59,23 @@ func (cu *ChargeCodeRepository) GetChargeCodes(page int, pageSize int) ([]*useca
 		var MaxUses int
 		var CurrentUses int
 		var Amount float64
+		var Version int
+		var Status string
 
-		if err := rows.Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount); err != nil {
-			fmt.Printf("Error scanning charge code row: %v", err)
-			return nil, errors.New("database query error")
+		if err := rows.Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount, &Version, &Status); err != nil {
+			slog.ErrorContext(ctx, "error scanning charge code row", "error", err)
+			return nil, usecase.InternalError("database query error", err)
 		}
 
 		// Adding a new User object to the slice
 
-		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount}
+		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount, Version: Version, Status: Status}
 		ChargeCodes = append(ChargeCodes, newChargeCode)
 		// Process the retrieved data here
 	}
 
 	if err := rows.Err(); err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
 	}
 
 	// Return the list of transactions and no error
@@ -85,22 +83,17 @@ func (cu *ChargeCodeRepository) GetChargeCodes(page int, pageSize int) ([]*useca
 	if len(ChargeCodes) > 0 {
 		return ChargeCodes, nil // Success case, return charge codes and no error
 	}
-	return nil, errors.New("charge codes not found")
+	return nil, usecase.NotFoundError("charge codes not found")
 
 	// Replace someError with an actual error value
 }
 
-func (cu *ChargeCodeRepository) GetChargeCodeByID(id int) (*usecase.ChargeCode, error) {
+func (cu *ChargeCodeRepository) GetChargeCodeByID(ctx context.Context, id int) (*usecase.ChargeCode, error) {
 
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
-	}
 	// Query all transactions from the 'transaction' table
 
 	query := `
-	SELECT charge_code_id, code, max_uses, current_uses, amount
+	SELECT charge_code_id, code, max_uses, current_uses, amount, version, status
 	FROM charge_code
 	WHERE charge_code_id = ?
 	`
@@ -111,36 +104,33 @@ func (cu *ChargeCodeRepository) GetChargeCodeByID(id int) (*usecase.ChargeCode,
 		MaxUses      int
 		CurrentUses  int
 		Amount       float64
+		Version      int
+		Status       string
 	)
 
-	err := cu.db.QueryRow(query, id).Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount)
+	err := cu.db.QueryRowContext(ctx, query, id).Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount, &Version, &Status)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("charge code not found")
+			return nil, usecase.NotFoundError("charge code not found")
 		} else {
-			fmt.Printf("Error querying charge code by ID: %v", err)
-			return nil, errors.New("database query error")
+			slog.ErrorContext(ctx, "error querying charge code by ID", "error", err)
+			return nil, usecase.InternalError("database query error", err)
 		}
 	} else {
 
-		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount}
+		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount, Version: Version, Status: Status}
 
 		return newChargeCode, nil // Success case, return user and no error
 
 	}
 }
 
-func (cu *ChargeCodeRepository) GetChargeCodeByCode(code string) (*usecase.ChargeCode, error) {
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
-	}
+func (cu *ChargeCodeRepository) GetChargeCodeByCode(ctx context.Context, code string) (*usecase.ChargeCode, error) {
 	// Query all transactions from the 'transaction' table
 
 	query := `
-	SELECT charge_code_id, code, max_uses, current_uses, amount
+	SELECT charge_code_id, code, max_uses, current_uses, amount, version, status
 	FROM charge_code
 	WHERE code = ?
 	`
@@ -151,125 +141,194 @@ func (cu *ChargeCodeRepository) GetChargeCodeByCode(code string) (*usecase.Charg
 		MaxUses      int
 		CurrentUses  int
 		Amount       float64
+		Version      int
+		Status       string
 	)
 
-	err := cu.db.QueryRow(query, code).Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount)
+	err := cu.db.QueryRowContext(ctx, query, code).Scan(&ChargeCodeID, &Code, &MaxUses, &CurrentUses, &Amount, &Version, &Status)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("charge code not found")
+			return nil, usecase.NotFoundError("charge code not found")
 		} else {
-			fmt.Printf("Error querying charge code by code: %v", err)
-			return nil, errors.New("database query error")
+			slog.ErrorContext(ctx, "error querying charge code by code", "error", err)
+			return nil, usecase.InternalError("database query error", err)
 		}
 	} else {
 
-		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount}
+		newChargeCode := &usecase.ChargeCode{ChargeCodeID: ChargeCodeID, Code: Code, MaxUses: MaxUses, CurrentUses: CurrentUses, Amount: Amount, Version: Version, Status: Status}
 
 		return newChargeCode, nil // Success case, return user and no error
 
 	}
 }
 
-func (cu *ChargeCodeRepository) CreateChargeCode(chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+func (cu *ChargeCodeRepository) CreateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
 
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	if chargeCode.Amount > cu.config.Limits().MaxChargeCodeAmount {
+		return nil, usecase.ValidationError("amount is very big")
 	}
 
-	if chargeCode.Amount > cu.config.MaxChargeCodeAmount {
-		return nil, errors.New("amount is very big")
-	}
-
-	if chargeCode.Amount < cu.config.MinChargeCodeAmount {
-		return nil, errors.New("amount is very small")
+	if chargeCode.Amount < cu.config.Limits().MinChargeCodeAmount {
+		return nil, usecase.ValidationError("amount is very small")
 	}
 
 	// Insert the new charge code into the 'charge_code' table
-	_, err := cu.db.Exec(`
+	result, err := cu.db.ExecContext(ctx, `
 	   INSERT INTO charge_code (code, max_uses, amount)
 	   VALUES (?, ?, ?)
    `, chargeCode.Code, chargeCode.MaxUses, chargeCode.Amount)
 	if err != nil {
-		fmt.Printf("Error creating charge code: %v", err)
-		return nil, errors.New("database error")
+		if isDuplicateEntry(err) {
+			return nil, usecase.ConflictError("a charge code with the same code already exists")
+		}
+		slog.ErrorContext(ctx, "error creating charge code", "error", err)
+		return nil, usecase.InternalError("database error", err)
 	}
 
+	chargeCodeID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading charge code id", "error", err)
+		return nil, usecase.InternalError("database error", err)
+	}
+	chargeCode.ChargeCodeID = int(chargeCodeID)
+	chargeCode.CurrentUses = 0
+	chargeCode.Version = 1
+	chargeCode.Status = usecase.ChargeCodeActive
+
 	return chargeCode, nil
 }
 
-func (cu *ChargeCodeRepository) DeleteChargeCode(id int) error {
-
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return errors.New("internal Server Error")
-	}
-	// Delete the charge code by ID from the 'charge_code' table
-	_, err := cu.db.Exec(`
-   DELETE FROM charge_code
-   WHERE charge_code_id = ?
-`, id)
+// SetChargeCodeStatus changes the status of a charge code. Charge codes are
+// never deleted, so that their redemptions keep pointing at them.
+func (cu *ChargeCodeRepository) SetChargeCodeStatus(ctx context.Context, id int, status string) (*usecase.ChargeCode, error) {
+	_, err := cu.db.ExecContext(ctx, `
+	   UPDATE charge_code
+	   SET status = ?, version = version + 1
+	   WHERE charge_code_id = ?
+   `, status, id)
 	if err != nil {
-		fmt.Printf("Error deleting charge code: %v", err)
-		return errors.New("database error")
+		slog.ErrorContext(ctx, "error changing charge code status", "error", err, "charge_code_id", id)
+		return nil, usecase.InternalError("database error", err)
 	}
-	return nil
+
+	return cu.GetChargeCodeByID(ctx, id)
 }
 
-func (cu *ChargeCodeRepository) UpdateChargeCode(chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+func (cu *ChargeCodeRepository) UpdateChargeCode(ctx context.Context, chargeCode *usecase.ChargeCode) (*usecase.ChargeCode, error) {
+
+	if chargeCode.Amount > cu.config.Limits().MaxChargeCodeAmount {
+		return nil, usecase.ValidationError("amount is very big")
 	}
 
-	// Update the charge code by ID in the 'charge_code' table
-	_, err := cu.db.Exec(`
+	if chargeCode.Amount < cu.config.Limits().MinChargeCodeAmount {
+		return nil, usecase.ValidationError("amount is very small")
+	}
+
+	// Update the charge code by ID in the 'charge_code' table, unless it
+	// changed since chargeCode.Version was read. current_uses is only
+	// changed by redemptions.
+	result, err := cu.db.ExecContext(ctx, `
 	   UPDATE charge_code
-	   SET code = ?, max_uses = ?, amount = ?, current_uses = ?
-	   WHERE charge_code_id = ?
-   `, chargeCode.Code, chargeCode.MaxUses, chargeCode.Amount, chargeCode.CurrentUses, chargeCode.ChargeCodeID)
+	   SET code = ?, max_uses = ?, amount = ?, version = version + 1
+	   WHERE charge_code_id = ? AND version = ?
+   `, chargeCode.Code, chargeCode.MaxUses, chargeCode.Amount, chargeCode.ChargeCodeID, chargeCode.Version)
 	if err != nil {
-		fmt.Printf("Error deleting charge code: %v", err)
-		return nil, errors.New("database error")
+		if isDuplicateEntry(err) {
+			return nil, usecase.ConflictError("a charge code with the same code already exists")
+		}
+		slog.ErrorContext(ctx, "error updating charge code", "error", err)
+		return nil, usecase.InternalError("database error", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading updated charge codes", "error", err)
+		return nil, usecase.InternalError("database error", err)
+	}
+	if updated == 0 {
+		return nil, usecase.ErrVersionMismatch
 	}
 
+	chargeCode.Version++
 	return chargeCode, nil
 }
 
-func (cu *ChargeCodeRepository) GetUserChargeCodes(userId int, page int, pageSize int) ([]*usecase.ChargeCode, error) {
+func (cu *ChargeCodeRepository) PatchChargeCode(ctx context.Context, id int, version int, patch *usecase.ChargeCodePatch) (*usecase.ChargeCode, error) {
+	// Only write the columns set in the patch
+	var (
+		columns []string
+		args    []interface{}
+	)
+	if patch.Code != nil {
+		columns, args = append(columns, "code = ?"), append(args, *patch.Code)
+	}
+	if patch.MaxUses != nil {
+		columns, args = append(columns, "max_uses = ?"), append(args, *patch.MaxUses)
+	}
+	if patch.Amount != nil {
+		if *patch.Amount > cu.config.Limits().MaxChargeCodeAmount {
+			return nil, usecase.ValidationError("amount is very big")
+		}
+		if *patch.Amount < cu.config.Limits().MinChargeCodeAmount {
+			return nil, usecase.ValidationError("amount is very small")
+		}
+		columns, args = append(columns, "amount = ?"), append(args, *patch.Amount)
+	}
+	if len(columns) == 0 {
+		return cu.GetChargeCodeByID(ctx, id)
+	}
+
+	result, err := cu.db.ExecContext(ctx, `
+	   UPDATE charge_code
+	   SET `+strings.Join(columns, ", ")+`, version = version + 1
+	   WHERE charge_code_id = ? AND version = ?
+   `, append(args, id, version)...)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, usecase.ConflictError("a charge code with the same code already exists")
+		}
+		slog.ErrorContext(ctx, "error patching charge code", "error", err, "charge_code_id", id)
+		return nil, usecase.InternalError("database error", err)
+	}
 
-	// Ensure the database connection is valid
-	if err := cu.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading patched charge codes", "error", err, "charge_code_id", id)
+		return nil, usecase.InternalError("database error", err)
+	}
+	if updated == 0 {
+		return nil, usecase.ErrVersionMismatch
 	}
-	if page > cu.config.MaxPage {
-		return nil, errors.New("page exceeds the maximum allowed limit")
+
+	return cu.GetChargeCodeByID(ctx, id)
+}
+
+func (cu *ChargeCodeRepository) GetUserChargeCodes(ctx context.Context, userId int, statuses []string, page int, pageSize int) ([]*usecase.ChargeCode, error) {
+
+	if page > cu.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
 	}
 
-	if pageSize > cu.config.MaxPageSize {
-		return nil, errors.New("page size exceeds the maximum allowed limit")
+	if pageSize > cu.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
 	}
 
 	// Calculate the offset based on the page and pageSize
 	offset := (page - 1) * pageSize
 
 	// Query the charge codes by user ID with pagination from the 'user_charge_code' table
-	rows, err := cu.db.Query(`
-        SELECT uc.charge_code_id, cc.code, cc.max_uses, cc.current_uses, cc.amount
+	rows, err := cu.db.QueryContext(ctx, `
+        SELECT uc.charge_code_id, cc.code, cc.max_uses, cc.current_uses, cc.amount, cc.version, cc.status
         FROM user_charge_code uc
         INNER JOIN charge_code cc ON uc.charge_code_id = cc.charge_code_id
-        WHERE uc.user_id = ?
+        WHERE uc.user_id = ? AND `+statusCondition("cc.status", statuses)+`
         LIMIT ? OFFSET ?
-    `, userId, pageSize, offset)
+    `, append(append([]interface{}{userId}, statusArgs(statuses)...), pageSize, offset)...)
 
 	if err != nil {
-		fmt.Printf("Error querying user charge codes: %v", err)
-		return nil, errors.New("database error")
+		slog.ErrorContext(ctx, "error querying user charge codes", "error", err)
+		return nil, usecase.InternalError("database error", err)
 	}
 	defer rows.Close()
 
@@ -281,27 +340,46 @@ func (cu *ChargeCodeRepository) GetUserChargeCodes(userId int, page int, pageSiz
 		var code string
 		var maxUses, currentUses int
 		var amount float64
+		var version int
+		var status string
 
-		if err := rows.Scan(&chargeCodeID, &code, &maxUses, &currentUses, &amount); err != nil {
-			fmt.Printf("Error scanning charge code row: %v", err)
-			return nil, errors.New("database error")
+		if err := rows.Scan(&chargeCodeID, &code, &maxUses, &currentUses, &amount, &version, &status); err != nil {
+			slog.ErrorContext(ctx, "error scanning charge code row", "error", err)
+			return nil, usecase.InternalError("database error", err)
 		}
 
 		// Adding a new User object to the slice
 
-		newChargeCode := &usecase.ChargeCode{ChargeCodeID: chargeCodeID, Code: code, MaxUses: maxUses, CurrentUses: currentUses, Amount: amount}
+		newChargeCode := &usecase.ChargeCode{ChargeCodeID: chargeCodeID, Code: code, MaxUses: maxUses, CurrentUses: currentUses, Amount: amount, Version: version, Status: status}
 		ChargeCodes = append(ChargeCodes, newChargeCode)
 		// Process the retrieved data here
 	}
 
 	if err := rows.Err(); err != nil {
-		fmt.Printf("Error iterating through charge code rows: %v", err)
-		return nil, errors.New("database error")
+		slog.ErrorContext(ctx, "error iterating through charge code rows", "error", err)
+		return nil, usecase.InternalError("database error", err)
 	}
 
 	// Return the list of transactions and no error
 	if len(ChargeCodes) > 0 {
 		return ChargeCodes, nil // Success case, return charge codes and no error
 	}
-	return nil, errors.New("charge codes not found")
+	return nil, usecase.NotFoundError("charge codes not found")
+}
+
+// statusCondition filters column by statuses, or matches every row when
+// statuses is empty. statusArgs are its arguments.
+func statusCondition(column string, statuses []string) string {
+	if len(statuses) == 0 {
+		return "TRUE"
+	}
+	return column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(statuses)), ", ") + ")"
+}
+
+func statusArgs(statuses []string) []interface{} {
+	args := make([]interface{}, 0, len(statuses))
+	for _, status := range statuses {
+		args = append(args, status)
+	}
+	return args
 }
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestChargeCodeRepositoryCreateAndGet(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+
+	created := createChargeCode(t, repo, "SPRING", 10, 5000)
+	if created.ChargeCodeID == 0 || created.Version != 1 || created.Status != usecase.ChargeCodeActive {
+		t.Fatalf("created charge code = %+v", created)
+	}
+
+	byCode, err := repo.GetChargeCodeByCode(ctx, "SPRING")
+	if err != nil {
+		t.Fatalf("GetChargeCodeByCode: %v", err)
+	}
+	if *byCode != *created {
+		t.Errorf("GetChargeCodeByCode = %+v, want %+v", byCode, created)
+	}
+
+	byID, err := repo.GetChargeCodeByID(ctx, created.ChargeCodeID)
+	if err != nil {
+		t.Fatalf("GetChargeCodeByID: %v", err)
+	}
+	if *byID != *created {
+		t.Errorf("GetChargeCodeByID = %+v, want %+v", byID, created)
+	}
+
+	if _, err := repo.GetChargeCodeByCode(ctx, "MISSING"); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetChargeCodeByCode of a missing code: err = %v, want not found", err)
+	}
+	if _, err := repo.GetChargeCodeByID(ctx, created.ChargeCodeID+1); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetChargeCodeByID of a missing id: err = %v, want not found", err)
+	}
+}
+
+func TestChargeCodeRepositoryCreateAmountLimits(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+
+	for _, amount := range []float64{999, 1000001} {
+		_, err := repo.CreateChargeCode(context.Background(), &usecase.ChargeCode{Code: "LIMITS", MaxUses: 1, Amount: amount})
+		if !errors.Is(err, usecase.ErrValidation) {
+			t.Errorf("CreateChargeCode with amount %v: err = %v, want validation error", amount, err)
+		}
+	}
+}
+
+func TestChargeCodeRepositoryGetChargeCodesPagination(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+	statuses := []string{usecase.ChargeCodeActive}
+
+	for i := 1; i <= 5; i++ {
+		createChargeCode(t, repo, fmt.Sprintf("CODE%d", i), 1, 1000)
+	}
+
+	seen := map[int]bool{}
+	for page, want := range map[int]int{1: 2, 2: 2, 3: 1} {
+		chargeCodes, err := repo.GetChargeCodes(ctx, statuses, page, 2)
+		if err != nil {
+			t.Fatalf("GetChargeCodes page %d: %v", page, err)
+		}
+		if len(chargeCodes) != want {
+			t.Errorf("GetChargeCodes page %d returned %d charge codes, want %d", page, len(chargeCodes), want)
+		}
+		for _, chargeCode := range chargeCodes {
+			seen[chargeCode.ChargeCodeID] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("pages returned %d distinct charge codes, want 5", len(seen))
+	}
+
+	if _, err := repo.GetChargeCodes(ctx, statuses, 4, 2); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetChargeCodes past the last page: err = %v, want not found", err)
+	}
+	if _, err := repo.GetChargeCodes(ctx, statuses, 41, 2); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("GetChargeCodes past MaxPage: err = %v, want validation error", err)
+	}
+	if _, err := repo.GetChargeCodes(ctx, statuses, 1, 31); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("GetChargeCodes past MaxPageSize: err = %v, want validation error", err)
+	}
+}
+
+func TestChargeCodeRepositoryGetChargeCodesByStatus(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+
+	active := createChargeCode(t, repo, "ACTIVE", 1, 1000)
+	paused := createChargeCode(t, repo, "PAUSED", 1, 1000)
+	updated, err := repo.SetChargeCodeStatus(ctx, paused.ChargeCodeID, usecase.ChargeCodePaused)
+	if err != nil {
+		t.Fatalf("SetChargeCodeStatus: %v", err)
+	}
+	if updated.Status != usecase.ChargeCodePaused || updated.Version != 2 {
+		t.Errorf("SetChargeCodeStatus = %+v, want paused at version 2", updated)
+	}
+
+	chargeCodes, err := repo.GetChargeCodes(ctx, []string{usecase.ChargeCodeActive}, 1, 10)
+	if err != nil {
+		t.Fatalf("GetChargeCodes: %v", err)
+	}
+	if len(chargeCodes) != 1 || chargeCodes[0].ChargeCodeID != active.ChargeCodeID {
+		t.Errorf("GetChargeCodes of active codes = %+v, want only %s", chargeCodes, active.Code)
+	}
+
+	chargeCodes, err = repo.GetChargeCodes(ctx, []string{usecase.ChargeCodeActive, usecase.ChargeCodePaused}, 1, 10)
+	if err != nil {
+		t.Fatalf("GetChargeCodes: %v", err)
+	}
+	if len(chargeCodes) != 2 {
+		t.Errorf("GetChargeCodes of active and paused codes returned %d charge codes, want 2", len(chargeCodes))
+	}
+}
+
+func TestChargeCodeRepositoryUpdateChargeCode(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+
+	created := createChargeCode(t, repo, "SUMMER", 10, 5000)
+	change := *created
+	change.MaxUses = 20
+	change.CurrentUses = 5
+	updated, err := repo.UpdateChargeCode(ctx, &change)
+	if err != nil {
+		t.Fatalf("UpdateChargeCode: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("UpdateChargeCode version = %d, want 2", updated.Version)
+	}
+
+	stored, err := repo.GetChargeCodeByID(ctx, created.ChargeCodeID)
+	if err != nil {
+		t.Fatalf("GetChargeCodeByID: %v", err)
+	}
+	if stored.MaxUses != 20 || stored.CurrentUses != 0 || stored.Version != 2 {
+		t.Errorf("stored charge code = %+v, want max_uses 20 and current_uses 0 at version 2", stored)
+	}
+
+	tooBig := *stored
+	tooBig.Amount = 1000001
+	if _, err := repo.UpdateChargeCode(ctx, &tooBig); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("UpdateChargeCode past the maximum amount: err = %v, want validation error", err)
+	}
+
+	// created still holds version 1
+	if _, err := repo.UpdateChargeCode(ctx, created); !errors.Is(err, usecase.ErrVersionMismatch) {
+		t.Errorf("UpdateChargeCode of a stale version: err = %v, want version mismatch", err)
+	}
+}
+
+func TestChargeCodeRepositoryPatchChargeCode(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+
+	createChargeCode(t, repo, "TAKEN", 1, 1000)
+	created := createChargeCode(t, repo, "AUTUMN", 10, 5000)
+
+	amount := 7000.0
+	patched, err := repo.PatchChargeCode(ctx, created.ChargeCodeID, created.Version, &usecase.ChargeCodePatch{Amount: &amount})
+	if err != nil {
+		t.Fatalf("PatchChargeCode: %v", err)
+	}
+	if patched.Amount != amount || patched.Code != "AUTUMN" || patched.MaxUses != 10 || patched.Version != 2 {
+		t.Errorf("PatchChargeCode = %+v, want only the amount changed at version 2", patched)
+	}
+
+	if _, err := repo.PatchChargeCode(ctx, created.ChargeCodeID, created.Version, &usecase.ChargeCodePatch{Amount: &amount}); !errors.Is(err, usecase.ErrVersionMismatch) {
+		t.Errorf("PatchChargeCode of a stale version: err = %v, want version mismatch", err)
+	}
+
+	taken := "TAKEN"
+	if _, err := repo.PatchChargeCode(ctx, created.ChargeCodeID, patched.Version, &usecase.ChargeCodePatch{Code: &taken}); !errors.Is(err, usecase.ErrConflict) {
+		t.Errorf("PatchChargeCode to a used code: err = %v, want conflict", err)
+	}
+
+	tooBig := 1000001.0
+	if _, err := repo.PatchChargeCode(ctx, created.ChargeCodeID, patched.Version, &usecase.ChargeCodePatch{Amount: &tooBig}); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("PatchChargeCode past the maximum amount: err = %v, want validation error", err)
+	}
+}
@@ -0,0 +1,247 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// FraudRepository stores fraud decisions and reads the history the fraud
+// rules look at.
+type FraudRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewFraudRepository(db *sql.DB, config *config.AppConfig) *FraudRepository {
+	return &FraudRepository{db: db, config: config}
+}
+
+func (fr *FraudRepository) CountUserTransactions(ctx context.Context, userID int, since time.Time) (int, error) {
+	var count int
+	err := fr.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM transaction WHERE user_id = ? AND timestamp > ?", userID, since.UTC()).Scan(&count)
+	if err != nil {
+		slog.ErrorContext(ctx, "error counting user transactions", "error", err, "user_id", userID)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return count, nil
+}
+
+func (fr *FraudRepository) GetUserFirstTransactionAt(ctx context.Context, userID int) (time.Time, error) {
+	var firstAt sql.NullString
+	err := fr.db.QueryRowContext(ctx, "SELECT MIN(timestamp) FROM transaction WHERE user_id = ?", userID).Scan(&firstAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying first user transaction", "error", err, "user_id", userID)
+		return time.Time{}, usecase.InternalError("database query error", err)
+	}
+	if !firstAt.Valid {
+		return time.Time{}, nil
+	}
+	return parseTimestamp(firstAt.String)
+}
+
+func (fr *FraudRepository) SumUserCredits(ctx context.Context, userID int, since time.Time) (float64, error) {
+	var credits float64
+	err := fr.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM transaction WHERE user_id = ? AND amount > 0 AND timestamp > ?", userID, since.UTC()).Scan(&credits)
+	if err != nil {
+		slog.ErrorContext(ctx, "error summing user credits", "error", err, "user_id", userID)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return credits, nil
+}
+
+func (fr *FraudRepository) CountPhoneNumbersByIP(ctx context.Context, clientIP string, kind string, phoneNumber string, since time.Time) (int, error) {
+	var count int
+	err := fr.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT phone_number)
+		FROM fraud_decision
+		WHERE client_ip = ? AND kind = ? AND phone_number <> ? AND created_at > ?
+	`, clientIP, kind, phoneNumber, since.UTC()).Scan(&count)
+	if err != nil {
+		slog.ErrorContext(ctx, "error counting phone numbers by IP", "error", err, "client_ip", clientIP)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return count, nil
+}
+
+func (fr *FraudRepository) CreateDecision(ctx context.Context, decision *usecase.FraudDecision) error {
+	results, err := json.Marshal(decision.Results)
+	if err != nil {
+		return usecase.InternalError("fraud decision encoding error", err)
+	}
+
+	result, err := fr.db.ExecContext(ctx, `
+		INSERT INTO fraud_decision (kind, entity_id, user_id, phone_number, client_ip, charge_code_id, amount, action, score, results, review_status, request_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, decision.Kind, nullableID(decision.EntityID), decision.UserID, decision.PhoneNumber, decision.ClientIP, nullableID(decision.ChargeCodeID),
+		decision.Amount, decision.Action, decision.Score, string(results), decision.ReviewStatus, decision.RequestID, decision.CreatedAt.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating fraud decision", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+
+	decisionID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading fraud decision id", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+	decision.DecisionID = int(decisionID)
+	return nil
+}
+
+// nullableID stores a missing ID as NULL.
+func nullableID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+const fraudDecisionColumns = `decision_id, kind, entity_id, user_id, phone_number, client_ip, charge_code_id, amount, action, score, results,
+		review_status, reviewed_by, review_note, reviewed_at, request_id, created_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFraudDecision(row rowScanner) (*usecase.FraudDecision, error) {
+	var (
+		decision                                    usecase.FraudDecision
+		entityID, chargeCodeID                      sql.NullInt64
+		clientIP, reviewedBy, reviewNote, requestID sql.NullString
+		reviewedAt                                  sql.NullString
+		results                                     []byte
+		createdAt                                   string
+	)
+	err := row.Scan(&decision.DecisionID, &decision.Kind, &entityID, &decision.UserID, &decision.PhoneNumber, &clientIP, &chargeCodeID,
+		&decision.Amount, &decision.Action, &decision.Score, &results,
+		&decision.ReviewStatus, &reviewedBy, &reviewNote, &reviewedAt, &requestID, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	decision.EntityID = int(entityID.Int64)
+	decision.ChargeCodeID = int(chargeCodeID.Int64)
+	decision.ClientIP = clientIP.String
+	decision.ReviewedBy = reviewedBy.String
+	decision.ReviewNote = reviewNote.String
+	decision.RequestID = requestID.String
+
+	if err := json.Unmarshal(results, &decision.Results); err != nil {
+		return nil, usecase.InternalError("fraud decision decoding error", err)
+	}
+
+	if reviewedAt.Valid {
+		parsedTime, err := parseTimestamp(reviewedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		decision.ReviewedAt = &parsedTime
+	}
+	decision.CreatedAt, err = parseTimestamp(createdAt)
+	if err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+func (fr *FraudRepository) GetDecisions(ctx context.Context, filter *usecase.FraudDecisionFilter, page int, pageSize int) ([]*usecase.FraudDecision, error) {
+
+	if page > fr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > fr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Build the WHERE clause from the filter fields that are set
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.ReviewStatus != "" {
+		conditions = append(conditions, "review_status = ?")
+		args = append(args, filter.ReviewStatus)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	rows, err := fr.db.QueryContext(ctx, `
+		SELECT `+fraudDecisionColumns+`
+		FROM fraud_decision
+		`+where+`
+		ORDER BY decision_id DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying fraud decisions", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	decisions := []*usecase.FraudDecision{}
+	for rows.Next() {
+		decision, err := scanFraudDecision(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "error scanning fraud decision row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		decisions = append(decisions, decision)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating fraud decision rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return decisions, nil
+}
+
+func (fr *FraudRepository) GetDecisionByID(ctx context.Context, id int) (*usecase.FraudDecision, error) {
+	row := fr.db.QueryRowContext(ctx, "SELECT "+fraudDecisionColumns+" FROM fraud_decision WHERE decision_id = ?", id)
+	decision, err := scanFraudDecision(row)
+	if err == sql.ErrNoRows {
+		return nil, usecase.NotFoundError("fraud decision not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying fraud decision", "error", err, "decision_id", id)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	return decision, nil
+}
+
+func (fr *FraudRepository) ReviewDecision(ctx context.Context, id int, review *usecase.FraudReview, reviewer string, at time.Time) error {
+	result, err := fr.db.ExecContext(ctx, `
+		UPDATE fraud_decision
+		SET review_status = ?, reviewed_by = ?, review_note = ?, reviewed_at = ?
+		WHERE decision_id = ? AND review_status = ?
+	`, review.Status, reviewer, review.Note, at.UTC(), id, usecase.FraudReviewPending)
+	if err != nil {
+		slog.ErrorContext(ctx, "error reviewing fraud decision", "error", err, "decision_id", id)
+		return usecase.InternalError("database update error", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading affected rows", "error", err)
+		return usecase.InternalError("database update error", err)
+	}
+	if affected == 0 {
+		return usecase.ConflictError("fraud decision is not pending review")
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var fraudNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestFraudRepositoryHistory(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewFraudRepository(db, appConfig)
+	ctx := context.Background()
+
+	userID := insertUser(t, db, "09120000001")
+	idleID := insertUser(t, db, "09120000002")
+	insertTransaction(t, db, userID, 5000, fraudNow.Add(-2*time.Hour))
+	insertTransaction(t, db, userID, 1000, fraudNow.Add(-30*time.Minute))
+	insertTransaction(t, db, userID, -500, fraudNow.Add(-10*time.Minute))
+
+	since := fraudNow.Add(-time.Hour)
+	if count, err := repo.CountUserTransactions(ctx, userID, since); err != nil || count != 2 {
+		t.Errorf("CountUserTransactions = %d, %v, want 2 within the hour", count, err)
+	}
+	if credits, err := repo.SumUserCredits(ctx, userID, since); err != nil || credits != 1000 {
+		t.Errorf("SumUserCredits = %v, %v, want 1000 of credits within the hour", credits, err)
+	}
+	if firstAt, err := repo.GetUserFirstTransactionAt(ctx, userID); err != nil || !firstAt.Equal(fraudNow.Add(-2*time.Hour)) {
+		t.Errorf("GetUserFirstTransactionAt = %s, %v, want %s", firstAt, err, fraudNow.Add(-2*time.Hour))
+	}
+
+	// A user without transactions has no history
+	if count, err := repo.CountUserTransactions(ctx, idleID, since); err != nil || count != 0 {
+		t.Errorf("CountUserTransactions of an idle user = %d, %v, want 0", count, err)
+	}
+	if credits, err := repo.SumUserCredits(ctx, idleID, since); err != nil || credits != 0 {
+		t.Errorf("SumUserCredits of an idle user = %v, %v, want 0", credits, err)
+	}
+	if firstAt, err := repo.GetUserFirstTransactionAt(ctx, idleID); err != nil || !firstAt.IsZero() {
+		t.Errorf("GetUserFirstTransactionAt of an idle user = %s, %v, want the zero time", firstAt, err)
+	}
+}
+
+// createDecision records a fraud decision of phoneNumber from clientIP.
+func createDecision(t *testing.T, repo *FraudRepository, phoneNumber string, clientIP string, action string, createdAt time.Time) *usecase.FraudDecision {
+	t.Helper()
+	reviewStatus := usecase.FraudReviewNone
+	if action == usecase.FraudActionReview {
+		reviewStatus = usecase.FraudReviewPending
+	}
+	decision := &usecase.FraudDecision{
+		Kind:         usecase.FraudKindRedemption,
+		UserID:       1,
+		PhoneNumber:  phoneNumber,
+		ClientIP:     clientIP,
+		ChargeCodeID: 7,
+		Amount:       1000,
+		Action:       action,
+		Score:        40,
+		Results:      []*usecase.FraudRuleResult{{Rule: "velocity", Action: action, Score: 40, Reason: "3 transactions within 10m0s"}},
+		ReviewStatus: reviewStatus,
+		RequestID:    "request-1",
+		CreatedAt:    createdAt,
+	}
+	if err := repo.CreateDecision(context.Background(), decision); err != nil {
+		t.Fatalf("CreateDecision: %v", err)
+	}
+	return decision
+}
+
+func TestFraudRepositoryDecisions(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewFraudRepository(db, appConfig)
+	ctx := context.Background()
+
+	review := createDecision(t, repo, "09120000001", "10.0.0.1", usecase.FraudActionReview, fraudNow)
+	deny := createDecision(t, repo, "09120000002", "10.0.0.1", usecase.FraudActionDeny, fraudNow)
+
+	stored, err := repo.GetDecisionByID(ctx, review.DecisionID)
+	if err != nil {
+		t.Fatalf("GetDecisionByID: %v", err)
+	}
+	if !reflect.DeepEqual(stored, review) {
+		t.Errorf("GetDecisionByID = %+v, want %+v", stored, review)
+	}
+
+	tests := []struct {
+		filter usecase.FraudDecisionFilter
+		want   []int
+	}{
+		{usecase.FraudDecisionFilter{}, []int{deny.DecisionID, review.DecisionID}},
+		{usecase.FraudDecisionFilter{Action: usecase.FraudActionDeny}, []int{deny.DecisionID}},
+		{usecase.FraudDecisionFilter{ReviewStatus: usecase.FraudReviewPending}, []int{review.DecisionID}},
+		{usecase.FraudDecisionFilter{Action: usecase.FraudActionAllow}, []int{}},
+	}
+	for _, test := range tests {
+		decisions, err := repo.GetDecisions(ctx, &test.filter, 1, 10)
+		if err != nil {
+			t.Fatalf("GetDecisions: %v", err)
+		}
+		ids := []int{}
+		for _, decision := range decisions {
+			ids = append(ids, decision.DecisionID)
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("GetDecisions(%+v) = %v, want %v, newest first", test.filter, ids, test.want)
+		}
+	}
+
+	if _, err := repo.GetDecisionByID(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetDecisionByID of a missing decision: err = %v, want not found", err)
+	}
+}
+
+func TestFraudRepositoryReviewDecision(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewFraudRepository(db, appConfig)
+	ctx := context.Background()
+
+	pending := createDecision(t, repo, "09120000001", "10.0.0.1", usecase.FraudActionReview, fraudNow)
+	denied := createDecision(t, repo, "09120000002", "10.0.0.1", usecase.FraudActionDeny, fraudNow)
+	reviewedAt := fraudNow.Add(time.Hour)
+
+	err := repo.ReviewDecision(ctx, pending.DecisionID, &usecase.FraudReview{Status: usecase.FraudReviewApproved, Note: "known customer"}, "analyst", reviewedAt)
+	if err != nil {
+		t.Fatalf("ReviewDecision: %v", err)
+	}
+	stored, err := repo.GetDecisionByID(ctx, pending.DecisionID)
+	if err != nil {
+		t.Fatalf("GetDecisionByID: %v", err)
+	}
+	if stored.ReviewStatus != usecase.FraudReviewApproved || stored.ReviewedBy != "analyst" || stored.ReviewNote != "known customer" ||
+		stored.ReviewedAt == nil || !stored.ReviewedAt.Equal(reviewedAt) {
+		t.Errorf("reviewed decision = %+v, want approved by analyst at %s", stored, reviewedAt)
+	}
+
+	// Only a pending decision can be reviewed, and only once
+	for _, id := range []int{pending.DecisionID, denied.DecisionID, 99} {
+		err := repo.ReviewDecision(ctx, id, &usecase.FraudReview{Status: usecase.FraudReviewRejected}, "analyst", reviewedAt)
+		if !errors.Is(err, usecase.ErrConflict) {
+			t.Errorf("ReviewDecision of decision %d: err = %v, want a conflict", id, err)
+		}
+	}
+}
+
+func TestFraudRepositoryCountPhoneNumbersByIP(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewFraudRepository(db, appConfig)
+	ctx := context.Background()
+
+	createDecision(t, repo, "09120000001", "10.0.0.1", usecase.FraudActionAllow, fraudNow.Add(-time.Minute))
+	createDecision(t, repo, "09120000002", "10.0.0.1", usecase.FraudActionAllow, fraudNow.Add(-2*time.Minute))
+	createDecision(t, repo, "09120000002", "10.0.0.1", usecase.FraudActionAllow, fraudNow.Add(-3*time.Minute))
+	// Outside the window, from another IP and of the caller itself
+	createDecision(t, repo, "09120000003", "10.0.0.1", usecase.FraudActionAllow, fraudNow.Add(-time.Hour))
+	createDecision(t, repo, "09120000004", "10.0.0.2", usecase.FraudActionAllow, fraudNow.Add(-time.Minute))
+	createDecision(t, repo, "09120000005", "10.0.0.1", usecase.FraudActionAllow, fraudNow.Add(-time.Minute))
+
+	count, err := repo.CountPhoneNumbersByIP(ctx, "10.0.0.1", usecase.FraudKindRedemption, "09120000005", fraudNow.Add(-10*time.Minute))
+	if err != nil {
+		t.Fatalf("CountPhoneNumbersByIP: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountPhoneNumbersByIP = %d, want the 2 other phone numbers within the window", count)
+	}
+	if count, err := repo.CountPhoneNumbersByIP(ctx, "10.0.0.1", usecase.FraudKindTransaction, "09120000005", fraudNow.Add(-10*time.Minute)); err != nil || count != 0 {
+		t.Errorf("CountPhoneNumbersByIP of another kind = %d, %v, want 0", count, err)
+	}
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+)
+
+type HealthRepository struct {
+	db     *sql.DB
+	config *config.AppConfig
+}
+
+func NewHealthRepository(db *sql.DB, config *config.AppConfig) *HealthRepository {
+	return &HealthRepository{db: db, config: config}
+}
+
+func (hr *HealthRepository) Ping(ctx context.Context) error {
+	if err := hr.db.PingContext(ctx); err != nil {
+		slog.ErrorContext(ctx, "error pinging database", "error", err)
+		return usecase.InternalError("database unreachable", err)
+	}
+	return nil
+}
+
+func (hr *HealthRepository) GetSchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := hr.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading schema version", "error", err)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"chargeCode/internal/database"
+	"context"
+	"testing"
+)
+
+func TestHealthRepository(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewHealthRepository(db, appConfig)
+	ctx := context.Background()
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+	if version, err := repo.GetSchemaVersion(ctx); err != nil || version != database.SchemaVersion {
+		t.Errorf("GetSchemaVersion = %d, %v, want %d", version, err, database.SchemaVersion)
+	}
+
+	// A closed pool is reported as unreachable
+	db.Close()
+	if err := repo.Ping(ctx); err == nil {
+		t.Errorf("Ping of a closed database: err = nil, want an error")
+	}
+}
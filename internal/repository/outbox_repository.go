@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// outboxRelayLock is the MySQL named lock held by the instance that relays
+// the outbox, so that only one instance publishes at a time.
+const outboxRelayLock = "chargeCode.outbox_relay"
+
+type OutboxRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewOutboxRepository(db *sql.DB, config *config.AppConfig) *OutboxRepository {
+	return &OutboxRepository{db: db, config: config}
+}
+
+func (or *OutboxRepository) Enqueue(ctx context.Context, event *usecase.Event) error {
+
+	_, err := or.db.ExecContext(ctx, `
+		INSERT INTO outbox (event_id, event_type, event_key, payload, occurred_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, event.ID, event.Type, event.Key, []byte(event.Data), event.OccurredAt.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "error inserting outbox event", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
+
+func (or *OutboxRepository) WithRelayLock(ctx context.Context, fn func() error) (bool, error) {
+	pool, ok := or.db.(*sql.DB)
+	if !ok {
+		return false, usecase.InternalError("outbox relay needs a database connection pool", nil)
+	}
+
+	// A named lock belongs to a connection, so keep one for the whole run
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting database connection", "error", err)
+		return false, usecase.InternalError("internal Server Error", err)
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", outboxRelayLock).Scan(&acquired); err != nil {
+		slog.ErrorContext(ctx, "error acquiring outbox relay lock", "error", err)
+		return false, usecase.InternalError("database query error", err)
+	}
+	if acquired.Int64 != 1 {
+		return false, nil
+	}
+	defer func() {
+		var released sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", outboxRelayLock).Scan(&released); err != nil {
+			slog.ErrorContext(ctx, "error releasing outbox relay lock", "error", err)
+		}
+	}()
+
+	return true, fn()
+}
+
+func (or *OutboxRepository) GetPendingMessages(ctx context.Context, afterID int64, skipKeys []string, limit int) ([]*usecase.OutboxMessage, error) {
+
+	keyCondition := "TRUE"
+	args := []interface{}{usecase.OutboxMessagePending, afterID}
+	if len(skipKeys) > 0 {
+		keyCondition = "event_key NOT IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(skipKeys)), ", ") + ")"
+		for _, key := range skipKeys {
+			args = append(args, key)
+		}
+	}
+
+	rows, err := or.db.QueryContext(ctx, `
+		SELECT outbox_id, event_id, event_type, event_key, payload, occurred_at, attempts
+		FROM outbox
+		WHERE status = ? AND outbox_id > ? AND `+keyCondition+`
+		ORDER BY outbox_id
+		LIMIT ?
+	`, append(args, limit)...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying outbox", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	messages := []*usecase.OutboxMessage{}
+	for rows.Next() {
+		message := &usecase.OutboxMessage{Event: &usecase.Event{}}
+		var payload []byte
+		var occurredAt string
+
+		err := rows.Scan(&message.OutboxID, &message.Event.ID, &message.Event.Type, &message.Event.Key, &payload, &occurredAt, &message.Attempts)
+		if err != nil {
+			slog.ErrorContext(ctx, "error scanning outbox row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+
+		message.Event.Data = payload
+		message.Event.OccurredAt, err = time.Parse("2006-01-02 15:04:05.999999", occurredAt)
+		if err != nil {
+			slog.ErrorContext(ctx, "error parsing time", "error", err)
+			return nil, usecase.InternalError("time parse error", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return messages, nil
+}
+
+func (or *OutboxRepository) DeleteMessage(ctx context.Context, outboxID int64) error {
+
+	_, err := or.db.ExecContext(ctx, "DELETE FROM outbox WHERE outbox_id = ?", outboxID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error deleting outbox event", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
+
+func (or *OutboxRepository) RecordFailure(ctx context.Context, outboxID int64, cause error, dead bool) error {
+
+	status := usecase.OutboxMessagePending
+	if dead {
+		status = usecase.OutboxMessageDead
+	}
+
+	_, err := or.db.ExecContext(ctx, `
+		UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, status = ?
+		WHERE outbox_id = ?
+	`, cause.Error(), status, outboxID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating outbox event", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
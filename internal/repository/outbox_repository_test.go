@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// enqueueEvents writes one event per key to the outbox, named after its
+// position, and returns them.
+func enqueueEvents(t *testing.T, repo *OutboxRepository, keys ...string) []*usecase.Event {
+	t.Helper()
+	occurredAt := time.Date(2024, 1, 1, 12, 0, 0, 123456000, time.UTC)
+	events := make([]*usecase.Event, len(keys))
+	for i, key := range keys {
+		events[i] = &usecase.Event{
+			ID:         "event-" + string(rune('a'+i)),
+			Type:       usecase.EventTransactionCreated,
+			Key:        key,
+			OccurredAt: occurredAt.Add(time.Duration(i) * time.Second),
+			Data:       json.RawMessage(`{"amount":1000}`),
+		}
+		if err := repo.Enqueue(context.Background(), events[i]); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+	return events
+}
+
+// sameJSON reports whether a and b hold the same JSON value. JSON columns
+// are returned reformatted by the server.
+func sameJSON(a, b []byte) bool {
+	var valueA, valueB interface{}
+	return json.Unmarshal(a, &valueA) == nil && json.Unmarshal(b, &valueB) == nil && reflect.DeepEqual(valueA, valueB)
+}
+
+// pendingIDs returns the event IDs of the pending messages.
+func pendingIDs(t *testing.T, repo *OutboxRepository, afterID int64, skipKeys []string, limit int) ([]string, []*usecase.OutboxMessage) {
+	t.Helper()
+	messages, err := repo.GetPendingMessages(context.Background(), afterID, skipKeys, limit)
+	if err != nil {
+		t.Fatalf("GetPendingMessages: %v", err)
+	}
+	ids := []string{}
+	for _, message := range messages {
+		ids = append(ids, message.Event.ID)
+	}
+	return ids, messages
+}
+
+func TestOutboxRepositoryGetPendingMessages(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewOutboxRepository(db, appConfig)
+	events := enqueueEvents(t, repo, "user:a", "user:b", "user:a", "user:c")
+
+	ids, messages := pendingIDs(t, repo, 0, nil, 10)
+	if want := []string{"event-a", "event-b", "event-c", "event-d"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("pending = %v, want %v in order", ids, want)
+	}
+	first := messages[0]
+	if first.Event.Type != events[0].Type || first.Event.Key != "user:a" || !first.Event.OccurredAt.Equal(events[0].OccurredAt) ||
+		!sameJSON(first.Event.Data, events[0].Data) || first.Attempts != 0 {
+		t.Errorf("first message = %+v with event %+v, want the enqueued event", first, first.Event)
+	}
+
+	tests := []struct {
+		name     string
+		afterID  int64
+		skipKeys []string
+		limit    int
+		want     []string
+	}{
+		{"limit", 0, nil, 2, []string{"event-a", "event-b"}},
+		{"after a message", messages[1].OutboxID, nil, 10, []string{"event-c", "event-d"}},
+		{"skipping a key", 0, []string{"user:a"}, 10, []string{"event-b", "event-d"}},
+		{"skipping several keys", 0, []string{"user:a", "user:c"}, 10, []string{"event-b"}},
+		{"after a message skipping a key", messages[0].OutboxID, []string{"user:b"}, 10, []string{"event-c", "event-d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if ids, _ := pendingIDs(t, repo, test.afterID, test.skipKeys, test.limit); !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("pending = %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestOutboxRepositoryRecordFailureAndDelete(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewOutboxRepository(db, appConfig)
+	ctx := context.Background()
+	enqueueEvents(t, repo, "user:a", "user:b", "user:c")
+	_, messages := pendingIDs(t, repo, 0, nil, 10)
+
+	// A failed message stays pending with its attempts counted
+	if err := repo.RecordFailure(ctx, messages[0].OutboxID, errors.New("sink unavailable"), false); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if err := repo.RecordFailure(ctx, messages[0].OutboxID, errors.New("sink unavailable"), false); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	// A dead-lettered message is kept but no longer pending
+	if err := repo.RecordFailure(ctx, messages[1].OutboxID, errors.New("malformed event"), true); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if err := repo.DeleteMessage(ctx, messages[2].OutboxID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	ids, pending := pendingIDs(t, repo, 0, nil, 10)
+	if want := []string{"event-a"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("pending = %v, want %v", ids, want)
+	}
+	if pending[0].Attempts != 2 {
+		t.Errorf("attempts = %d, want 2", pending[0].Attempts)
+	}
+
+	var status, lastError string
+	var attempts int
+	err := db.QueryRow("SELECT status, attempts, last_error FROM outbox WHERE outbox_id = ?", messages[1].OutboxID).Scan(&status, &attempts, &lastError)
+	if err != nil {
+		t.Fatalf("reading the dead message: %v", err)
+	}
+	if status != usecase.OutboxMessageDead || attempts != 1 || lastError != "malformed event" {
+		t.Errorf("dead message = %s after %d attempts with %q, want dead after 1 with its error", status, attempts, lastError)
+	}
+}
+
+func TestOutboxRepositoryWithRelayLock(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewOutboxRepository(db, appConfig)
+	ctx := context.Background()
+
+	ran, err := repo.WithRelayLock(ctx, func() error {
+		// Another instance does not get the lock while it is held
+		ranInside, err := repo.WithRelayLock(ctx, func() error {
+			t.Errorf("relay ran while another held the lock")
+			return nil
+		})
+		if err != nil || ranInside {
+			t.Errorf("WithRelayLock while held = %v, %v, want not run", ranInside, err)
+		}
+		return errors.New("relay failed")
+	})
+	if !ran || err == nil || err.Error() != "relay failed" {
+		t.Errorf("WithRelayLock = %v, %v, want run with the relay error", ran, err)
+	}
+
+	// The lock is released after the run, even when it failed
+	if ran, err := repo.WithRelayLock(ctx, func() error { return nil }); !ran || err != nil {
+		t.Errorf("WithRelayLock after the release = %v, %v, want run", ran, err)
+	}
+}
@@ -0,0 +1,371 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ReconciliationRepository compares balances and charge code uses with their
+// history and stores the reconciliation reports.
+type ReconciliationRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewReconciliationRepository(db *sql.DB, config *config.AppConfig) *ReconciliationRepository {
+	return &ReconciliationRepository{db: db, config: config}
+}
+
+func (rr *ReconciliationRepository) FindBalanceDiscrepancies(ctx context.Context) ([]*usecase.ReconciliationDiscrepancy, error) {
+	return rr.findDiscrepancies(ctx, usecase.ReconciliationUserBalance, `
+		SELECT u.user_id, u.balance, COALESCE(SUM(t.amount), 0) AS expected
+		FROM user u
+		LEFT JOIN transaction t ON t.user_id = u.user_id
+		GROUP BY u.user_id, u.balance
+		HAVING u.balance <> expected
+		ORDER BY u.user_id
+	`)
+}
+
+func (rr *ReconciliationRepository) FindChargeCodeDiscrepancies(ctx context.Context) ([]*usecase.ReconciliationDiscrepancy, error) {
+	return rr.findDiscrepancies(ctx, usecase.ReconciliationChargeCodeUses, `
+		SELECT c.charge_code_id, c.current_uses, COUNT(uc.user_charge_code_id) AS expected
+		FROM charge_code c
+		LEFT JOIN user_charge_code uc ON uc.charge_code_id = c.charge_code_id
+		GROUP BY c.charge_code_id, c.current_uses
+		HAVING c.current_uses <> expected
+		ORDER BY c.charge_code_id
+	`)
+}
+
+func (rr *ReconciliationRepository) findDiscrepancies(ctx context.Context, kind string, query string) ([]*usecase.ReconciliationDiscrepancy, error) {
+	rows, err := rr.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying discrepancies", "error", err, "kind", kind)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	discrepancies := []*usecase.ReconciliationDiscrepancy{}
+	for rows.Next() {
+		discrepancy := &usecase.ReconciliationDiscrepancy{Kind: kind, Status: usecase.DiscrepancyOpen}
+		if err := rows.Scan(&discrepancy.EntityID, &discrepancy.Recorded, &discrepancy.Expected); err != nil {
+			slog.ErrorContext(ctx, "error scanning discrepancy row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating discrepancy rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return discrepancies, nil
+}
+
+func (rr *ReconciliationRepository) CreateRun(ctx context.Context, run *usecase.ReconciliationRun) error {
+	result, err := rr.db.ExecContext(ctx, "INSERT INTO reconciliation_run (trigger_type, status, started_at) VALUES (?, ?, ?)",
+		run.Trigger, run.Status, run.StartedAt.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating reconciliation run", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+
+	runID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading reconciliation run id", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+	run.RunID = int(runID)
+	return nil
+}
+
+func (rr *ReconciliationRepository) FinishRun(ctx context.Context, run *usecase.ReconciliationRun) error {
+	var runError interface{}
+	if run.Error != "" {
+		runError = run.Error
+	}
+
+	_, err := rr.db.ExecContext(ctx, `
+		UPDATE reconciliation_run
+		SET status = ?, balance_discrepancies = ?, charge_code_discrepancies = ?, error = ?, finished_at = ?
+		WHERE run_id = ?
+	`, run.Status, run.BalanceDiscrepancies, run.ChargeCodeDiscrepancies, runError, run.FinishedAt.UTC(), run.RunID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error finishing reconciliation run", "error", err, "run_id", run.RunID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
+
+func (rr *ReconciliationRepository) CreateDiscrepancies(ctx context.Context, runID int, discrepancies []*usecase.ReconciliationDiscrepancy) error {
+	// Insert in batches to keep the statements small
+	const batchSize = 500
+	for start := 0; start < len(discrepancies); start += batchSize {
+		batch := discrepancies[start:min(start+batchSize, len(discrepancies))]
+
+		placeholders := make([]string, 0, len(batch))
+		args := make([]interface{}, 0, len(batch)*6)
+		for _, discrepancy := range batch {
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+			args = append(args, runID, discrepancy.Kind, discrepancy.EntityID, discrepancy.Recorded, discrepancy.Expected, discrepancy.Status)
+		}
+
+		_, err := rr.db.ExecContext(ctx, `
+			INSERT INTO reconciliation_discrepancy (run_id, kind, entity_id, recorded, expected, status)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			slog.ErrorContext(ctx, "error creating discrepancies", "error", err, "run_id", runID)
+			return usecase.InternalError("database insert error", err)
+		}
+	}
+	return nil
+}
+
+const reconciliationRunColumns = `run_id, trigger_type, status, balance_discrepancies, charge_code_discrepancies, repaired, error,
+		started_at, finished_at, repaired_at`
+
+func scanReconciliationRun(row rowScanner) (*usecase.ReconciliationRun, error) {
+	var (
+		run                    usecase.ReconciliationRun
+		runError               sql.NullString
+		finishedAt, repairedAt sql.NullString
+		startedAt              string
+	)
+	err := row.Scan(&run.RunID, &run.Trigger, &run.Status, &run.BalanceDiscrepancies, &run.ChargeCodeDiscrepancies, &run.Repaired, &runError,
+		&startedAt, &finishedAt, &repairedAt)
+	if err != nil {
+		return nil, err
+	}
+	run.Error = runError.String
+
+	run.StartedAt, err = parseTimestamp(startedAt)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		parsedTime, err := parseTimestamp(finishedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		run.FinishedAt = &parsedTime
+	}
+	if repairedAt.Valid {
+		parsedTime, err := parseTimestamp(repairedAt.String)
+		if err != nil {
+			return nil, err
+		}
+		run.RepairedAt = &parsedTime
+	}
+	return &run, nil
+}
+
+func (rr *ReconciliationRepository) GetRuns(ctx context.Context, page int, pageSize int) ([]*usecase.ReconciliationRun, error) {
+
+	if page > rr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > rr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+
+	rows, err := rr.db.QueryContext(ctx, `
+		SELECT `+reconciliationRunColumns+`
+		FROM reconciliation_run
+		ORDER BY run_id DESC
+		LIMIT ? OFFSET ?
+	`, pageSize, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying reconciliation runs", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	runs := []*usecase.ReconciliationRun{}
+	for rows.Next() {
+		run, err := scanReconciliationRun(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "error scanning reconciliation run row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		runs = append(runs, run)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating reconciliation run rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return runs, nil
+}
+
+func (rr *ReconciliationRepository) GetRunByID(ctx context.Context, id int) (*usecase.ReconciliationRun, error) {
+	row := rr.db.QueryRowContext(ctx, "SELECT "+reconciliationRunColumns+" FROM reconciliation_run WHERE run_id = ?", id)
+	run, err := scanReconciliationRun(row)
+	if err == sql.ErrNoRows {
+		return nil, usecase.NotFoundError("reconciliation run not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying reconciliation run", "error", err, "run_id", id)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	return run, nil
+}
+
+func (rr *ReconciliationRepository) GetDiscrepancies(ctx context.Context, runID int, page int, pageSize int) ([]*usecase.ReconciliationDiscrepancy, error) {
+
+	if page > rr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > rr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+
+	return rr.queryDiscrepancies(ctx, `
+		SELECT discrepancy_id, run_id, kind, entity_id, recorded, expected, status, note
+		FROM reconciliation_discrepancy
+		WHERE run_id = ?
+		ORDER BY discrepancy_id
+		LIMIT ? OFFSET ?
+	`, runID, pageSize, offset)
+}
+
+func (rr *ReconciliationRepository) GetOpenDiscrepancies(ctx context.Context, runID int) ([]*usecase.ReconciliationDiscrepancy, error) {
+	return rr.queryDiscrepancies(ctx, `
+		SELECT discrepancy_id, run_id, kind, entity_id, recorded, expected, status, note
+		FROM reconciliation_discrepancy
+		WHERE run_id = ? AND status = ?
+		ORDER BY discrepancy_id
+	`, runID, usecase.DiscrepancyOpen)
+}
+
+func (rr *ReconciliationRepository) queryDiscrepancies(ctx context.Context, query string, args ...interface{}) ([]*usecase.ReconciliationDiscrepancy, error) {
+	rows, err := rr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying discrepancies", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	discrepancies := []*usecase.ReconciliationDiscrepancy{}
+	for rows.Next() {
+		var (
+			discrepancy usecase.ReconciliationDiscrepancy
+			note        sql.NullString
+		)
+		err := rows.Scan(&discrepancy.DiscrepancyID, &discrepancy.RunID, &discrepancy.Kind, &discrepancy.EntityID,
+			&discrepancy.Recorded, &discrepancy.Expected, &discrepancy.Status, &note)
+		if err != nil {
+			slog.ErrorContext(ctx, "error scanning discrepancy row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		discrepancy.Note = note.String
+		discrepancies = append(discrepancies, &discrepancy)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating discrepancy rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return discrepancies, nil
+}
+
+func (rr *ReconciliationRepository) LockBalance(ctx context.Context, userID int) (float64, float64, error) {
+	var balance float64
+	err := rr.db.QueryRowContext(ctx, "SELECT balance FROM user WHERE user_id = ? FOR UPDATE", userID).Scan(&balance)
+	if err == sql.ErrNoRows {
+		return 0, 0, usecase.NotFoundError("user not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking user balance", "error", err, "user_id", userID)
+		return 0, 0, usecase.InternalError("database query error", err)
+	}
+
+	// The user lock keeps new transactions out, since inserting one updates
+	// the balance
+	var sum float64
+	err = rr.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM transaction WHERE user_id = ? LOCK IN SHARE MODE", userID).Scan(&sum)
+	if err != nil {
+		slog.ErrorContext(ctx, "error summing user transactions", "error", err, "user_id", userID)
+		return 0, 0, usecase.InternalError("database query error", err)
+	}
+	return balance, sum, nil
+}
+
+func (rr *ReconciliationRepository) SetBalance(ctx context.Context, userID int, balance float64) error {
+	_, err := rr.db.ExecContext(ctx, "UPDATE user SET balance = ?, version = version + 1 WHERE user_id = ?", balance, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error repairing user balance", "error", err, "user_id", userID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
+
+func (rr *ReconciliationRepository) LockChargeCodeUses(ctx context.Context, chargeCodeID int) (int, int, error) {
+	var currentUses int
+	err := rr.db.QueryRowContext(ctx, "SELECT current_uses FROM charge_code WHERE charge_code_id = ? FOR UPDATE", chargeCodeID).Scan(&currentUses)
+	if err == sql.ErrNoRows {
+		return 0, 0, usecase.NotFoundError("charge code not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking charge code", "error", err, "charge_code_id", chargeCodeID)
+		return 0, 0, usecase.InternalError("database query error", err)
+	}
+
+	var redemptions int
+	err = rr.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_charge_code WHERE charge_code_id = ? LOCK IN SHARE MODE", chargeCodeID).Scan(&redemptions)
+	if err != nil {
+		slog.ErrorContext(ctx, "error counting charge code redemptions", "error", err, "charge_code_id", chargeCodeID)
+		return 0, 0, usecase.InternalError("database query error", err)
+	}
+	return currentUses, redemptions, nil
+}
+
+func (rr *ReconciliationRepository) SetChargeCodeUses(ctx context.Context, chargeCodeID int, uses int) error {
+	_, err := rr.db.ExecContext(ctx, "UPDATE charge_code SET current_uses = ?, version = version + 1 WHERE charge_code_id = ?", uses, chargeCodeID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error repairing charge code uses", "error", err, "charge_code_id", chargeCodeID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
+
+func (rr *ReconciliationRepository) SetDiscrepancyStatus(ctx context.Context, discrepancy *usecase.ReconciliationDiscrepancy) error {
+	var note interface{}
+	if discrepancy.Note != "" {
+		note = discrepancy.Note
+	}
+
+	_, err := rr.db.ExecContext(ctx, "UPDATE reconciliation_discrepancy SET status = ?, note = ? WHERE discrepancy_id = ?",
+		discrepancy.Status, note, discrepancy.DiscrepancyID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating discrepancy", "error", err, "discrepancy_id", discrepancy.DiscrepancyID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
+
+func (rr *ReconciliationRepository) MarkRunRepaired(ctx context.Context, runID int, at time.Time) error {
+	_, err := rr.db.ExecContext(ctx, `
+		UPDATE reconciliation_run
+		SET repaired = (SELECT COUNT(*) FROM reconciliation_discrepancy WHERE run_id = ? AND status = ?), repaired_at = ?
+		WHERE run_id = ?
+	`, runID, usecase.DiscrepancyRepaired, at.UTC(), runID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating reconciliation run", "error", err, "run_id", runID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
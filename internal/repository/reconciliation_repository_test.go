@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReconciliationRepositoryFindDiscrepancies(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewReconciliationRepository(db, appConfig)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	consistentID := insertUser(t, db, "09120000001")
+	insertTransaction(t, db, consistentID, 1000, now)
+	driftedID := insertUser(t, db, "09120000002")
+	insertTransaction(t, db, driftedID, 2000, now)
+	// A balance changed outside of a transaction
+	if _, err := db.Exec("UPDATE user SET balance = 500 WHERE user_id = ?", driftedID); err != nil {
+		t.Fatalf("changing the balance: %v", err)
+	}
+
+	chargeCodeRepo := NewChargeCodeRepository(db, appConfig)
+	createChargeCode(t, chargeCodeRepo, "CONSISTENT", 10, 1000)
+	drifted := createChargeCode(t, chargeCodeRepo, "DRIFTED", 10, 1000)
+	if _, err := db.Exec("UPDATE charge_code SET current_uses = 2 WHERE charge_code_id = ?", drifted.ChargeCodeID); err != nil {
+		t.Fatalf("changing the uses: %v", err)
+	}
+
+	balances, err := repo.FindBalanceDiscrepancies(ctx)
+	if err != nil {
+		t.Fatalf("FindBalanceDiscrepancies: %v", err)
+	}
+	want := []*usecase.ReconciliationDiscrepancy{
+		{Kind: usecase.ReconciliationUserBalance, EntityID: driftedID, Recorded: 500, Expected: 2000, Status: usecase.DiscrepancyOpen},
+	}
+	if !reflect.DeepEqual(balances, want) {
+		t.Errorf("FindBalanceDiscrepancies = %+v, want %+v", balances, want)
+	}
+
+	uses, err := repo.FindChargeCodeDiscrepancies(ctx)
+	if err != nil {
+		t.Fatalf("FindChargeCodeDiscrepancies: %v", err)
+	}
+	want = []*usecase.ReconciliationDiscrepancy{
+		{Kind: usecase.ReconciliationChargeCodeUses, EntityID: drifted.ChargeCodeID, Recorded: 2, Expected: 0, Status: usecase.DiscrepancyOpen},
+	}
+	if !reflect.DeepEqual(uses, want) {
+		t.Errorf("FindChargeCodeDiscrepancies = %+v, want %+v", uses, want)
+	}
+
+	// Repairing brings the recorded values back to the history
+	balance, sum, err := repo.LockBalance(ctx, driftedID)
+	if err != nil || balance != 500 || sum != 2000 {
+		t.Errorf("LockBalance = %v, %v, %v, want 500 against 2000", balance, sum, err)
+	}
+	if err := repo.SetBalance(ctx, driftedID, sum); err != nil {
+		t.Fatalf("SetBalance: %v", err)
+	}
+	currentUses, redemptions, err := repo.LockChargeCodeUses(ctx, drifted.ChargeCodeID)
+	if err != nil || currentUses != 2 || redemptions != 0 {
+		t.Errorf("LockChargeCodeUses = %d, %d, %v, want 2 against 0", currentUses, redemptions, err)
+	}
+	if err := repo.SetChargeCodeUses(ctx, drifted.ChargeCodeID, redemptions); err != nil {
+		t.Fatalf("SetChargeCodeUses: %v", err)
+	}
+	if balances, err := repo.FindBalanceDiscrepancies(ctx); err != nil || len(balances) != 0 {
+		t.Errorf("FindBalanceDiscrepancies after the repair = %+v, %v, want none", balances, err)
+	}
+	if uses, err := repo.FindChargeCodeDiscrepancies(ctx); err != nil || len(uses) != 0 {
+		t.Errorf("FindChargeCodeDiscrepancies after the repair = %+v, %v, want none", uses, err)
+	}
+
+	if _, _, err := repo.LockBalance(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("LockBalance of a missing user: err = %v, want not found", err)
+	}
+	if _, _, err := repo.LockChargeCodeUses(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("LockChargeCodeUses of a missing charge code: err = %v, want not found", err)
+	}
+}
+
+func TestReconciliationRepositoryRuns(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewReconciliationRepository(db, appConfig)
+	ctx := context.Background()
+	startedAt := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	finishedAt := startedAt.Add(time.Minute)
+
+	failed := &usecase.ReconciliationRun{Trigger: usecase.ReconciliationTriggerSchedule, Status: usecase.ReconciliationRunning, StartedAt: startedAt}
+	if err := repo.CreateRun(ctx, failed); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	failed.Status = usecase.ReconciliationFailed
+	failed.Error = "database query error"
+	failed.FinishedAt = &finishedAt
+	if err := repo.FinishRun(ctx, failed); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	run := &usecase.ReconciliationRun{Trigger: usecase.ReconciliationTriggerManual, Status: usecase.ReconciliationRunning, StartedAt: startedAt}
+	if err := repo.CreateRun(ctx, run); err != nil {
+		t.Fatalf("CreateRun: %v", err)
+	}
+	discrepancies := []*usecase.ReconciliationDiscrepancy{
+		{Kind: usecase.ReconciliationUserBalance, EntityID: 1, Recorded: 500, Expected: 2000, Status: usecase.DiscrepancyOpen},
+		{Kind: usecase.ReconciliationUserBalance, EntityID: 2, Recorded: 0, Expected: 100, Status: usecase.DiscrepancyOpen},
+		{Kind: usecase.ReconciliationChargeCodeUses, EntityID: 1, Recorded: 2, Expected: 0, Status: usecase.DiscrepancyOpen},
+	}
+	if err := repo.CreateDiscrepancies(ctx, run.RunID, discrepancies); err != nil {
+		t.Fatalf("CreateDiscrepancies: %v", err)
+	}
+	run.Status = usecase.ReconciliationCompleted
+	run.BalanceDiscrepancies = 2
+	run.ChargeCodeDiscrepancies = 1
+	run.FinishedAt = &finishedAt
+	if err := repo.FinishRun(ctx, run); err != nil {
+		t.Fatalf("FinishRun: %v", err)
+	}
+
+	runs, err := repo.GetRuns(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("GetRuns: %v", err)
+	}
+	if !reflect.DeepEqual(runs, []*usecase.ReconciliationRun{run, failed}) {
+		t.Errorf("GetRuns = %+v, want %+v and %+v, newest first", runs, run, failed)
+	}
+
+	// Repair one discrepancy and skip another
+	open, err := repo.GetOpenDiscrepancies(ctx, run.RunID)
+	if err != nil || len(open) != 3 {
+		t.Fatalf("GetOpenDiscrepancies = %+v, %v, want 3", open, err)
+	}
+	open[0].Status = usecase.DiscrepancyRepaired
+	open[1].Status = usecase.DiscrepancySkipped
+	open[1].Note = "user not found"
+	for _, discrepancy := range open[:2] {
+		if err := repo.SetDiscrepancyStatus(ctx, discrepancy); err != nil {
+			t.Fatalf("SetDiscrepancyStatus: %v", err)
+		}
+	}
+	repairedAt := finishedAt.Add(time.Hour)
+	if err := repo.MarkRunRepaired(ctx, run.RunID, repairedAt); err != nil {
+		t.Fatalf("MarkRunRepaired: %v", err)
+	}
+
+	if open, err := repo.GetOpenDiscrepancies(ctx, run.RunID); err != nil || len(open) != 1 || open[0].Kind != usecase.ReconciliationChargeCodeUses {
+		t.Errorf("GetOpenDiscrepancies after the repair = %+v, %v, want the charge code discrepancy", open, err)
+	}
+	page, err := repo.GetDiscrepancies(ctx, run.RunID, 2, 2)
+	if err != nil {
+		t.Fatalf("GetDiscrepancies: %v", err)
+	}
+	if len(page) != 1 || page[0].DiscrepancyID != open[2].DiscrepancyID || page[0].RunID != run.RunID {
+		t.Errorf("second page of discrepancies = %+v, want the last one of run %d", page, run.RunID)
+	}
+	skipped, err := repo.GetDiscrepancies(ctx, run.RunID, 1, 2)
+	if err != nil {
+		t.Fatalf("GetDiscrepancies: %v", err)
+	}
+	if len(skipped) != 2 || skipped[1].Status != usecase.DiscrepancySkipped || skipped[1].Note != "user not found" {
+		t.Errorf("first page of discrepancies = %+v, want the skipped one with its note", skipped)
+	}
+
+	stored, err := repo.GetRunByID(ctx, run.RunID)
+	if err != nil {
+		t.Fatalf("GetRunByID: %v", err)
+	}
+	if stored.Repaired != 1 || stored.RepairedAt == nil || !stored.RepairedAt.Equal(repairedAt) {
+		t.Errorf("repaired run = %+v, want 1 repaired at %s", stored, repairedAt)
+	}
+	if _, err := repo.GetRunByID(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetRunByID of a missing run: err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets and expired failure records are
+// dropped so that the memory store does not grow without bound.
+const sweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     usecase.RateLimit
+}
+
+type attemptRecord struct {
+	failures      int
+	totalFailures int
+	windowStarted time.Time
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+	window        time.Duration
+}
+
+// MemoryRedemptionAttemptStore keeps redemption attempts in process memory.
+// It is only suitable for a single instance deployment.
+type MemoryRedemptionAttemptStore struct {
+	mu        sync.Mutex
+	config    *config.AppConfig
+	buckets   map[string]*tokenBucket
+	attempts  map[string]*attemptRecord
+	lastSweep time.Time
+}
+
+func NewMemoryRedemptionAttemptStore(config *config.AppConfig) *MemoryRedemptionAttemptStore {
+	return &MemoryRedemptionAttemptStore{
+		config:   config,
+		buckets:  map[string]*tokenBucket{},
+		attempts: map[string]*attemptRecord{},
+	}
+}
+
+// refill returns the number of tokens in a bucket at now.
+func refill(tokens float64, updatedAt time.Time, limit usecase.RateLimit, now time.Time) float64 {
+	elapsed := now.Sub(updatedAt).Minutes()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Burst), tokens+elapsed*limit.PerMinute)
+}
+
+// waitForToken returns how long it takes until a bucket holding tokens has a
+// whole token again.
+func waitForToken(tokens float64, limit usecase.RateLimit) time.Duration {
+	missing := 1 - tokens
+	return time.Duration(missing / limit.PerMinute * float64(time.Minute))
+}
+
+func (ms *MemoryRedemptionAttemptStore) TakeToken(ctx context.Context, key string, limit usecase.RateLimit, now time.Time) (bool, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.sweep(now)
+
+	bucket, ok := ms.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), updatedAt: now}
+		ms.buckets[key] = bucket
+	}
+	bucket.limit = limit
+	bucket.tokens = refill(bucket.tokens, bucket.updatedAt, limit, now)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return false, waitForToken(bucket.tokens, limit), nil
+	}
+	bucket.tokens--
+	return true, 0, nil
+}
+
+func (ms *MemoryRedemptionAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration, now time.Time) (int, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, ok := ms.attempts[key]
+	if !ok {
+		record = &attemptRecord{windowStarted: now}
+		ms.attempts[key] = record
+	}
+	if now.Sub(record.windowStarted) > window {
+		record.failures = 0
+		record.windowStarted = now
+	}
+	record.failures++
+	record.totalFailures++
+	record.lastFailureAt = now
+	record.window = window
+	return record.failures, nil
+}
+
+func (ms *MemoryRedemptionAttemptStore) ResetFailures(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if record, ok := ms.attempts[key]; ok {
+		record.failures = 0
+	}
+	return nil
+}
+
+func (ms *MemoryRedemptionAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, ok := ms.attempts[key]
+	if !ok {
+		record = &attemptRecord{windowStarted: until}
+		ms.attempts[key] = record
+	}
+	record.lockedUntil = until
+	return nil
+}
+
+func (ms *MemoryRedemptionAttemptStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	record, ok := ms.attempts[key]
+	if !ok || !record.lockedUntil.After(now) {
+		return time.Time{}, false, nil
+	}
+	return record.lockedUntil, true, nil
+}
+
+func (ms *MemoryRedemptionAttemptStore) GetFailureStats(ctx context.Context, page int, pageSize int) ([]*usecase.RedemptionFailureStat, error) {
+	if page > ms.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > ms.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	ms.mu.Lock()
+	stats := []*usecase.RedemptionFailureStat{}
+	for key, record := range ms.attempts {
+		if record.totalFailures == 0 {
+			continue
+		}
+		stat := &usecase.RedemptionFailureStat{
+			Key:           key,
+			Failures:      record.failures,
+			TotalFailures: record.totalFailures,
+			WindowStarted: record.windowStarted,
+			LastFailureAt: record.lastFailureAt,
+		}
+		if !record.lockedUntil.IsZero() {
+			lockedUntil := record.lockedUntil
+			stat.LockedUntil = &lockedUntil
+		}
+		stats = append(stats, stat)
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalFailures != stats[j].TotalFailures {
+			return stats[i].TotalFailures > stats[j].TotalFailures
+		}
+		return stats[i].Key < stats[j].Key
+	})
+
+	offset := (page - 1) * pageSize
+	if offset < 0 || offset >= len(stats) {
+		return nil, usecase.NotFoundError("redemption failures not found")
+	}
+	end := offset + pageSize
+	if end > len(stats) {
+		end = len(stats)
+	}
+	return stats[offset:end], nil
+}
+
+// sweep drops buckets that have refilled completely and failure records whose
+// window and lockout are both over. The caller must hold ms.mu.
+func (ms *MemoryRedemptionAttemptStore) sweep(now time.Time) {
+	if now.Sub(ms.lastSweep) < sweepInterval {
+		return
+	}
+	ms.lastSweep = now
+
+	for key, bucket := range ms.buckets {
+		if refill(bucket.tokens, bucket.updatedAt, bucket.limit, now) >= float64(bucket.limit.Burst) {
+			delete(ms.buckets, key)
+		}
+	}
+	for key, record := range ms.attempts {
+		if now.Sub(record.windowStarted) > record.window && !record.lockedUntil.After(now) {
+			delete(ms.attempts, key)
+		}
+	}
+}
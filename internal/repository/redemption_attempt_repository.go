@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// RedemptionAttemptRepository keeps redemption attempts in MySQL so that every
+// instance of the service shares the same buckets, counters and lockouts.
+type RedemptionAttemptRepository struct {
+	db     *sql.DB
+	config *config.AppConfig
+}
+
+func NewRedemptionAttemptRepository(db *sql.DB, config *config.AppConfig) *RedemptionAttemptRepository {
+	return &RedemptionAttemptRepository{db: db, config: config}
+}
+
+func (rr *RedemptionAttemptRepository) TakeToken(ctx context.Context, key string, limit usecase.RateLimit, now time.Time) (bool, time.Duration, error) {
+
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error beginning transaction", "error", err)
+		return false, 0, usecase.InternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	// Create a full bucket the first time the key is seen
+	_, err = tx.ExecContext(ctx, `
+		INSERT IGNORE INTO rate_limit_bucket (bucket_key, tokens, updated_at_ms)
+		VALUES (?, ?, ?)
+	`, key, limit.Burst, now.UnixMilli())
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating rate limit bucket", "error", err)
+		return false, 0, usecase.InternalError("database error", err)
+	}
+
+	var tokens float64
+	var updatedAtMs int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT tokens, updated_at_ms
+		FROM rate_limit_bucket
+		WHERE bucket_key = ?
+		FOR UPDATE
+	`, key).Scan(&tokens, &updatedAtMs)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying rate limit bucket", "error", err)
+		return false, 0, usecase.InternalError("database query error", err)
+	}
+
+	tokens = refill(tokens, time.UnixMilli(updatedAtMs), limit, now)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE rate_limit_bucket
+		SET tokens = ?, updated_at_ms = ?
+		WHERE bucket_key = ?
+	`, tokens, now.UnixMilli(), key)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating rate limit bucket", "error", err)
+		return false, 0, usecase.InternalError("database error", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "error committing transaction", "error", err)
+		return false, 0, usecase.InternalError("database error", err)
+	}
+
+	if !allowed {
+		return false, waitForToken(tokens, limit), nil
+	}
+	return true, 0, nil
+}
+
+func (rr *RedemptionAttemptRepository) RecordFailure(ctx context.Context, key string, window time.Duration, now time.Time) (int, error) {
+
+	now = now.UTC()
+	windowStart := now.Add(-window)
+
+	// The failures column is assigned before window_started so that it still
+	// sees the window of the previous failure.
+	_, err := rr.db.ExecContext(ctx, `
+		INSERT INTO redemption_attempt (attempt_key, failures, total_failures, window_started, last_failure_at)
+		VALUES (?, 1, 1, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			failures = IF(window_started IS NULL OR window_started < ?, 1, failures + 1),
+			window_started = IF(window_started IS NULL OR window_started < ?, VALUES(window_started), window_started),
+			total_failures = total_failures + 1,
+			last_failure_at = VALUES(last_failure_at)
+	`, key, now, now, windowStart, windowStart)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording redemption failure", "error", err)
+		return 0, usecase.InternalError("database error", err)
+	}
+
+	var failures int
+	err = rr.db.QueryRowContext(ctx, "SELECT failures FROM redemption_attempt WHERE attempt_key = ?", key).Scan(&failures)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying redemption failures", "error", err)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return failures, nil
+}
+
+func (rr *RedemptionAttemptRepository) ResetFailures(ctx context.Context, key string) error {
+
+	_, err := rr.db.ExecContext(ctx, "UPDATE redemption_attempt SET failures = 0 WHERE attempt_key = ?", key)
+	if err != nil {
+		slog.ErrorContext(ctx, "error resetting redemption failures", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
+
+func (rr *RedemptionAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+
+	_, err := rr.db.ExecContext(ctx, `
+		INSERT INTO redemption_attempt (attempt_key, locked_until)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE locked_until = VALUES(locked_until)
+	`, key, until.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking redemption key", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
+
+func (rr *RedemptionAttemptRepository) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, bool, error) {
+
+	var lockedUntil string
+	err := rr.db.QueryRowContext(ctx, `
+		SELECT locked_until
+		FROM redemption_attempt
+		WHERE attempt_key = ? AND locked_until > ?
+	`, key, now.UTC()).Scan(&lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, false, nil
+		}
+		slog.ErrorContext(ctx, "error querying redemption lockout", "error", err)
+		return time.Time{}, false, usecase.InternalError("database query error", err)
+	}
+
+	format := "2006-01-02 15:04:05"
+	parsedTime, err := time.Parse(format, lockedUntil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error parsing time", "error", err)
+		return time.Time{}, false, usecase.InternalError("time parse error", err)
+	}
+	return parsedTime, true, nil
+}
+
+func (rr *RedemptionAttemptRepository) GetFailureStats(ctx context.Context, page int, pageSize int) ([]*usecase.RedemptionFailureStat, error) {
+
+	if page > rr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > rr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+
+	rows, err := rr.db.QueryContext(ctx, `
+		SELECT attempt_key, failures, total_failures, window_started, last_failure_at, locked_until
+		FROM redemption_attempt
+		WHERE total_failures > 0
+		ORDER BY total_failures DESC, attempt_key
+		LIMIT ? OFFSET ?
+	`, pageSize, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying redemption failures", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	stats := []*usecase.RedemptionFailureStat{}
+
+	format := "2006-01-02 15:04:05"
+	for rows.Next() {
+		var key string
+		var failures, totalFailures int
+		var windowStarted, lastFailureAt, lockedUntil sql.NullString
+
+		if err := rows.Scan(&key, &failures, &totalFailures, &windowStarted, &lastFailureAt, &lockedUntil); err != nil {
+			slog.ErrorContext(ctx, "error scanning redemption failure row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+
+		stat := &usecase.RedemptionFailureStat{Key: key, Failures: failures, TotalFailures: totalFailures}
+		if windowStarted.Valid {
+			stat.WindowStarted, _ = time.Parse(format, windowStarted.String)
+		}
+		if lastFailureAt.Valid {
+			stat.LastFailureAt, _ = time.Parse(format, lastFailureAt.String)
+		}
+		if lockedUntil.Valid {
+			parsedTime, err := time.Parse(format, lockedUntil.String)
+			if err == nil {
+				stat.LockedUntil = &parsedTime
+			}
+		}
+		stats = append(stats, stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+
+	if len(stats) > 0 {
+		return stats, nil
+	}
+	return nil, usecase.NotFoundError("redemption failures not found")
+}
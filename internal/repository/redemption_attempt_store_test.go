@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redemptionAttemptStores returns a fresh instance of every
+// usecase.RedemptionAttemptStore, by name.
+func redemptionAttemptStores(t *testing.T) map[string]usecase.RedemptionAttemptStore {
+	t.Helper()
+	db, appConfig := newTestDB(t)
+	return map[string]usecase.RedemptionAttemptStore{
+		"memory": NewMemoryRedemptionAttemptStore(testConfig("")),
+		"mysql":  NewRedemptionAttemptRepository(db, appConfig),
+	}
+}
+
+var attemptStoreStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestRedemptionAttemptStoreTakeToken(t *testing.T) {
+	limit := usecase.RateLimit{PerMinute: 2, Burst: 3}
+	steps := []struct {
+		after      time.Duration
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		// A new bucket is full
+		{0, true, 0},
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 30 * time.Second},
+		// Half a minute refills one token
+		{30 * time.Second, true, 0},
+		{30 * time.Second, false, 30 * time.Second},
+		// A quarter of a minute refills half of one
+		{45 * time.Second, false, 15 * time.Second},
+		// An idle bucket refills up to Burst only
+		{time.Hour, true, 0},
+		{time.Hour, true, 0},
+		{time.Hour, true, 0},
+		{time.Hour, false, 30 * time.Second},
+	}
+
+	for name, store := range redemptionAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i, step := range steps {
+				allowed, retryAfter, err := store.TakeToken(ctx, "phone:09120000001", limit, attemptStoreStart.Add(step.after))
+				if err != nil {
+					t.Fatalf("step %d: TakeToken: %v", i, err)
+				}
+				if allowed != step.allowed || retryAfter.Round(time.Second) != step.retryAfter {
+					t.Errorf("step %d: TakeToken = %v, %s, want %v, %s", i, allowed, retryAfter, step.allowed, step.retryAfter)
+				}
+			}
+
+			// Buckets are kept per key
+			if allowed, _, err := store.TakeToken(ctx, "ip:10.0.0.1", limit, attemptStoreStart.Add(time.Hour)); err != nil || !allowed {
+				t.Errorf("TakeToken of another key = %v, %v, want a token", allowed, err)
+			}
+		})
+	}
+}
+
+func TestRedemptionAttemptStoreFailureWindow(t *testing.T) {
+	const window = 10 * time.Minute
+	steps := []struct {
+		after    time.Duration
+		failures int
+	}{
+		{0, 1},
+		{time.Minute, 2},
+		{window, 3},
+		// The window starts at the first failure and is over after it
+		{window + time.Minute, 1},
+		{window + 2*time.Minute, 2},
+	}
+
+	for name, store := range redemptionAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i, step := range steps {
+				failures, err := store.RecordFailure(ctx, "phone:09120000001", window, attemptStoreStart.Add(step.after))
+				if err != nil {
+					t.Fatalf("step %d: RecordFailure: %v", i, err)
+				}
+				if failures != step.failures {
+					t.Errorf("step %d: RecordFailure = %d, want %d", i, failures, step.failures)
+				}
+			}
+
+			if err := store.ResetFailures(ctx, "phone:09120000001"); err != nil {
+				t.Fatalf("ResetFailures: %v", err)
+			}
+			failures, err := store.RecordFailure(ctx, "phone:09120000001", window, attemptStoreStart.Add(window+3*time.Minute))
+			if err != nil {
+				t.Fatalf("RecordFailure: %v", err)
+			}
+			if failures != 1 {
+				t.Errorf("RecordFailure after ResetFailures = %d, want 1", failures)
+			}
+
+			stats, err := store.GetFailureStats(ctx, 1, 10)
+			if err != nil {
+				t.Fatalf("GetFailureStats: %v", err)
+			}
+			if len(stats) != 1 || stats[0].Key != "phone:09120000001" || stats[0].Failures != 1 || stats[0].TotalFailures != 6 {
+				t.Errorf("GetFailureStats = %+v, want 1 failure of 6 for phone:09120000001", stats)
+			}
+		})
+	}
+}
+
+func TestRedemptionAttemptStoreLock(t *testing.T) {
+	lockedUntil := attemptStoreStart.Add(15 * time.Minute)
+
+	for name, store := range redemptionAttemptStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			if _, locked, err := store.LockedUntil(ctx, "ip:10.0.0.1", attemptStoreStart); err != nil || locked {
+				t.Fatalf("LockedUntil of a new key = %v, %v, want unlocked", locked, err)
+			}
+			if err := store.Lock(ctx, "ip:10.0.0.1", lockedUntil); err != nil {
+				t.Fatalf("Lock: %v", err)
+			}
+
+			until, locked, err := store.LockedUntil(ctx, "ip:10.0.0.1", lockedUntil.Add(-time.Second))
+			if err != nil {
+				t.Fatalf("LockedUntil: %v", err)
+			}
+			if !locked || !until.Equal(lockedUntil) {
+				t.Errorf("LockedUntil inside the lockout = %s, %v, want %s, true", until, locked, lockedUntil)
+			}
+			if _, locked, err := store.LockedUntil(ctx, "ip:10.0.0.1", lockedUntil); err != nil || locked {
+				t.Errorf("LockedUntil at the end of the lockout = %v, %v, want unlocked", locked, err)
+			}
+			if _, locked, err := store.LockedUntil(ctx, "ip:10.0.0.2", attemptStoreStart); err != nil || locked {
+				t.Errorf("LockedUntil of another key = %v, %v, want unlocked", locked, err)
+			}
+		})
+	}
+}
+
+// TestRedemptionAttemptRepositoryConcurrentTakeToken takes tokens from one
+// bucket from several instances at once. No more than Burst may be taken,
+// which relies on the row lock of SELECT ... FOR UPDATE.
+func TestRedemptionAttemptRepositoryConcurrentTakeToken(t *testing.T) {
+	db, appConfig := newServerTestDB(t, "row locks")
+	store := NewRedemptionAttemptRepository(db, appConfig)
+	limit := usecase.RateLimit{PerMinute: 1, Burst: 3}
+
+	const attempts = 10
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := store.TakeToken(context.Background(), "ip:10.0.0.1", limit, attemptStoreStart)
+			if err != nil {
+				t.Errorf("TakeToken: %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != limit.Burst {
+		t.Errorf("%d of %d concurrent attempts got a token, want %d", allowed, attempts, limit.Burst)
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/database"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+)
+
+// serverURLEnv names a MySQL or MariaDB server, such as a local install, to
+// run the tests on instead of the in-process engine. Tests that need what the
+// engine lacks only run when it is set. The userManager database on the
+// server is dropped before every test, so never point it at real data.
+const serverURLEnv = "TEST_MYSQL_URL"
+
+// testConfig returns the configuration the tests run with, using the limits
+// of cmd/sample.env except for a lower minimum charge code amount.
+func testConfig(mysqlURL string) *config.AppConfig {
+	appConfig := &config.AppConfig{MysqlUrl: mysqlURL}
+	appConfig.SetLimits(&config.Limits{
+		MaxPage:              40,
+		MaxPageSize:          30,
+		MinChargeCodeAmount:  1000,
+		MaxChargeCodeAmount:  1000000,
+		MinTransactionAmount: -200000,
+		MaxTransactionAmount: 2000000,
+	})
+	return appConfig
+}
+
+// newTestDB returns a connection to an empty database with the schema of
+// database.NewDBConnection. It is served by an in-process go-mysql-server, or
+// by the server named by TEST_MYSQL_URL when that is set, and closed when
+// the test ends.
+func newTestDB(t *testing.T) (*sql.DB, *config.AppConfig) {
+	t.Helper()
+	if serverURL := os.Getenv(serverURLEnv); serverURL != "" {
+		return newServerDB(t, serverURL)
+	}
+	return newEngineDB(t)
+}
+
+// newServerTestDB is newTestDB for tests of a feature the in-process engine
+// does not support. The test is skipped unless TEST_MYSQL_URL is set.
+func newServerTestDB(t *testing.T, feature string) (*sql.DB, *config.AppConfig) {
+	t.Helper()
+	serverURL := os.Getenv(serverURLEnv)
+	if serverURL == "" {
+		t.Skipf("the in-process engine does not support %s, set %s to run this test on a MySQL or MariaDB server", feature, serverURLEnv)
+	}
+	return newServerDB(t, serverURL)
+}
+
+// newEngineDB starts a go-mysql-server with an in-memory database for one
+// test. The repositories reach it over TCP with the MySQL driver, like they
+// reach a real server.
+func newEngineDB(t *testing.T) (*sql.DB, *config.AppConfig) {
+	t.Helper()
+
+	engineDB := memory.NewDatabase(database.DatabaseName)
+	// Foreign keys need indexes on the primary keys they reference
+	engineDB.EnablePrimaryKeyIndexes()
+	provider := memory.NewDBProvider(engineDB)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for the engine: %v", err)
+	}
+	srv, err := server.NewServer(server.Config{Protocol: "tcp", Address: listener.Addr().String(), Listener: listener},
+		sqle.NewDefault(provider), gmssql.NewContext, memory.NewSessionBuilder(provider), nil)
+	if err != nil {
+		listener.Close()
+		t.Fatalf("starting the engine: %v", err)
+	}
+	go srv.Start()
+	t.Cleanup(func() { srv.Close() })
+
+	return openTestDB(t, "root@tcp("+listener.Addr().String()+")/")
+}
+
+func newServerDB(t *testing.T, serverURL string) (*sql.DB, *config.AppConfig) {
+	t.Helper()
+
+	bootstrap, err := sql.Open("mysql", serverURL)
+	if err != nil {
+		t.Fatalf("connecting to %s: %v", serverURLEnv, err)
+	}
+	_, err = bootstrap.Exec("DROP DATABASE IF EXISTS " + database.DatabaseName)
+	bootstrap.Close()
+	if err != nil {
+		t.Fatalf("dropping the test database: %v", err)
+	}
+
+	return openTestDB(t, serverURL)
+}
+
+func openTestDB(t *testing.T, mysqlURL string) (*sql.DB, *config.AppConfig) {
+	t.Helper()
+
+	appConfig := testConfig(mysqlURL)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	db, err := database.NewDBConnection(ctx, appConfig)
+	if err != nil {
+		t.Fatalf("creating the schema: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, appConfig
+}
+
+// insertUser adds a user with a zero balance and returns its id. Users are
+// otherwise only created by redeeming a charge code.
+func insertUser(t *testing.T, db *sql.DB, phoneNumber string) int {
+	t.Helper()
+	result, err := db.Exec("INSERT INTO user (phoneNumber, balance) VALUES (?, 0)", phoneNumber)
+	if err != nil {
+		t.Fatalf("inserting user %s: %v", phoneNumber, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("reading user id: %v", err)
+	}
+	return int(id)
+}
+
+// createChargeCode adds an active charge code.
+func createChargeCode(t *testing.T, repo *ChargeCodeRepository, code string, maxUses int, amount float64) *usecase.ChargeCode {
+	t.Helper()
+	chargeCode, err := repo.CreateChargeCode(context.Background(), &usecase.ChargeCode{Code: code, MaxUses: maxUses, Amount: amount})
+	if err != nil {
+		t.Fatalf("creating charge code %s: %v", code, err)
+	}
+	return chargeCode
+}
+
+// insertTransaction adds a transaction of the user made at a given time. The
+// update_user_balance trigger keeps the balance.
+func insertTransaction(t *testing.T, db *sql.DB, userID int, amount float64, at time.Time) {
+	t.Helper()
+	_, err := db.Exec("INSERT INTO transaction (user_id, amount, timestamp) VALUES (?, ?, ?)", userID, amount, at.UTC())
+	if err != nil {
+		t.Fatalf("inserting a transaction of user %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errDuplicateEntry is the MySQL error number of a unique key violation.
+const errDuplicateEntry = 1062
+
+// isDuplicateEntry reports whether err is a unique key violation. The error
+// number is checked rather than the message, which differs between servers.
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry
+}
+
+// executor is implemented by both *sql.DB and *sql.Tx, so a repository can
+// run on its own or as part of a Store transaction.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Store implements usecase.Transactor on top of a MySQL connection pool.
+type Store struct {
+	db     *sql.DB
+	config *config.AppConfig
+}
+
+func NewStore(db *sql.DB, config *config.AppConfig) *Store {
+	return &Store{db: db, config: config}
+}
+
+func (s *Store) WithinTransaction(ctx context.Context, fn func(repos *usecase.Repositories) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error beginning transaction", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	// Rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	repos := &usecase.Repositories{
+		Users:        &UserRepository{db: tx, config: s.config},
+		ChargeCodes:  &ChargeCodeRepository{db: tx, config: s.config},
+		Transactions: &TransactionRepository{db: tx, config: s.config},
+		Audit:        &AuditRepository{db: tx, config: s.config},
+		Outbox:       &OutboxRepository{db: tx, config: s.config},
+		Webhooks:     &WebhookRepository{db: tx, config: s.config},
+
+		TransactionLimits: &TransactionLimitRepository{db: tx, config: s.config},
+		Fraud:             &FraudRepository{db: tx, config: s.config},
+		Reconciliation:    &ReconciliationRepository{db: tx, config: s.config},
+	}
+
+	if err := fn(repos); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "error committing transaction", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreWithinTransactionRollsBack(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	store := NewStore(db, appConfig)
+	ctx := context.Background()
+
+	failed := errors.New("failed")
+	err := store.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		if _, err := repos.ChargeCodes.CreateChargeCode(ctx, &usecase.ChargeCode{Code: "ROLLBACK", MaxUses: 1, Amount: 1000}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithinTransaction: err = %v, want %v", err, failed)
+	}
+
+	if _, err := NewChargeCodeRepository(db, appConfig).GetChargeCodeByCode(ctx, "ROLLBACK"); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetChargeCodeByCode of a rolled back charge code: err = %v, want not found", err)
+	}
+}
+
+func TestStoreWithinTransactionCommits(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	store := NewStore(db, appConfig)
+	ctx := context.Background()
+
+	err := store.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		_, err := repos.ChargeCodes.CreateChargeCode(ctx, &usecase.ChargeCode{Code: "COMMIT", MaxUses: 1, Amount: 1000})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction: %v", err)
+	}
+
+	if _, err := NewChargeCodeRepository(db, appConfig).GetChargeCodeByCode(ctx, "COMMIT"); err != nil {
+		t.Errorf("GetChargeCodeByCode of a committed charge code: %v", err)
+	}
+}
+
+func TestStoreWithinTransactionRollsBackWebhooks(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	store := NewStore(db, appConfig)
+	ctx := context.Background()
+
+	failed := errors.New("failed")
+	err := store.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		subscription := &usecase.WebhookSubscription{URL: "https://example.com/a", EventTypes: []string{usecase.EventUserCreated}, Secret: "s3cret", Active: true}
+		if _, err := repos.Webhooks.CreateSubscription(ctx, subscription); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithinTransaction: err = %v, want %v", err, failed)
+	}
+
+	if _, err := NewWebhookRepository(db, appConfig).GetSubscriptions(ctx, 1, 10); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetSubscriptions after a rolled back subscription: err = %v, want not found", err)
+	}
+
+	// Claiming deliveries runs its own transaction
+	err = store.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+		_, err := repos.Webhooks.ClaimDueDeliveries(ctx, webhookNow, 10, time.Minute)
+		return err
+	})
+	if !errors.Is(err, usecase.ErrInternal) {
+		t.Errorf("ClaimDueDeliveries in a transaction: err = %v, want an internal error", err)
+	}
+}
+
+func TestSchemaRejectsNegativeBalance(t *testing.T) {
+	db, _ := newTestDB(t)
+	id := insertUser(t, db, "09120000001")
+
+	_, err := db.Exec("UPDATE user SET balance = -1 WHERE user_id = ?", id)
+	if err == nil || !strings.Contains(err.Error(), "check_balance_non_negative") {
+		t.Errorf("setting a negative balance: err = %v, want the check_balance_non_negative constraint to reject it", err)
+	}
+}
+
+func TestSchemaAuditLogIsAppendOnly(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewAuditRepository(db, appConfig)
+	ctx := context.Background()
+
+	err := repo.CreateAuditLog(ctx, &usecase.AuditLog{Actor: "test", ActorVerified: true, Action: usecase.AuditActionChargeCodeCreate, EntityType: usecase.AuditEntityChargeCode, EntityID: 1, ClientIP: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("CreateAuditLog: %v", err)
+	}
+	auditLogs, err := repo.GetAuditLogs(ctx, &usecase.AuditLogFilter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("GetAuditLogs: %v", err)
+	}
+	if len(auditLogs) != 1 || auditLogs[0].Actor != "test" || !auditLogs[0].ActorVerified || auditLogs[0].ClientIP != "10.0.0.1" {
+		t.Fatalf("GetAuditLogs = %+v, want the verified entry of test from 10.0.0.1", auditLogs)
+	}
+
+	for _, statement := range []string{"UPDATE audit_log SET actor = 'someone else'", "DELETE FROM audit_log"} {
+		_, err := db.Exec(statement)
+		if err == nil || !strings.Contains(err.Error(), "audit_log is append-only") {
+			t.Errorf("%s: err = %v, want the append-only trigger to reject it", statement, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+type TransactionLimitRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewTransactionLimitRepository(db *sql.DB, config *config.AppConfig) *TransactionLimitRepository {
+	return &TransactionLimitRepository{db: db, config: config}
+}
+
+func (lr *TransactionLimitRepository) LockUser(ctx context.Context, userID int) error {
+	var lockedID int
+	err := lr.db.QueryRowContext(ctx, "SELECT user_id FROM user WHERE user_id = ? FOR UPDATE", userID).Scan(&lockedID)
+	if err == sql.ErrNoRows {
+		return usecase.NotFoundError("user not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking user", "error", err, "user_id", userID)
+		return usecase.InternalError("database query error", err)
+	}
+	return nil
+}
+
+func (lr *TransactionLimitRepository) GetActivity(ctx context.Context, userID int, since time.Time) ([]*usecase.TransactionActivity, error) {
+
+	// A locking read sees the latest committed rows, not the snapshot taken
+	// when the transaction first read, so transactions committed while
+	// LockUser waited are counted
+	rows, err := lr.db.QueryContext(ctx, `
+		SELECT amount, timestamp
+		FROM transaction
+		WHERE user_id = ? AND timestamp > ?
+		ORDER BY timestamp, transaction_id
+		LOCK IN SHARE MODE
+	`, userID, since.UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying transaction activity", "error", err, "user_id", userID)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	activity := []*usecase.TransactionActivity{}
+	for rows.Next() {
+		var (
+			amount    float64
+			timestamp string
+		)
+		if err := rows.Scan(&amount, &timestamp); err != nil {
+			slog.ErrorContext(ctx, "error scanning transaction activity", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+
+		parsedTime, err := parseTimestamp(timestamp)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, &usecase.TransactionActivity{Amount: amount, Timestamp: parsedTime})
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating transaction activity", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return activity, nil
+}
+
+func (lr *TransactionLimitRepository) GetOverrides(ctx context.Context, userID int) (*usecase.TransactionLimitOverrides, error) {
+	var (
+		dailyDebit, dailyCredit, monthlyDebit, monthlyCredit sql.NullFloat64
+		dailyCount, monthlyCount                             sql.NullInt64
+	)
+	err := lr.db.QueryRowContext(ctx, `
+		SELECT daily_debit, daily_credit, daily_count, monthly_debit, monthly_credit, monthly_count
+		FROM user_transaction_limit
+		WHERE user_id = ?
+	`, userID).Scan(&dailyDebit, &dailyCredit, &dailyCount, &monthlyDebit, &monthlyCredit, &monthlyCount)
+	if err == sql.ErrNoRows {
+		return &usecase.TransactionLimitOverrides{}, nil
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying transaction limits", "error", err, "user_id", userID)
+		return nil, usecase.InternalError("database query error", err)
+	}
+
+	return &usecase.TransactionLimitOverrides{
+		DailyDebit:    nullFloat(dailyDebit),
+		DailyCredit:   nullFloat(dailyCredit),
+		DailyCount:    nullInt(dailyCount),
+		MonthlyDebit:  nullFloat(monthlyDebit),
+		MonthlyCredit: nullFloat(monthlyCredit),
+		MonthlyCount:  nullInt(monthlyCount),
+	}, nil
+}
+
+func (lr *TransactionLimitRepository) SetOverrides(ctx context.Context, userID int, overrides *usecase.TransactionLimitOverrides) error {
+	_, err := lr.db.ExecContext(ctx, `
+		INSERT INTO user_transaction_limit (user_id, daily_debit, daily_credit, daily_count, monthly_debit, monthly_credit, monthly_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			daily_debit = VALUES(daily_debit),
+			daily_credit = VALUES(daily_credit),
+			daily_count = VALUES(daily_count),
+			monthly_debit = VALUES(monthly_debit),
+			monthly_credit = VALUES(monthly_credit),
+			monthly_count = VALUES(monthly_count)
+	`, userID, overrides.DailyDebit, overrides.DailyCredit, overrides.DailyCount, overrides.MonthlyDebit, overrides.MonthlyCredit, overrides.MonthlyCount)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating transaction limits", "error", err, "user_id", userID)
+		return usecase.InternalError("database update error", err)
+	}
+	return nil
+}
+
+func (lr *TransactionLimitRepository) DeleteOverrides(ctx context.Context, userID int) error {
+	_, err := lr.db.ExecContext(ctx, "DELETE FROM user_transaction_limit WHERE user_id = ?", userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error deleting transaction limits", "error", err, "user_id", userID)
+		return usecase.InternalError("database delete error", err)
+	}
+	return nil
+}
+
+func nullFloat(value sql.NullFloat64) *float64 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Float64
+}
+
+func nullInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	converted := int(value.Int64)
+	return &converted
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransactionLimitRepositoryGetActivity(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionLimitRepository(db, appConfig)
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	userID := insertUser(t, db, "09120000001")
+	otherID := insertUser(t, db, "09120000002")
+	insertTransaction(t, db, userID, 1000, now.Add(-25*time.Hour))
+	insertTransaction(t, db, userID, -300, now.Add(-time.Hour))
+	insertTransaction(t, db, userID, 2000, now.Add(-2*time.Hour))
+	insertTransaction(t, db, otherID, 5000, now.Add(-time.Hour))
+
+	activity, err := repo.GetActivity(ctx, userID, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	want := []*usecase.TransactionActivity{
+		{Amount: 2000, Timestamp: now.Add(-2 * time.Hour)},
+		{Amount: -300, Timestamp: now.Add(-time.Hour)},
+	}
+	if !reflect.DeepEqual(activity, want) {
+		t.Errorf("GetActivity = %+v, want the transactions within the day, oldest first", activity)
+	}
+
+	if err := repo.LockUser(ctx, userID); err != nil {
+		t.Errorf("LockUser: %v", err)
+	}
+	if err := repo.LockUser(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("LockUser of a missing user: err = %v, want not found", err)
+	}
+}
+
+// The limits compare the Go clock with timestamps set by the server, which
+// only works when both are in UTC.
+func TestTransactionLimitRepositoryUsesUTC(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionLimitRepository(db, appConfig)
+	ctx := context.Background()
+
+	var timeZone string
+	if err := db.QueryRow("SELECT @@session.time_zone").Scan(&timeZone); err != nil {
+		t.Fatalf("reading the session time zone: %v", err)
+	}
+	if timeZone != "+00:00" {
+		t.Errorf("session time zone = %s, want +00:00", timeZone)
+	}
+
+	userID := insertUser(t, db, "09120000001")
+	if _, err := db.Exec("INSERT INTO transaction (user_id, amount) VALUES (?, 10)", userID); err != nil {
+		t.Fatalf("inserting a transaction: %v", err)
+	}
+	now := time.Now()
+	activity, err := repo.GetActivity(ctx, userID, now.Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("GetActivity: %v", err)
+	}
+	if len(activity) != 1 {
+		t.Fatalf("GetActivity = %+v, want the transaction made just now", activity)
+	}
+	if offset := activity[0].Timestamp.Sub(now); offset < -time.Minute || offset > time.Minute {
+		t.Errorf("timestamp = %s, want about %s", activity[0].Timestamp, now.UTC())
+	}
+}
+
+func TestTransactionLimitRepositoryOverrides(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionLimitRepository(db, appConfig)
+	ctx := context.Background()
+	userID := insertUser(t, db, "09120000001")
+
+	getOverrides := func() *usecase.TransactionLimitOverrides {
+		t.Helper()
+		overrides, err := repo.GetOverrides(ctx, userID)
+		if err != nil {
+			t.Fatalf("GetOverrides: %v", err)
+		}
+		return overrides
+	}
+
+	if overrides := getOverrides(); !reflect.DeepEqual(overrides, &usecase.TransactionLimitOverrides{}) {
+		t.Errorf("GetOverrides without overrides = %+v, want none", overrides)
+	}
+
+	dailyDebit, monthlyCount := 50000.0, 30
+	set := &usecase.TransactionLimitOverrides{DailyDebit: &dailyDebit, MonthlyCount: &monthlyCount}
+	if err := repo.SetOverrides(ctx, userID, set); err != nil {
+		t.Fatalf("SetOverrides: %v", err)
+	}
+	if overrides := getOverrides(); !reflect.DeepEqual(overrides, set) {
+		t.Errorf("GetOverrides = %+v, want %+v", overrides, set)
+	}
+
+	// Setting the overrides again replaces all of them
+	dailyCount := 5
+	replaced := &usecase.TransactionLimitOverrides{DailyCount: &dailyCount}
+	if err := repo.SetOverrides(ctx, userID, replaced); err != nil {
+		t.Fatalf("SetOverrides: %v", err)
+	}
+	if overrides := getOverrides(); !reflect.DeepEqual(overrides, replaced) {
+		t.Errorf("GetOverrides after replacing = %+v, want %+v", overrides, replaced)
+	}
+
+	if err := repo.DeleteOverrides(ctx, userID); err != nil {
+		t.Fatalf("DeleteOverrides: %v", err)
+	}
+	if overrides := getOverrides(); !reflect.DeepEqual(overrides, &usecase.TransactionLimitOverrides{}) {
+		t.Errorf("GetOverrides after deleting = %+v, want none", overrides)
+	}
+}
@@ -4,17 +4,16 @@ package repository
 import (
 	"chargeCode/internal/config"
 	"chargeCode/internal/usecase"
+	"context"
 	"database/sql"
-	"errors"
-	"fmt"
+	"log/slog"
 	"regexp"
-	"strings"
 	"time"
 )
 
 type TransactionRepository struct {
 	// Implement data storage and retrieval methods here
-	db     *sql.DB
+	db     executor
 	config *config.AppConfig
 }
 
@@ -23,121 +22,131 @@ func NewTransactionRepository(db *sql.DB, config *config.AppConfig) *Transaction
 	return &TransactionRepository{db: db, config: config}
 }
 
-func (tr *TransactionRepository) CreateTransaction(transaction *usecase.Transaction) (*usecase.Transaction, error) {
+func (tr *TransactionRepository) CreateTransaction(ctx context.Context, transaction *usecase.Transaction) (*usecase.Transaction, error) {
 
-	if !(transaction.Amount >= tr.config.MinTransactionAmount && transaction.Amount <= tr.config.MaxTransactionAmount) {
-		return nil, errors.New("amount is outside the valid range")
+	limits := tr.config.Limits()
+	if !(transaction.Amount >= limits.MinTransactionAmount && transaction.Amount <= limits.MaxTransactionAmount) {
+		return nil, usecase.ValidationError("amount is outside the valid range")
 	}
 
-	userRepository := NewUserRepository(tr.db, tr.config)
-	currentUser, err := userRepository.GetUserByPhoneNumber(transaction.PhoneNumber)
+	userRepository := &UserRepository{db: tr.db, config: tr.config}
+	currentUser, err := userRepository.GetUserByPhoneNumber(ctx, transaction.PhoneNumber)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		return nil, err
 	}
 
 	if transaction.Amount < 0 && (currentUser.Balance+transaction.Amount) < 0 {
-		return nil, errors.New("transaction failed. insufficient funds")
+		return nil, usecase.ErrInsufficientFunds
 	}
 
 	// Insert the new transaction into the 'transaction' table
-	_, err = tr.db.Exec("INSERT INTO transaction (user_id, amount) VALUES (?, ?)", currentUser.ID, transaction.Amount)
+	result, err := tr.db.ExecContext(ctx, "INSERT INTO transaction (user_id, amount) VALUES (?, ?)", currentUser.ID, transaction.Amount)
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New("database insert error")
+		slog.ErrorContext(ctx, "error inserting transaction", "error", err, "user_id", currentUser.ID)
+		return nil, usecase.InternalError("database insert error", err)
 	}
 
+	transactionID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading transaction id", "error", err)
+		return nil, usecase.InternalError("database insert error", err)
+	}
+	transaction.TransactionID = int(transactionID)
+
 	// If the creation is successful, return the created transaction and no error
 	return transaction, nil
 }
 
-func (tr *TransactionRepository) CreateChargeTransaction(chargeCodeTransaction *usecase.ChargeCodeTransaction) (*usecase.ChargeCodeTransaction, error) {
+func (tr *TransactionRepository) CreateChargeTransaction(ctx context.Context, chargeCodeTransaction *usecase.ChargeCodeTransaction) (*usecase.ChargeCodeTransaction, error) {
 
 	formatPattern := `^09\d{9}$`
 
 	// Compile the regular expression
 	re := regexp.MustCompile(formatPattern)
 	if !re.MatchString(chargeCodeTransaction.PhoneNumber) {
-		return nil, errors.New("phone number is incorrect Most Like 09121114323")
-	}
-	// Ensure the database connection is valid
-	if err := tr.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+		return nil, usecase.ErrInvalidPhoneNumber
 	}
-
-	_, err := tr.db.Exec(`
+	_, err := tr.db.ExecContext(ctx, `
 	INSERT INTO user (phoneNumber, balance)
 	VALUES (?, ?)
 `, chargeCodeTransaction.PhoneNumber, 0)
 	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate") {
-			return nil, errors.New("user with the same phone number already exists")
+		if isDuplicateEntry(err) {
+			return nil, usecase.ErrPhoneNumberRegistered
 		}
-		fmt.Println(err)
-		return nil, errors.New("database insert error")
+		slog.ErrorContext(ctx, "error inserting user", "error", err, "phoneNumber", chargeCodeTransaction.PhoneNumber)
+		return nil, usecase.InternalError("database insert error", err)
 	}
 
-	userRepository := NewUserRepository(tr.db, tr.config)
-	currentUser, err := userRepository.GetUserByPhoneNumber(chargeCodeTransaction.PhoneNumber)
+	userRepository := &UserRepository{db: tr.db, config: tr.config}
+	currentUser, err := userRepository.GetUserByPhoneNumber(ctx, chargeCodeTransaction.PhoneNumber)
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New(err.Error())
+		slog.ErrorContext(ctx, "error querying user", "error", err, "phoneNumber", chargeCodeTransaction.PhoneNumber)
+		return nil, err
 	}
 
 	var userAlreadyRedeemed int
 
 	// SQL query to count the rows in user_charge_code
 	queryuserAlreadyRedeemed := "SELECT COUNT(*) FROM user_charge_code WHERE user_id = ? AND charge_code_id = ?"
-	err = tr.db.QueryRow(queryuserAlreadyRedeemed, currentUser.ID, chargeCodeTransaction.ChargeCodeID).Scan(&userAlreadyRedeemed)
+	err = tr.db.QueryRowContext(ctx, queryuserAlreadyRedeemed, currentUser.ID, chargeCodeTransaction.ChargeCodeID).Scan(&userAlreadyRedeemed)
 
 	if err != nil {
-		fmt.Println("Error executing queryCheckUseChargeCode:", err)
-		return nil, errors.New(err.Error())
+		slog.ErrorContext(ctx, "error executing queryCheckUseChargeCode", "error", err)
+		return nil, usecase.InternalError("database query error", err)
 	}
 
 	if userAlreadyRedeemed > 0 {
-		return nil, errors.New("user has already redeemed this charge_code")
+		return nil, usecase.ErrChargeCodeAlreadyRedeemed
 	}
 
+	// Lock the charge code, so that it cannot be paused or archived before
+	// the redemption commits
 	query := `
-	SELECT charge_code_id, max_uses, current_uses, amount
+	SELECT charge_code_id, max_uses, current_uses, amount, status
 	FROM charge_code
-	WHERE charge_code_id = ? AND current_uses < max_uses;
+	WHERE charge_code_id = ?
+	FOR UPDATE;
 `
 
 	var chargeCodeID, maxUses, currentUses int
 	var amount float64
+	var status string
 
-	err = tr.db.QueryRow(query, chargeCodeTransaction.ChargeCodeID).Scan(&chargeCodeID, &maxUses, &currentUses, &amount)
+	err = tr.db.QueryRowContext(ctx, query, chargeCodeTransaction.ChargeCodeID).Scan(&chargeCodeID, &maxUses, &currentUses, &amount, &status)
 
+	if err == sql.ErrNoRows {
+		return nil, usecase.ErrChargeCodeUnavailable
+	}
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New(err.Error())
+		slog.ErrorContext(ctx, "error querying charge code", "error", err, "charge_code_id", chargeCodeTransaction.ChargeCodeID)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	if status != usecase.ChargeCodeActive {
+		return nil, usecase.ErrChargeCodeInactive
+	}
+	if currentUses >= maxUses {
+		return nil, usecase.ErrChargeCodeUnavailable
 	}
 
 	// Call the RedeemChargeCode stored procedure
-	_, err = tr.db.Exec("CALL RedeemChargeCode(?, ?)", currentUser.ID, chargeCodeID)
+	_, err = tr.db.ExecContext(ctx, "CALL RedeemChargeCode(?, ?)", currentUser.ID, chargeCodeID)
 
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New("stored procedure error")
+		slog.ErrorContext(ctx, "error redeeming charge code", "error", err, "charge_code_id", chargeCodeID, "user_id", currentUser.ID)
+		return nil, usecase.InternalError("stored procedure error", err)
 	}
 	// If the creation is successful, return the created ChargeCodeTransaction and no error
 	return chargeCodeTransaction, nil
 }
 
-func (tr *TransactionRepository) GetTransactions(page int, pageSize int) ([]*usecase.Transaction, error) {
-	if page > tr.config.MaxPage {
-		return nil, errors.New("page exceeds the maximum allowed limit")
+func (tr *TransactionRepository) GetTransactions(ctx context.Context, page int, pageSize int) ([]*usecase.Transaction, error) {
+	if page > tr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
 	}
 
-	if pageSize > tr.config.MaxPageSize {
-		return nil, errors.New("page size exceeds the maximum allowed limit")
-	}
-	// Ensure the database connection is valid
-	if err := tr.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	if pageSize > tr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
 	}
 	// Calculate the OFFSET based on the page number and page size
 	offset := (page - 1) * pageSize
@@ -147,13 +156,14 @@ func (tr *TransactionRepository) GetTransactions(page int, pageSize int) ([]*use
 		SELECT t.transaction_id, u.phoneNumber, t.amount, t.timestamp
 		FROM transaction t
 		INNER JOIN user u ON t.user_id = u.user_id
+		ORDER BY t.transaction_id
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := tr.db.Query(query, pageSize, offset)
+	rows, err := tr.db.QueryContext(ctx, query, pageSize, offset)
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying transactions", "error", err)
+		return nil, usecase.InternalError("database query error", err)
 	}
 
 	defer rows.Close()
@@ -168,8 +178,8 @@ func (tr *TransactionRepository) GetTransactions(page int, pageSize int) ([]*use
 		var timestamp string
 
 		if err := rows.Scan(&transactionID, &phoneNumber, &amount, &timestamp); err != nil {
-			fmt.Println(err)
-			return nil, errors.New("database scan error")
+			slog.ErrorContext(ctx, "error scanning transaction row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
 		}
 
 		// Adding a new User object to the slice
@@ -177,8 +187,8 @@ func (tr *TransactionRepository) GetTransactions(page int, pageSize int) ([]*use
 		format := "2006-01-02 15:04:05"
 		parsedTime, err := time.Parse(format, timestamp)
 		if err != nil {
-			fmt.Println("Error parsing time:", err)
-			return nil, errors.New("time parse error")
+			slog.ErrorContext(ctx, "error parsing time", "error", err)
+			return nil, usecase.InternalError("time parse error", err)
 		}
 		newTransaction := &usecase.Transaction{TransactionID: transactionID, PhoneNumber: phoneNumber, Amount: amount, Timestamp: parsedTime}
 		transactions = append(transactions, newTransaction)
@@ -186,25 +196,20 @@ func (tr *TransactionRepository) GetTransactions(page int, pageSize int) ([]*use
 	}
 
 	if err := rows.Err(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("database rows error")
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
 	}
 
 	// Return the list of transactions and no error
 	if len(transactions) > 0 {
 		return transactions, nil // Success case, return charge codes and no error
 	}
-	return nil, errors.New("transaction not found")
+	return nil, usecase.NotFoundError("transaction not found")
 
 }
 
-func (tr *TransactionRepository) GetTransactionByID(id int) (*usecase.Transaction, error) {
+func (tr *TransactionRepository) GetTransactionByID(ctx context.Context, id int) (*usecase.Transaction, error) {
 
-	// Ensure the database connection is valid
-	if err := tr.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
-	}
 	// Query all transactions from the 'transaction' table
 
 	query := `
@@ -221,21 +226,21 @@ func (tr *TransactionRepository) GetTransactionByID(id int) (*usecase.Transactio
 		timestamp     string
 	)
 
-	err := tr.db.QueryRow(query, id).Scan(&transactionID, &phoneNumber, &amount, &timestamp)
+	err := tr.db.QueryRowContext(ctx, query, id).Scan(&transactionID, &phoneNumber, &amount, &timestamp)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("transaction not found")
+			return nil, usecase.NotFoundError("transaction not found")
 		} else {
-			fmt.Println(err)
-			return nil, errors.New("database query error")
+			slog.ErrorContext(ctx, "error querying transaction by ID", "error", err, "transaction_id", id)
+			return nil, usecase.InternalError("database query error", err)
 		}
 	} else {
 		format := "2006-01-02 15:04:05"
 		parsedTime, err := time.Parse(format, timestamp)
 		if err != nil {
-			fmt.Println("Error parsing time:", err)
-			return nil, errors.New("time parse error")
+			slog.ErrorContext(ctx, "error parsing time", "error", err)
+			return nil, usecase.InternalError("time parse error", err)
 		}
 
 		transaction := &usecase.Transaction{
@@ -250,20 +255,14 @@ func (tr *TransactionRepository) GetTransactionByID(id int) (*usecase.Transactio
 	}
 }
 
-func (tr *TransactionRepository) GetUserTransactionsByUserID(id int, page int, pageSize int) ([]*usecase.Transaction, error) {
+func (tr *TransactionRepository) GetUserTransactionsByUserID(ctx context.Context, id int, page int, pageSize int) ([]*usecase.Transaction, error) {
 
-	if page > tr.config.MaxPage {
-		return nil, errors.New("page exceeds the maximum allowed limit")
+	if page > tr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
 	}
 
-	if pageSize > tr.config.MaxPageSize {
-		return nil, errors.New("page size exceeds the maximum allowed limit")
-	}
-
-	// Ensure the database connection is valid
-	if err := tr.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	if pageSize > tr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
 	}
 
 	// Calculate the OFFSET based on the page number and page size
@@ -275,13 +274,14 @@ func (tr *TransactionRepository) GetUserTransactionsByUserID(id int, page int, p
 		FROM transaction t
 		INNER JOIN user u ON t.user_id = u.user_id
 		WHERE u.user_id = ?
+		ORDER BY t.transaction_id
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := tr.db.Query(query, id, pageSize, offset)
+	rows, err := tr.db.QueryContext(ctx, query, id, pageSize, offset)
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying user transactions", "error", err, "user_id", id)
+		return nil, usecase.InternalError("database query error", err)
 	}
 
 	defer rows.Close()
@@ -296,8 +296,8 @@ func (tr *TransactionRepository) GetUserTransactionsByUserID(id int, page int, p
 		var timestamp string
 
 		if err := rows.Scan(&transactionID, &phoneNumber, &amount, &timestamp); err != nil {
-			fmt.Println(err)
-			return nil, errors.New("data scan error")
+			slog.ErrorContext(ctx, "error scanning transaction row", "error", err)
+			return nil, usecase.InternalError("data scan error", err)
 		}
 
 		// Adding a new User object to the slice
@@ -305,8 +305,8 @@ func (tr *TransactionRepository) GetUserTransactionsByUserID(id int, page int, p
 		format := "2006-01-02 15:04:05"
 		parsedTime, err := time.Parse(format, timestamp)
 		if err != nil {
-			fmt.Println("Error parsing time:", err)
-			return nil, errors.New("time parse error")
+			slog.ErrorContext(ctx, "error parsing time", "error", err)
+			return nil, usecase.InternalError("time parse error", err)
 		}
 		newTransaction := &usecase.Transaction{TransactionID: transactionID, PhoneNumber: phoneNumber, Amount: amount, Timestamp: parsedTime}
 		transactions = append(transactions, newTransaction)
@@ -314,40 +314,56 @@ func (tr *TransactionRepository) GetUserTransactionsByUserID(id int, page int, p
 	}
 
 	if err := rows.Err(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("row iteration error")
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("row iteration error", err)
 	}
 
 	// Return the list of transactions and no error
 	if len(transactions) > 0 {
 		return transactions, nil // Success case, return charge codes and no error
 	}
-	return nil, errors.New("transaction not found")
+	return nil, usecase.NotFoundError("transaction not found")
 
 }
 
-func (tr *TransactionRepository) GetUserTotalTransaction(userId int) (int, error) {
-
-	// Ensure the database connection is valid
-	if err := tr.db.Ping(); err != nil {
-		fmt.Println(err)
-		return 0, errors.New("internal Server Error")
-	}
-
-	println(userId)
+func (tr *TransactionRepository) GetUserTotalTransaction(ctx context.Context, userId int) (int, error) {
 
 	// Query the total transaction count for the user
 	var totalTransactionCount int
-	err := tr.db.QueryRow(`
+	err := tr.db.QueryRowContext(ctx, `
     SELECT COUNT(*) FROM transaction t
     INNER JOIN user u ON t.user_id = u.user_id
     WHERE u.user_id = ?
 `, userId).Scan(&totalTransactionCount)
 
-	println(totalTransactionCount)
 	if err != nil {
-		fmt.Printf("Error querying total transaction count: %v", err)
-		return 0, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying total transaction count", "error", err)
+		return 0, usecase.InternalError("database query error", err)
 	}
 	return totalTransactionCount, nil
 }
+
+func (tr *TransactionRepository) GetImportedTransactionID(ctx context.Context, reference string) (int, error) {
+	var transactionID int
+	err := tr.db.QueryRowContext(ctx, "SELECT transaction_id FROM transaction_import WHERE reference = ?", reference).Scan(&transactionID)
+	if err == sql.ErrNoRows {
+		return 0, usecase.NotFoundError("import reference not found")
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying import reference", "error", err, "reference", reference)
+		return 0, usecase.InternalError("database query error", err)
+	}
+	return transactionID, nil
+}
+
+func (tr *TransactionRepository) CreateImportReference(ctx context.Context, reference string, transactionID int) error {
+	_, err := tr.db.ExecContext(ctx, "INSERT INTO transaction_import (reference, transaction_id) VALUES (?, ?)", reference, transactionID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return usecase.ConflictError("reference " + reference + " is being imported by another request")
+		}
+		slog.ErrorContext(ctx, "error inserting import reference", "error", err, "reference", reference)
+		return usecase.InternalError("database insert error", err)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTransactionRepositoryCreateTransaction(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	users := NewUserRepository(db, appConfig)
+	ctx := context.Background()
+
+	id := insertUser(t, db, "09120000001")
+
+	created, err := repo.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: 5000})
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+	if created.TransactionID == 0 {
+		t.Errorf("CreateTransaction did not set the transaction id")
+	}
+	if _, err := repo.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: -2000}); err != nil {
+		t.Fatalf("CreateTransaction of a debit: %v", err)
+	}
+
+	// The balance is kept by the update_user_balance trigger
+	user, err := users.GetUserByID(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.Balance != 3000 || user.Version != 3 {
+		t.Errorf("user = %+v, want balance 3000 at version 3", user)
+	}
+
+	total, err := repo.GetUserTotalTransaction(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserTotalTransaction: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("GetUserTotalTransaction = %d, want 2", total)
+	}
+}
+
+func TestTransactionRepositoryImportReferences(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	ctx := context.Background()
+
+	insertUser(t, db, "09120000001")
+	created, err := repo.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: 5000})
+	if err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+
+	if _, err := repo.GetImportedTransactionID(ctx, "INV-1"); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetImportedTransactionID before the import: err = %v, want not found", err)
+	}
+	if err := repo.CreateImportReference(ctx, "INV-1", created.TransactionID); err != nil {
+		t.Fatalf("CreateImportReference: %v", err)
+	}
+	if id, err := repo.GetImportedTransactionID(ctx, "INV-1"); err != nil || id != created.TransactionID {
+		t.Errorf("GetImportedTransactionID = %d, %v, want %d", id, err, created.TransactionID)
+	}
+	if err := repo.CreateImportReference(ctx, "INV-1", created.TransactionID); !errors.Is(err, usecase.ErrConflict) {
+		t.Errorf("CreateImportReference of an imported reference: err = %v, want a conflict", err)
+	}
+}
+
+func TestTransactionRepositoryCreateTransactionErrors(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	ctx := context.Background()
+
+	insertUser(t, db, "09120000001")
+	if _, err := repo.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: "09120000001", Amount: 1000}); err != nil {
+		t.Fatalf("CreateTransaction: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		transaction *usecase.Transaction
+		want        error
+	}{
+		{"debit past the balance", &usecase.Transaction{PhoneNumber: "09120000001", Amount: -1001}, usecase.ErrInsufficientFunds},
+		{"amount past the maximum", &usecase.Transaction{PhoneNumber: "09120000001", Amount: 2000001}, usecase.ErrValidation},
+		{"amount past the minimum", &usecase.Transaction{PhoneNumber: "09120000001", Amount: -200001}, usecase.ErrValidation},
+		{"missing user", &usecase.Transaction{PhoneNumber: "09120000002", Amount: 1000}, usecase.ErrNotFound},
+		{"invalid phone number", &usecase.Transaction{PhoneNumber: "0912", Amount: 1000}, usecase.ErrInvalidPhoneNumber},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := repo.CreateTransaction(ctx, tt.transaction); !errors.Is(err, tt.want) {
+				t.Errorf("CreateTransaction: err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	balance, err := NewUserRepository(db, appConfig).GetUserBalance(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetUserBalance: %v", err)
+	}
+	if balance != 1000 {
+		t.Errorf("balance after the failed transactions = %v, want 1000", balance)
+	}
+}
+
+func TestTransactionRepositoryGetTransactionsPagination(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	ctx := context.Background()
+
+	first := insertUser(t, db, "09120000001")
+	insertUser(t, db, "09120000002")
+	for i := 0; i < 3; i++ {
+		for _, phoneNumber := range []string{"09120000001", "09120000002"} {
+			if _, err := repo.CreateTransaction(ctx, &usecase.Transaction{PhoneNumber: phoneNumber, Amount: 1000}); err != nil {
+				t.Fatalf("CreateTransaction: %v", err)
+			}
+		}
+	}
+
+	// Pages follow the transaction ids, so reading them all sees every
+	// transaction once
+	ids := []int{}
+	for page, want := range []int{4, 2} {
+		transactions, err := repo.GetTransactions(ctx, page+1, 4)
+		if err != nil {
+			t.Fatalf("GetTransactions page %d: %v", page+1, err)
+		}
+		if len(transactions) != want {
+			t.Errorf("GetTransactions page %d returned %d transactions, want %d", page+1, len(transactions), want)
+		}
+		for _, transaction := range transactions {
+			ids = append(ids, transaction.TransactionID)
+		}
+	}
+	if want := []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("transactions of every page = %v, want %v", ids, want)
+	}
+	if _, err := repo.GetTransactions(ctx, 3, 4); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetTransactions past the last page: err = %v, want not found", err)
+	}
+	if _, err := repo.GetTransactions(ctx, 41, 4); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("GetTransactions past MaxPage: err = %v, want validation error", err)
+	}
+
+	transactions, err := repo.GetUserTransactionsByUserID(ctx, first, 1, 10)
+	if err != nil {
+		t.Fatalf("GetUserTransactionsByUserID: %v", err)
+	}
+	if len(transactions) != 3 {
+		t.Errorf("GetUserTransactionsByUserID returned %d transactions, want 3", len(transactions))
+	}
+	for _, transaction := range transactions {
+		if transaction.PhoneNumber != "09120000001" || transaction.Timestamp.IsZero() {
+			t.Errorf("GetUserTransactionsByUserID returned %+v", transaction)
+		}
+	}
+
+	transaction, err := repo.GetTransactionByID(ctx, transactions[0].TransactionID)
+	if err != nil {
+		t.Fatalf("GetTransactionByID: %v", err)
+	}
+	if *transaction != *transactions[0] {
+		t.Errorf("GetTransactionByID = %+v, want %+v", transaction, transactions[0])
+	}
+	if _, err := repo.GetTransactionByID(ctx, 1000); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetTransactionByID of a missing transaction: err = %v, want not found", err)
+	}
+}
+
+func TestTransactionRepositoryCreateChargeTransaction(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	chargeCodes := NewChargeCodeRepository(db, appConfig)
+	users := NewUserRepository(db, appConfig)
+	ctx := context.Background()
+
+	chargeCode := createChargeCode(t, chargeCodes, "WELCOME", 2, 5000)
+	redemption := &usecase.ChargeCodeTransaction{PhoneNumber: "09120000001", ChargeCodeID: chargeCode.ChargeCodeID}
+	if _, err := repo.CreateChargeTransaction(ctx, redemption); err != nil {
+		t.Fatalf("CreateChargeTransaction: %v", err)
+	}
+
+	// RedeemChargeCode creates the transaction, whose trigger credits the
+	// new user
+	user, err := users.GetUserByPhoneNumber(ctx, "09120000001")
+	if err != nil {
+		t.Fatalf("GetUserByPhoneNumber: %v", err)
+	}
+	if user.Balance != 5000 {
+		t.Errorf("balance after the redemption = %v, want 5000", user.Balance)
+	}
+
+	redeemed, err := chargeCodes.GetChargeCodeByID(ctx, chargeCode.ChargeCodeID)
+	if err != nil {
+		t.Fatalf("GetChargeCodeByID: %v", err)
+	}
+	if redeemed.CurrentUses != 1 || redeemed.Version != 2 {
+		t.Errorf("charge code after the redemption = %+v, want one use at version 2", redeemed)
+	}
+
+	userChargeCodes, err := chargeCodes.GetUserChargeCodes(ctx, user.ID, usecase.ChargeCodeStatuses, 1, 10)
+	if err != nil {
+		t.Fatalf("GetUserChargeCodes: %v", err)
+	}
+	if len(userChargeCodes) != 1 || userChargeCodes[0].ChargeCodeID != chargeCode.ChargeCodeID {
+		t.Errorf("GetUserChargeCodes = %+v, want %s", userChargeCodes, chargeCode.Code)
+	}
+}
+
+func TestTransactionRepositoryCreateChargeTransactionLimits(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewTransactionRepository(db, appConfig)
+	chargeCodes := NewChargeCodeRepository(db, appConfig)
+	ctx := context.Background()
+
+	chargeCode := createChargeCode(t, chargeCodes, "LIMITED", 2, 1000)
+	paused := createChargeCode(t, chargeCodes, "PAUSED", 2, 1000)
+	if _, err := chargeCodes.SetChargeCodeStatus(ctx, paused.ChargeCodeID, usecase.ChargeCodePaused); err != nil {
+		t.Fatalf("SetChargeCodeStatus: %v", err)
+	}
+
+	for _, phoneNumber := range []string{"09120000001", "09120000002"} {
+		if _, err := repo.CreateChargeTransaction(ctx, &usecase.ChargeCodeTransaction{PhoneNumber: phoneNumber, ChargeCodeID: chargeCode.ChargeCodeID}); err != nil {
+			t.Fatalf("CreateChargeTransaction for %s: %v", phoneNumber, err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		redemption *usecase.ChargeCodeTransaction
+		want       error
+	}{
+		{"all uses taken", &usecase.ChargeCodeTransaction{PhoneNumber: "09120000003", ChargeCodeID: chargeCode.ChargeCodeID}, usecase.ErrChargeCodeUnavailable},
+		{"paused", &usecase.ChargeCodeTransaction{PhoneNumber: "09120000004", ChargeCodeID: paused.ChargeCodeID}, usecase.ErrChargeCodeInactive},
+		{"missing charge code", &usecase.ChargeCodeTransaction{PhoneNumber: "09120000005", ChargeCodeID: paused.ChargeCodeID + 1}, usecase.ErrChargeCodeUnavailable},
+		{"registered phone number", &usecase.ChargeCodeTransaction{PhoneNumber: "09120000001", ChargeCodeID: paused.ChargeCodeID}, usecase.ErrPhoneNumberRegistered},
+		{"invalid phone number", &usecase.ChargeCodeTransaction{PhoneNumber: "0912", ChargeCodeID: chargeCode.ChargeCodeID}, usecase.ErrInvalidPhoneNumber},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := repo.CreateChargeTransaction(ctx, tt.redemption); !errors.Is(err, tt.want) {
+				t.Errorf("CreateChargeTransaction: err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	stored, err := chargeCodes.GetChargeCodeByID(ctx, chargeCode.ChargeCodeID)
+	if err != nil {
+		t.Fatalf("GetChargeCodeByID: %v", err)
+	}
+	if stored.CurrentUses != 2 {
+		t.Errorf("current uses = %d, want 2", stored.CurrentUses)
+	}
+}
+
+// TestTransactionRepositoryConcurrentRedemptions redeems the last use of a
+// charge code from several transactions at once. Only one may succeed, which
+// relies on the row lock of SELECT ... FOR UPDATE.
+func TestTransactionRepositoryConcurrentRedemptions(t *testing.T) {
+	db, appConfig := newServerTestDB(t, "row locks")
+	chargeCodes := NewChargeCodeRepository(db, appConfig)
+	store := NewStore(db, appConfig)
+	ctx := context.Background()
+
+	chargeCode := createChargeCode(t, chargeCodes, "LASTONE", 1, 1000)
+
+	const redemptions = 5
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < redemptions; i++ {
+		wg.Add(1)
+		go func(phoneNumber string) {
+			defer wg.Done()
+			err := store.WithinTransaction(ctx, func(repos *usecase.Repositories) error {
+				_, err := repos.Transactions.CreateChargeTransaction(ctx, &usecase.ChargeCodeTransaction{PhoneNumber: phoneNumber, ChargeCodeID: chargeCode.ChargeCodeID})
+				return err
+			})
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			} else if !errors.Is(err, usecase.ErrChargeCodeUnavailable) {
+				t.Errorf("CreateChargeTransaction for %s: %v", phoneNumber, err)
+			}
+		}(fmt.Sprintf("0912000000%d", i))
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("%d redemptions of the last use succeeded, want 1", succeeded)
+	}
+	stored, err := chargeCodes.GetChargeCodeByID(ctx, chargeCode.ChargeCodeID)
+	if err != nil {
+		t.Fatalf("GetChargeCodeByID: %v", err)
+	}
+	if stored.CurrentUses != 1 {
+		t.Errorf("current uses = %d, want 1", stored.CurrentUses)
+	}
+}
@@ -4,15 +4,15 @@ package repository
 import (
 	"chargeCode/internal/config"
 	"chargeCode/internal/usecase"
+	"context"
 	"database/sql"
-	"errors" // Import the errors package
-	"fmt"
+	"log/slog"
 	"regexp"
 )
 
 type UserRepository struct {
 	// Implement data storage and retrieval methods here
-	db     *sql.DB
+	db     executor
 	config *config.AppConfig
 }
 
@@ -22,45 +22,41 @@ func NewUserRepository(db *sql.DB, config *config.AppConfig) *UserRepository {
 	return &UserRepository{db: db, config: config}
 }
 
-func (ur *UserRepository) GetUserByPhoneNumber(phoneNumber string) (*usecase.User, error) {
-
-	// Ensure the database connection is valid
-	if err := ur.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
-	}
+func (ur *UserRepository) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*usecase.User, error) {
 
 	formatPattern := `^09\d{9}$`
 
 	// Compile the regular expression
 	re := regexp.MustCompile(formatPattern)
 	if !re.MatchString(phoneNumber) {
-		return nil, errors.New("phone number is incorrect Most Like 09121114323")
+		return nil, usecase.ErrInvalidPhoneNumber
 	}
 
 	// Query to retrieve user by phone number
-	query := "SELECT user_id, phoneNumber, balance FROM user WHERE phoneNumber = ?"
+	query := "SELECT user_id, phoneNumber, balance, version FROM user WHERE phoneNumber = ?"
 
 	var (
 		userID  int
 		phone   string
 		balance float64
+		version int
 	)
 
-	err := ur.db.QueryRow(query, phoneNumber).Scan(&userID, &phone, &balance)
+	err := ur.db.QueryRowContext(ctx, query, phoneNumber).Scan(&userID, &phone, &balance, &version)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("user not found")
+			return nil, usecase.NotFoundError("user not found")
 		} else {
-			fmt.Println("Database error:", err)
-			return nil, errors.New("database query error")
+			slog.ErrorContext(ctx, "error querying user by phone number", "error", err, "phoneNumber", phoneNumber)
+			return nil, usecase.InternalError("database query error", err)
 		}
 	} else {
 		user := &usecase.User{
 			ID:          userID,
 			PhoneNumber: phone, // Replace with actual data retrieval logic
 			Balance:     balance,
+			Version:     version,
 		}
 
 		return user, nil // Success case, return user and no error
@@ -68,55 +64,108 @@ func (ur *UserRepository) GetUserByPhoneNumber(phoneNumber string) (*usecase.Use
 	}
 }
 
-func (ur *UserRepository) UpdateUser(user *usecase.User) (*usecase.User, error) {
+func (ur *UserRepository) GetUserByID(ctx context.Context, id int) (*usecase.User, error) {
+
+	query := "SELECT user_id, phoneNumber, balance, version FROM user WHERE user_id = ?"
+
+	var (
+		userID  int
+		phone   string
+		balance float64
+		version int
+	)
+
+	err := ur.db.QueryRowContext(ctx, query, id).Scan(&userID, &phone, &balance, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, usecase.NotFoundError("user not found")
+		}
+		slog.ErrorContext(ctx, "error querying user by ID", "error", err, "user_id", id)
+		return nil, usecase.InternalError("database query error", err)
+	}
+
+	return &usecase.User{ID: userID, PhoneNumber: phone, Balance: balance, Version: version}, nil
+}
+
+func (ur *UserRepository) UpdateUser(ctx context.Context, user *usecase.User) (*usecase.User, error) {
 
 	formatPattern := `^09\d{9}$`
 
 	// Compile the regular expression
 	re := regexp.MustCompile(formatPattern)
 	if !re.MatchString(user.PhoneNumber) {
-		return nil, errors.New("phone number is incorrect Most Like 09121114323")
+		return nil, usecase.ErrInvalidPhoneNumber
 	}
 
 	if user.Balance < 0 {
-		return nil, errors.New("invalid user data")
+		return nil, usecase.ValidationError("invalid user data")
 	}
 
-	// Ensure the database connection is valid
-	if err := ur.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	// Only update the user if it did not change since user.Version was read
+	result, err := ur.db.ExecContext(ctx, "UPDATE user SET phoneNumber=?, balance=?, version=version+1 WHERE user_id=? AND version=?", user.PhoneNumber, user.Balance, user.ID, user.Version)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, usecase.ErrPhoneNumberRegistered
+		}
+		slog.ErrorContext(ctx, "error updating user", "error", err, "user_id", user.ID)
+		return nil, usecase.InternalError("database update error", err)
 	}
 
-	_, err := ur.db.Exec("UPDATE user SET  phoneNumber=?, balance=? WHERE user_id=?", user.PhoneNumber, user.Balance, user.ID)
+	updated, err := result.RowsAffected()
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New("database update error")
+		slog.ErrorContext(ctx, "error reading updated users", "error", err, "user_id", user.ID)
+		return nil, usecase.InternalError("database update error", err)
 	}
+	if updated == 0 {
+		return nil, usecase.ErrVersionMismatch
+	}
+
+	user.Version++
 	return user, nil
 }
 
-func (ur *UserRepository) ListOfUsersUseChargeCode(chargeCodeId int, page int, pageSize int) ([]*usecase.User, error) {
+func (ur *UserRepository) PatchUser(ctx context.Context, id int, version int, patch *usecase.UserPatch) (*usecase.User, error) {
+	// The phone number is the only column a patch can set
+	if patch.PhoneNumber == nil {
+		return ur.GetUserByID(ctx, id)
+	}
+
+	result, err := ur.db.ExecContext(ctx, "UPDATE user SET phoneNumber=?, version=version+1 WHERE user_id=? AND version=?", *patch.PhoneNumber, id, version)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return nil, usecase.ErrPhoneNumberRegistered
+		}
+		slog.ErrorContext(ctx, "error patching user", "error", err, "user_id", id)
+		return nil, usecase.InternalError("database update error", err)
+	}
 
-	if page > ur.config.MaxPage {
-		return nil, errors.New("page exceeds the maximum allowed limit")
+	updated, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading patched users", "error", err, "user_id", id)
+		return nil, usecase.InternalError("database update error", err)
 	}
+	if updated == 0 {
+		return nil, usecase.ErrVersionMismatch
+	}
+
+	return ur.GetUserByID(ctx, id)
+}
+
+func (ur *UserRepository) ListOfUsersUseChargeCode(ctx context.Context, chargeCodeId int, page int, pageSize int) ([]*usecase.User, error) {
 
-	if pageSize > ur.config.MaxPageSize {
-		return nil, errors.New("page size exceeds the maximum allowed limit")
+	if page > ur.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
 	}
 
-	// Ensure the database connection is valid
-	if err := ur.db.Ping(); err != nil {
-		fmt.Println(err)
-		return nil, errors.New("internal Server Error")
+	if pageSize > ur.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
 	}
 
 	//check charge code exist
-	chargeCodeRepository := NewChargeCodeRepository(ur.db, ur.config)
-	_, err := chargeCodeRepository.GetChargeCodeByID(chargeCodeId)
+	chargeCodeRepository := &ChargeCodeRepository{db: ur.db, config: ur.config}
+	_, err := chargeCodeRepository.GetChargeCodeByID(ctx, chargeCodeId)
 	if err != nil {
-		return nil, errors.New(err.Error())
+		return nil, err
 	}
 
 	users := []*usecase.User{}
@@ -127,7 +176,7 @@ func (ur *UserRepository) ListOfUsersUseChargeCode(chargeCodeId int, page int, p
 
 	// Prepare the SQL query with pagination
 	query := `
-			SELECT u.*
+			SELECT u.user_id, u.phoneNumber, u.balance, u.version
 			FROM user u
 			JOIN user_charge_code ucc ON u.user_id = ucc.user_id
 			JOIN charge_code cc ON ucc.charge_code_id = cc.charge_code_id
@@ -136,10 +185,10 @@ func (ur *UserRepository) ListOfUsersUseChargeCode(chargeCodeId int, page int, p
 		`
 
 	// Execute the query
-	rows, err := ur.db.Query(query, chargeCodeId, pageSize, offset)
+	rows, err := ur.db.QueryContext(ctx, query, chargeCodeId, pageSize, offset)
 	if err != nil {
-		fmt.Println(err)
-		return nil, errors.New(err.Error())
+		slog.ErrorContext(ctx, "error querying charge code users", "error", err, "charge_code_id", chargeCodeId)
+		return nil, usecase.InternalError("database query error", err)
 	}
 	defer rows.Close()
 
@@ -149,14 +198,15 @@ func (ur *UserRepository) ListOfUsersUseChargeCode(chargeCodeId int, page int, p
 			userID      int
 			phoneNumber string
 			balance     float64 // Assuming balance is a decimal column
+			version     int
 		)
-		if err := rows.Scan(&userID, &phoneNumber, &balance); err != nil {
-			fmt.Println(err)
-			return nil, errors.New("database query error")
+		if err := rows.Scan(&userID, &phoneNumber, &balance, &version); err != nil {
+			slog.ErrorContext(ctx, "error scanning user row", "error", err)
+			return nil, usecase.InternalError("database query error", err)
 		}
 
 		// Adding a new User object to the slice
-		newUser := &usecase.User{ID: userID, PhoneNumber: phoneNumber, Balance: balance}
+		newUser := &usecase.User{ID: userID, PhoneNumber: phoneNumber, Balance: balance, Version: version}
 		users = append(users, newUser)
 	}
 
@@ -164,37 +214,31 @@ func (ur *UserRepository) ListOfUsersUseChargeCode(chargeCodeId int, page int, p
 		return users, nil // Success case, return charge codes and no error
 	}
 
-	return nil, errors.New("no users found for the charge code ID")
+	return nil, usecase.NotFoundError("no users found for the charge code ID")
 }
 
-func (ur *UserRepository) GetUserBalance(userId int) (float64, error) {
-
-	// Ensure the database connection is valid
-	if err := ur.db.Ping(); err != nil {
-		fmt.Println(err)
-		return 0, errors.New("internal Server Error")
-	}
+func (ur *UserRepository) GetUserBalance(ctx context.Context, userId int) (float64, error) {
 
 	// Check if the user exists based on user ID
 	var userExists bool
 	query := "SELECT COUNT(*) FROM user WHERE user_id = ?"
-	err := ur.db.QueryRow(query, userId).Scan(&userExists)
+	err := ur.db.QueryRowContext(ctx, query, userId).Scan(&userExists)
 	if err != nil {
-		fmt.Println(err)
-		return 0, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying user", "error", err, "user_id", userId)
+		return 0, usecase.InternalError("database query error", err)
 	}
 
 	if !userExists {
-		return 0, errors.New("user not found")
+		return 0, usecase.NotFoundError("user not found")
 	}
 
 	// Retrieve the user's balance
 	query = "SELECT balance FROM user WHERE user_id = ?"
 	var balance float64
-	err = ur.db.QueryRow(query, userId).Scan(&balance)
+	err = ur.db.QueryRowContext(ctx, query, userId).Scan(&balance)
 	if err != nil {
-		fmt.Println(err)
-		return 0, errors.New("database query error")
+		slog.ErrorContext(ctx, "error querying user balance", "error", err, "user_id", userId)
+		return 0, usecase.InternalError("database query error", err)
 	}
 
 	return balance, nil
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUserRepositoryGetUserByPhoneNumber(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewUserRepository(db, appConfig)
+	ctx := context.Background()
+
+	id := insertUser(t, db, "09120000001")
+
+	user, err := repo.GetUserByPhoneNumber(ctx, "09120000001")
+	if err != nil {
+		t.Fatalf("GetUserByPhoneNumber: %v", err)
+	}
+	if user.ID != id || user.Balance != 0 || user.Version != 1 {
+		t.Errorf("GetUserByPhoneNumber = %+v, want user %d with a zero balance at version 1", user, id)
+	}
+
+	if _, err := repo.GetUserByPhoneNumber(ctx, "09120000002"); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetUserByPhoneNumber of a missing user: err = %v, want not found", err)
+	}
+	if _, err := repo.GetUserByPhoneNumber(ctx, "9120000001"); !errors.Is(err, usecase.ErrInvalidPhoneNumber) {
+		t.Errorf("GetUserByPhoneNumber of an invalid phone number: err = %v, want invalid phone number", err)
+	}
+	if _, err := repo.GetUserByID(ctx, id+1); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetUserByID of a missing user: err = %v, want not found", err)
+	}
+}
+
+func TestUserRepositoryUpdateUser(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewUserRepository(db, appConfig)
+	ctx := context.Background()
+
+	id := insertUser(t, db, "09120000001")
+
+	updated, err := repo.UpdateUser(ctx, &usecase.User{ID: id, PhoneNumber: "09120000009", Balance: 10, Version: 1})
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.Version != 2 {
+		t.Errorf("UpdateUser version = %d, want 2", updated.Version)
+	}
+
+	if _, err := repo.UpdateUser(ctx, &usecase.User{ID: id, PhoneNumber: "09120000009", Balance: 20, Version: 1}); !errors.Is(err, usecase.ErrVersionMismatch) {
+		t.Errorf("UpdateUser of a stale version: err = %v, want version mismatch", err)
+	}
+	if _, err := repo.UpdateUser(ctx, &usecase.User{ID: id, PhoneNumber: "09120000009", Balance: -1, Version: 2}); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("UpdateUser with a negative balance: err = %v, want validation error", err)
+	}
+	if _, err := repo.UpdateUser(ctx, &usecase.User{ID: id, PhoneNumber: "0912", Version: 2}); !errors.Is(err, usecase.ErrInvalidPhoneNumber) {
+		t.Errorf("UpdateUser with an invalid phone number: err = %v, want invalid phone number", err)
+	}
+
+	balance, err := repo.GetUserBalance(ctx, id)
+	if err != nil {
+		t.Fatalf("GetUserBalance: %v", err)
+	}
+	if balance != 10 {
+		t.Errorf("GetUserBalance = %v, want 10", balance)
+	}
+	if _, err := repo.GetUserBalance(ctx, id+1); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetUserBalance of a missing user: err = %v, want not found", err)
+	}
+}
+
+func TestUserRepositoryPatchUser(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewUserRepository(db, appConfig)
+	ctx := context.Background()
+
+	insertUser(t, db, "09120000001")
+	id := insertUser(t, db, "09120000002")
+
+	phoneNumber := "09120000003"
+	patched, err := repo.PatchUser(ctx, id, 1, &usecase.UserPatch{PhoneNumber: &phoneNumber})
+	if err != nil {
+		t.Fatalf("PatchUser: %v", err)
+	}
+	if patched.PhoneNumber != phoneNumber || patched.Version != 2 {
+		t.Errorf("PatchUser = %+v, want phone number %s at version 2", patched, phoneNumber)
+	}
+
+	taken := "09120000001"
+	if _, err := repo.PatchUser(ctx, id, 2, &usecase.UserPatch{PhoneNumber: &taken}); !errors.Is(err, usecase.ErrPhoneNumberRegistered) {
+		t.Errorf("PatchUser to a registered phone number: err = %v, want phone number registered", err)
+	}
+	if _, err := repo.PatchUser(ctx, id, 1, &usecase.UserPatch{PhoneNumber: &phoneNumber}); !errors.Is(err, usecase.ErrVersionMismatch) {
+		t.Errorf("PatchUser of a stale version: err = %v, want version mismatch", err)
+	}
+}
+
+func TestUserRepositoryListOfUsersUseChargeCode(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewUserRepository(db, appConfig)
+	chargeCodes := NewChargeCodeRepository(db, appConfig)
+	transactions := NewTransactionRepository(db, appConfig)
+	ctx := context.Background()
+
+	chargeCode := createChargeCode(t, chargeCodes, "CAMPAIGN", 10, 1000)
+	unused := createChargeCode(t, chargeCodes, "UNUSED", 10, 1000)
+	for i := 1; i <= 3; i++ {
+		redemption := &usecase.ChargeCodeTransaction{PhoneNumber: fmt.Sprintf("0912000000%d", i), ChargeCodeID: chargeCode.ChargeCodeID}
+		if _, err := transactions.CreateChargeTransaction(ctx, redemption); err != nil {
+			t.Fatalf("CreateChargeTransaction: %v", err)
+		}
+	}
+
+	for page, want := range map[int]int{1: 2, 2: 1} {
+		users, err := repo.ListOfUsersUseChargeCode(ctx, chargeCode.ChargeCodeID, page, 2)
+		if err != nil {
+			t.Fatalf("ListOfUsersUseChargeCode page %d: %v", page, err)
+		}
+		if len(users) != want {
+			t.Errorf("ListOfUsersUseChargeCode page %d returned %d users, want %d", page, len(users), want)
+		}
+	}
+
+	if _, err := repo.ListOfUsersUseChargeCode(ctx, unused.ChargeCodeID, 1, 2); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("ListOfUsersUseChargeCode of an unused charge code: err = %v, want not found", err)
+	}
+	if _, err := repo.ListOfUsersUseChargeCode(ctx, unused.ChargeCodeID+1, 1, 2); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("ListOfUsersUseChargeCode of a missing charge code: err = %v, want not found", err)
+	}
+	if _, err := repo.ListOfUsersUseChargeCode(ctx, chargeCode.ChargeCodeID, 1, 31); !errors.Is(err, usecase.ErrValidation) {
+		t.Errorf("ListOfUsersUseChargeCode past MaxPageSize: err = %v, want validation error", err)
+	}
+}
@@ -0,0 +1,434 @@
+package repository
+
+import (
+	"chargeCode/internal/config"
+	"chargeCode/internal/usecase"
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+type WebhookRepository struct {
+	db     executor
+	config *config.AppConfig
+}
+
+func NewWebhookRepository(db *sql.DB, config *config.AppConfig) *WebhookRepository {
+	return &WebhookRepository{db: db, config: config}
+}
+
+// parseTimestamp parses a DATETIME or TIMESTAMP column scanned as a string.
+func parseTimestamp(value string) (time.Time, error) {
+	format := "2006-01-02 15:04:05"
+	parsedTime, err := time.Parse(format, value)
+	if err != nil {
+		slog.Error("error parsing time", "error", err)
+		return time.Time{}, usecase.InternalError("time parse error", err)
+	}
+	return parsedTime, nil
+}
+
+func (wr *WebhookRepository) CreateSubscription(ctx context.Context, subscription *usecase.WebhookSubscription) (*usecase.WebhookSubscription, error) {
+
+	result, err := wr.db.ExecContext(ctx, `
+		INSERT INTO webhook_subscription (url, secret, event_types, active)
+		VALUES (?, ?, ?, ?)
+	`, subscription.URL, subscription.Secret, strings.Join(subscription.EventTypes, ","), subscription.Active)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating webhook subscription", "error", err)
+		return nil, usecase.InternalError("database insert error", err)
+	}
+
+	subscriptionID, err := result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading webhook subscription id", "error", err)
+		return nil, usecase.InternalError("database insert error", err)
+	}
+	subscription.SubscriptionID = int(subscriptionID)
+	subscription.CreatedAt = time.Now().UTC()
+	return subscription, nil
+}
+
+// scanSubscriptions reads subscription rows. The secret column is only read
+// when withSecret is set.
+func scanSubscriptions(ctx context.Context, rows *sql.Rows, withSecret bool) ([]*usecase.WebhookSubscription, error) {
+	subscriptions := []*usecase.WebhookSubscription{}
+
+	for rows.Next() {
+		var subscription usecase.WebhookSubscription
+		var eventTypes, createdAt string
+
+		dest := []interface{}{&subscription.SubscriptionID, &subscription.URL, &eventTypes, &subscription.Active, &createdAt}
+		if withSecret {
+			dest = append(dest, &subscription.Secret)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			slog.ErrorContext(ctx, "error scanning webhook subscription row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+
+		subscription.EventTypes = strings.Split(eventTypes, ",")
+		parsedTime, err := parseTimestamp(createdAt)
+		if err != nil {
+			return nil, err
+		}
+		subscription.CreatedAt = parsedTime
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return subscriptions, nil
+}
+
+func (wr *WebhookRepository) GetSubscriptions(ctx context.Context, page int, pageSize int) ([]*usecase.WebhookSubscription, error) {
+
+	if page > wr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > wr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+
+	rows, err := wr.db.QueryContext(ctx, `
+		SELECT subscription_id, url, event_types, active, created_at
+		FROM webhook_subscription
+		ORDER BY subscription_id
+		LIMIT ? OFFSET ?
+	`, pageSize, offset)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying webhook subscriptions", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	subscriptions, err := scanSubscriptions(ctx, rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscriptions) > 0 {
+		return subscriptions, nil
+	}
+	return nil, usecase.NotFoundError("webhook subscriptions not found")
+}
+
+func (wr *WebhookRepository) GetSubscriptionByID(ctx context.Context, id int) (*usecase.WebhookSubscription, error) {
+
+	rows, err := wr.db.QueryContext(ctx, `
+		SELECT subscription_id, url, event_types, active, created_at, secret
+		FROM webhook_subscription
+		WHERE subscription_id = ?
+	`, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying webhook subscription by ID", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	subscriptions, err := scanSubscriptions(ctx, rows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subscriptions) == 0 {
+		return nil, usecase.NotFoundError("webhook subscription not found")
+	}
+	return subscriptions[0], nil
+}
+
+func (wr *WebhookRepository) GetActiveSubscriptions(ctx context.Context) ([]*usecase.WebhookSubscription, error) {
+
+	rows, err := wr.db.QueryContext(ctx, `
+		SELECT subscription_id, url, event_types, active, created_at
+		FROM webhook_subscription
+		WHERE active = TRUE
+	`)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying active webhook subscriptions", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	return scanSubscriptions(ctx, rows, false)
+}
+
+func (wr *WebhookRepository) DeactivateSubscription(ctx context.Context, id int) error {
+
+	result, err := wr.db.ExecContext(ctx, "UPDATE webhook_subscription SET active = FALSE WHERE subscription_id = ?", id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error deactivating webhook subscription", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading affected rows", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	if affected == 0 {
+		return usecase.NotFoundError("webhook subscription not found")
+	}
+	return nil
+}
+
+func (wr *WebhookRepository) CreateDelivery(ctx context.Context, delivery *usecase.WebhookDelivery) error {
+
+	// The outbox publishes at least once; a repeated event keeps its existing
+	// delivery, whose id is then returned by LAST_INSERT_ID
+	result, err := wr.db.ExecContext(ctx, `
+		INSERT INTO webhook_delivery (subscription_id, event_id, event_type, payload, status, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE delivery_id = LAST_INSERT_ID(delivery_id)
+	`, delivery.SubscriptionID, delivery.EventID, delivery.EventType, string(delivery.Payload), delivery.Status, delivery.NextAttemptAt)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating webhook delivery", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+
+	delivery.DeliveryID, err = result.LastInsertId()
+	if err != nil {
+		slog.ErrorContext(ctx, "error reading webhook delivery id", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+	return nil
+}
+
+const deliveryColumns = `delivery_id, subscription_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, created_at`
+
+func scanDelivery(scan func(dest ...interface{}) error) (*usecase.WebhookDelivery, error) {
+	var delivery usecase.WebhookDelivery
+	var payload, nextAttemptAt, createdAt string
+	var lastStatusCode sql.NullInt64
+	var lastError sql.NullString
+
+	if err := scan(&delivery.DeliveryID, &delivery.SubscriptionID, &delivery.EventID, &delivery.EventType, &payload,
+		&delivery.Status, &delivery.Attempts, &nextAttemptAt, &lastStatusCode, &lastError, &createdAt); err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = []byte(payload)
+	delivery.LastStatusCode = int(lastStatusCode.Int64)
+	delivery.LastError = lastError.String
+
+	var err error
+	if delivery.NextAttemptAt, err = parseTimestamp(nextAttemptAt); err != nil {
+		return nil, err
+	}
+	if delivery.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (wr *WebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*usecase.WebhookDelivery, error) {
+
+	pool, ok := wr.db.(*sql.DB)
+	if !ok {
+		return nil, usecase.InternalError("claiming webhook deliveries needs a database connection pool", nil)
+	}
+
+	tx, err := pool.BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error beginning transaction", "error", err)
+		return nil, usecase.InternalError("database error", err)
+	}
+	defer tx.Rollback()
+
+	// SKIP LOCKED lets several instances claim different deliveries at once
+	rows, err := tx.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_delivery
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, delivery_id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`, usecase.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying due webhook deliveries", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+
+	deliveries := []*usecase.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows.Scan)
+		if err != nil {
+			rows.Close()
+			slog.ErrorContext(ctx, "error scanning webhook delivery row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+
+	leasedUntil := now.Add(lease)
+	for _, delivery := range deliveries {
+		_, err := tx.ExecContext(ctx, "UPDATE webhook_delivery SET next_attempt_at = ? WHERE delivery_id = ?", leasedUntil, delivery.DeliveryID)
+		if err != nil {
+			slog.ErrorContext(ctx, "error claiming webhook delivery", "error", err)
+			return nil, usecase.InternalError("database error", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "error committing transaction", "error", err)
+		return nil, usecase.InternalError("database error", err)
+	}
+	return deliveries, nil
+}
+
+func (wr *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *usecase.WebhookDelivery) error {
+
+	var lastStatusCode interface{}
+	if delivery.LastStatusCode != 0 {
+		lastStatusCode = delivery.LastStatusCode
+	}
+
+	_, err := wr.db.ExecContext(ctx, `
+		UPDATE webhook_delivery
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?
+		WHERE delivery_id = ?
+	`, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, lastStatusCode, delivery.LastError, delivery.DeliveryID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error updating webhook delivery", "error", err)
+		return usecase.InternalError("database error", err)
+	}
+	return nil
+}
+
+func (wr *WebhookRepository) CreateDeliveryAttempt(ctx context.Context, deliveryID int64, attempt *usecase.WebhookDeliveryAttempt) error {
+
+	var statusCode interface{}
+	if attempt.StatusCode != 0 {
+		statusCode = attempt.StatusCode
+	}
+
+	_, err := wr.db.ExecContext(ctx, `
+		INSERT INTO webhook_delivery_attempt (delivery_id, status_code, error, duration_ms)
+		VALUES (?, ?, ?, ?)
+	`, deliveryID, statusCode, attempt.Error, attempt.DurationMs)
+	if err != nil {
+		slog.ErrorContext(ctx, "error creating webhook delivery attempt", "error", err)
+		return usecase.InternalError("database insert error", err)
+	}
+	return nil
+}
+
+func (wr *WebhookRepository) GetDeliveries(ctx context.Context, subscriptionID int, status string, page int, pageSize int) ([]*usecase.WebhookDelivery, error) {
+
+	if page > wr.config.Limits().MaxPage {
+		return nil, usecase.ValidationError("page exceeds the maximum allowed limit")
+	}
+
+	if pageSize > wr.config.Limits().MaxPageSize {
+		return nil, usecase.ValidationError("page size exceeds the maximum allowed limit")
+	}
+
+	// Calculate the OFFSET based on the page number and page size
+	offset := (page - 1) * pageSize
+
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_delivery
+		WHERE subscription_id = ?`
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY delivery_id DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+
+	rows, err := wr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying webhook deliveries", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*usecase.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows.Scan)
+		if err != nil {
+			slog.ErrorContext(ctx, "error scanning webhook delivery row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+
+	if len(deliveries) > 0 {
+		return deliveries, nil
+	}
+	return nil, usecase.NotFoundError("webhook deliveries not found")
+}
+
+func (wr *WebhookRepository) GetDeliveryByID(ctx context.Context, id int64) (*usecase.WebhookDelivery, error) {
+
+	delivery, err := scanDelivery(wr.db.QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_delivery
+		WHERE delivery_id = ?
+	`, id).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, usecase.NotFoundError("webhook delivery not found")
+		}
+		slog.ErrorContext(ctx, "error querying webhook delivery by ID", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+
+	// Attach the delivery log
+	rows, err := wr.db.QueryContext(ctx, `
+		SELECT attempt_id, status_code, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempt
+		WHERE delivery_id = ?
+		ORDER BY attempt_id
+	`, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error querying webhook delivery attempts", "error", err)
+		return nil, usecase.InternalError("database query error", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attempt usecase.WebhookDeliveryAttempt
+		var statusCode sql.NullInt64
+		var attemptError sql.NullString
+		var attemptedAt string
+
+		if err := rows.Scan(&attempt.AttemptID, &statusCode, &attemptError, &attempt.DurationMs, &attemptedAt); err != nil {
+			slog.ErrorContext(ctx, "error scanning webhook delivery attempt row", "error", err)
+			return nil, usecase.InternalError("database scan error", err)
+		}
+		attempt.StatusCode = int(statusCode.Int64)
+		attempt.Error = attemptError.String
+		if attempt.AttemptedAt, err = parseTimestamp(attemptedAt); err != nil {
+			return nil, err
+		}
+		delivery.AttemptLog = append(delivery.AttemptLog, &attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "error iterating rows", "error", err)
+		return nil, usecase.InternalError("database rows error", err)
+	}
+	return delivery, nil
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"chargeCode/internal/usecase"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func createSubscription(t *testing.T, repo *WebhookRepository, url string, active bool) *usecase.WebhookSubscription {
+	t.Helper()
+	subscription, err := repo.CreateSubscription(context.Background(), &usecase.WebhookSubscription{
+		URL:        url,
+		Secret:     "s3cret",
+		EventTypes: []string{usecase.EventTransactionCreated, usecase.EventUserCreated},
+		Active:     active,
+	})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	return subscription
+}
+
+// createDelivery adds a pending delivery of eventID due at nextAttemptAt.
+func createDelivery(t *testing.T, repo *WebhookRepository, subscriptionID int, eventID string, nextAttemptAt time.Time) *usecase.WebhookDelivery {
+	t.Helper()
+	delivery := &usecase.WebhookDelivery{
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		EventType:      usecase.EventTransactionCreated,
+		Payload:        []byte(`{"id":"` + eventID + `"}`),
+		Status:         usecase.WebhookDeliveryPending,
+		NextAttemptAt:  nextAttemptAt,
+	}
+	if err := repo.CreateDelivery(context.Background(), delivery); err != nil {
+		t.Fatalf("CreateDelivery: %v", err)
+	}
+	return delivery
+}
+
+func deliveryIDs(deliveries []*usecase.WebhookDelivery) []int64 {
+	ids := []int64{}
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.DeliveryID)
+	}
+	return ids
+}
+
+var webhookNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestWebhookRepositorySubscriptions(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewWebhookRepository(db, appConfig)
+	ctx := context.Background()
+
+	active := createSubscription(t, repo, "https://example.com/a", true)
+	createSubscription(t, repo, "https://example.com/b", true)
+
+	stored, err := repo.GetSubscriptionByID(ctx, active.SubscriptionID)
+	if err != nil {
+		t.Fatalf("GetSubscriptionByID: %v", err)
+	}
+	if stored.URL != active.URL || stored.Secret != "s3cret" || !stored.Active || !reflect.DeepEqual(stored.EventTypes, active.EventTypes) {
+		t.Errorf("GetSubscriptionByID = %+v, want %+v with its secret", stored, active)
+	}
+
+	// Listings leave the secret out
+	subscriptions, err := repo.GetSubscriptions(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("GetSubscriptions: %v", err)
+	}
+	if len(subscriptions) != 2 || subscriptions[0].Secret != "" {
+		t.Errorf("GetSubscriptions = %+v, want 2 subscriptions without secrets", subscriptions)
+	}
+
+	if err := repo.DeactivateSubscription(ctx, active.SubscriptionID); err != nil {
+		t.Fatalf("DeactivateSubscription: %v", err)
+	}
+	activeSubscriptions, err := repo.GetActiveSubscriptions(ctx)
+	if err != nil {
+		t.Fatalf("GetActiveSubscriptions: %v", err)
+	}
+	if len(activeSubscriptions) != 1 || activeSubscriptions[0].URL != "https://example.com/b" {
+		t.Errorf("GetActiveSubscriptions = %+v, want only the active subscription", activeSubscriptions)
+	}
+
+	if err := repo.DeactivateSubscription(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("DeactivateSubscription of a missing subscription: err = %v, want not found", err)
+	}
+	if _, err := repo.GetSubscriptionByID(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetSubscriptionByID of a missing subscription: err = %v, want not found", err)
+	}
+}
+
+func TestWebhookRepositoryCreateDeliveryIsIdempotent(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewWebhookRepository(db, appConfig)
+	subscription := createSubscription(t, repo, "https://example.com/a", true)
+
+	first := createDelivery(t, repo, subscription.SubscriptionID, "event-1", webhookNow)
+	// The outbox may publish an event again
+	again := createDelivery(t, repo, subscription.SubscriptionID, "event-1", webhookNow)
+	if again.DeliveryID != first.DeliveryID {
+		t.Errorf("delivery of a repeated event = %d, want the existing %d", again.DeliveryID, first.DeliveryID)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhook_delivery").Scan(&count); err != nil {
+		t.Fatalf("counting deliveries: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("%d deliveries, want 1", count)
+	}
+}
+
+func TestWebhookRepositoryClaimDueDeliveries(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewWebhookRepository(db, appConfig)
+	ctx := context.Background()
+	subscription := createSubscription(t, repo, "https://example.com/a", true)
+	const lease = 10 * time.Minute
+
+	later := createDelivery(t, repo, subscription.SubscriptionID, "event-1", webhookNow.Add(-time.Minute))
+	earlier := createDelivery(t, repo, subscription.SubscriptionID, "event-2", webhookNow.Add(-2*time.Minute))
+	future := createDelivery(t, repo, subscription.SubscriptionID, "event-3", webhookNow.Add(time.Minute))
+	succeeded := createDelivery(t, repo, subscription.SubscriptionID, "event-4", webhookNow.Add(-time.Hour))
+	succeeded.Status = usecase.WebhookDeliverySucceeded
+	if err := repo.UpdateDelivery(ctx, succeeded); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+
+	claim := func(now time.Time, limit int) []int64 {
+		t.Helper()
+		deliveries, err := repo.ClaimDueDeliveries(ctx, now, limit, lease)
+		if err != nil {
+			t.Fatalf("ClaimDueDeliveries: %v", err)
+		}
+		return deliveryIDs(deliveries)
+	}
+
+	// Due deliveries come oldest first, up to limit
+	if ids, want := claim(webhookNow, 1), []int64{earlier.DeliveryID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("claimed %v, want %v", ids, want)
+	}
+	if ids, want := claim(webhookNow, 10), []int64{later.DeliveryID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("claimed %v, want %v: claimed deliveries are leased", ids, want)
+	}
+	if ids := claim(webhookNow.Add(time.Minute), 10); !reflect.DeepEqual(ids, []int64{future.DeliveryID}) {
+		t.Errorf("claimed %v once the future delivery is due, want only it", ids)
+	}
+
+	// A lease that runs out, say because the instance stopped, frees the
+	// delivery for another attempt. Both leases end together, so they come in
+	// the order they were created.
+	if ids, want := claim(webhookNow.Add(lease), 10), []int64{later.DeliveryID, earlier.DeliveryID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("claimed %v after the lease, want %v", ids, want)
+	}
+
+	stored, err := repo.GetDeliveryByID(ctx, earlier.DeliveryID)
+	if err != nil {
+		t.Fatalf("GetDeliveryByID: %v", err)
+	}
+	if want := webhookNow.Add(2 * lease); !stored.NextAttemptAt.Equal(want) {
+		t.Errorf("next attempt = %s, want the end of the lease %s", stored.NextAttemptAt, want)
+	}
+}
+
+// TestWebhookRepositoryClaimSkipsLockedDeliveries claims deliveries while
+// another instance holds one of them, which relies on FOR UPDATE SKIP LOCKED.
+func TestWebhookRepositoryClaimSkipsLockedDeliveries(t *testing.T) {
+	db, appConfig := newServerTestDB(t, "row locks")
+	repo := NewWebhookRepository(db, appConfig)
+	ctx := context.Background()
+	subscription := createSubscription(t, repo, "https://example.com/a", true)
+
+	locked := createDelivery(t, repo, subscription.SubscriptionID, "event-1", webhookNow.Add(-2*time.Minute))
+	free := createDelivery(t, repo, subscription.SubscriptionID, "event-2", webhookNow.Add(-time.Minute))
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer tx.Rollback()
+	var lockedID int64
+	if err := tx.QueryRowContext(ctx, "SELECT delivery_id FROM webhook_delivery WHERE delivery_id = ? FOR UPDATE", locked.DeliveryID).Scan(&lockedID); err != nil {
+		t.Fatalf("locking a delivery: %v", err)
+	}
+
+	deliveries, err := repo.ClaimDueDeliveries(ctx, webhookNow, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimDueDeliveries: %v", err)
+	}
+	if ids, want := deliveryIDs(deliveries), []int64{free.DeliveryID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("claimed %v while a delivery is locked, want %v", ids, want)
+	}
+}
+
+func TestWebhookRepositoryDeliveryLog(t *testing.T) {
+	db, appConfig := newTestDB(t)
+	repo := NewWebhookRepository(db, appConfig)
+	ctx := context.Background()
+	subscription := createSubscription(t, repo, "https://example.com/a", true)
+	delivery := createDelivery(t, repo, subscription.SubscriptionID, "event-1", webhookNow)
+	createDelivery(t, repo, subscription.SubscriptionID, "event-2", webhookNow)
+
+	attempts := []*usecase.WebhookDeliveryAttempt{
+		{Error: "connection refused", DurationMs: 12},
+		{StatusCode: 503, Error: "receiver responded with status 503", DurationMs: 40},
+	}
+	for _, attempt := range attempts {
+		if err := repo.CreateDeliveryAttempt(ctx, delivery.DeliveryID, attempt); err != nil {
+			t.Fatalf("CreateDeliveryAttempt: %v", err)
+		}
+	}
+	delivery.Status = usecase.WebhookDeliveryDead
+	delivery.Attempts = 2
+	delivery.LastStatusCode = 503
+	delivery.LastError = "receiver responded with status 503"
+	if err := repo.UpdateDelivery(ctx, delivery); err != nil {
+		t.Fatalf("UpdateDelivery: %v", err)
+	}
+
+	stored, err := repo.GetDeliveryByID(ctx, delivery.DeliveryID)
+	if err != nil {
+		t.Fatalf("GetDeliveryByID: %v", err)
+	}
+	if stored.Status != usecase.WebhookDeliveryDead || stored.Attempts != 2 || stored.LastStatusCode != 503 || stored.LastError != delivery.LastError ||
+		!sameJSON(stored.Payload, delivery.Payload) {
+		t.Errorf("GetDeliveryByID = %+v, want the updated delivery", stored)
+	}
+	if len(stored.AttemptLog) != 2 {
+		t.Fatalf("attempt log = %+v, want 2 attempts", stored.AttemptLog)
+	}
+	for i, attempt := range stored.AttemptLog {
+		if attempt.StatusCode != attempts[i].StatusCode || attempt.Error != attempts[i].Error || attempt.DurationMs != attempts[i].DurationMs {
+			t.Errorf("attempt %d = %+v, want %+v", i, attempt, attempts[i])
+		}
+	}
+
+	dead, err := repo.GetDeliveries(ctx, subscription.SubscriptionID, usecase.WebhookDeliveryDead, 1, 10)
+	if err != nil {
+		t.Fatalf("GetDeliveries: %v", err)
+	}
+	if ids := deliveryIDs(dead); !reflect.DeepEqual(ids, []int64{delivery.DeliveryID}) {
+		t.Errorf("dead deliveries = %v, want %d", ids, delivery.DeliveryID)
+	}
+	if _, err := repo.GetDeliveries(ctx, subscription.SubscriptionID, usecase.WebhookDeliverySucceeded, 1, 10); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetDeliveries without a match: err = %v, want not found", err)
+	}
+	if _, err := repo.GetDeliveryByID(ctx, 99); !errors.Is(err, usecase.ErrNotFound) {
+		t.Errorf("GetDeliveryByID of a missing delivery: err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSanitizeStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM users WHERE phone_number = '09121234567'", "SELECT * FROM users WHERE phone_number = ?"},
+		{`SELECT * FROM users WHERE phone_number = "09121234567"`, "SELECT * FROM users WHERE phone_number = ?"},
+		// Escaped and doubled quotes stay inside the literal
+		{`UPDATE users SET name = 'O\'Brien' WHERE id = 7`, "UPDATE users SET name = ? WHERE id = ?"},
+		{"UPDATE users SET name = 'O''Brien' WHERE id = 7", "UPDATE users SET name = ? WHERE id = ?"},
+		{"UPDATE users\n\tSET balance = balance + 12.5\n\tWHERE user_id = ?", "UPDATE users SET balance = balance + ? WHERE user_id = ?"},
+		// Digits in names are not literals
+		{"SELECT sha256 FROM t1 LIMIT 10", "SELECT sha256 FROM t1 LIMIT ?"},
+	}
+	for _, test := range tests {
+		if sanitized := SanitizeStatement(test.query); sanitized != test.want {
+			t.Errorf("SanitizeStatement(%q) = %q, want %q", test.query, sanitized, test.want)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	for _, exporter := range []string{"", ExporterNone, ExporterStdout} {
+		shutdown, err := Setup(context.Background(), Config{Exporter: exporter, ServiceName: "test", SampleRatio: 1})
+		if err != nil {
+			t.Fatalf("Setup with the exporter %q: %v", exporter, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("shutting down the exporter %q: %v", exporter, err)
+		}
+	}
+
+	if _, err := Setup(context.Background(), Config{Exporter: "jaeger"}); err == nil {
+		t.Errorf("Setup with an unknown exporter succeeded")
+	}
+}
@@ -0,0 +1,130 @@
+// internal/usecase/audit_usecase.go
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionUserUpdate        = "user.update"
+	AuditActionChargeCodeCreate  = "charge_code.create"
+	AuditActionChargeCodeUpdate  = "charge_code.update"
+	AuditActionChargeCodePause   = "charge_code.pause"
+	AuditActionChargeCodeArchive = "charge_code.archive"
+	AuditActionChargeCodeRestore = "charge_code.restore"
+	AuditActionChargeCodeRedeem  = "charge_code.redeem"
+	AuditActionTransactionCreate = "transaction.create"
+	AuditActionTransactionAdjust = "transaction.adjust"
+	AuditActionTransactionImport = "transaction.import"
+	AuditActionUserLimitsUpdate  = "user.limits.update"
+	AuditActionUserLimitsDelete  = "user.limits.delete"
+	AuditActionFraudReview       = "fraud_decision.review"
+	AuditActionReconciliation    = "reconciliation.repair"
+	AuditActionWebhookCreate     = "webhook.create"
+	AuditActionWebhookDeactivate = "webhook.deactivate"
+	AuditActionWebhookRedeliver  = "webhook.redeliver"
+
+	AuditEntityUser          = "user"
+	AuditEntityChargeCode    = "charge_code"
+	AuditEntityTransaction   = "transaction"
+	AuditEntityFraudDecision = "fraud_decision"
+	AuditEntityWebhook       = "webhook_subscription"
+	AuditEntityDelivery      = "webhook_delivery"
+)
+
+// Actor identifies who performed a mutating operation and the request it
+// came from.
+type Actor struct {
+	Name string
+	// Verified is set when Name was vouched for by a trusted party rather than
+	// merely claimed by the caller
+	Verified  bool
+	RequestID string
+	ClientIP  string
+}
+
+type AuditLog struct {
+	AuditID       int             `json:"audit_id"`
+	Actor         string          `json:"actor"`
+	ActorVerified bool            `json:"actor_verified"`
+	Action        string          `json:"action"`
+	EntityType    string          `json:"entity_type"`
+	EntityID      int             `json:"entity_id"`
+	Before        json.RawMessage `json:"before" swaggertype:"object"`
+	After         json.RawMessage `json:"after" swaggertype:"object"`
+	RequestID     string          `json:"request_id"`
+	ClientIP      string          `json:"client_ip"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// AuditLogFilter narrows GetAuditLogs. Zero values are ignored.
+type AuditLogFilter struct {
+	Actor      string
+	Action     string
+	EntityType string
+	EntityID   int
+	RequestID  string
+	From       time.Time
+	To         time.Time
+}
+
+// AuditRepository is append-only: entries can be written and queried but
+// never changed.
+type AuditRepository interface {
+	CreateAuditLog(ctx context.Context, auditLog *AuditLog) error
+	GetAuditLogs(ctx context.Context, filter *AuditLogFilter, page int, pageSize int) ([]*AuditLog, error)
+}
+
+// newAuditLog snapshots before and after as JSON. A nil snapshot is stored
+// as NULL, e.g. there is no after for a delete.
+func newAuditLog(actor *Actor, action string, entityType string, entityID int, before interface{}, after interface{}) (*AuditLog, error) {
+	auditLog := &AuditLog{
+		Actor:         actor.Name,
+		ActorVerified: actor.Verified,
+		Action:        action,
+		EntityType:    entityType,
+		EntityID:      entityID,
+		RequestID:     actor.RequestID,
+		ClientIP:      actor.ClientIP,
+	}
+
+	var err error
+	if before != nil {
+		if auditLog.Before, err = json.Marshal(before); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if auditLog.After, err = json.Marshal(after); err != nil {
+			return nil, err
+		}
+	}
+	return auditLog, nil
+}
+
+// writeAuditLog records an audit entry with the repositories of the current
+// transaction.
+func writeAuditLog(ctx context.Context, repos *Repositories, actor *Actor, action string, entityType string, entityID int, before interface{}, after interface{}) error {
+	auditLog, err := newAuditLog(actor, action, entityType, entityID, before, after)
+	if err != nil {
+		return err
+	}
+	return repos.Audit.CreateAuditLog(ctx, auditLog)
+}
+
+type AuditUseCase struct {
+	AuditRepository AuditRepository
+}
+
+func NewAuditUseCase(auditRepo AuditRepository) *AuditUseCase {
+	return &AuditUseCase{AuditRepository: auditRepo}
+}
+
+func (au *AuditUseCase) GetAuditLogs(ctx context.Context, filter *AuditLogFilter, page int, pageSize int) (_ []*AuditLog, err error) {
+	ctx, span := startSpan(ctx, "AuditUseCase.GetAuditLogs")
+	defer endSpan(span, &err)
+
+	return au.AuditRepository.GetAuditLogs(ctx, filter, page, pageSize)
+}
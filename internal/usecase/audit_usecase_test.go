@@ -0,0 +1,52 @@
+package usecase
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// snapshot returns the JSON an audit log stores for v, nil for NULL.
+func snapshot(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshalling %v: %v", v, err)
+	}
+	return data
+}
+
+func TestNewAuditLog(t *testing.T) {
+	actor := &Actor{Name: "ops", Verified: true, RequestID: "req-1", ClientIP: "10.0.0.1"}
+	chargeCode := &ChargeCode{ChargeCodeID: 7, Code: "c216", MaxUses: 100, Amount: 50}
+
+	tests := []struct {
+		name   string
+		action string
+		before interface{}
+		after  interface{}
+	}{
+		{"create", AuditActionChargeCodeCreate, nil, chargeCode},
+		{"update", AuditActionChargeCodeUpdate, chargeCode, &ChargeCode{ChargeCodeID: 7, Code: "c217", MaxUses: 100, Amount: 50}},
+		{"archive", AuditActionChargeCodeArchive, chargeCode, &ChargeCode{ChargeCodeID: 7, Code: "c216", MaxUses: 100, Amount: 50, Status: ChargeCodeArchived}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auditLog, err := newAuditLog(actor, test.action, AuditEntityChargeCode, 7, test.before, test.after)
+			if err != nil {
+				t.Fatalf("newAuditLog: %v", err)
+			}
+			if auditLog.Actor != "ops" || !auditLog.ActorVerified || auditLog.RequestID != "req-1" || auditLog.ClientIP != "10.0.0.1" ||
+				auditLog.Action != test.action || auditLog.EntityType != AuditEntityChargeCode || auditLog.EntityID != 7 {
+				t.Errorf("audit log = %+v, want the %s of charge code 7 by the verified ops", auditLog, test.action)
+			}
+			before, after := snapshot(t, test.before), snapshot(t, test.after)
+			if string(auditLog.Before) != string(before) || string(auditLog.After) != string(after) ||
+				(auditLog.Before == nil) != (before == nil) || (auditLog.After == nil) != (after == nil) {
+				t.Errorf("before = %s, after %s, want %s and %s", auditLog.Before, auditLog.After, before, after)
+			}
+		})
+	}
+}
@@ -1,57 +1,281 @@
 // internal/usecase/charge_code_usecase
 package usecase
 
+import (
+	"context"
+	"fmt"
+)
+
 type ChargeCode struct {
 	ChargeCodeID int     `json:"charge_code_id"`
 	Code         string  `json:"code" binding:"required"`
 	MaxUses      int     `json:"max_uses" binding:"required"`
 	CurrentUses  int     `json:"current_uses"`
 	Amount       float64 `json:"amount" binding:"required"`
+	// Version is incremented by every change to the charge code, including
+	// redemptions. An update has to name the version it was based on.
+	Version int `json:"version"`
+	// Status is set by CreateChargeCode and changed by the lifecycle
+	// methods, never by an update
+	Status string `json:"status"`
+}
+
+// Statuses of a charge code. Only active codes can be redeemed. Archiving
+// replaces deleting, so that redemptions keep pointing at their code.
+const (
+	ChargeCodeActive   = "active"
+	ChargeCodePaused   = "paused"
+	ChargeCodeArchived = "archived"
+)
+
+var ChargeCodeStatuses = []string{ChargeCodeActive, ChargeCodePaused, ChargeCodeArchived}
+
+// ChargeCodePatch is a partial update of a charge code. Nil fields are left
+// unchanged; the current uses are only changed by redemptions.
+type ChargeCodePatch struct {
+	Code    *string
+	MaxUses *int
+	Amount  *float64
 }
 
 type ChargeCodeRepository interface {
-	CreateChargeCode(chargeCode *ChargeCode) (*ChargeCode, error)
-	GetChargeCodes(page int, pageSize int) ([]*ChargeCode, error)
-	GetChargeCodeByCode(code string) (*ChargeCode, error)
-	GetChargeCodeByID(id int) (*ChargeCode, error)
-	DeleteChargeCode(id int) error
-	UpdateChargeCode(chargeCode *ChargeCode) (*ChargeCode, error)
-	GetUserChargeCodes(userId int, page int, pageSize int) ([]*ChargeCode, error)
+	CreateChargeCode(ctx context.Context, chargeCode *ChargeCode) (*ChargeCode, error)
+	GetChargeCodes(ctx context.Context, statuses []string, page int, pageSize int) ([]*ChargeCode, error)
+	GetChargeCodeByCode(ctx context.Context, code string) (*ChargeCode, error)
+	GetChargeCodeByID(ctx context.Context, id int) (*ChargeCode, error)
+	SetChargeCodeStatus(ctx context.Context, id int, status string) (*ChargeCode, error)
+	UpdateChargeCode(ctx context.Context, chargeCode *ChargeCode) (*ChargeCode, error)
+	PatchChargeCode(ctx context.Context, id int, version int, patch *ChargeCodePatch) (*ChargeCode, error)
+	GetUserChargeCodes(ctx context.Context, userId int, statuses []string, page int, pageSize int) ([]*ChargeCode, error)
 }
 
 type ChargeCodeUseCase struct {
 	ChargeCodeRepository ChargeCodeRepository
+	Transactor           Transactor
 }
 
-func NewChargeCodeUseCase(chargeCodeRepo ChargeCodeRepository) *ChargeCodeUseCase {
-	return &ChargeCodeUseCase{ChargeCodeRepository: chargeCodeRepo}
+func NewChargeCodeUseCase(chargeCodeRepo ChargeCodeRepository, transactor Transactor) *ChargeCodeUseCase {
+	return &ChargeCodeUseCase{ChargeCodeRepository: chargeCodeRepo, Transactor: transactor}
 }
 
-func (cu *ChargeCodeUseCase) GetChargeCodes(page int, pageSize int) ([]*ChargeCode, error) {
-	return cu.ChargeCodeRepository.GetChargeCodes(page, pageSize)
+// GetChargeCodes lists the charge codes with one of statuses, by default the
+// ones that are not archived.
+func (cu *ChargeCodeUseCase) GetChargeCodes(ctx context.Context, statuses []string, page int, pageSize int) (_ []*ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.GetChargeCodes")
+	defer endSpan(span, &err)
+
+	if len(statuses) == 0 {
+		statuses = []string{ChargeCodeActive, ChargeCodePaused}
+	}
+	if err := validateChargeCodeStatuses(statuses); err != nil {
+		return nil, err
+	}
+	return cu.ChargeCodeRepository.GetChargeCodes(ctx, statuses, page, pageSize)
 }
 
-func (cu *ChargeCodeUseCase) GetChargeCodeByCode(code string) (*ChargeCode, error) {
-	return cu.ChargeCodeRepository.GetChargeCodeByCode(code)
+func (cu *ChargeCodeUseCase) GetChargeCodeByCode(ctx context.Context, code string) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.GetChargeCodeByCode")
+	defer endSpan(span, &err)
+
+	return cu.ChargeCodeRepository.GetChargeCodeByCode(ctx, code)
 
 }
 
-func (cu *ChargeCodeUseCase) GetChargeCodeByID(id int) (*ChargeCode, error) {
-	return cu.ChargeCodeRepository.GetChargeCodeByID(id)
+func (cu *ChargeCodeUseCase) GetChargeCodeByID(ctx context.Context, id int) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.GetChargeCodeByID")
+	defer endSpan(span, &err)
+
+	return cu.ChargeCodeRepository.GetChargeCodeByID(ctx, id)
 }
 
-func (uc *ChargeCodeUseCase) CreateChargeCode(chargeCode *ChargeCode) (*ChargeCode, error) {
-	return uc.ChargeCodeRepository.CreateChargeCode(chargeCode)
+func (uc *ChargeCodeUseCase) CreateChargeCode(ctx context.Context, chargeCode *ChargeCode, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.CreateChargeCode")
+	defer endSpan(span, &err)
+
+	var created *ChargeCode
+	err = uc.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		var err error
+		chargeCode.Status = ChargeCodeActive
+		created, err = repos.ChargeCodes.CreateChargeCode(ctx, chargeCode)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionChargeCodeCreate, AuditEntityChargeCode, created.ChargeCodeID, nil, created)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// PauseChargeCode stops redemptions of an active charge code until it is
+// restored.
+func (cu *ChargeCodeUseCase) PauseChargeCode(ctx context.Context, id int, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.PauseChargeCode")
+	defer endSpan(span, &err)
+
+	return cu.setStatus(ctx, id, ChargeCodePaused, []string{ChargeCodeActive}, AuditActionChargeCodePause, actor)
 }
 
-func (cu *ChargeCodeUseCase) DeleteChargeCode(id int) error {
-	return cu.ChargeCodeRepository.DeleteChargeCode(id)
+// ArchiveChargeCode retires a charge code. It is kept with its redemptions
+// but no longer listed by default, redeemed or changed.
+func (cu *ChargeCodeUseCase) ArchiveChargeCode(ctx context.Context, id int, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.ArchiveChargeCode")
+	defer endSpan(span, &err)
+
+	return cu.setStatus(ctx, id, ChargeCodeArchived, []string{ChargeCodeActive, ChargeCodePaused}, AuditActionChargeCodeArchive, actor)
+}
+
+// RestoreChargeCode makes a paused or archived charge code active again.
+func (cu *ChargeCodeUseCase) RestoreChargeCode(ctx context.Context, id int, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.RestoreChargeCode")
+	defer endSpan(span, &err)
+
+	return cu.setStatus(ctx, id, ChargeCodeActive, []string{ChargeCodePaused, ChargeCodeArchived}, AuditActionChargeCodeRestore, actor)
 }
 
-func (cu *ChargeCodeUseCase) UpdateChargeCode(chargeCode *ChargeCode) (*ChargeCode, error) {
-	return cu.ChargeCodeRepository.UpdateChargeCode(chargeCode)
+// setStatus moves a charge code from one of the statuses in from to status.
+// A charge code that already has status is returned unchanged.
+func (cu *ChargeCodeUseCase) setStatus(ctx context.Context, id int, status string, from []string, action string, actor *Actor) (*ChargeCode, error) {
+	var changed *ChargeCode
+	err := cu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.ChargeCodes.GetChargeCodeByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.Status == status {
+			changed = before
+			return nil
+		}
+		if !containsString(from, before.Status) {
+			return ConflictError(fmt.Sprintf("a %s charge code cannot become %s", before.Status, status))
+		}
+
+		changed, err = repos.ChargeCodes.SetChargeCodeStatus(ctx, id, status)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, action, AuditEntityChargeCode, id, before, changed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (cu *ChargeCodeUseCase) UpdateChargeCode(ctx context.Context, chargeCode *ChargeCode, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.UpdateChargeCode")
+	defer endSpan(span, &err)
+
+	var updated *ChargeCode
+	err = cu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.ChargeCodes.GetChargeCodeByID(ctx, chargeCode.ChargeCodeID)
+		if err != nil {
+			return err
+		}
+		if before.Version != chargeCode.Version {
+			return ErrVersionMismatch
+		}
+		if before.Status == ChargeCodeArchived {
+			return ErrChargeCodeArchived
+		}
+		if chargeCode.MaxUses != before.MaxUses && chargeCode.MaxUses < before.CurrentUses {
+			return ValidationError(fmt.Sprintf("max_uses most not be less than current_uses (%d)", before.CurrentUses))
+		}
+		// Redemptions alone change the current uses
+		chargeCode.Status = before.Status
+		chargeCode.CurrentUses = before.CurrentUses
+
+		updated, err = repos.ChargeCodes.UpdateChargeCode(ctx, chargeCode)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionChargeCodeUpdate, AuditEntityChargeCode, chargeCode.ChargeCodeID, before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// PatchChargeCode changes the fields set in patch of the charge code at
+// version. Only the fields that differ from the current ones are written;
+// when none does, nothing is written and the version stays the same.
+func (cu *ChargeCodeUseCase) PatchChargeCode(ctx context.Context, id int, version int, patch *ChargeCodePatch, actor *Actor) (_ *ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.PatchChargeCode")
+	defer endSpan(span, &err)
+
+	var patched *ChargeCode
+	err = cu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.ChargeCodes.GetChargeCodeByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.Version != version {
+			return ErrVersionMismatch
+		}
+		if before.Status == ChargeCodeArchived {
+			return ErrChargeCodeArchived
+		}
+
+		changes := &ChargeCodePatch{}
+		if patch.Code != nil && *patch.Code != before.Code {
+			if *patch.Code == "" {
+				return ValidationError("code most not be empty")
+			}
+			changes.Code = patch.Code
+		}
+		if patch.MaxUses != nil && *patch.MaxUses != before.MaxUses {
+			if *patch.MaxUses < before.CurrentUses {
+				return ValidationError(fmt.Sprintf("max_uses most not be less than current_uses (%d)", before.CurrentUses))
+			}
+			changes.MaxUses = patch.MaxUses
+		}
+		if patch.Amount != nil && *patch.Amount != before.Amount {
+			if *patch.Amount <= 0 {
+				return ValidationError("amount most be bigger than zero")
+			}
+			changes.Amount = patch.Amount
+		}
+		if changes.Code == nil && changes.MaxUses == nil && changes.Amount == nil {
+			patched = before
+			return nil
+		}
+
+		patched, err = repos.ChargeCodes.PatchChargeCode(ctx, id, version, changes)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionChargeCodeUpdate, AuditEntityChargeCode, id, before, patched)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// GetUserChargeCodes lists the charge codes a user redeemed with one of
+// statuses, by default all of them, since it is the redemption history of
+// the user.
+func (cu *ChargeCodeUseCase) GetUserChargeCodes(ctx context.Context, userId int, statuses []string, page int, pageSize int) (_ []*ChargeCode, err error) {
+	ctx, span := startSpan(ctx, "ChargeCodeUseCase.GetUserChargeCodes")
+	defer endSpan(span, &err)
+
+	if err := validateChargeCodeStatuses(statuses); err != nil {
+		return nil, err
+	}
+	return cu.ChargeCodeRepository.GetUserChargeCodes(ctx, userId, statuses, page, pageSize)
 }
 
-func (cu *ChargeCodeUseCase) GetUserChargeCodes(userId int, page int, pageSize int) ([]*ChargeCode, error) {
-	return cu.ChargeCodeRepository.GetUserChargeCodes(userId, page, pageSize)
+func validateChargeCodeStatuses(statuses []string) error {
+	for _, status := range statuses {
+		if !containsString(ChargeCodeStatuses, status) {
+			return ValidationError(fmt.Sprintf("unknown charge code status %q", status))
+		}
+	}
+	return nil
 }
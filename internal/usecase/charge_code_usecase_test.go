@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func newTestChargeCodes() (*ChargeCodeUseCase, *memoryStore) {
+	store := newMemoryStore()
+	// 12 of the 100 uses are redeemed
+	store.addChargeCode("c216", 100, 12, 50)
+	return NewChargeCodeUseCase(nil, store), store
+}
+
+func TestUpdateChargeCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		chargeCode ChargeCode
+		archived   bool
+		err        error
+		message    string
+	}{
+		{"update", ChargeCode{Code: "c217", MaxUses: 200, Amount: 60, Version: 1}, false, nil, ""},
+		{"max uses at the current uses", ChargeCode{Code: "c216", MaxUses: 12, Amount: 50, Version: 1}, false, nil, ""},
+		{"max uses below the current uses", ChargeCode{Code: "c216", MaxUses: 11, Amount: 50, Version: 1}, false,
+			ErrValidation, "max_uses most not be less than current_uses (12)"},
+		{"stale version", ChargeCode{Code: "c217", MaxUses: 200, Amount: 60, Version: 2}, false, ErrVersionMismatch, ErrVersionMismatch.Message},
+		{"archived", ChargeCode{Code: "c217", MaxUses: 200, Amount: 60, Version: 1}, true, ErrChargeCodeArchived, ErrChargeCodeArchived.Message},
+		{"missing", ChargeCode{ChargeCodeID: 2, Code: "c217", MaxUses: 200, Amount: 60, Version: 1}, false, ErrNotFound, "charge code not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store := newTestChargeCodes()
+			if test.archived {
+				store.data.chargeCodes[1].Status = ChargeCodeArchived
+			}
+			if test.chargeCode.ChargeCodeID == 0 {
+				test.chargeCode.ChargeCodeID = 1
+			}
+			// The body cannot change the uses or the status
+			test.chargeCode.CurrentUses, test.chargeCode.Status = 0, ChargeCodePaused
+
+			updated, err := uc.UpdateChargeCode(context.Background(), &test.chargeCode, &Actor{Name: "ops"})
+			stored := store.data.chargeCodes[1]
+			if test.err != nil {
+				if !errors.Is(err, test.err) || err.Error() != test.message {
+					t.Fatalf("UpdateChargeCode: err = %v, want %q", err, test.message)
+				}
+				if stored.Version != 1 || stored.MaxUses != 100 || len(store.data.auditLogs) != 0 {
+					t.Errorf("charge code = %+v with %d audit logs, want it unchanged", stored, len(store.data.auditLogs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateChargeCode: %v", err)
+			}
+
+			want := ChargeCode{ChargeCodeID: 1, Code: test.chargeCode.Code, MaxUses: test.chargeCode.MaxUses, CurrentUses: 12, Amount: test.chargeCode.Amount,
+				Version: 2, Status: ChargeCodeActive}
+			if *updated != want || *stored != want {
+				t.Errorf("updated = %+v, stored %+v, want %+v", updated, stored, want)
+			}
+			if len(store.data.auditLogs) != 1 || store.data.auditLogs[0].Action != AuditActionChargeCodeUpdate || store.data.auditLogs[0].Actor != "ops" {
+				t.Errorf("audit logs = %+v, want the update by ops", store.data.auditLogs)
+			}
+		})
+	}
+}
+
+// A charge code whose max uses were lowered below its uses before the check
+// existed can still be updated without raising them.
+func TestUpdateChargeCodeKeepsMaxUsesBelowCurrentUses(t *testing.T) {
+	uc, store := newTestChargeCodes()
+	store.data.chargeCodes[1].MaxUses = 10
+
+	chargeCode := &ChargeCode{ChargeCodeID: 1, Code: "c216", MaxUses: 10, Amount: 70, Version: 1}
+	if _, err := uc.UpdateChargeCode(context.Background(), chargeCode, &Actor{}); err != nil {
+		t.Fatalf("UpdateChargeCode: %v", err)
+	}
+	if stored := store.data.chargeCodes[1]; stored.Amount != 70 || stored.MaxUses != 10 {
+		t.Errorf("charge code = %+v, want the amount changed", stored)
+	}
+}
+
+func stringRef(s string) *string {
+	return &s
+}
+
+func intRef(i int) *int {
+	return &i
+}
+
+func TestPatchChargeCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   ChargeCodePatch
+		version int
+		status  string
+		err     error
+		message string
+		// want is the stored code, max uses and amount, and the version
+		want ChargeCode
+	}{
+		{"code", ChargeCodePatch{Code: stringRef("c217")}, 1, ChargeCodeActive, nil, "",
+			ChargeCode{Code: "c217", MaxUses: 100, Amount: 50, Version: 2}},
+		{"every field", ChargeCodePatch{Code: stringRef("c217"), MaxUses: intRef(200), Amount: floatRef(60)}, 1, ChargeCodeActive, nil, "",
+			ChargeCode{Code: "c217", MaxUses: 200, Amount: 60, Version: 2}},
+		{"max uses at the current uses", ChargeCodePatch{MaxUses: intRef(12)}, 1, ChargeCodeActive, nil, "",
+			ChargeCode{Code: "c216", MaxUses: 12, Amount: 50, Version: 2}},
+		{"paused", ChargeCodePatch{Amount: floatRef(60)}, 1, ChargeCodePaused, nil, "",
+			ChargeCode{Code: "c216", MaxUses: 100, Amount: 60, Version: 2}},
+		// Nothing changes, so nothing is written
+		{"same values", ChargeCodePatch{Code: stringRef("c216"), MaxUses: intRef(100), Amount: floatRef(50)}, 1, ChargeCodeActive, nil, "",
+			ChargeCode{Code: "c216", MaxUses: 100, Amount: 50, Version: 1}},
+		{"empty patch", ChargeCodePatch{}, 1, ChargeCodeActive, nil, "",
+			ChargeCode{Code: "c216", MaxUses: 100, Amount: 50, Version: 1}},
+
+		{"empty code", ChargeCodePatch{Code: stringRef("")}, 1, ChargeCodeActive, ErrValidation, "code most not be empty", ChargeCode{}},
+		{"max uses below the current uses", ChargeCodePatch{MaxUses: intRef(11)}, 1, ChargeCodeActive, ErrValidation,
+			"max_uses most not be less than current_uses (12)", ChargeCode{}},
+		{"zero amount", ChargeCodePatch{Amount: floatRef(0)}, 1, ChargeCodeActive, ErrValidation, "amount most be bigger than zero", ChargeCode{}},
+		// One invalid field fails the whole patch
+		{"valid and invalid fields", ChargeCodePatch{Code: stringRef("c217"), Amount: floatRef(-1)}, 1, ChargeCodeActive, ErrValidation,
+			"amount most be bigger than zero", ChargeCode{}},
+		{"stale version", ChargeCodePatch{Amount: floatRef(60)}, 2, ChargeCodeActive, ErrVersionMismatch, ErrVersionMismatch.Message, ChargeCode{}},
+		// The version is checked before anything is compared
+		{"stale version of an empty patch", ChargeCodePatch{}, 2, ChargeCodeActive, ErrVersionMismatch, ErrVersionMismatch.Message, ChargeCode{}},
+		{"archived", ChargeCodePatch{Amount: floatRef(60)}, 1, ChargeCodeArchived, ErrChargeCodeArchived, ErrChargeCodeArchived.Message, ChargeCode{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store := newTestChargeCodes()
+			store.data.chargeCodes[1].Status = test.status
+
+			patched, err := uc.PatchChargeCode(context.Background(), 1, test.version, &test.patch, &Actor{Name: "ops"})
+			stored := store.data.chargeCodes[1]
+			if test.err != nil {
+				if !errors.Is(err, test.err) || err.Error() != test.message {
+					t.Fatalf("PatchChargeCode: err = %v, want %q", err, test.message)
+				}
+				if stored.Version != 1 || len(store.data.auditLogs) != 0 {
+					t.Errorf("charge code = %+v with %d audit logs, want it unchanged", stored, len(store.data.auditLogs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PatchChargeCode: %v", err)
+			}
+
+			want := ChargeCode{ChargeCodeID: 1, Code: test.want.Code, MaxUses: test.want.MaxUses, CurrentUses: 12, Amount: test.want.Amount,
+				Version: test.want.Version, Status: test.status}
+			if *patched != want || *stored != want {
+				t.Errorf("patched = %+v, stored %+v, want %+v", patched, stored, want)
+			}
+			// Only a change is audited
+			if audited := len(store.data.auditLogs) == 1; audited != (test.want.Version == 2) {
+				t.Errorf("%d audit logs, want one for a change", len(store.data.auditLogs))
+			}
+		})
+	}
+}
+
+// Pausing and restoring change the status alone, so restoring a paused
+// charge code gives back every use it had.
+func TestChargeCodeLifecycleKeepsUses(t *testing.T) {
+	uc, store := newTestChargeCodes()
+	ctx := context.Background()
+
+	steps := []struct {
+		name   string
+		change func(ctx context.Context, id int, actor *Actor) (*ChargeCode, error)
+		status string
+		err    error
+	}{
+		{"pause", uc.PauseChargeCode, ChargeCodePaused, nil},
+		{"pause again", uc.PauseChargeCode, ChargeCodePaused, nil},
+		{"restore", uc.RestoreChargeCode, ChargeCodeActive, nil},
+		{"archive", uc.ArchiveChargeCode, ChargeCodeArchived, nil},
+		{"pause an archived charge code", uc.PauseChargeCode, ChargeCodeArchived, ErrConflict},
+		{"restore", uc.RestoreChargeCode, ChargeCodeActive, nil},
+	}
+	for _, step := range steps {
+		changed, err := step.change(ctx, 1, &Actor{})
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.err)
+		}
+		stored := store.data.chargeCodes[1]
+		if stored.Status != step.status || stored.MaxUses != 100 || stored.CurrentUses != 12 {
+			t.Fatalf("%s: charge code = %+v, want %s with 12 of 100 uses", step.name, stored, step.status)
+		}
+		if err == nil && *changed != *stored {
+			t.Errorf("%s: returned %+v, want the stored %+v", step.name, changed, stored)
+		}
+	}
+	// Pausing a paused charge code wrote nothing
+	if len(store.data.auditLogs) != 4 || store.data.chargeCodes[1].Version != 5 {
+		t.Errorf("%d audit logs and version %d, want 4 changes", len(store.data.auditLogs), store.data.chargeCodes[1].Version)
+	}
+}
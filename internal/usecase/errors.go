@@ -0,0 +1,85 @@
+// internal/usecase/errors.go
+package usecase
+
+import "errors"
+
+// Error kinds. Every error returned by a repository or usecase matches one of
+// them with errors.Is, and the delivery layer picks the response status from
+// the kind.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrValidation         = errors.New("validation failed")
+	ErrInsufficientFunds  = errors.New("transaction failed. insufficient funds")
+	ErrLimitExceeded      = errors.New("limit exceeded")
+	ErrForbidden          = errors.New("forbidden")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrInternal           = errors.New("internal error")
+)
+
+// Errors returned by repositories that callers need to tell apart.
+var (
+	ErrInvalidPhoneNumber        = &Error{Kind: ErrValidation, Code: "invalid_phone_number", Message: "phone number is incorrect Most Like 09121114323"}
+	ErrPhoneNumberRegistered     = &Error{Kind: ErrConflict, Code: "phone_number_registered", Message: "user with the same phone number already exists"}
+	ErrChargeCodeAlreadyRedeemed = &Error{Kind: ErrConflict, Code: "charge_code_already_redeemed", Message: "user has already redeemed this charge_code"}
+	ErrChargeCodeUnavailable     = &Error{Kind: ErrConflict, Code: "charge_code_unavailable", Message: "charge code is not available"}
+	ErrChargeCodeInactive        = &Error{Kind: ErrConflict, Code: "charge_code_inactive", Message: "charge code is paused or archived"}
+	ErrChargeCodeArchived        = &Error{Kind: ErrConflict, Code: "charge_code_archived", Message: "an archived charge code cannot be changed, restore it first"}
+	ErrVersionMismatch           = &Error{Kind: ErrPreconditionFailed, Code: "version_mismatch", Message: "the resource was changed since it was read, reload it and try again"}
+)
+
+// Error codes of the error kinds. Clients can rely on them not changing.
+const (
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeValidationFailed  = "validation_failed"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeLimitExceeded     = "limit_exceeded"
+
+	CodeTransactionLimitExceeded = "transaction_limit_exceeded"
+	CodeInternal                 = "internal_error"
+)
+
+// Error is an error of a known kind. Code is a stable machine-readable
+// identifier and Message is safe to return to clients; Err is the underlying
+// cause, which is only logged.
+type Error struct {
+	Kind    error
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap makes both the kind and the cause match with errors.Is and errors.As.
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func NotFoundError(message string) error {
+	return &Error{Kind: ErrNotFound, Code: CodeNotFound, Message: message}
+}
+
+func ConflictError(message string) error {
+	return &Error{Kind: ErrConflict, Code: CodeConflict, Message: message}
+}
+
+func ValidationError(message string) error {
+	return &Error{Kind: ErrValidation, Code: CodeValidationFailed, Message: message}
+}
+
+func LimitExceededError(message string) error {
+	return &Error{Kind: ErrLimitExceeded, Code: CodeLimitExceeded, Message: message}
+}
+
+// InternalError reports a failure the client cannot fix, such as a failed
+// query. message is returned to the client and cause is kept for logging.
+func InternalError(message string, cause error) error {
+	return &Error{Kind: ErrInternal, Code: CodeInternal, Message: message, Err: cause}
+}
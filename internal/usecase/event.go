@@ -0,0 +1,83 @@
+// internal/usecase/event.go
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventTransactionCreated  = "transaction.created"
+	EventChargeCodeRedeemed  = "charge_code.redeemed"
+	EventChargeCodeExhausted = "charge_code.exhausted"
+	EventUserCreated         = "user.created"
+)
+
+// EventTypes lists every event type that can be published.
+var EventTypes = []string{
+	EventTransactionCreated,
+	EventChargeCodeRedeemed,
+	EventChargeCodeExhausted,
+	EventUserCreated,
+}
+
+// Event is a domain event. It is written to the outbox in the transaction of
+// the change it describes and published by the OutboxRelay. Events with the
+// same Key, e.g. "user:09121234567", are published in the order they were written.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Key        string          `json:"key,omitempty"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// ChargeCodeRedemption is the data of charge_code.redeemed and
+// charge_code.exhausted events.
+type ChargeCodeRedemption struct {
+	ChargeCodeID int     `json:"charge_code_id"`
+	Code         string  `json:"code"`
+	UserID       int     `json:"user_id"`
+	PhoneNumber  string  `json:"phoneNumber"`
+	Amount       float64 `json:"amount"`
+	CurrentUses  int     `json:"current_uses"`
+	MaxUses      int     `json:"max_uses"`
+}
+
+// EventPublisher delivers events to interested parties.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+func isEventType(eventType string) bool {
+	for _, known := range EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// randomID returns a random hex identifier of n bytes.
+func randomID(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func NewEvent(eventType string, data interface{}) (*Event, error) {
+	id, err := randomID(16)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{ID: id, Type: eventType, OccurredAt: time.Now().UTC(), Data: payload}, nil
+}
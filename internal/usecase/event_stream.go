@@ -0,0 +1,226 @@
+// internal/usecase/event_stream.go
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+type EventStreamConfig struct {
+	// BufferSize is the number of recent events kept for clients that
+	// resume after a reconnect
+	BufferSize int
+	// ClientBufferSize is the number of events queued for a client before
+	// it is disconnected as too slow
+	ClientBufferSize int
+	MaxClients       int
+}
+
+// StreamEvent is an event with its position in the stream. Clients resume
+// after the Seq of the last event they received.
+type StreamEvent struct {
+	Seq   uint64
+	Event *Event
+
+	// Fields of the event data used by filters
+	phoneNumber  string
+	chargeCodeID int
+}
+
+// EventFilter selects the events of a subscription. Empty fields match every
+// event.
+type EventFilter struct {
+	Types        []string
+	PhoneNumber  string
+	ChargeCodeID int
+}
+
+func (f *EventFilter) matches(event *StreamEvent) bool {
+	if len(f.Types) > 0 && !containsString(f.Types, event.Event.Type) {
+		return false
+	}
+	if f.PhoneNumber != "" && event.phoneNumber != f.PhoneNumber {
+		return false
+	}
+	if f.ChargeCodeID != 0 && event.chargeCodeID != f.ChargeCodeID {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// EventSubscription receives the events of a filter. Replay holds the
+// buffered events after the requested position; Events receives the events
+// published afterwards and is closed when the subscription ends.
+type EventSubscription struct {
+	Replay []*StreamEvent
+	// Gap reports that some events after the requested position were no
+	// longer buffered, so the client has to reload its state
+	Gap    bool
+	Events <-chan *StreamEvent
+
+	filter EventFilter
+	events chan *StreamEvent
+	// slow is set when the subscription was ended because its client did
+	// not keep up
+	slow bool
+}
+
+// EventStream fans the published events out to live subscribers, such as
+// Server-Sent Events clients. It is an EventPublisher fed by the outbox
+// relay, so it only sees the events relayed by this instance, and the relay
+// runs on one instance at a time: the stream is for single-instance
+// deployments. Publishing never blocks: a subscriber whose queue is full is disconnected and can
+// resume from the buffer.
+type EventStream struct {
+	config EventStreamConfig
+
+	mu            sync.Mutex
+	seq           uint64
+	buffer        []*StreamEvent
+	ids           map[string]bool
+	subscriptions map[*EventSubscription]bool
+	closed        bool
+}
+
+func NewEventStream(config EventStreamConfig) *EventStream {
+	return &EventStream{
+		config:        config,
+		ids:           map[string]bool{},
+		subscriptions: map[*EventSubscription]bool{},
+	}
+}
+
+// Publish adds event to the stream. The relay delivers at least once, so an
+// event that is still buffered is not published again.
+func (es *EventStream) Publish(ctx context.Context, event *Event) error {
+	// The data of every event type names these fields alike, up to case
+	var data struct {
+		PhoneNumber  string `json:"phoneNumber"`
+		ChargeCodeID int    `json:"charge_code_id"`
+	}
+	_ = json.Unmarshal(event.Data, &data)
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.closed || es.ids[event.ID] {
+		return nil
+	}
+
+	es.seq++
+	streamEvent := &StreamEvent{Seq: es.seq, Event: event, phoneNumber: data.PhoneNumber, chargeCodeID: data.ChargeCodeID}
+	if len(es.buffer) == es.config.BufferSize && len(es.buffer) > 0 {
+		delete(es.ids, es.buffer[0].Event.ID)
+		es.buffer = es.buffer[1:]
+	}
+	if es.config.BufferSize > 0 {
+		es.buffer = append(es.buffer, streamEvent)
+		es.ids[event.ID] = true
+	}
+
+	for subscription := range es.subscriptions {
+		if !subscription.filter.matches(streamEvent) {
+			continue
+		}
+		select {
+		case subscription.events <- streamEvent:
+		default:
+			subscription.slow = true
+			es.remove(subscription)
+		}
+	}
+	return nil
+}
+
+// Subscribe starts a subscription to the events matching filter. With
+// resume set, the buffered events after lastSeq are replayed.
+func (es *EventStream) Subscribe(filter EventFilter, lastSeq uint64, resume bool) (*EventSubscription, error) {
+	for _, eventType := range filter.Types {
+		if !isEventType(eventType) {
+			return nil, ValidationError(fmt.Sprintf("unknown event type %q", eventType))
+		}
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if es.config.MaxClients > 0 && len(es.subscriptions) >= es.config.MaxClients {
+		return nil, LimitExceededError("too many event stream clients, try again later")
+	}
+
+	events := make(chan *StreamEvent, es.config.ClientBufferSize)
+	subscription := &EventSubscription{Events: events, filter: filter, events: events}
+	if es.closed {
+		close(events)
+		return subscription, nil
+	}
+
+	if resume {
+		// The sequence restarts with the process, so a position ahead of
+		// it was given out by an earlier run
+		if lastSeq > es.seq {
+			lastSeq = 0
+			subscription.Gap = true
+		}
+		oldest := es.seq + 1
+		if len(es.buffer) > 0 {
+			oldest = es.buffer[0].Seq
+		}
+		if lastSeq+1 < oldest {
+			subscription.Gap = true
+		}
+		for _, event := range es.buffer {
+			if event.Seq > lastSeq && filter.matches(event) {
+				subscription.Replay = append(subscription.Replay, event)
+			}
+		}
+	}
+
+	es.subscriptions[subscription] = true
+	return subscription, nil
+}
+
+// Unsubscribe ends a subscription. It may be called more than once.
+func (es *EventStream) Unsubscribe(subscription *EventSubscription) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.remove(subscription)
+}
+
+// Slow reports whether the subscription was ended because its client did
+// not keep up. It is only meaningful once Events has been closed.
+func (es *EventStream) Slow(subscription *EventSubscription) bool {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return subscription.slow
+}
+
+// Close ends every subscription, so that a graceful shutdown does not wait
+// for streaming clients.
+func (es *EventStream) Close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	es.closed = true
+	for subscription := range es.subscriptions {
+		es.remove(subscription)
+	}
+}
+
+func (es *EventStream) remove(subscription *EventSubscription) {
+	if es.subscriptions[subscription] {
+		delete(es.subscriptions, subscription)
+		close(subscription.events)
+	}
+}
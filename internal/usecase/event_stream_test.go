@@ -0,0 +1,240 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// publish publishes an event of eventType for phoneNumber with the id n to
+// stream.
+func publish(t *testing.T, stream *EventStream, n int, eventType string, phoneNumber string) {
+	t.Helper()
+	event := &Event{ID: fmt.Sprintf("event-%d", n), Type: eventType, Data: []byte(`{"phoneNumber":"` + phoneNumber + `","charge_code_id":7}`)}
+	if err := stream.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func seqs(events []*StreamEvent) []uint64 {
+	result := []uint64{}
+	for _, event := range events {
+		result = append(result, event.Seq)
+	}
+	return result
+}
+
+// received returns the events queued for subscription.
+func received(subscription *EventSubscription) []*StreamEvent {
+	events := []*StreamEvent{}
+	for {
+		select {
+		case event, ok := <-subscription.Events:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestEventStreamResume(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{BufferSize: 3, ClientBufferSize: 10})
+	for n := 1; n <= 5; n++ {
+		publish(t, stream, n, EventTransactionCreated, "09120000001")
+	}
+
+	tests := []struct {
+		name    string
+		lastSeq uint64
+		resume  bool
+		replay  []uint64
+		gap     bool
+	}{
+		{"new client", 0, false, []uint64{}, false},
+		{"caught up", 5, true, []uint64{}, false},
+		{"within the buffer", 3, true, []uint64{4, 5}, false},
+		{"just before the buffer", 2, true, []uint64{3, 4, 5}, false},
+		// Events 1 and 2 were overwritten
+		{"behind the buffer", 0, true, []uint64{3, 4, 5}, true},
+		{"one event overrun", 1, true, []uint64{3, 4, 5}, true},
+		// A position of an earlier run of the process
+		{"ahead of the stream", 9, true, []uint64{3, 4, 5}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subscription, err := stream.Subscribe(EventFilter{}, test.lastSeq, test.resume)
+			if err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			defer stream.Unsubscribe(subscription)
+			if replay := seqs(subscription.Replay); !reflect.DeepEqual(replay, test.replay) || subscription.Gap != test.gap {
+				t.Errorf("replay = %v with gap %v, want %v with gap %v", replay, subscription.Gap, test.replay, test.gap)
+			}
+		})
+	}
+}
+
+func TestEventStreamResumeWithoutBuffer(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{ClientBufferSize: 10})
+	publish(t, stream, 1, EventTransactionCreated, "09120000001")
+
+	subscription, err := stream.Subscribe(EventFilter{}, 0, true)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if len(subscription.Replay) != 0 || !subscription.Gap {
+		t.Errorf("replay = %v with gap %v, want a gap", seqs(subscription.Replay), subscription.Gap)
+	}
+	if subscription, _ := stream.Subscribe(EventFilter{}, 1, true); subscription.Gap {
+		t.Errorf("a client that saw the last event has a gap")
+	}
+}
+
+func TestEventStreamFilters(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{BufferSize: 10, ClientBufferSize: 10})
+	publish(t, stream, 1, EventTransactionCreated, "09120000001")
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		seqs   []uint64
+	}{
+		{"every event", EventFilter{}, []uint64{1, 2, 3, 4}},
+		{"types", EventFilter{Types: []string{EventChargeCodeRedeemed, EventUserCreated}}, []uint64{3, 4}},
+		{"phone number", EventFilter{PhoneNumber: "09120000001"}, []uint64{1, 3}},
+		{"charge code", EventFilter{ChargeCodeID: 7}, []uint64{1, 2, 3, 4}},
+		{"other charge code", EventFilter{ChargeCodeID: 8}, []uint64{}},
+		{"all fields", EventFilter{Types: []string{EventTransactionCreated}, PhoneNumber: "09120000002"}, []uint64{2}},
+	}
+	subscriptions := map[string]*EventSubscription{}
+	for _, test := range tests {
+		subscription, err := stream.Subscribe(test.filter, 0, true)
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		subscriptions[test.name] = subscription
+	}
+	publish(t, stream, 2, EventTransactionCreated, "09120000002")
+	publish(t, stream, 3, EventChargeCodeRedeemed, "09120000001")
+	publish(t, stream, 4, EventUserCreated, "09120000003")
+
+	for _, test := range tests {
+		subscription := subscriptions[test.name]
+		// The filter applies to the replay and to the live events alike
+		if got := append(seqs(subscription.Replay), seqs(received(subscription))...); !reflect.DeepEqual(got, test.seqs) {
+			t.Errorf("%s: events %v, want %v", test.name, got, test.seqs)
+		}
+	}
+
+	if _, err := stream.Subscribe(EventFilter{Types: []string{"transaction.deleted"}}, 0, false); !errors.Is(err, ErrValidation) {
+		t.Errorf("Subscribe to an unknown type: err = %v, want a validation error", err)
+	}
+}
+
+func TestEventStreamSkipsRedeliveredEvents(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{BufferSize: 2, ClientBufferSize: 10})
+	subscription, _ := stream.Subscribe(EventFilter{}, 0, false)
+
+	publish(t, stream, 1, EventUserCreated, "09120000001")
+	publish(t, stream, 1, EventUserCreated, "09120000001")
+	publish(t, stream, 2, EventUserCreated, "09120000001")
+	publish(t, stream, 3, EventUserCreated, "09120000001")
+	// Event 1 left the buffer, so it can no longer be told apart
+	publish(t, stream, 1, EventUserCreated, "09120000001")
+
+	if got := seqs(received(subscription)); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+		t.Errorf("events %v, want every event once while buffered", got)
+	}
+}
+
+func TestEventStreamDropsSlowClients(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{BufferSize: 10, ClientBufferSize: 2})
+	slow, _ := stream.Subscribe(EventFilter{}, 0, false)
+	fast, _ := stream.Subscribe(EventFilter{}, 0, false)
+	// A client of other events keeps up, since it is sent nothing
+	other, _ := stream.Subscribe(EventFilter{Types: []string{EventUserCreated}}, 0, false)
+
+	for n := 1; n <= 3; n++ {
+		publish(t, stream, n, EventTransactionCreated, "09120000001")
+		if n < 3 {
+			<-fast.Events
+		}
+	}
+
+	if got := seqs(received(slow)); !reflect.DeepEqual(got, []uint64{1, 2}) {
+		t.Errorf("slow client got %v, want the events that fit in its queue", got)
+	}
+	if _, ok := <-slow.Events; ok || !stream.Slow(slow) {
+		t.Errorf("slow client still subscribed, want it dropped as slow")
+	}
+	if event := <-fast.Events; event.Seq != 3 || stream.Slow(fast) {
+		t.Errorf("fast client got %d, want 3 without being dropped", event.Seq)
+	}
+	if stream.Slow(other) {
+		t.Errorf("client of other events dropped")
+	}
+
+	// The dropped client resumes from the buffer without a gap
+	resumed, err := stream.Subscribe(EventFilter{}, 2, true)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if replay := seqs(resumed.Replay); !reflect.DeepEqual(replay, []uint64{3}) || resumed.Gap {
+		t.Errorf("replay = %v with gap %v, want 3 without a gap", replay, resumed.Gap)
+	}
+
+	// Ending the dropped subscription again is harmless
+	stream.Unsubscribe(slow)
+}
+
+func TestEventStreamMaxClients(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{ClientBufferSize: 1, MaxClients: 2})
+	first, _ := stream.Subscribe(EventFilter{}, 0, false)
+	if _, err := stream.Subscribe(EventFilter{}, 0, false); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	if _, err := stream.Subscribe(EventFilter{}, 0, false); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Subscribe over the limit: err = %v, want limit exceeded", err)
+	}
+
+	// Leaving, also by being dropped, frees a place
+	stream.Unsubscribe(first)
+	slow, err := stream.Subscribe(EventFilter{}, 0, false)
+	if err != nil {
+		t.Fatalf("Subscribe after a client left: %v", err)
+	}
+	publish(t, stream, 1, EventUserCreated, "09120000001")
+	publish(t, stream, 2, EventUserCreated, "09120000001")
+	if !stream.Slow(slow) {
+		t.Fatalf("the client was not dropped")
+	}
+	if _, err := stream.Subscribe(EventFilter{}, 0, false); err != nil {
+		t.Errorf("Subscribe after a client was dropped: %v", err)
+	}
+}
+
+func TestEventStreamClose(t *testing.T) {
+	stream := NewEventStream(EventStreamConfig{BufferSize: 10, ClientBufferSize: 10})
+	subscription, _ := stream.Subscribe(EventFilter{}, 0, false)
+
+	stream.Close()
+	if _, ok := <-subscription.Events; ok || stream.Slow(subscription) {
+		t.Errorf("subscription still open after Close, or ended as slow")
+	}
+
+	// Clients connecting during the shutdown end at once
+	publish(t, stream, 1, EventUserCreated, "09120000001")
+	late, err := stream.Subscribe(EventFilter{}, 0, true)
+	if err != nil {
+		t.Fatalf("Subscribe after Close: %v", err)
+	}
+	if _, ok := <-late.Events; ok || len(late.Replay) != 0 {
+		t.Errorf("subscription after Close is open or replays events")
+	}
+}
@@ -0,0 +1,268 @@
+// internal/usecase/fraud_engine.go
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Actions of fraud rules and decisions, from the mildest to the strictest.
+const (
+	FraudActionAllow  = "allow"
+	FraudActionReview = "review"
+	FraudActionDeny   = "deny"
+)
+
+// Kinds of the operations checked for fraud.
+const (
+	FraudKindTransaction = "transaction"
+	FraudKindRedemption  = "redemption"
+)
+
+// Review states of a fraud decision. Decisions that were not allowed start
+// out pending.
+const (
+	FraudReviewNone     = "none"
+	FraudReviewPending  = "pending"
+	FraudReviewApproved = "approved"
+	FraudReviewRejected = "rejected"
+)
+
+var fraudActionSeverity = map[string]int{
+	FraudActionAllow:  0,
+	FraudActionReview: 1,
+	FraudActionDeny:   2,
+}
+
+// ErrTransactionDenied is returned when the fraud rules deny a transaction or
+// redemption. It does not say which rule matched.
+var ErrTransactionDenied = &Error{Kind: ErrForbidden, Code: "transaction_denied", Message: "the operation was denied by the fraud checks"}
+
+// FraudCheck is the operation the fraud rules look at. It has already been
+// written in the current database transaction.
+type FraudCheck struct {
+	Kind         string
+	UserID       int
+	PhoneNumber  string
+	Amount       float64
+	ChargeCodeID int
+	ClientIP     string
+	Now          time.Time
+}
+
+// FraudRuleResult is the verdict of one rule.
+type FraudRuleResult struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// FraudRule is one check of the fraud engine. Rules must be safe for
+// concurrent use.
+type FraudRule interface {
+	Name() string
+	// Evaluate returns nil when the rule does not match check.
+	Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error)
+}
+
+// FraudHistory is the history the rules can look at. It reads inside the
+// database transaction of the checked operation, so the operation itself is
+// included.
+type FraudHistory interface {
+	CountUserTransactions(ctx context.Context, userID int, since time.Time) (int, error)
+	// GetUserFirstTransactionAt returns the zero time when the user has no
+	// transactions.
+	GetUserFirstTransactionAt(ctx context.Context, userID int) (time.Time, error)
+	SumUserCredits(ctx context.Context, userID int, since time.Time) (float64, error)
+	// CountPhoneNumbersByIP counts the phone numbers other than phoneNumber
+	// with a decision of kind from clientIP since the given time.
+	CountPhoneNumbersByIP(ctx context.Context, clientIP string, kind string, phoneNumber string, since time.Time) (int, error)
+}
+
+// FraudDecision is the outcome of the fraud rules for one operation. EntityID
+// is the created transaction or redeemed charge code, zero when the operation
+// was denied.
+type FraudDecision struct {
+	DecisionID   int                `json:"decision_id"`
+	Kind         string             `json:"kind"`
+	EntityID     int                `json:"entity_id,omitempty"`
+	UserID       int                `json:"user_id"`
+	PhoneNumber  string             `json:"phone_number"`
+	ClientIP     string             `json:"client_ip"`
+	ChargeCodeID int                `json:"charge_code_id,omitempty"`
+	Amount       float64            `json:"amount"`
+	Action       string             `json:"action"`
+	Score        int                `json:"score"`
+	Results      []*FraudRuleResult `json:"results"`
+	ReviewStatus string             `json:"review_status"`
+	ReviewedBy   string             `json:"reviewed_by,omitempty"`
+	ReviewNote   string             `json:"review_note,omitempty"`
+	ReviewedAt   *time.Time         `json:"reviewed_at,omitempty"`
+	RequestID    string             `json:"request_id,omitempty"`
+	CreatedAt    time.Time          `json:"created_at"`
+}
+
+// FraudDecisionFilter narrows down a decision search. Empty fields match
+// every decision.
+type FraudDecisionFilter struct {
+	Action       string
+	ReviewStatus string
+}
+
+// FraudReview is a reviewer's verdict on a decision.
+type FraudReview struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected" example:"approved"`
+	Note   string `json:"note"`
+}
+
+type FraudRepository interface {
+	FraudHistory
+	CreateDecision(ctx context.Context, decision *FraudDecision) error
+	GetDecisions(ctx context.Context, filter *FraudDecisionFilter, page int, pageSize int) ([]*FraudDecision, error)
+	GetDecisionByID(ctx context.Context, id int) (*FraudDecision, error)
+	// ReviewDecision records review on a pending decision. It returns a
+	// conflict error when the decision is not pending.
+	ReviewDecision(ctx context.Context, id int, review *FraudReview, reviewer string, at time.Time) error
+}
+
+// FraudConfig escalates a decision by the total score of its rules, on top of
+// the strictest action any rule returned. A zero score disables the
+// escalation.
+type FraudConfig struct {
+	ReviewScore int
+	DenyScore   int
+}
+
+// FraudEngine runs the fraud rules on transactions and redemptions before they
+// are committed and records every decision for review.
+type FraudEngine struct {
+	Rules      []FraudRule
+	Repository FraudRepository
+	Transactor Transactor
+	Config     FraudConfig
+	Metrics    BusinessMetrics
+	now        func() time.Time
+}
+
+func NewFraudEngine(rules []FraudRule, fraudRepo FraudRepository, transactor Transactor, config FraudConfig, metrics BusinessMetrics) *FraudEngine {
+	return &FraudEngine{Rules: rules, Repository: fraudRepo, Transactor: transactor, Config: config, Metrics: metrics, now: time.Now}
+}
+
+// Evaluate runs every rule on check and combines their results. The caller
+// rejects the operation when the action is deny and records the decision
+// with Record once the database transaction has ended.
+func (fe *FraudEngine) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck, actor *Actor) (*FraudDecision, error) {
+	check.Now = fe.now()
+	decision := &FraudDecision{
+		Kind:         check.Kind,
+		UserID:       check.UserID,
+		PhoneNumber:  check.PhoneNumber,
+		ClientIP:     check.ClientIP,
+		ChargeCodeID: check.ChargeCodeID,
+		Amount:       check.Amount,
+		Action:       FraudActionAllow,
+		Results:      []*FraudRuleResult{},
+		RequestID:    actor.RequestID,
+		CreatedAt:    check.Now,
+	}
+
+	for _, rule := range fe.Rules {
+		result, err := rule.Evaluate(ctx, history, check)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			continue
+		}
+		result.Rule = rule.Name()
+		decision.Results = append(decision.Results, result)
+		decision.Score += result.Score
+		decision.Action = stricterFraudAction(decision.Action, result.Action)
+	}
+
+	if fe.Config.DenyScore > 0 && decision.Score >= fe.Config.DenyScore {
+		decision.Action = FraudActionDeny
+	} else if fe.Config.ReviewScore > 0 && decision.Score >= fe.Config.ReviewScore {
+		decision.Action = stricterFraudAction(decision.Action, FraudActionReview)
+	}
+
+	decision.ReviewStatus = FraudReviewNone
+	if decision.Action != FraudActionAllow {
+		decision.ReviewStatus = FraudReviewPending
+	}
+	return decision, nil
+}
+
+// Record persists decision outside of the database transaction of the
+// operation, so denied operations are kept even though they are rolled back.
+// A failure is only logged: the operation has already been decided.
+func (fe *FraudEngine) Record(ctx context.Context, decision *FraudDecision) {
+	fe.Metrics.FraudDecision(decision.Kind, decision.Action)
+
+	if err := fe.Repository.CreateDecision(ctx, decision); err != nil {
+		slog.ErrorContext(ctx, "error recording fraud decision", "error", err, "kind", decision.Kind, "action", decision.Action)
+	}
+}
+
+// recordOutcome records decision unless the operation failed for a reason
+// other than the decision itself.
+func (fe *FraudEngine) recordOutcome(ctx context.Context, decision *FraudDecision, err error) {
+	if decision == nil || (err != nil && !errors.Is(err, ErrTransactionDenied)) {
+		return
+	}
+	fe.Record(context.WithoutCancel(ctx), decision)
+}
+
+func stricterFraudAction(a string, b string) string {
+	if fraudActionSeverity[b] > fraudActionSeverity[a] {
+		return b
+	}
+	return a
+}
+
+func (fe *FraudEngine) GetDecisions(ctx context.Context, filter *FraudDecisionFilter, page int, pageSize int) (_ []*FraudDecision, err error) {
+	ctx, span := startSpan(ctx, "FraudEngine.GetDecisions")
+	defer endSpan(span, &err)
+
+	return fe.Repository.GetDecisions(ctx, filter, page, pageSize)
+}
+
+func (fe *FraudEngine) GetDecisionByID(ctx context.Context, id int) (_ *FraudDecision, err error) {
+	ctx, span := startSpan(ctx, "FraudEngine.GetDecisionByID")
+	defer endSpan(span, &err)
+
+	return fe.Repository.GetDecisionByID(ctx, id)
+}
+
+// ReviewDecision approves or rejects a pending decision. It only records the
+// verdict; a rejected transaction has to be reversed separately.
+func (fe *FraudEngine) ReviewDecision(ctx context.Context, id int, review *FraudReview, actor *Actor) (_ *FraudDecision, err error) {
+	ctx, span := startSpan(ctx, "FraudEngine.ReviewDecision")
+	defer endSpan(span, &err)
+
+	var reviewed *FraudDecision
+	err = fe.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.Fraud.GetDecisionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Fraud.ReviewDecision(ctx, id, review, actor.Name, fe.now()); err != nil {
+			return err
+		}
+
+		reviewed, err = repos.Fraud.GetDecisionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionFraudReview, AuditEntityFraudDecision, id, before, reviewed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reviewed, nil
+}
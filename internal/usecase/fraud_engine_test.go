@@ -0,0 +1,300 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeFraudRepository returns a fixed history and keeps the decisions it
+// records. It stands for the connection pool, outside any transaction.
+type fakeFraudRepository struct {
+	FraudRepository
+	transactions   int
+	firstAt        time.Time
+	credits        float64
+	phoneNumbers   int
+	decisions      []*FraudDecision
+	historyErr     error
+	lastSince      time.Time
+	lastKind       string
+	lastExcludedTo string
+}
+
+func (r *fakeFraudRepository) CountUserTransactions(ctx context.Context, userID int, since time.Time) (int, error) {
+	r.lastSince = since
+	return r.transactions, r.historyErr
+}
+
+func (r *fakeFraudRepository) GetUserFirstTransactionAt(ctx context.Context, userID int) (time.Time, error) {
+	return r.firstAt, r.historyErr
+}
+
+func (r *fakeFraudRepository) SumUserCredits(ctx context.Context, userID int, since time.Time) (float64, error) {
+	r.lastSince = since
+	return r.credits, r.historyErr
+}
+
+func (r *fakeFraudRepository) CountPhoneNumbersByIP(ctx context.Context, clientIP string, kind string, phoneNumber string, since time.Time) (int, error) {
+	r.lastSince, r.lastKind, r.lastExcludedTo = since, kind, phoneNumber
+	return r.phoneNumbers, r.historyErr
+}
+
+func (r *fakeFraudRepository) CreateDecision(ctx context.Context, decision *FraudDecision) error {
+	decision.DecisionID = len(r.decisions) + 1
+	r.decisions = append(r.decisions, decision)
+	return nil
+}
+
+var fraudNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var (
+	reviewRule = FraudRuleAction{Action: FraudActionReview, Score: 30}
+	denyRule   = FraudRuleAction{Action: FraudActionDeny, Score: 100}
+)
+
+func TestFraudRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    FraudRule
+		history fakeFraudRepository
+		check   FraudCheck
+		matches bool
+	}{
+		{"velocity at the limit", &VelocityRule{MaxTransactions: 5, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{transactions: 5}, FraudCheck{}, false},
+		{"velocity over the limit", &VelocityRule{MaxTransactions: 5, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{transactions: 6}, FraudCheck{}, true},
+		{"velocity disabled", &VelocityRule{Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{transactions: 100}, FraudCheck{}, false},
+
+		{"amount below the threshold", &AmountRule{Threshold: 1000, FraudRuleAction: reviewRule},
+			fakeFraudRepository{}, FraudCheck{Amount: -999.99}, false},
+		{"debit at the threshold", &AmountRule{Threshold: 1000, FraudRuleAction: reviewRule},
+			fakeFraudRepository{}, FraudCheck{Amount: -1000}, true},
+		{"credit at the threshold", &AmountRule{Threshold: 1000, FraudRuleAction: reviewRule},
+			fakeFraudRepository{}, FraudCheck{Amount: 1000}, true},
+
+		{"debit from a new account", &NewAccountRule{MaxAge: 24 * time.Hour, MinDebit: 100, FraudRuleAction: reviewRule},
+			fakeFraudRepository{firstAt: fraudNow.Add(-time.Hour)}, FraudCheck{Amount: -100}, true},
+		{"small debit from a new account", &NewAccountRule{MaxAge: 24 * time.Hour, MinDebit: 100, FraudRuleAction: reviewRule},
+			fakeFraudRepository{firstAt: fraudNow.Add(-time.Hour)}, FraudCheck{Amount: -99}, false},
+		{"credit to a new account", &NewAccountRule{MaxAge: 24 * time.Hour, MinDebit: 100, FraudRuleAction: reviewRule},
+			fakeFraudRepository{firstAt: fraudNow.Add(-time.Hour)}, FraudCheck{Amount: 500}, false},
+		{"debit from an old account", &NewAccountRule{MaxAge: 24 * time.Hour, MinDebit: 100, FraudRuleAction: reviewRule},
+			fakeFraudRepository{firstAt: fraudNow.Add(-24 * time.Hour)}, FraudCheck{Amount: -100}, false},
+		{"debit from an account without transactions", &NewAccountRule{MaxAge: 24 * time.Hour, MinDebit: 100, FraudRuleAction: reviewRule},
+			fakeFraudRepository{}, FraudCheck{Amount: -100}, false},
+
+		{"phone numbers of an IP at the limit", &IPFanOutRule{MaxPhoneNumbers: 3, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{phoneNumbers: 2}, FraudCheck{ClientIP: "10.0.0.1"}, false},
+		{"phone numbers of an IP over the limit", &IPFanOutRule{MaxPhoneNumbers: 3, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{phoneNumbers: 3}, FraudCheck{ClientIP: "10.0.0.1"}, true},
+		{"no client IP", &IPFanOutRule{MaxPhoneNumbers: 3, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{phoneNumbers: 10}, FraudCheck{}, false},
+
+		{"debit draining credits", &CreditDrainRule{Ratio: 0.9, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{credits: 100}, FraudCheck{Amount: -90}, true},
+		{"debit below the ratio", &CreditDrainRule{Ratio: 0.9, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{credits: 100}, FraudCheck{Amount: -89}, false},
+		{"debit without credits", &CreditDrainRule{Ratio: 0.9, Window: time.Hour, FraudRuleAction: reviewRule},
+			fakeFraudRepository{}, FraudCheck{Amount: -90}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.check.Now = fraudNow
+			result, err := test.rule.Evaluate(context.Background(), &test.history, &test.check)
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+			if matches := result != nil; matches != test.matches {
+				t.Fatalf("Evaluate = %+v, want a match %v", result, test.matches)
+			}
+			if result != nil && (result.Action != reviewRule.Action || result.Score != reviewRule.Score || result.Reason == "") {
+				t.Errorf("Evaluate = %+v, want the action and score of the rule with a reason", result)
+			}
+		})
+	}
+}
+
+func TestFraudRulesLookBackOverTheirWindow(t *testing.T) {
+	history := &fakeFraudRepository{}
+	check := &FraudCheck{Kind: FraudKindRedemption, PhoneNumber: "09120000001", ClientIP: "10.0.0.1", Amount: -10, Now: fraudNow}
+	rules := []FraudRule{
+		&VelocityRule{MaxTransactions: 1, Window: time.Hour},
+		&IPFanOutRule{MaxPhoneNumbers: 1, Window: time.Hour},
+		&CreditDrainRule{Ratio: 1, Window: time.Hour},
+	}
+	for _, rule := range rules {
+		history.lastSince = time.Time{}
+		if _, err := rule.Evaluate(context.Background(), history, check); err != nil {
+			t.Fatalf("%s: %v", rule.Name(), err)
+		}
+		if !history.lastSince.Equal(fraudNow.Add(-time.Hour)) {
+			t.Errorf("%s looks back to %s, want one window", rule.Name(), history.lastSince)
+		}
+	}
+	// The fan out counts the other phone numbers with the same kind
+	if history.lastKind != FraudKindRedemption || history.lastExcludedTo != check.PhoneNumber {
+		t.Errorf("CountPhoneNumbersByIP got kind %s without %s, want %s without %s", history.lastKind, history.lastExcludedTo, FraudKindRedemption, check.PhoneNumber)
+	}
+}
+
+// fixedRule always returns its result.
+type fixedRule struct {
+	name   string
+	result *FraudRuleResult
+}
+
+func (r *fixedRule) Name() string {
+	return r.name
+}
+
+func (r *fixedRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.result == nil {
+		return nil, nil
+	}
+	result := *r.result
+	return &result, nil
+}
+
+func newTestFraudEngine(rules []FraudRule, config FraudConfig) *FraudEngine {
+	engine := NewFraudEngine(rules, &fakeFraudRepository{}, nil, config, NopBusinessMetrics{})
+	engine.now = func() time.Time { return fraudNow }
+	return engine
+}
+
+func TestFraudEngineEvaluate(t *testing.T) {
+	allow := &fixedRule{"allow", &FraudRuleResult{Action: FraudActionAllow, Score: 20}}
+	review := &fixedRule{"review", &FraudRuleResult{Action: FraudActionReview, Score: 30}}
+	deny := &fixedRule{"deny", &FraudRuleResult{Action: FraudActionDeny, Score: 10}}
+	none := &fixedRule{"none", nil}
+
+	tests := []struct {
+		name    string
+		rules   []FraudRule
+		config  FraudConfig
+		action  string
+		score   int
+		matched []string
+	}{
+		{"no rule matches", []FraudRule{none}, FraudConfig{ReviewScore: 1, DenyScore: 2}, FraudActionAllow, 0, []string{}},
+		{"strictest action", []FraudRule{allow, review, deny, none}, FraudConfig{}, FraudActionDeny, 60, []string{"allow", "review", "deny"}},
+		{"review without escalation", []FraudRule{allow, review}, FraudConfig{}, FraudActionReview, 50, []string{"allow", "review"}},
+		{"below the review score", []FraudRule{allow}, FraudConfig{ReviewScore: 21, DenyScore: 100}, FraudActionAllow, 20, []string{"allow"}},
+		{"escalated to review", []FraudRule{allow, allow}, FraudConfig{ReviewScore: 40, DenyScore: 100}, FraudActionReview, 40, []string{"allow", "allow"}},
+		{"escalated to deny", []FraudRule{allow, review}, FraudConfig{ReviewScore: 40, DenyScore: 50}, FraudActionDeny, 50, []string{"allow", "review"}},
+		{"review score never lowers", []FraudRule{deny}, FraudConfig{ReviewScore: 5}, FraudActionDeny, 10, []string{"deny"}},
+		{"zero scores disable escalation", []FraudRule{allow, allow, allow}, FraudConfig{}, FraudActionAllow, 60, []string{"allow", "allow", "allow"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := newTestFraudEngine(test.rules, test.config)
+			check := &FraudCheck{Kind: FraudKindTransaction, UserID: 1, PhoneNumber: "09120000001", Amount: -50, ClientIP: "10.0.0.1"}
+			decision, err := engine.Evaluate(context.Background(), &fakeFraudRepository{}, check, &Actor{RequestID: "request-1"})
+			if err != nil {
+				t.Fatalf("Evaluate: %v", err)
+			}
+
+			if decision.Action != test.action || decision.Score != test.score {
+				t.Errorf("decision = %s with %d, want %s with %d", decision.Action, decision.Score, test.action, test.score)
+			}
+			names := []string{}
+			for _, result := range decision.Results {
+				names = append(names, result.Rule)
+			}
+			if !reflect.DeepEqual(names, test.matched) {
+				t.Errorf("results of %v, want %v", names, test.matched)
+			}
+			reviewStatus := FraudReviewPending
+			if test.action == FraudActionAllow {
+				reviewStatus = FraudReviewNone
+			}
+			if decision.ReviewStatus != reviewStatus {
+				t.Errorf("review status = %s, want %s", decision.ReviewStatus, reviewStatus)
+			}
+			if decision.RequestID != "request-1" || decision.ClientIP != check.ClientIP || !decision.CreatedAt.Equal(fraudNow) || !check.Now.Equal(fraudNow) {
+				t.Errorf("decision = %+v, want the request, client IP and time of the check", decision)
+			}
+		})
+	}
+}
+
+func TestFraudEngineEvaluateFails(t *testing.T) {
+	failed := errors.New("history unavailable")
+	engine := newTestFraudEngine([]FraudRule{&VelocityRule{MaxTransactions: 1, Window: time.Hour}}, FraudConfig{})
+	_, err := engine.Evaluate(context.Background(), &fakeFraudRepository{historyErr: failed}, &FraudCheck{}, &Actor{})
+	if !errors.Is(err, failed) {
+		t.Errorf("Evaluate: err = %v, want %v", err, failed)
+	}
+}
+
+// newTestFraudTransactions returns a usecase whose fraud rules return rule
+// for every transaction, and the fraud repository of the connection pool its
+// decisions have to go to. The store's fraud repository stands for the
+// transaction, which the decisions must stay out of.
+func newTestFraudTransactions(rule FraudRuleAction) (*TransactionUseCase, *memoryStore, *fakeFraudRepository) {
+	store := newMemoryStore()
+	store.addUser("09120000001", 100)
+	store.fraud = &fakeFraudRepository{}
+	fraudRepo := &fakeFraudRepository{}
+
+	engine := NewFraudEngine([]FraudRule{&AmountRule{Threshold: 1, FraudRuleAction: rule}}, fraudRepo, store, FraudConfig{}, NopBusinessMetrics{})
+	limiter := NewTransactionLimiter(store, func() TransactionLimits { return TransactionLimits{} })
+	return NewTransactionUseCase(nil, store, nil, limiter, engine, NopBusinessMetrics{}), store, fraudRepo
+}
+
+func TestCreateTransactionRecordsFraudDecisions(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      FraudRuleAction
+		commitErr error
+		err       error
+		committed bool
+		recorded  string
+	}{
+		{"allowed", FraudRuleAction{Action: FraudActionAllow}, nil, nil, true, FraudActionAllow},
+		{"held for review", reviewRule, nil, nil, true, FraudActionReview},
+		// The denied transaction is rolled back, its decision is kept
+		{"denied", denyRule, nil, ErrTransactionDenied, false, FraudActionDeny},
+		// A transaction that failed for another reason was never decided
+		{"commit failed", reviewRule, ErrInternal, ErrInternal, false, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store, fraudRepo := newTestFraudTransactions(test.rule)
+			store.commitErr = test.commitErr
+
+			created, err := uc.CreateTransaction(context.Background(), &Transaction{PhoneNumber: "09120000001", Amount: -10}, &Actor{ClientIP: "10.0.0.1"})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("CreateTransaction: err = %v, want %v", err, test.err)
+			}
+			if committed := len(store.data.transactions) == 1 && len(store.data.auditLogs) == 1; committed != test.committed {
+				t.Errorf("transaction committed = %v, want %v", committed, test.committed)
+			}
+
+			if inTransaction := store.fraud.(*fakeFraudRepository).decisions; len(inTransaction) != 0 {
+				t.Errorf("%d decisions recorded in the database transaction, want none", len(inTransaction))
+			}
+			if test.recorded == "" {
+				if len(fraudRepo.decisions) != 0 {
+					t.Errorf("decisions = %+v, want none recorded", fraudRepo.decisions)
+				}
+				return
+			}
+			if len(fraudRepo.decisions) != 1 {
+				t.Fatalf("%d decisions recorded, want 1", len(fraudRepo.decisions))
+			}
+			decision := fraudRepo.decisions[0]
+			if decision.Action != test.recorded || decision.Kind != FraudKindTransaction || decision.UserID != 1 || decision.ClientIP != "10.0.0.1" {
+				t.Errorf("decision = %+v, want %s of the transaction of user 1", decision, test.recorded)
+			}
+			// A denied transaction has no id to point at
+			if test.committed && decision.EntityID != created.TransactionID || !test.committed && decision.EntityID != 0 {
+				t.Errorf("decision entity = %d, want the created transaction or none", decision.EntityID)
+			}
+		})
+	}
+}
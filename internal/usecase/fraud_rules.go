@@ -0,0 +1,147 @@
+// internal/usecase/fraud_rules.go
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// FraudRuleAction is what a rule returns when it matches. A rule whose
+// threshold is zero is disabled and never matches.
+type FraudRuleAction struct {
+	Action string
+	Score  int
+}
+
+func (a FraudRuleAction) result(reason string) *FraudRuleResult {
+	return &FraudRuleResult{Action: a.Action, Score: a.Score, Reason: reason}
+}
+
+// VelocityRule matches users with more than MaxTransactions transactions
+// within Window.
+type VelocityRule struct {
+	MaxTransactions int
+	Window          time.Duration
+	FraudRuleAction
+}
+
+func (r *VelocityRule) Name() string {
+	return "velocity"
+}
+
+func (r *VelocityRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.MaxTransactions <= 0 {
+		return nil, nil
+	}
+
+	count, err := history.CountUserTransactions(ctx, check.UserID, check.Now.Add(-r.Window))
+	if err != nil {
+		return nil, err
+	}
+	if count <= r.MaxTransactions {
+		return nil, nil
+	}
+	return r.result(fmt.Sprintf("%d transactions within %s", count, r.Window)), nil
+}
+
+// AmountRule matches transactions and redemptions whose absolute amount is at
+// least Threshold.
+type AmountRule struct {
+	Threshold float64
+	FraudRuleAction
+}
+
+func (r *AmountRule) Name() string {
+	return "amount_threshold"
+}
+
+func (r *AmountRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.Threshold <= 0 || math.Abs(check.Amount) < r.Threshold {
+		return nil, nil
+	}
+	return r.result(fmt.Sprintf("amount of %s is at least %s", formatLimit(math.Abs(check.Amount)), formatLimit(r.Threshold))), nil
+}
+
+// NewAccountRule matches debits of at least MinDebit from accounts whose
+// first transaction is less than MaxAge old.
+type NewAccountRule struct {
+	MaxAge   time.Duration
+	MinDebit float64
+	FraudRuleAction
+}
+
+func (r *NewAccountRule) Name() string {
+	return "new_account"
+}
+
+func (r *NewAccountRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.MinDebit <= 0 || -check.Amount < r.MinDebit {
+		return nil, nil
+	}
+
+	firstAt, err := history.GetUserFirstTransactionAt(ctx, check.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if firstAt.IsZero() || check.Now.Sub(firstAt) >= r.MaxAge {
+		return nil, nil
+	}
+	return r.result(fmt.Sprintf("debit of %s from an account active for %s", formatLimit(-check.Amount), check.Now.Sub(firstAt).Round(time.Second))), nil
+}
+
+// IPFanOutRule matches client IPs used by more than MaxPhoneNumbers phone
+// numbers for the same kind of operation within Window, such as many new
+// phone numbers redeeming charge codes from one IP.
+type IPFanOutRule struct {
+	MaxPhoneNumbers int
+	Window          time.Duration
+	FraudRuleAction
+}
+
+func (r *IPFanOutRule) Name() string {
+	return "ip_fan_out"
+}
+
+func (r *IPFanOutRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.MaxPhoneNumbers <= 0 || check.ClientIP == "" {
+		return nil, nil
+	}
+
+	others, err := history.CountPhoneNumbersByIP(ctx, check.ClientIP, check.Kind, check.PhoneNumber, check.Now.Add(-r.Window))
+	if err != nil {
+		return nil, err
+	}
+	if others+1 <= r.MaxPhoneNumbers {
+		return nil, nil
+	}
+	return r.result(fmt.Sprintf("%d phone numbers from %s within %s", others+1, check.ClientIP, r.Window)), nil
+}
+
+// CreditDrainRule matches debits of at least Ratio times the credits the user
+// received within Window, such as a large debit right after a credit.
+type CreditDrainRule struct {
+	Ratio  float64
+	Window time.Duration
+	FraudRuleAction
+}
+
+func (r *CreditDrainRule) Name() string {
+	return "credit_drain"
+}
+
+func (r *CreditDrainRule) Evaluate(ctx context.Context, history FraudHistory, check *FraudCheck) (*FraudRuleResult, error) {
+	if r.Ratio <= 0 || check.Amount >= 0 {
+		return nil, nil
+	}
+
+	credits, err := history.SumUserCredits(ctx, check.UserID, check.Now.Add(-r.Window))
+	if err != nil {
+		return nil, err
+	}
+	if credits <= 0 || -check.Amount < r.Ratio*credits {
+		return nil, nil
+	}
+	return r.result(fmt.Sprintf("debit of %s after credits of %s within %s", formatLimit(-check.Amount), formatLimit(credits), r.Window)), nil
+}
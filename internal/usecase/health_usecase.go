@@ -0,0 +1,163 @@
+// internal/usecase/health_usecase.go
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// HealthReport is the readiness of the service with the result of every check.
+type HealthReport struct {
+	Status    string                        `json:"status"`
+	Checks    map[string]*HealthCheckResult `json:"checks"`
+	CheckedAt time.Time                     `json:"checked_at"`
+}
+
+type HealthCheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+type HealthRepository interface {
+	// Ping checks that the database is reachable.
+	Ping(ctx context.Context) error
+	// GetSchemaVersion returns the newest schema version recorded in the database.
+	GetSchemaVersion(ctx context.Context) (int, error)
+}
+
+type HealthConfig struct {
+	// SchemaVersion is the schema version this build needs
+	SchemaVersion int
+	// WorkerStaleAfter is how long a worker may go without a successful round
+	WorkerStaleAfter time.Duration
+	// CacheTTL is how long a report is reused before the checks run again
+	CacheTTL time.Duration
+}
+
+// HealthUseCase runs the readiness checks. Probes hit it every few seconds
+// from every load balancer, so a report is cached for CacheTTL.
+type HealthUseCase struct {
+	HealthRepository HealthRepository
+	Workers          map[string]*Heartbeat
+	Config           HealthConfig
+
+	mu     sync.Mutex
+	report *HealthReport
+}
+
+func NewHealthUseCase(healthRepo HealthRepository, workers map[string]*Heartbeat, config HealthConfig) *HealthUseCase {
+	return &HealthUseCase{HealthRepository: healthRepo, Workers: workers, Config: config}
+}
+
+// Readiness checks the database, the schema version and the background
+// workers. The report's Status is HealthStatusOK only if every check passed.
+func (hu *HealthUseCase) Readiness(ctx context.Context) *HealthReport {
+	// Concurrent probes wait for one run of the checks instead of each
+	// running their own
+	hu.mu.Lock()
+	defer hu.mu.Unlock()
+
+	now := time.Now().UTC()
+	if hu.report != nil && now.Sub(hu.report.CheckedAt) < hu.Config.CacheTTL {
+		return hu.report
+	}
+
+	report := &HealthReport{Status: HealthStatusOK, Checks: map[string]*HealthCheckResult{}, CheckedAt: now}
+	check := func(name string, fn func() error) {
+		start := time.Now()
+		result := &HealthCheckResult{Status: HealthStatusOK}
+		if err := fn(); err != nil {
+			result.Status = HealthStatusFail
+			result.Error = err.Error()
+			report.Status = HealthStatusFail
+		}
+		result.DurationMs = time.Since(start).Milliseconds()
+		report.Checks[name] = result
+	}
+
+	check("database", func() error {
+		return hu.HealthRepository.Ping(ctx)
+	})
+	check("schema_version", func() error {
+		version, err := hu.HealthRepository.GetSchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		// A newer schema is fine: schema changes only add to it
+		if version < hu.Config.SchemaVersion {
+			return fmt.Errorf("schema version %d is older than the required version %d", version, hu.Config.SchemaVersion)
+		}
+		return nil
+	})
+	for name, heartbeat := range hu.Workers {
+		check(name, func() error {
+			return heartbeat.Check(now, hu.Config.WorkerStaleAfter)
+		})
+	}
+
+	hu.report = report
+	return report
+}
+
+// Heartbeat records the rounds of a background worker so that the readiness
+// check notices a worker that stopped or keeps failing.
+type Heartbeat struct {
+	mu          sync.Mutex
+	running     bool
+	lastSuccess time.Time
+	lastErr     error
+}
+
+// Start marks the worker as running. It counts as a successful round so that
+// a worker is healthy while its first round is in progress.
+func (h *Heartbeat) Start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = true
+	h.lastSuccess = time.Now().UTC()
+	h.lastErr = nil
+}
+
+// Beat records the outcome of a round.
+func (h *Heartbeat) Beat(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastErr = err
+	if err == nil {
+		h.lastSuccess = time.Now().UTC()
+	}
+}
+
+// Stop marks the worker as stopped.
+func (h *Heartbeat) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = false
+}
+
+// Check returns an error if the worker is not running or has not completed a
+// round successfully within staleAfter of now.
+func (h *Heartbeat) Check(now time.Time, staleAfter time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.running {
+		return errors.New("worker is not running")
+	}
+	if now.Sub(h.lastSuccess) > staleAfter {
+		if h.lastErr != nil {
+			return fmt.Errorf("no successful round since %s: %w", h.lastSuccess.Format(time.RFC3339), h.lastErr)
+		}
+		return fmt.Errorf("no successful round since %s", h.lastSuccess.Format(time.RFC3339))
+	}
+	return nil
+}
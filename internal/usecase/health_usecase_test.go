@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeHealthRepository struct {
+	pingErr       error
+	schemaVersion int
+	pings         int
+}
+
+func (r *fakeHealthRepository) Ping(ctx context.Context) error {
+	r.pings++
+	return r.pingErr
+}
+
+func (r *fakeHealthRepository) GetSchemaVersion(ctx context.Context) (int, error) {
+	return r.schemaVersion, nil
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name          string
+		pingErr       error
+		schemaVersion int
+		worker        func(heartbeat *Heartbeat)
+		// failing are the checks that fail
+		failing []string
+	}{
+		{"ready", nil, 3, func(heartbeat *Heartbeat) { heartbeat.Start() }, nil},
+		{"newer schema", nil, 4, func(heartbeat *Heartbeat) { heartbeat.Start() }, nil},
+		{"database down", errors.New("connection refused"), 3, func(heartbeat *Heartbeat) { heartbeat.Start() }, []string{"database"}},
+		{"old schema", nil, 2, func(heartbeat *Heartbeat) { heartbeat.Start() }, []string{"schema_version"}},
+		{"worker not started", nil, 3, func(heartbeat *Heartbeat) {}, []string{"outbox_relay"}},
+		{"worker stopped", nil, 3, func(heartbeat *Heartbeat) {
+			heartbeat.Start()
+			heartbeat.Stop()
+		}, []string{"outbox_relay"}},
+		// A failing round is fine until the worker goes stale
+		{"worker failed a round", nil, 3, func(heartbeat *Heartbeat) {
+			heartbeat.Start()
+			heartbeat.Beat(errors.New("broker unavailable"))
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			heartbeat := &Heartbeat{}
+			test.worker(heartbeat)
+			uc := NewHealthUseCase(&fakeHealthRepository{pingErr: test.pingErr, schemaVersion: test.schemaVersion},
+				map[string]*Heartbeat{"outbox_relay": heartbeat}, HealthConfig{SchemaVersion: 3, WorkerStaleAfter: time.Minute})
+
+			report := uc.Readiness(context.Background())
+			failing := []string{}
+			for _, name := range []string{"database", "schema_version", "outbox_relay"} {
+				result, ok := report.Checks[name]
+				if !ok {
+					t.Fatalf("report = %+v, want the %s check", report, name)
+				}
+				if result.Status == HealthStatusFail {
+					failing = append(failing, name)
+				}
+			}
+			if strings.Join(failing, ",") != strings.Join(test.failing, ",") {
+				t.Errorf("failing checks = %v, want %v", failing, test.failing)
+			}
+			wantStatus := HealthStatusOK
+			if len(test.failing) > 0 {
+				wantStatus = HealthStatusFail
+			}
+			if report.Status != wantStatus {
+				t.Errorf("status = %s, want %s", report.Status, wantStatus)
+			}
+		})
+	}
+}
+
+func TestReadinessCachesReports(t *testing.T) {
+	repo := &fakeHealthRepository{schemaVersion: 1}
+	uc := NewHealthUseCase(repo, nil, HealthConfig{SchemaVersion: 1, CacheTTL: time.Hour})
+
+	first := uc.Readiness(context.Background())
+	repo.pingErr = errors.New("connection refused")
+	if second := uc.Readiness(context.Background()); second != first || repo.pings != 1 {
+		t.Errorf("%d pings, want the first report reused", repo.pings)
+	}
+
+	uc.Config.CacheTTL = 0
+	if report := uc.Readiness(context.Background()); report.Status != HealthStatusFail || repo.pings != 2 {
+		t.Errorf("status = %s after %d pings, want the checks run again", report.Status, repo.pings)
+	}
+}
+
+func TestHeartbeatCheck(t *testing.T) {
+	heartbeat := &Heartbeat{}
+	heartbeat.Start()
+	now := time.Now().UTC()
+
+	if err := heartbeat.Check(now, time.Minute); err != nil {
+		t.Errorf("Check of a started worker: %v", err)
+	}
+
+	heartbeat.Beat(errors.New("broker unavailable"))
+	err := heartbeat.Check(now.Add(2*time.Minute), time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "broker unavailable") {
+		t.Errorf("Check of a stale worker: err = %v, want the last error", err)
+	}
+
+	heartbeat.Beat(nil)
+	if err := heartbeat.Check(time.Now().UTC(), time.Minute); err != nil {
+		t.Errorf("Check after a successful round: %v", err)
+	}
+}
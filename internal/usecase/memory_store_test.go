@@ -0,0 +1,291 @@
+package usecase
+
+import (
+	"context"
+	"time"
+)
+
+// memoryData is the data of a memoryStore.
+type memoryData struct {
+	users        map[int]*User
+	chargeCodes  map[int]*ChargeCode
+	transactions []*Transaction
+	imports      map[string]int
+	auditLogs    []*AuditLog
+	events       []*Event
+}
+
+// clone copies the data, so that a transaction can change it and be thrown
+// away.
+func (d *memoryData) clone() *memoryData {
+	cloned := &memoryData{
+		users:        map[int]*User{},
+		chargeCodes:  map[int]*ChargeCode{},
+		transactions: append([]*Transaction(nil), d.transactions...),
+		imports:      map[string]int{},
+		auditLogs:    append([]*AuditLog(nil), d.auditLogs...),
+		events:       append([]*Event(nil), d.events...),
+	}
+	for id, user := range d.users {
+		copied := *user
+		cloned.users[id] = &copied
+	}
+	for id, chargeCode := range d.chargeCodes {
+		copied := *chargeCode
+		cloned.chargeCodes[id] = &copied
+	}
+	for reference, transactionID := range d.imports {
+		cloned.imports[reference] = transactionID
+	}
+	return cloned
+}
+
+// memoryStore is a Transactor over data kept in memory. A transaction works
+// on a copy of the data, which replaces the data when it commits. The
+// repositories implement what the tests use; the other methods panic.
+type memoryStore struct {
+	data *memoryData
+	// webhooks, fraud and reconciliation are used as they are, so their
+	// changes are not rolled back
+	webhooks       WebhookRepository
+	fraud          FraudRepository
+	reconciliation ReconciliationRepository
+	// commitErr fails every commit after the transaction ran
+	commitErr error
+	// transactions counts the database transactions run
+	transactions int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{data: &memoryData{users: map[int]*User{}, chargeCodes: map[int]*ChargeCode{}, imports: map[string]int{}}}
+}
+
+// addUser adds a user with balance and returns its id.
+func (s *memoryStore) addUser(phoneNumber string, balance float64) int {
+	id := len(s.data.users) + 1
+	s.data.users[id] = &User{ID: id, PhoneNumber: phoneNumber, Balance: balance, Version: 1}
+	return id
+}
+
+// addChargeCode adds an active charge code and returns its id.
+func (s *memoryStore) addChargeCode(code string, maxUses int, currentUses int, amount float64) int {
+	id := len(s.data.chargeCodes) + 1
+	s.data.chargeCodes[id] = &ChargeCode{ChargeCodeID: id, Code: code, MaxUses: maxUses, CurrentUses: currentUses, Amount: amount,
+		Version: 1, Status: ChargeCodeActive}
+	return id
+}
+
+func (s *memoryStore) WithinTransaction(ctx context.Context, fn func(repos *Repositories) error) error {
+	s.transactions++
+	tx := s.data.clone()
+	repos := &Repositories{
+		Users:        &memoryUsers{data: tx},
+		ChargeCodes:  &memoryChargeCodes{data: tx},
+		Transactions: &memoryTransactions{data: tx},
+		Audit:        &memoryAudit{data: tx},
+		Outbox:       &memoryOutbox{data: tx},
+		Webhooks:     s.webhooks,
+
+		TransactionLimits: &memoryTransactionLimits{data: tx},
+		Fraud:             s.fraud,
+		Reconciliation:    s.reconciliation,
+	}
+	if err := fn(repos); err != nil {
+		return err
+	}
+	if s.commitErr != nil {
+		return s.commitErr
+	}
+	s.data = tx
+	return nil
+}
+
+type memoryUsers struct {
+	UserRepository
+	data *memoryData
+}
+
+func (r *memoryUsers) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*User, error) {
+	for _, user := range r.data.users {
+		if user.PhoneNumber == phoneNumber {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, NotFoundError("user not found")
+}
+
+func (r *memoryUsers) GetUserByID(ctx context.Context, id int) (*User, error) {
+	user, ok := r.data.users[id]
+	if !ok {
+		return nil, NotFoundError("user not found")
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *memoryUsers) PatchUser(ctx context.Context, id int, version int, patch *UserPatch) (*User, error) {
+	user, ok := r.data.users[id]
+	if !ok {
+		return nil, NotFoundError("user not found")
+	}
+	if user.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	if patch.PhoneNumber != nil {
+		for _, other := range r.data.users {
+			if other.ID != id && other.PhoneNumber == *patch.PhoneNumber {
+				return nil, ErrPhoneNumberRegistered
+			}
+		}
+		user.PhoneNumber = *patch.PhoneNumber
+	}
+	user.Version++
+	patched := *user
+	return &patched, nil
+}
+
+type memoryChargeCodes struct {
+	ChargeCodeRepository
+	data *memoryData
+}
+
+func (r *memoryChargeCodes) GetChargeCodeByID(ctx context.Context, id int) (*ChargeCode, error) {
+	chargeCode, ok := r.data.chargeCodes[id]
+	if !ok {
+		return nil, NotFoundError("charge code not found")
+	}
+	found := *chargeCode
+	return &found, nil
+}
+
+// change applies fn to the charge code at version, like the conditional
+// updates of the repository.
+func (r *memoryChargeCodes) change(id int, version int, fn func(chargeCode *ChargeCode)) (*ChargeCode, error) {
+	chargeCode, ok := r.data.chargeCodes[id]
+	if !ok {
+		return nil, NotFoundError("charge code not found")
+	}
+	if chargeCode.Version != version {
+		return nil, ErrVersionMismatch
+	}
+	fn(chargeCode)
+	chargeCode.Version++
+	changed := *chargeCode
+	return &changed, nil
+}
+
+func (r *memoryChargeCodes) UpdateChargeCode(ctx context.Context, chargeCode *ChargeCode) (*ChargeCode, error) {
+	return r.change(chargeCode.ChargeCodeID, chargeCode.Version, func(stored *ChargeCode) {
+		stored.Code, stored.MaxUses, stored.Amount = chargeCode.Code, chargeCode.MaxUses, chargeCode.Amount
+	})
+}
+
+func (r *memoryChargeCodes) PatchChargeCode(ctx context.Context, id int, version int, patch *ChargeCodePatch) (*ChargeCode, error) {
+	return r.change(id, version, func(stored *ChargeCode) {
+		if patch.Code != nil {
+			stored.Code = *patch.Code
+		}
+		if patch.MaxUses != nil {
+			stored.MaxUses = *patch.MaxUses
+		}
+		if patch.Amount != nil {
+			stored.Amount = *patch.Amount
+		}
+	})
+}
+
+func (r *memoryChargeCodes) SetChargeCodeStatus(ctx context.Context, id int, status string) (*ChargeCode, error) {
+	chargeCode, ok := r.data.chargeCodes[id]
+	if !ok {
+		return nil, NotFoundError("charge code not found")
+	}
+	return r.change(id, chargeCode.Version, func(stored *ChargeCode) { stored.Status = status })
+}
+
+// memoryTransactionLimits has no activity and no overrides, so only the
+// size of a single transaction counts towards the limits.
+type memoryTransactionLimits struct {
+	TransactionLimitRepository
+	data *memoryData
+}
+
+func (r *memoryTransactionLimits) LockUser(ctx context.Context, userID int) error {
+	if _, ok := r.data.users[userID]; !ok {
+		return NotFoundError("user not found")
+	}
+	return nil
+}
+
+func (r *memoryTransactionLimits) GetActivity(ctx context.Context, userID int, since time.Time) ([]*TransactionActivity, error) {
+	return []*TransactionActivity{}, nil
+}
+
+func (r *memoryTransactionLimits) GetOverrides(ctx context.Context, userID int) (*TransactionLimitOverrides, error) {
+	return &TransactionLimitOverrides{}, nil
+}
+
+// memoryMaxAmount stands in for the amount range the database checks.
+const memoryMaxAmount = 1000000
+
+type memoryTransactions struct {
+	TransactionRepository
+	data *memoryData
+}
+
+func (r *memoryTransactions) CreateTransaction(ctx context.Context, transaction *Transaction) (*Transaction, error) {
+	if transaction.Amount < -memoryMaxAmount || transaction.Amount > memoryMaxAmount {
+		return nil, ValidationError("amount is outside the valid range")
+	}
+	for _, user := range r.data.users {
+		if user.PhoneNumber != transaction.PhoneNumber {
+			continue
+		}
+		if user.Balance+transaction.Amount < 0 {
+			return nil, ErrInsufficientFunds
+		}
+		user.Balance += transaction.Amount
+		user.Version++
+		created := *transaction
+		created.TransactionID = len(r.data.transactions) + 1
+		r.data.transactions = append(r.data.transactions, &created)
+		return &created, nil
+	}
+	return nil, NotFoundError("user not found")
+}
+
+func (r *memoryTransactions) GetImportedTransactionID(ctx context.Context, reference string) (int, error) {
+	transactionID, ok := r.data.imports[reference]
+	if !ok {
+		return 0, NotFoundError("import reference not found")
+	}
+	return transactionID, nil
+}
+
+func (r *memoryTransactions) CreateImportReference(ctx context.Context, reference string, transactionID int) error {
+	if _, ok := r.data.imports[reference]; ok {
+		return ConflictError("reference " + reference + " is being imported by another request")
+	}
+	r.data.imports[reference] = transactionID
+	return nil
+}
+
+type memoryAudit struct {
+	AuditRepository
+	data *memoryData
+}
+
+func (r *memoryAudit) CreateAuditLog(ctx context.Context, auditLog *AuditLog) error {
+	auditLog.AuditID = len(r.data.auditLogs) + 1
+	r.data.auditLogs = append(r.data.auditLogs, auditLog)
+	return nil
+}
+
+type memoryOutbox struct {
+	data *memoryData
+}
+
+func (r *memoryOutbox) Enqueue(ctx context.Context, event *Event) error {
+	r.data.events = append(r.data.events, event)
+	return nil
+}
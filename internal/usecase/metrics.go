@@ -0,0 +1,63 @@
+// internal/usecase/metrics.go
+package usecase
+
+import "errors"
+
+// Reasons a charge code redemption fails, as reported to BusinessMetrics.
+const (
+	RedemptionFailureRateLimited     = "rate_limited"
+	RedemptionFailureLocked          = "locked"
+	RedemptionFailureInvalidPhone    = "invalid_phone"
+	RedemptionFailurePhoneRegistered = "phone_registered"
+	RedemptionFailureAlreadyRedeemed = "already_redeemed"
+	RedemptionFailureUnavailable     = "unavailable"
+	RedemptionFailureInactive        = "inactive"
+	RedemptionFailureLimitExceeded   = "transaction_limit"
+	RedemptionFailureDenied          = "fraud_denied"
+	RedemptionFailureError           = "error"
+)
+
+// BusinessMetrics records business events for monitoring. Implementations
+// must be safe for concurrent use.
+type BusinessMetrics interface {
+	ChargeCodeRedeemed(chargeCodeID int)
+	RedemptionFailed(reason string)
+	TransactionCreated(amount float64)
+	InsufficientFunds()
+	FraudDecision(kind string, action string)
+}
+
+// NopBusinessMetrics discards every metric.
+type NopBusinessMetrics struct{}
+
+func (NopBusinessMetrics) ChargeCodeRedeemed(chargeCodeID int)      {}
+func (NopBusinessMetrics) RedemptionFailed(reason string)           {}
+func (NopBusinessMetrics) TransactionCreated(amount float64)        {}
+func (NopBusinessMetrics) InsufficientFunds()                       {}
+func (NopBusinessMetrics) FraudDecision(kind string, action string) {}
+
+func redemptionFailureReason(err error) string {
+	var limitErr *RedemptionLimitError
+	switch {
+	case errors.As(err, &limitErr) && limitErr.Locked:
+		return RedemptionFailureLocked
+	case errors.As(err, &limitErr):
+		return RedemptionFailureRateLimited
+	case errors.Is(err, ErrInvalidPhoneNumber):
+		return RedemptionFailureInvalidPhone
+	case errors.Is(err, ErrPhoneNumberRegistered):
+		return RedemptionFailurePhoneRegistered
+	case errors.Is(err, ErrChargeCodeAlreadyRedeemed):
+		return RedemptionFailureAlreadyRedeemed
+	case errors.Is(err, ErrChargeCodeUnavailable):
+		return RedemptionFailureUnavailable
+	case errors.Is(err, ErrChargeCodeInactive):
+		return RedemptionFailureInactive
+	case errors.As(err, new(*TransactionLimitError)):
+		return RedemptionFailureLimitExceeded
+	case errors.Is(err, ErrTransactionDenied):
+		return RedemptionFailureDenied
+	default:
+		return RedemptionFailureError
+	}
+}
@@ -0,0 +1,166 @@
+// internal/usecase/outbox_usecase.go
+package usecase
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Statuses of an outbox message. A message is dead once it failed
+// MaxAttempts times; it is kept for inspection but no longer published.
+const (
+	OutboxMessagePending = "pending"
+	OutboxMessageDead    = "dead"
+)
+
+// OutboxMessage is an event waiting in the outbox to be published.
+type OutboxMessage struct {
+	OutboxID int64
+	Event    *Event
+	Attempts int
+}
+
+// OutboxRepository writes events to the outbox. It is used through
+// Repositories so that an event is committed together with the change that
+// caused it.
+type OutboxRepository interface {
+	Enqueue(ctx context.Context, event *Event) error
+}
+
+// OutboxRelayRepository is used by the relay to drain the outbox.
+type OutboxRelayRepository interface {
+	// WithRelayLock runs fn only if no other instance is relaying, and
+	// reports whether it ran.
+	WithRelayLock(ctx context.Context, fn func() error) (bool, error)
+	// GetPendingMessages returns up to limit pending messages written after
+	// afterID in order, leaving out the messages of skipKeys.
+	GetPendingMessages(ctx context.Context, afterID int64, skipKeys []string, limit int) ([]*OutboxMessage, error)
+	// DeleteMessage acknowledges a published message.
+	DeleteMessage(ctx context.Context, outboxID int64) error
+	// RecordFailure counts a failed publication of a message, and marks it
+	// dead when dead is set.
+	RecordFailure(ctx context.Context, outboxID int64, cause error, dead bool) error
+}
+
+type OutboxRelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+}
+
+// OutboxRelay publishes outbox messages in the order they were written. A
+// message is deleted only after the publisher accepted it, so delivery is at
+// least once: a crash between the two publishes the message again. Messages
+// of the same key (one user) are never published out of order; when one
+// fails, later messages with that key wait for the next round. A message
+// that failed MaxAttempts times is dead-lettered, so that it stops holding
+// back its key.
+type OutboxRelay struct {
+	OutboxRepository OutboxRelayRepository
+	Publisher        EventPublisher
+	Config           OutboxRelayConfig
+	Heartbeat        *Heartbeat
+}
+
+func NewOutboxRelay(outboxRepo OutboxRelayRepository, publisher EventPublisher, config OutboxRelayConfig) *OutboxRelay {
+	return &OutboxRelay{OutboxRepository: outboxRepo, Publisher: publisher, Config: config, Heartbeat: &Heartbeat{}}
+}
+
+// userEventKey keys the events of a user by phone number, which identifies a
+// user before the user row exists.
+func userEventKey(phoneNumber string) string {
+	return "user:" + phoneNumber
+}
+
+func chargeCodeEventKey(chargeCodeID int) string {
+	return "charge_code:" + strconv.Itoa(chargeCodeID)
+}
+
+// enqueueEvent writes an event to the outbox of the current transaction.
+func enqueueEvent(ctx context.Context, repos *Repositories, eventType string, key string, data interface{}) error {
+	event, err := NewEvent(eventType, data)
+	if err != nil {
+		return err
+	}
+	event.Key = key
+	return repos.Outbox.Enqueue(ctx, event)
+}
+
+// Run relays the outbox every PollInterval until ctx is cancelled.
+func (or *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(or.Config.PollInterval)
+	defer ticker.Stop()
+
+	or.Heartbeat.Start()
+	defer or.Heartbeat.Stop()
+
+	for {
+		_, err := or.OutboxRepository.WithRelayLock(ctx, func() error { return or.RelayPending(ctx) })
+		if err != nil {
+			slog.Error("error relaying outbox", "error", err)
+		}
+		or.Heartbeat.Beat(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publishes the pending messages in one pass over the outbox.
+// Once a message of a key fails, the later messages of that key are not even
+// read, so failing messages never fill a batch and hold back other keys.
+func (or *OutboxRelay) RelayPending(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "OutboxRelay.RelayPending")
+	defer endSpan(span, &err)
+
+	var (
+		afterID     int64
+		blockedKeys []string
+	)
+	blocked := map[string]bool{}
+	for ctx.Err() == nil {
+		messages, err := or.OutboxRepository.GetPendingMessages(ctx, afterID, blockedKeys, or.Config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, message := range messages {
+			if ctx.Err() != nil {
+				return nil
+			}
+			afterID = message.OutboxID
+			// The key may have failed earlier in this batch
+			if blocked[message.Event.Key] {
+				continue
+			}
+
+			if publishErr := or.Publisher.Publish(ctx, message.Event); publishErr != nil {
+				dead := message.Attempts+1 >= or.Config.MaxAttempts
+				if err := or.OutboxRepository.RecordFailure(ctx, message.OutboxID, publishErr, dead); err != nil {
+					return err
+				}
+				if dead {
+					slog.WarnContext(ctx, "outbox message dead-lettered", "outbox_id", message.OutboxID, "event_id", message.Event.ID, "error", publishErr)
+					continue
+				}
+				blocked[message.Event.Key] = true
+				blockedKeys = append(blockedKeys, message.Event.Key)
+				continue
+			}
+
+			if err := or.OutboxRepository.DeleteMessage(ctx, message.OutboxID); err != nil {
+				return err
+			}
+		}
+
+		if len(messages) < or.Config.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
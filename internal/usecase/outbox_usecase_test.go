@@ -0,0 +1,140 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeOutbox keeps outbox messages in memory, in the order they were written.
+type fakeOutbox struct {
+	messages []*OutboxMessage
+	dead     []int64
+}
+
+func (o *fakeOutbox) WithRelayLock(ctx context.Context, fn func() error) (bool, error) {
+	return true, fn()
+}
+
+func (o *fakeOutbox) GetPendingMessages(ctx context.Context, afterID int64, skipKeys []string, limit int) ([]*OutboxMessage, error) {
+	skip := map[string]bool{}
+	for _, key := range skipKeys {
+		skip[key] = true
+	}
+	pending := []*OutboxMessage{}
+	for _, message := range o.messages {
+		if message.OutboxID > afterID && !skip[message.Event.Key] && len(pending) < limit {
+			pending = append(pending, message)
+		}
+	}
+	return pending, nil
+}
+
+func (o *fakeOutbox) DeleteMessage(ctx context.Context, outboxID int64) error {
+	for i, message := range o.messages {
+		if message.OutboxID == outboxID {
+			o.messages = append(o.messages[:i], o.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (o *fakeOutbox) RecordFailure(ctx context.Context, outboxID int64, cause error, dead bool) error {
+	for _, message := range o.messages {
+		if message.OutboxID == outboxID {
+			message.Attempts++
+		}
+	}
+	if dead {
+		o.dead = append(o.dead, outboxID)
+		return o.DeleteMessage(ctx, outboxID)
+	}
+	return nil
+}
+
+// fakePublisher records the events it published and fails the ones whose ID
+// is in failing.
+type fakePublisher struct {
+	failing   map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, event *Event) error {
+	if p.failing[event.ID] {
+		return errors.New("sink unavailable")
+	}
+	p.published = append(p.published, event.ID)
+	return nil
+}
+
+func newFakeOutbox(events ...*Event) *fakeOutbox {
+	outbox := &fakeOutbox{}
+	for i, event := range events {
+		outbox.messages = append(outbox.messages, &OutboxMessage{OutboxID: int64(i + 1), Event: event})
+	}
+	return outbox
+}
+
+func TestOutboxRelayPendingSkipsBlockedKeys(t *testing.T) {
+	// Failing messages fill the first batch
+	outbox := newFakeOutbox(
+		&Event{ID: "a1", Key: "user:a"},
+		&Event{ID: "b1", Key: "user:b"},
+		&Event{ID: "a2", Key: "user:a"},
+		&Event{ID: "c1", Key: "user:c"},
+		&Event{ID: "b2", Key: "user:b"},
+		&Event{ID: "c2", Key: "user:c"},
+	)
+	publisher := &fakePublisher{failing: map[string]bool{"a1": true, "b1": true}}
+	relay := NewOutboxRelay(outbox, publisher, OutboxRelayConfig{BatchSize: 2, MaxAttempts: 5})
+
+	if err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+
+	if want := []string{"c1", "c2"}; !reflect.DeepEqual(publisher.published, want) {
+		t.Errorf("published %v, want %v", publisher.published, want)
+	}
+	var pending []string
+	for _, message := range outbox.messages {
+		pending = append(pending, message.Event.ID)
+	}
+	if want := []string{"a1", "b1", "a2", "b2"}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending %v, want %v", pending, want)
+	}
+	if outbox.messages[0].Attempts != 1 || outbox.messages[1].Attempts != 1 {
+		t.Errorf("attempts of the failed messages = %d, %d, want 1, 1", outbox.messages[0].Attempts, outbox.messages[1].Attempts)
+	}
+}
+
+func TestOutboxRelayPendingDeadLetters(t *testing.T) {
+	outbox := newFakeOutbox(
+		&Event{ID: "a1", Key: "user:a"},
+		&Event{ID: "a2", Key: "user:a"},
+	)
+	publisher := &fakePublisher{failing: map[string]bool{"a1": true}}
+	relay := NewOutboxRelay(outbox, publisher, OutboxRelayConfig{BatchSize: 10, MaxAttempts: 3})
+	ctx := context.Background()
+
+	for round := 1; round < relay.Config.MaxAttempts; round++ {
+		if err := relay.RelayPending(ctx); err != nil {
+			t.Fatalf("RelayPending: %v", err)
+		}
+		if len(publisher.published) != 0 || len(outbox.dead) != 0 {
+			t.Fatalf("after %d failures: published %v and dead-lettered %v, want neither", round, publisher.published, outbox.dead)
+		}
+	}
+
+	// The last attempt dead-letters a1, which releases a2 in the same round
+	if err := relay.RelayPending(ctx); err != nil {
+		t.Fatalf("RelayPending: %v", err)
+	}
+	if want := []int64{1}; !reflect.DeepEqual(outbox.dead, want) {
+		t.Errorf("dead-lettered %v, want %v", outbox.dead, want)
+	}
+	if want := []string{"a2"}; !reflect.DeepEqual(publisher.published, want) {
+		t.Errorf("published %v, want %v", publisher.published, want)
+	}
+}
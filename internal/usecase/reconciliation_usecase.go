@@ -0,0 +1,328 @@
+// internal/usecase/reconciliation_usecase.go
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Kinds of reconciliation discrepancies.
+const (
+	// ReconciliationUserBalance is a user whose balance differs from the sum
+	// of their transactions.
+	ReconciliationUserBalance = "user_balance"
+	// ReconciliationChargeCodeUses is a charge code whose current_uses
+	// differs from the number of its redemptions.
+	ReconciliationChargeCodeUses = "charge_code_uses"
+)
+
+// What started a reconciliation run.
+const (
+	ReconciliationTriggerSchedule = "schedule"
+	ReconciliationTriggerManual   = "manual"
+)
+
+// States of a reconciliation run.
+const (
+	ReconciliationRunning   = "running"
+	ReconciliationCompleted = "completed"
+	ReconciliationFailed    = "failed"
+)
+
+// States of a discrepancy. A discrepancy is skipped when it changed since the
+// run found it or could not be repaired.
+const (
+	DiscrepancyOpen     = "open"
+	DiscrepancyRepaired = "repaired"
+	DiscrepancySkipped  = "skipped"
+)
+
+// ReconciliationRun is the report of one reconciliation. Finding
+// discrepancies never changes them; Repair fixes them afterwards.
+type ReconciliationRun struct {
+	RunID                   int        `json:"run_id"`
+	Trigger                 string     `json:"trigger"`
+	Status                  string     `json:"status"`
+	BalanceDiscrepancies    int        `json:"balance_discrepancies"`
+	ChargeCodeDiscrepancies int        `json:"charge_code_discrepancies"`
+	Repaired                int        `json:"repaired"`
+	Error                   string     `json:"error,omitempty"`
+	StartedAt               time.Time  `json:"started_at"`
+	FinishedAt              *time.Time `json:"finished_at,omitempty"`
+	RepairedAt              *time.Time `json:"repaired_at,omitempty"`
+}
+
+// ReconciliationDiscrepancy is one entity whose recorded value differs from
+// the value derived from its history. EntityID is a user or a charge code,
+// depending on Kind.
+type ReconciliationDiscrepancy struct {
+	DiscrepancyID int     `json:"discrepancy_id"`
+	RunID         int     `json:"run_id"`
+	Kind          string  `json:"kind"`
+	EntityID      int     `json:"entity_id"`
+	Recorded      float64 `json:"recorded"`
+	Expected      float64 `json:"expected"`
+	Status        string  `json:"status"`
+	Note          string  `json:"note,omitempty"`
+}
+
+type ReconciliationRepository interface {
+	// FindBalanceDiscrepancies compares every balance with the sum of the
+	// transactions of its user.
+	FindBalanceDiscrepancies(ctx context.Context) ([]*ReconciliationDiscrepancy, error)
+	// FindChargeCodeDiscrepancies compares every current_uses with the
+	// number of redemptions of its charge code.
+	FindChargeCodeDiscrepancies(ctx context.Context) ([]*ReconciliationDiscrepancy, error)
+
+	CreateRun(ctx context.Context, run *ReconciliationRun) error
+	FinishRun(ctx context.Context, run *ReconciliationRun) error
+	CreateDiscrepancies(ctx context.Context, runID int, discrepancies []*ReconciliationDiscrepancy) error
+	GetRuns(ctx context.Context, page int, pageSize int) ([]*ReconciliationRun, error)
+	GetRunByID(ctx context.Context, id int) (*ReconciliationRun, error)
+	GetDiscrepancies(ctx context.Context, runID int, page int, pageSize int) ([]*ReconciliationDiscrepancy, error)
+	GetOpenDiscrepancies(ctx context.Context, runID int) ([]*ReconciliationDiscrepancy, error)
+
+	// LockBalance locks the user and returns their balance and the sum of
+	// their transactions.
+	LockBalance(ctx context.Context, userID int) (float64, float64, error)
+	SetBalance(ctx context.Context, userID int, balance float64) error
+	// LockChargeCodeUses locks the charge code and returns its current_uses
+	// and the number of its redemptions.
+	LockChargeCodeUses(ctx context.Context, chargeCodeID int) (int, int, error)
+	SetChargeCodeUses(ctx context.Context, chargeCodeID int, uses int) error
+	SetDiscrepancyStatus(ctx context.Context, discrepancy *ReconciliationDiscrepancy) error
+	// MarkRunRepaired counts the repaired discrepancies of the run and sets
+	// its repair time.
+	MarkRunRepaired(ctx context.Context, runID int, at time.Time) error
+}
+
+// ReconciliationConfig schedules the reconciliation once a day at At after
+// midnight UTC. AutoRepair repairs the discrepancies of scheduled runs right
+// after they are found.
+type ReconciliationConfig struct {
+	Enabled    bool
+	At         time.Duration
+	AutoRepair bool
+}
+
+type ReconciliationUseCase struct {
+	ReconciliationRepository ReconciliationRepository
+	Transactor               Transactor
+	Config                   ReconciliationConfig
+	now                      func() time.Time
+}
+
+func NewReconciliationUseCase(reconciliationRepo ReconciliationRepository, transactor Transactor, config ReconciliationConfig) *ReconciliationUseCase {
+	return &ReconciliationUseCase{ReconciliationRepository: reconciliationRepo, Transactor: transactor, Config: config, now: time.Now}
+}
+
+// Run reconciles once a day until ctx is cancelled. It returns at once when
+// the schedule is disabled.
+func (ru *ReconciliationUseCase) Run(ctx context.Context) {
+	if !ru.Config.Enabled {
+		return
+	}
+
+	for {
+		next := nextDailyRun(ru.now(), ru.Config.At)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		run, err := ru.Reconcile(ctx, ReconciliationTriggerSchedule)
+		if err != nil {
+			slog.Error("error reconciling", "error", err)
+			continue
+		}
+		slog.Info("reconciliation finished", "run_id", run.RunID,
+			"balance_discrepancies", run.BalanceDiscrepancies, "charge_code_discrepancies", run.ChargeCodeDiscrepancies)
+
+		if ru.Config.AutoRepair && run.BalanceDiscrepancies+run.ChargeCodeDiscrepancies > 0 {
+			actor := &Actor{Name: "reconciliation"}
+			if _, err := ru.Repair(ctx, run.RunID, actor); err != nil {
+				slog.Error("error repairing reconciliation discrepancies", "error", err, "run_id", run.RunID)
+			}
+		}
+	}
+}
+
+// nextDailyRun returns the first time after now that is at after midnight
+// UTC.
+func nextDailyRun(now time.Time, at time.Duration) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(at)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Reconcile finds every discrepancy and stores them in a new run. It does not
+// change any balance or charge code.
+func (ru *ReconciliationUseCase) Reconcile(ctx context.Context, trigger string) (_ *ReconciliationRun, err error) {
+	ctx, span := startSpan(ctx, "ReconciliationUseCase.Reconcile")
+	defer endSpan(span, &err)
+
+	run := &ReconciliationRun{Trigger: trigger, Status: ReconciliationRunning, StartedAt: ru.now().UTC()}
+	if err := ru.ReconciliationRepository.CreateRun(ctx, run); err != nil {
+		return nil, err
+	}
+
+	findErr := ru.find(ctx, run)
+	finishedAt := ru.now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Status = ReconciliationCompleted
+	if findErr != nil {
+		run.Status = ReconciliationFailed
+		run.Error = findErr.Error()
+	}
+
+	// The run is finished even when the request was cancelled, so it does
+	// not stay running forever
+	if err := ru.ReconciliationRepository.FinishRun(context.WithoutCancel(ctx), run); err != nil {
+		return nil, err
+	}
+	if findErr != nil {
+		return nil, findErr
+	}
+	return run, nil
+}
+
+func (ru *ReconciliationUseCase) find(ctx context.Context, run *ReconciliationRun) error {
+	balances, err := ru.ReconciliationRepository.FindBalanceDiscrepancies(ctx)
+	if err != nil {
+		return err
+	}
+	chargeCodes, err := ru.ReconciliationRepository.FindChargeCodeDiscrepancies(ctx)
+	if err != nil {
+		return err
+	}
+
+	run.BalanceDiscrepancies = len(balances)
+	run.ChargeCodeDiscrepancies = len(chargeCodes)
+	return ru.ReconciliationRepository.CreateDiscrepancies(ctx, run.RunID, append(balances, chargeCodes...))
+}
+
+// Repair fixes the open discrepancies of a run: balances are set to the sum
+// of the transactions and current_uses to the number of redemptions. A
+// discrepancy that changed since the run is skipped, so the run should be
+// recent. Every repair is written to the audit log.
+func (ru *ReconciliationUseCase) Repair(ctx context.Context, runID int, actor *Actor) (_ *ReconciliationRun, err error) {
+	ctx, span := startSpan(ctx, "ReconciliationUseCase.Repair")
+	defer endSpan(span, &err)
+
+	run, err := ru.ReconciliationRepository.GetRunByID(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.Status != ReconciliationCompleted {
+		return nil, ConflictError("only completed reconciliation runs can be repaired")
+	}
+
+	discrepancies, err := ru.ReconciliationRepository.GetOpenDiscrepancies(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, discrepancy := range discrepancies {
+		if err := ru.repair(ctx, discrepancy, actor); err != nil {
+			// Skip the discrepancy but keep repairing the others
+			slog.ErrorContext(ctx, "error repairing discrepancy", "error", err, "discrepancy_id", discrepancy.DiscrepancyID)
+			discrepancy.Status = DiscrepancySkipped
+			discrepancy.Note = err.Error()
+			if err := ru.ReconciliationRepository.SetDiscrepancyStatus(ctx, discrepancy); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := ru.ReconciliationRepository.MarkRunRepaired(ctx, runID, ru.now().UTC()); err != nil {
+		return nil, err
+	}
+	return ru.ReconciliationRepository.GetRunByID(ctx, runID)
+}
+
+// repair fixes one discrepancy in its own database transaction.
+func (ru *ReconciliationUseCase) repair(ctx context.Context, discrepancy *ReconciliationDiscrepancy, actor *Actor) error {
+	return ru.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		var (
+			recorded, expected float64
+			entityType, field  string
+		)
+		switch discrepancy.Kind {
+		case ReconciliationUserBalance:
+			var err error
+			recorded, expected, err = repos.Reconciliation.LockBalance(ctx, discrepancy.EntityID)
+			if err != nil {
+				return err
+			}
+			entityType, field = AuditEntityUser, "balance"
+		case ReconciliationChargeCodeUses:
+			currentUses, redemptions, err := repos.Reconciliation.LockChargeCodeUses(ctx, discrepancy.EntityID)
+			if err != nil {
+				return err
+			}
+			recorded, expected = float64(currentUses), float64(redemptions)
+			entityType, field = AuditEntityChargeCode, "current_uses"
+		default:
+			return fmt.Errorf("unknown discrepancy kind %q", discrepancy.Kind)
+		}
+
+		// New transactions move the balance and the sum alike, so only a
+		// different drift means the entity was changed since the run
+		if cents(recorded-expected) != cents(discrepancy.Recorded-discrepancy.Expected) {
+			discrepancy.Status = DiscrepancySkipped
+			discrepancy.Note = "changed since the reconciliation run"
+			return repos.Reconciliation.SetDiscrepancyStatus(ctx, discrepancy)
+		}
+
+		var err error
+		if discrepancy.Kind == ReconciliationUserBalance {
+			err = repos.Reconciliation.SetBalance(ctx, discrepancy.EntityID, expected)
+		} else {
+			err = repos.Reconciliation.SetChargeCodeUses(ctx, discrepancy.EntityID, int(expected))
+		}
+		if err != nil {
+			return err
+		}
+
+		discrepancy.Status = DiscrepancyRepaired
+		discrepancy.Note = ""
+		if err := repos.Reconciliation.SetDiscrepancyStatus(ctx, discrepancy); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionReconciliation, entityType, discrepancy.EntityID,
+			map[string]float64{field: recorded}, map[string]float64{field: expected})
+	})
+}
+
+func (ru *ReconciliationUseCase) GetRuns(ctx context.Context, page int, pageSize int) (_ []*ReconciliationRun, err error) {
+	ctx, span := startSpan(ctx, "ReconciliationUseCase.GetRuns")
+	defer endSpan(span, &err)
+
+	return ru.ReconciliationRepository.GetRuns(ctx, page, pageSize)
+}
+
+func (ru *ReconciliationUseCase) GetRunByID(ctx context.Context, id int) (_ *ReconciliationRun, err error) {
+	ctx, span := startSpan(ctx, "ReconciliationUseCase.GetRunByID")
+	defer endSpan(span, &err)
+
+	return ru.ReconciliationRepository.GetRunByID(ctx, id)
+}
+
+func (ru *ReconciliationUseCase) GetDiscrepancies(ctx context.Context, runID int, page int, pageSize int) (_ []*ReconciliationDiscrepancy, err error) {
+	ctx, span := startSpan(ctx, "ReconciliationUseCase.GetDiscrepancies")
+	defer endSpan(span, &err)
+
+	if _, err := ru.ReconciliationRepository.GetRunByID(ctx, runID); err != nil {
+		return nil, err
+	}
+	return ru.ReconciliationRepository.GetDiscrepancies(ctx, runID, page, pageSize)
+}
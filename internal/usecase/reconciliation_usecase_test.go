@@ -0,0 +1,407 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeReconciliationRepository keeps runs and discrepancies in memory. The
+// recorded and expected values of every entity are what LockBalance and
+// LockChargeCodeUses find when a discrepancy is repaired.
+type fakeReconciliationRepository struct {
+	ReconciliationRepository
+	balances      []*ReconciliationDiscrepancy
+	chargeCodes   []*ReconciliationDiscrepancy
+	findErr       error
+	runs          []*ReconciliationRun
+	discrepancies []*ReconciliationDiscrepancy
+	// current holds the recorded and expected values of every entity by
+	// kind and id
+	current  map[string]map[int][2]float64
+	repaired map[string]map[int]float64
+	// onFinish is called when a run finishes and onRepaired when a run is
+	// repaired
+	onFinish, onRepaired func()
+}
+
+func newFakeReconciliationRepository() *fakeReconciliationRepository {
+	return &fakeReconciliationRepository{
+		current:  map[string]map[int][2]float64{ReconciliationUserBalance: {}, ReconciliationChargeCodeUses: {}},
+		repaired: map[string]map[int]float64{ReconciliationUserBalance: {}, ReconciliationChargeCodeUses: {}},
+	}
+}
+
+func (r *fakeReconciliationRepository) FindBalanceDiscrepancies(ctx context.Context) ([]*ReconciliationDiscrepancy, error) {
+	return r.balances, r.findErr
+}
+
+func (r *fakeReconciliationRepository) FindChargeCodeDiscrepancies(ctx context.Context) ([]*ReconciliationDiscrepancy, error) {
+	return r.chargeCodes, nil
+}
+
+func (r *fakeReconciliationRepository) CreateRun(ctx context.Context, run *ReconciliationRun) error {
+	run.RunID = len(r.runs) + 1
+	copied := *run
+	r.runs = append(r.runs, &copied)
+	return nil
+}
+
+func (r *fakeReconciliationRepository) FinishRun(ctx context.Context, run *ReconciliationRun) error {
+	copied := *run
+	r.runs[run.RunID-1] = &copied
+	if r.onFinish != nil {
+		r.onFinish()
+	}
+	return nil
+}
+
+func (r *fakeReconciliationRepository) CreateDiscrepancies(ctx context.Context, runID int, discrepancies []*ReconciliationDiscrepancy) error {
+	for _, discrepancy := range discrepancies {
+		copied := *discrepancy
+		copied.DiscrepancyID = len(r.discrepancies) + 1
+		copied.RunID = runID
+		r.discrepancies = append(r.discrepancies, &copied)
+	}
+	return nil
+}
+
+func (r *fakeReconciliationRepository) GetRunByID(ctx context.Context, id int) (*ReconciliationRun, error) {
+	if id < 1 || id > len(r.runs) {
+		return nil, NotFoundError("reconciliation run not found")
+	}
+	copied := *r.runs[id-1]
+	return &copied, nil
+}
+
+func (r *fakeReconciliationRepository) GetOpenDiscrepancies(ctx context.Context, runID int) ([]*ReconciliationDiscrepancy, error) {
+	open := []*ReconciliationDiscrepancy{}
+	for _, discrepancy := range r.discrepancies {
+		if discrepancy.RunID == runID && discrepancy.Status == DiscrepancyOpen {
+			copied := *discrepancy
+			open = append(open, &copied)
+		}
+	}
+	return open, nil
+}
+
+func (r *fakeReconciliationRepository) lock(kind string, id int) (float64, float64, error) {
+	values, ok := r.current[kind][id]
+	if !ok {
+		return 0, 0, NotFoundError("entity not found")
+	}
+	return values[0], values[1], nil
+}
+
+func (r *fakeReconciliationRepository) LockBalance(ctx context.Context, userID int) (float64, float64, error) {
+	return r.lock(ReconciliationUserBalance, userID)
+}
+
+func (r *fakeReconciliationRepository) SetBalance(ctx context.Context, userID int, balance float64) error {
+	r.repaired[ReconciliationUserBalance][userID] = balance
+	return nil
+}
+
+func (r *fakeReconciliationRepository) LockChargeCodeUses(ctx context.Context, chargeCodeID int) (int, int, error) {
+	currentUses, redemptions, err := r.lock(ReconciliationChargeCodeUses, chargeCodeID)
+	return int(currentUses), int(redemptions), err
+}
+
+func (r *fakeReconciliationRepository) SetChargeCodeUses(ctx context.Context, chargeCodeID int, uses int) error {
+	r.repaired[ReconciliationChargeCodeUses][chargeCodeID] = float64(uses)
+	return nil
+}
+
+func (r *fakeReconciliationRepository) SetDiscrepancyStatus(ctx context.Context, discrepancy *ReconciliationDiscrepancy) error {
+	copied := *discrepancy
+	r.discrepancies[discrepancy.DiscrepancyID-1] = &copied
+	return nil
+}
+
+func (r *fakeReconciliationRepository) MarkRunRepaired(ctx context.Context, runID int, at time.Time) error {
+	run := r.runs[runID-1]
+	run.Repaired = 0
+	for _, discrepancy := range r.discrepancies {
+		if discrepancy.RunID == runID && discrepancy.Status == DiscrepancyRepaired {
+			run.Repaired++
+		}
+	}
+	run.RepairedAt = &at
+	if r.onRepaired != nil {
+		r.onRepaired()
+	}
+	return nil
+}
+
+var reconciliationNow = time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+
+func newTestReconciliation(config ReconciliationConfig) (*ReconciliationUseCase, *memoryStore, *fakeReconciliationRepository) {
+	repo := newFakeReconciliationRepository()
+	store := newMemoryStore()
+	store.reconciliation = repo
+	uc := NewReconciliationUseCase(repo, store, config)
+	uc.now = func() time.Time { return reconciliationNow }
+	return uc, store, repo
+}
+
+func TestReconcile(t *testing.T) {
+	uc, store, repo := newTestReconciliation(ReconciliationConfig{})
+	repo.balances = []*ReconciliationDiscrepancy{
+		{Kind: ReconciliationUserBalance, EntityID: 1, Recorded: 500, Expected: 2000, Status: DiscrepancyOpen},
+		{Kind: ReconciliationUserBalance, EntityID: 2, Recorded: 0, Expected: 100, Status: DiscrepancyOpen},
+	}
+	repo.chargeCodes = []*ReconciliationDiscrepancy{
+		{Kind: ReconciliationChargeCodeUses, EntityID: 1, Recorded: 2, Expected: 0, Status: DiscrepancyOpen},
+	}
+
+	run, err := uc.Reconcile(context.Background(), ReconciliationTriggerManual)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	want := &ReconciliationRun{RunID: 1, Trigger: ReconciliationTriggerManual, Status: ReconciliationCompleted,
+		BalanceDiscrepancies: 2, ChargeCodeDiscrepancies: 1, StartedAt: reconciliationNow, FinishedAt: &reconciliationNow}
+	if !reflect.DeepEqual(run, want) || !reflect.DeepEqual(repo.runs, []*ReconciliationRun{want}) {
+		t.Errorf("run = %+v, stored %+v, want %+v", run, repo.runs[0], want)
+	}
+
+	if len(repo.discrepancies) != 3 {
+		t.Fatalf("%d discrepancies stored, want 3", len(repo.discrepancies))
+	}
+	for _, discrepancy := range repo.discrepancies {
+		if discrepancy.RunID != run.RunID || discrepancy.Status != DiscrepancyOpen {
+			t.Errorf("discrepancy = %+v, want open in run %d", discrepancy, run.RunID)
+		}
+	}
+	// Finding discrepancies never repairs them
+	if store.transactions != 0 || len(repo.repaired[ReconciliationUserBalance])+len(repo.repaired[ReconciliationChargeCodeUses]) != 0 {
+		t.Errorf("Reconcile repaired %v in %d transactions, want nothing changed", repo.repaired, store.transactions)
+	}
+}
+
+func TestReconcileFails(t *testing.T) {
+	uc, _, repo := newTestReconciliation(ReconciliationConfig{})
+	repo.findErr = InternalError("database query error", nil)
+
+	// A cancelled request still finishes its run
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := uc.Reconcile(ctx, ReconciliationTriggerManual); !errors.Is(err, ErrInternal) {
+		t.Fatalf("Reconcile: err = %v, want an internal error", err)
+	}
+	if run := repo.runs[0]; run.Status != ReconciliationFailed || run.Error != "database query error" || run.FinishedAt == nil {
+		t.Errorf("run = %+v, want failed with the error", run)
+	}
+	if len(repo.discrepancies) != 0 {
+		t.Errorf("%d discrepancies stored, want none", len(repo.discrepancies))
+	}
+}
+
+func TestReconciliationRepair(t *testing.T) {
+	tests := []struct {
+		name        string
+		discrepancy ReconciliationDiscrepancy
+		// current is what the entity records and its history gives now
+		current  *[2]float64
+		status   string
+		note     string
+		repaired *float64
+	}{
+		{"unchanged balance", ReconciliationDiscrepancy{Kind: ReconciliationUserBalance, Recorded: 500, Expected: 2000},
+			&[2]float64{500, 2000}, DiscrepancyRepaired, "", floatRef(2000)},
+		// A new transaction moved the balance and the sum alike
+		{"balance with a new transaction", ReconciliationDiscrepancy{Kind: ReconciliationUserBalance, Recorded: 500, Expected: 2000},
+			&[2]float64{400, 1900}, DiscrepancyRepaired, "", floatRef(1900)},
+		{"balance changed since the run", ReconciliationDiscrepancy{Kind: ReconciliationUserBalance, Recorded: 500, Expected: 2000},
+			&[2]float64{2000, 2000}, DiscrepancySkipped, "changed since the reconciliation run", nil},
+		{"balance drifting in cents", ReconciliationDiscrepancy{Kind: ReconciliationUserBalance, Recorded: 0.1, Expected: 0.3},
+			&[2]float64{0.1, 0.30000000000000004}, DiscrepancyRepaired, "", floatRef(0.30000000000000004)},
+		{"unchanged uses", ReconciliationDiscrepancy{Kind: ReconciliationChargeCodeUses, Recorded: 2, Expected: 0},
+			&[2]float64{2, 0}, DiscrepancyRepaired, "", floatRef(0)},
+		{"uses changed since the run", ReconciliationDiscrepancy{Kind: ReconciliationChargeCodeUses, Recorded: 2, Expected: 0},
+			&[2]float64{3, 3}, DiscrepancySkipped, "changed since the reconciliation run", nil},
+		{"deleted entity", ReconciliationDiscrepancy{Kind: ReconciliationUserBalance, Recorded: 500, Expected: 2000},
+			nil, DiscrepancySkipped, "entity not found", nil},
+		{"unknown kind", ReconciliationDiscrepancy{Kind: "wallet", Recorded: 1, Expected: 2},
+			nil, DiscrepancySkipped, `unknown discrepancy kind "wallet"`, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store, repo := newTestReconciliation(ReconciliationConfig{})
+			test.discrepancy.EntityID, test.discrepancy.Status = 7, DiscrepancyOpen
+			repo.balances = []*ReconciliationDiscrepancy{&test.discrepancy}
+			if test.current != nil {
+				repo.current[test.discrepancy.Kind][7] = *test.current
+			}
+			if _, err := uc.Reconcile(context.Background(), ReconciliationTriggerManual); err != nil {
+				t.Fatalf("Reconcile: %v", err)
+			}
+
+			run, err := uc.Repair(context.Background(), 1, &Actor{Name: "ops"})
+			if err != nil {
+				t.Fatalf("Repair: %v", err)
+			}
+			discrepancy := repo.discrepancies[0]
+			if discrepancy.Status != test.status || discrepancy.Note != test.note {
+				t.Errorf("discrepancy = %s %q, want %s %q", discrepancy.Status, discrepancy.Note, test.status, test.note)
+			}
+			if repaired := run.Repaired == 1; repaired != (test.status == DiscrepancyRepaired) || run.RepairedAt == nil {
+				t.Errorf("run = %d repaired at %v, want the repair counted", run.Repaired, run.RepairedAt)
+			}
+
+			value, set := repo.repaired[test.discrepancy.Kind][7]
+			if set != (test.repaired != nil) || set && value != *test.repaired {
+				t.Errorf("repaired value = %v set %v, want %v", value, set, test.repaired)
+			}
+			// Only a repair is audited
+			if audited := len(store.data.auditLogs) == 1; audited != set {
+				t.Fatalf("%d audit logs, want one for a repair", len(store.data.auditLogs))
+			}
+			if set && (store.data.auditLogs[0].Action != AuditActionReconciliation || store.data.auditLogs[0].Actor != "ops") {
+				t.Errorf("audit log = %s by %s, want the reconciliation by ops", store.data.auditLogs[0].Action, store.data.auditLogs[0].Actor)
+			}
+		})
+	}
+}
+
+func TestReconciliationRepairOnlyOpenDiscrepancies(t *testing.T) {
+	uc, _, repo := newTestReconciliation(ReconciliationConfig{})
+	repo.balances = []*ReconciliationDiscrepancy{{Kind: ReconciliationUserBalance, EntityID: 1, Recorded: 500, Expected: 2000, Status: DiscrepancyOpen}}
+	repo.current[ReconciliationUserBalance][1] = [2]float64{500, 2000}
+	if _, err := uc.Reconcile(context.Background(), ReconciliationTriggerManual); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if _, err := uc.Repair(context.Background(), 1, &Actor{}); err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+
+	// The balance drifted again, but the run was already repaired
+	repo.current[ReconciliationUserBalance][1] = [2]float64{0, 2000}
+	delete(repo.repaired[ReconciliationUserBalance], 1)
+	run, err := uc.Repair(context.Background(), 1, &Actor{})
+	if err != nil {
+		t.Fatalf("Repair again: %v", err)
+	}
+	if _, set := repo.repaired[ReconciliationUserBalance][1]; set || run.Repaired != 1 {
+		t.Errorf("repairing again changed the balance, %d repaired, want the repaired discrepancy left alone", run.Repaired)
+	}
+}
+
+func TestReconciliationRepairRuns(t *testing.T) {
+	uc, _, repo := newTestReconciliation(ReconciliationConfig{})
+	repo.findErr = InternalError("database query error", nil)
+	uc.Reconcile(context.Background(), ReconciliationTriggerManual)
+
+	if _, err := uc.Repair(context.Background(), 1, &Actor{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("Repair of a failed run: err = %v, want a conflict", err)
+	}
+	if _, err := uc.Repair(context.Background(), 2, &Actor{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Repair of a missing run: err = %v, want not found", err)
+	}
+}
+
+func TestNextDailyRun(t *testing.T) {
+	tests := []struct {
+		now  time.Time
+		at   time.Duration
+		want time.Time
+	}{
+		{time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), 3 * time.Hour, time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC), 3 * time.Hour, time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)},
+		{time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC), 3 * time.Hour, time.Date(2024, 2, 1, 3, 0, 0, 0, time.UTC)},
+		// The schedule is in UTC whatever the time zone of the clock
+		{time.Date(2024, 1, 1, 5, 0, 0, 0, time.FixedZone("IRST", 3*3600+1800)), 3 * time.Hour, time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if next := nextDailyRun(test.now, test.at); !next.Equal(test.want) {
+			t.Errorf("nextDailyRun(%s, %s) = %s, want %s", test.now, test.at, next, test.want)
+		}
+	}
+}
+
+// runScheduled runs the schedule of uc until stop is called, with a clock
+// that starts before the run is due and then moves on to the real time.
+func runScheduled(t *testing.T, uc *ReconciliationUseCase) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := false
+	uc.now = func() time.Time {
+		if !started {
+			started = true
+			return reconciliationNow.Add(-time.Minute)
+		}
+		return time.Now()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		uc.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run did not return after the context was cancelled")
+		}
+	}
+}
+
+func TestReconciliationRunSchedule(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoRepair bool
+		status     string
+	}{
+		{"reports only", false, DiscrepancyOpen},
+		{"repairs", true, DiscrepancyRepaired},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store, repo := newTestReconciliation(ReconciliationConfig{Enabled: true, At: 3 * time.Hour, AutoRepair: test.autoRepair})
+			repo.balances = []*ReconciliationDiscrepancy{{Kind: ReconciliationUserBalance, EntityID: 1, Recorded: 500, Expected: 2000, Status: DiscrepancyOpen}}
+			repo.current[ReconciliationUserBalance][1] = [2]float64{500, 2000}
+
+			finished := make(chan struct{})
+			if test.autoRepair {
+				repo.onRepaired = func() { close(finished) }
+			} else {
+				repo.onFinish = func() { close(finished) }
+			}
+			stop := runScheduled(t, uc)
+			select {
+			case <-finished:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the scheduled run did not finish")
+			}
+			stop()
+
+			if len(repo.runs) != 1 || repo.runs[0].Trigger != ReconciliationTriggerSchedule || repo.runs[0].Status != ReconciliationCompleted {
+				t.Fatalf("runs = %+v, want one completed scheduled run", repo.runs)
+			}
+			if discrepancy := repo.discrepancies[0]; discrepancy.Status != test.status {
+				t.Errorf("discrepancy = %s, want %s", discrepancy.Status, test.status)
+			}
+			// Repairs of the schedule are audited as the reconciliation
+			if test.autoRepair && (len(store.data.auditLogs) != 1 || store.data.auditLogs[0].Actor != "reconciliation") {
+				t.Errorf("audit logs = %+v, want the repair by reconciliation", store.data.auditLogs)
+			}
+		})
+	}
+}
+
+func TestReconciliationRunDisabled(t *testing.T) {
+	uc, _, repo := newTestReconciliation(ReconciliationConfig{At: 3 * time.Hour, AutoRepair: true})
+	uc.now = func() time.Time { return reconciliationNow.Add(-time.Minute) }
+
+	// Run returns at once without a schedule, even with a live context
+	uc.Run(context.Background())
+	if len(repo.runs) != 0 {
+		t.Errorf("%d runs, want none without a schedule", len(repo.runs))
+	}
+}
+
+func floatRef(f float64) *float64 {
+	return &f
+}
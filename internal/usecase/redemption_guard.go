@@ -0,0 +1,190 @@
+// internal/usecase/redemption_guard.go
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RateLimit describes a token bucket: it refills PerMinute tokens every
+// minute and holds at most Burst tokens.
+type RateLimit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// RedemptionFailureStat is the failure record kept for one phone number or
+// client IP.
+type RedemptionFailureStat struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	TotalFailures int        `json:"total_failures"`
+	WindowStarted time.Time  `json:"window_started"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// RedemptionAttemptStore keeps the token buckets, failure counters and
+// lockouts used by RedemptionGuard. The memory store is enough for a single
+// instance; the MySQL store is shared between instances.
+type RedemptionAttemptStore interface {
+	// TakeToken removes one token from the bucket for key. When the bucket is
+	// empty it returns false and how long until the next token is available.
+	TakeToken(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error)
+	// RecordFailure counts a failed redemption for key and returns the number
+	// of failures inside the current window.
+	RecordFailure(ctx context.Context, key string, window time.Duration, now time.Time) (int, error)
+	ResetFailures(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, until time.Time) error
+	LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, bool, error)
+	GetFailureStats(ctx context.Context, page int, pageSize int) ([]*RedemptionFailureStat, error)
+}
+
+type RedemptionGuardConfig struct {
+	PhoneLimit      RateLimit
+	IPLimit         RateLimit
+	MaxFailures     int
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+}
+
+// RedemptionLimitError is returned when a redemption attempt is throttled or
+// the caller is locked out after too many failed redemptions.
+type RedemptionLimitError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *RedemptionLimitError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed redemptions, try again in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many redemption attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+func (e *RedemptionLimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// RedemptionGuard protects charge code redemption against brute force by
+// rate limiting every phone number and client IP and locking them out after
+// repeated failures.
+type RedemptionGuard struct {
+	Store  RedemptionAttemptStore
+	Config RedemptionGuardConfig
+	now    func() time.Time
+}
+
+func NewRedemptionGuard(store RedemptionAttemptStore, config RedemptionGuardConfig) *RedemptionGuard {
+	return &RedemptionGuard{Store: store, Config: config, now: time.Now}
+}
+
+func phoneAttemptKey(phoneNumber string) string {
+	return "phone:" + phoneNumber
+}
+
+func ipAttemptKey(clientIP string) string {
+	return "ip:" + clientIP
+}
+
+// attemptKeys returns the keys an attempt is accounted against. The IP key is
+// skipped when the caller did not provide one.
+func attemptKeys(phoneNumber string, clientIP string) []string {
+	keys := []string{phoneAttemptKey(phoneNumber)}
+	if clientIP != "" {
+		keys = append(keys, ipAttemptKey(clientIP))
+	}
+	return keys
+}
+
+// Allow checks the lockouts and takes a token from both the phone number and
+// the client IP bucket.
+func (g *RedemptionGuard) Allow(ctx context.Context, phoneNumber string, clientIP string) (err error) {
+	ctx, span := startSpan(ctx, "RedemptionGuard.Allow")
+	defer endSpan(span, &err)
+
+	now := g.now()
+
+	for _, key := range attemptKeys(phoneNumber, clientIP) {
+		until, locked, err := g.Store.LockedUntil(ctx, key, now)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return &RedemptionLimitError{Locked: true, RetryAfter: until.Sub(now)}
+		}
+	}
+
+	allowed, retryAfter, err := g.Store.TakeToken(ctx, phoneAttemptKey(phoneNumber), g.Config.PhoneLimit, now)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &RedemptionLimitError{RetryAfter: retryAfter}
+	}
+
+	if clientIP != "" {
+		allowed, retryAfter, err = g.Store.TakeToken(ctx, ipAttemptKey(clientIP), g.Config.IPLimit, now)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return &RedemptionLimitError{RetryAfter: retryAfter}
+		}
+	}
+
+	return nil
+}
+
+// countsAsRedemptionFailure reports whether a failed redemption counts
+// towards the lockout. Only the outcomes of guessing charge codes or phone
+// numbers do: database errors, timeouts, fraud denials and limits say nothing
+// about the caller and must not lock it out.
+func countsAsRedemptionFailure(err error) bool {
+	for _, guess := range []error{ErrNotFound, ErrInvalidPhoneNumber, ErrPhoneNumberRegistered, ErrChargeCodeAlreadyRedeemed, ErrChargeCodeUnavailable, ErrChargeCodeInactive} {
+		if errors.Is(err, guess) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordFailure counts a failed redemption against the phone number and the
+// client IP, locking out whichever reached MaxFailures inside FailureWindow.
+func (g *RedemptionGuard) RecordFailure(ctx context.Context, phoneNumber string, clientIP string) (err error) {
+	ctx, span := startSpan(ctx, "RedemptionGuard.RecordFailure")
+	defer endSpan(span, &err)
+
+	now := g.now()
+
+	for _, key := range attemptKeys(phoneNumber, clientIP) {
+		failures, err := g.Store.RecordFailure(ctx, key, g.Config.FailureWindow, now)
+		if err != nil {
+			return err
+		}
+		if failures >= g.Config.MaxFailures {
+			if err := g.Store.Lock(ctx, key, now.Add(g.Config.LockoutDuration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the failures of a phone number after a successful
+// redemption. IP failures are kept since an IP may be shared by an attacker.
+func (g *RedemptionGuard) RecordSuccess(ctx context.Context, phoneNumber string) (err error) {
+	ctx, span := startSpan(ctx, "RedemptionGuard.RecordSuccess")
+	defer endSpan(span, &err)
+
+	return g.Store.ResetFailures(ctx, phoneAttemptKey(phoneNumber))
+}
+
+func (g *RedemptionGuard) GetFailureStats(ctx context.Context, page int, pageSize int) (_ []*RedemptionFailureStat, err error) {
+	ctx, span := startSpan(ctx, "RedemptionGuard.GetFailureStats")
+	defer endSpan(span, &err)
+
+	return g.Store.GetFailureStats(ctx, page, pageSize)
+}
@@ -0,0 +1,215 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeAttemptStore counts failures and keeps lockouts in maps. Its buckets
+// never run out unless tokens is set.
+type fakeAttemptStore struct {
+	tokens     map[string]int
+	failures   map[string]int
+	locks      map[string]time.Time
+	failureErr error
+	resetErr   error
+}
+
+func newFakeAttemptStore() *fakeAttemptStore {
+	return &fakeAttemptStore{failures: map[string]int{}, locks: map[string]time.Time{}}
+}
+
+func (s *fakeAttemptStore) TakeToken(ctx context.Context, key string, limit RateLimit, now time.Time) (bool, time.Duration, error) {
+	if s.tokens == nil {
+		return true, 0, nil
+	}
+	if s.tokens[key] == 0 {
+		return false, time.Minute, nil
+	}
+	s.tokens[key]--
+	return true, 0, nil
+}
+
+func (s *fakeAttemptStore) RecordFailure(ctx context.Context, key string, window time.Duration, now time.Time) (int, error) {
+	if s.failureErr != nil {
+		return 0, s.failureErr
+	}
+	s.failures[key]++
+	return s.failures[key], nil
+}
+
+func (s *fakeAttemptStore) ResetFailures(ctx context.Context, key string) error {
+	if s.resetErr != nil {
+		return s.resetErr
+	}
+	delete(s.failures, key)
+	return nil
+}
+
+func (s *fakeAttemptStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.locks[key] = until
+	return nil
+}
+
+func (s *fakeAttemptStore) LockedUntil(ctx context.Context, key string, now time.Time) (time.Time, bool, error) {
+	until, ok := s.locks[key]
+	return until, ok && until.After(now), nil
+}
+
+func (s *fakeAttemptStore) GetFailureStats(ctx context.Context, page int, pageSize int) ([]*RedemptionFailureStat, error) {
+	return nil, nil
+}
+
+// fakeTransactor fails every transaction with err without running it.
+type fakeTransactor struct {
+	err error
+}
+
+func (t *fakeTransactor) WithinTransaction(ctx context.Context, fn func(repos *Repositories) error) error {
+	return t.err
+}
+
+var testGuardConfig = RedemptionGuardConfig{
+	PhoneLimit:      RateLimit{PerMinute: 1, Burst: 2},
+	IPLimit:         RateLimit{PerMinute: 1, Burst: 2},
+	MaxFailures:     3,
+	FailureWindow:   10 * time.Minute,
+	LockoutDuration: 15 * time.Minute,
+}
+
+func newTestGuard(store RedemptionAttemptStore, now *time.Time) *RedemptionGuard {
+	guard := NewRedemptionGuard(store, testGuardConfig)
+	guard.now = func() time.Time { return *now }
+	return guard
+}
+
+func TestRedemptionGuardRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeAttemptStore()
+	store.tokens = map[string]int{"phone:09120000001": 1, "ip:10.0.0.1": 5}
+	guard := newTestGuard(store, &now)
+	ctx := context.Background()
+
+	if err := guard.Allow(ctx, "09120000001", "10.0.0.1"); err != nil {
+		t.Fatalf("first attempt: %v", err)
+	}
+
+	var limitErr *RedemptionLimitError
+	err := guard.Allow(ctx, "09120000001", "10.0.0.1")
+	if !errors.As(err, &limitErr) || limitErr.Locked || limitErr.RetryAfter != time.Minute {
+		t.Fatalf("attempt on an empty bucket: err = %v, want a rate limit retrying after a minute", err)
+	}
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("rate limit error does not match ErrLimitExceeded")
+	}
+	if store.tokens["ip:10.0.0.1"] != 4 {
+		t.Errorf("IP bucket holds %d tokens, want 4: a throttled phone number must not take an IP token", store.tokens["ip:10.0.0.1"])
+	}
+}
+
+func TestRedemptionGuardLockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := newFakeAttemptStore()
+	guard := newTestGuard(store, &now)
+	ctx := context.Background()
+
+	for i := 1; i < testGuardConfig.MaxFailures; i++ {
+		if err := guard.RecordFailure(ctx, "09120000001", "10.0.0.1"); err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if err := guard.Allow(ctx, "09120000001", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt after %d failures: %v", i, err)
+		}
+	}
+	if err := guard.RecordFailure(ctx, "09120000001", "10.0.0.1"); err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+
+	// Both the phone number and the IP are locked out
+	for _, attempt := range []struct{ phoneNumber, clientIP string }{
+		{"09120000001", "10.0.0.2"},
+		{"09120000002", "10.0.0.1"},
+	} {
+		var limitErr *RedemptionLimitError
+		err := guard.Allow(ctx, attempt.phoneNumber, attempt.clientIP)
+		if !errors.As(err, &limitErr) || !limitErr.Locked || limitErr.RetryAfter != testGuardConfig.LockoutDuration {
+			t.Errorf("attempt from %s at %s: err = %v, want a lockout for %s", attempt.phoneNumber, attempt.clientIP, err, testGuardConfig.LockoutDuration)
+		}
+	}
+
+	// A success clears the failures of the phone number, not its lockout
+	if err := guard.RecordSuccess(ctx, "09120000001"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	if err := guard.Allow(ctx, "09120000001", ""); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("attempt after a success inside the lockout: err = %v, want a lockout", err)
+	}
+
+	now = now.Add(testGuardConfig.LockoutDuration)
+	if err := guard.Allow(ctx, "09120000001", "10.0.0.1"); err != nil {
+		t.Errorf("attempt once the lockout is over: %v", err)
+	}
+}
+
+func TestCreateChargeTransactionCountsGuessesOnly(t *testing.T) {
+	tests := []struct {
+		err      error
+		counted  bool
+		describe string
+	}{
+		{NotFoundError("charge code not found"), true, "missing charge code"},
+		{ErrChargeCodeUnavailable, true, "exhausted charge code"},
+		{ErrChargeCodeInactive, true, "paused charge code"},
+		{ErrChargeCodeAlreadyRedeemed, true, "already redeemed charge code"},
+		{ErrInvalidPhoneNumber, true, "invalid phone number"},
+		{ErrPhoneNumberRegistered, true, "registered phone number"},
+		{InternalError("database error", errors.New("connection refused")), false, "database error"},
+		{InternalError("database error", context.DeadlineExceeded), false, "timeout"},
+		{ErrTransactionDenied, false, "fraud denial"},
+		{&TransactionLimitError{Limit: "daily", Max: 100}, false, "transaction limit"},
+	}
+	for _, test := range tests {
+		t.Run(test.describe, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			store := newFakeAttemptStore()
+			metrics := NopBusinessMetrics{}
+			transactor := &fakeTransactor{err: test.err}
+			uc := NewTransactionUseCase(nil, transactor, newTestGuard(store, &now), nil, NewFraudEngine(nil, nil, transactor, FraudConfig{}, metrics), metrics)
+
+			_, err := uc.CreateChargeTransaction(context.Background(), &ChargeCodeTransaction{PhoneNumber: "09120000001", ChargeCodeID: 1}, &Actor{ClientIP: "10.0.0.1"})
+			if err != test.err {
+				t.Errorf("CreateChargeTransaction: err = %v, want %v", err, test.err)
+			}
+			if counted := store.failures["phone:09120000001"] == 1; counted != test.counted {
+				t.Errorf("failure counted = %v, want %v", counted, test.counted)
+			}
+		})
+	}
+}
+
+func TestCreateChargeTransactionGuardErrors(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	metrics := NopBusinessMetrics{}
+	ctx := context.Background()
+	redemption := &ChargeCodeTransaction{PhoneNumber: "09120000001", ChargeCodeID: 1}
+
+	// A failure to record a failure does not hide the redemption error
+	store := newFakeAttemptStore()
+	store.failureErr = errors.New("store unavailable")
+	transactor := &fakeTransactor{err: ErrChargeCodeUnavailable}
+	uc := NewTransactionUseCase(nil, transactor, newTestGuard(store, &now), nil, NewFraudEngine(nil, nil, transactor, FraudConfig{}, metrics), metrics)
+	if _, err := uc.CreateChargeTransaction(ctx, redemption, &Actor{}); err != ErrChargeCodeUnavailable {
+		t.Errorf("CreateChargeTransaction with a failing store: err = %v, want %v", err, ErrChargeCodeUnavailable)
+	}
+
+	// A committed redemption succeeds even if its failures cannot be cleared
+	store = newFakeAttemptStore()
+	store.resetErr = errors.New("store unavailable")
+	transactor = &fakeTransactor{}
+	uc = NewTransactionUseCase(nil, transactor, newTestGuard(store, &now), nil, NewFraudEngine(nil, nil, transactor, FraudConfig{}, metrics), metrics)
+	if _, err := uc.CreateChargeTransaction(ctx, redemption, &Actor{}); err != nil {
+		t.Errorf("CreateChargeTransaction with a failing store: %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+// internal/usecase/transaction_import.go
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// ImportModeAtomic applies every row or none of them
+	ImportModeAtomic = "atomic"
+	// ImportModeBestEffort applies the valid rows and skips the others
+	ImportModeBestEffort = "best_effort"
+)
+
+const (
+	ImportTypeCredit = "credit"
+	ImportTypeDebit  = "debit"
+)
+
+// Statuses of an import row. A valid row was not applied because the import
+// was a dry run or another row failed an atomic import. A skipped row has a
+// reference that was imported before, as TransactionID, and is not posted
+// again.
+const (
+	ImportRowApplied = "applied"
+	ImportRowValid   = "valid"
+	ImportRowSkipped = "skipped"
+	ImportRowFailed  = "failed"
+)
+
+// importColumns are the columns the CSV header has to name, in any order.
+var importColumns = []string{"phone", "amount", "type", "reference"}
+
+// importBatchSize is the number of rows a best effort import commits at a
+// time.
+const importBatchSize = 500
+
+// maxReferenceLength is the size of the transaction_import.reference column.
+const maxReferenceLength = 255
+
+var validPhoneNumber = regexp.MustCompile(`^09\d{9}$`)
+
+type TransactionImportOptions struct {
+	Mode string
+	// DryRun validates every row against the current balances and applies
+	// none
+	DryRun  bool
+	MaxRows int
+}
+
+// TransactionImportRow is the result of one row of an import. Line is the
+// line of the row in the file.
+type TransactionImportRow struct {
+	Line          int     `json:"line"`
+	PhoneNumber   string  `json:"phoneNumber"`
+	Type          string  `json:"type"`
+	Amount        float64 `json:"amount"`
+	Reference     string  `json:"reference"`
+	Status        string  `json:"status"`
+	TransactionID int     `json:"transaction_id,omitempty"`
+	Code          string  `json:"code,omitempty"`
+	Error         string  `json:"error,omitempty"`
+
+	// invalid is the error found while reading the row
+	invalid error
+}
+
+type TransactionImportReport struct {
+	Mode    string                  `json:"mode"`
+	DryRun  bool                    `json:"dry_run"`
+	Total   int                     `json:"total"`
+	Applied int                     `json:"applied"`
+	Skipped int                     `json:"skipped"`
+	Failed  int                     `json:"failed"`
+	Rows    []*TransactionImportRow `json:"rows"`
+}
+
+// ImportTransactions posts a batch of adjustments read as CSV from r. The
+// header names the columns phone, amount, type (credit or debit) and
+// reference; amounts are positive and the type gives their sign. Like
+// AdjustBalance, the rows skip the per-user limits and fraud rules, and each
+// is audited with its reference as the reason.
+//
+// Rows are posted in order as they are read, so each row is checked against
+// the amount range and the balance left by the rows before it. A best effort
+// import commits the rows that passed every importBatchSize rows. An atomic
+// import or a dry run posts the whole file in one database transaction,
+// committed only when every row of an atomic import passed.
+//
+// References are saved with the transactions they were posted as, and a row
+// whose reference was imported before is skipped, so an upload retried after
+// a timeout posts nothing twice. A failure the client cannot fix aborts the
+// import in both modes; the batches a best effort import committed before it
+// stay, and are skipped when the file is sent again.
+func (tu *TransactionUseCase) ImportTransactions(ctx context.Context, r io.Reader, options TransactionImportOptions, actor *Actor) (_ *TransactionImportReport, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.ImportTransactions")
+	defer endSpan(span, &err)
+
+	if options.Mode != ImportModeAtomic && options.Mode != ImportModeBestEffort {
+		return nil, ValidationError("import mode most be atomic or best_effort")
+	}
+
+	reader, err := newImportReader(r, options.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	report := &TransactionImportReport{Mode: options.Mode, DryRun: options.DryRun, Rows: []*TransactionImportRow{}}
+
+	if options.Mode == ImportModeBestEffort && !options.DryRun {
+		for {
+			rows, err := reader.readBatch()
+			if err != nil {
+				return nil, err
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			var created []*Transaction
+			err = tu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+				var postErr error
+				created, _, postErr = postImportRows(ctx, repos, rows, actor)
+				return postErr
+			})
+			if err != nil {
+				return nil, err
+			}
+			tu.addImportRows(report, rows, created)
+		}
+		return report, nil
+	}
+
+	// errRollback discards the posted rows without failing the import
+	errRollback := errors.New("import rolled back")
+	var (
+		rows    []*TransactionImportRow
+		created []*Transaction
+	)
+	err = tu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		failed := false
+		for {
+			batch, err := reader.readBatch()
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			batchCreated, batchFailed, err := postImportRows(ctx, repos, batch, actor)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, batch...)
+			created = append(created, batchCreated...)
+			failed = failed || batchFailed
+		}
+
+		if options.DryRun || (failed && options.Mode == ImportModeAtomic) {
+			return errRollback
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errRollback):
+		tu.addImportRows(report, rows, nil)
+	case err != nil:
+		return nil, err
+	default:
+		tu.addImportRows(report, rows, created)
+	}
+	return report, nil
+}
+
+// postImportRows posts rows in the database transaction of repos. It returns
+// the transactions created and whether a row failed.
+func postImportRows(ctx context.Context, repos *Repositories, rows []*TransactionImportRow, actor *Actor) ([]*Transaction, bool, error) {
+	var created []*Transaction
+	failed := false
+	for _, row := range rows {
+		row.Status = ImportRowValid
+		if err := validateImportRow(row); err != nil {
+			row.fail(err)
+			failed = true
+			continue
+		}
+
+		transactionID, err := repos.Transactions.GetImportedTransactionID(ctx, row.Reference)
+		switch {
+		case err == nil:
+			row.Status, row.TransactionID = ImportRowSkipped, transactionID
+			continue
+		case !errors.Is(err, ErrNotFound):
+			return nil, false, err
+		}
+
+		amount := row.Amount
+		if row.Type == ImportTypeDebit {
+			amount = -amount
+		}
+		transaction, err := repos.Transactions.CreateTransaction(ctx, &Transaction{PhoneNumber: row.PhoneNumber, Amount: amount})
+		var domainErr *Error
+		switch {
+		case errors.Is(err, ErrInsufficientFunds), errors.As(err, &domainErr) && !errors.Is(err, ErrInternal):
+			row.fail(err)
+			failed = true
+			continue
+		case err != nil:
+			return nil, false, err
+		}
+		row.TransactionID = transaction.TransactionID
+		created = append(created, transaction)
+
+		if err := repos.Transactions.CreateImportReference(ctx, row.Reference, transaction.TransactionID); err != nil {
+			return nil, false, err
+		}
+		if err := enqueueEvent(ctx, repos, EventTransactionCreated, userEventKey(transaction.PhoneNumber), transaction); err != nil {
+			return nil, false, err
+		}
+		adjustment := &BalanceAdjustment{PhoneNumber: row.PhoneNumber, Amount: amount, Reason: row.Reference, Transaction: transaction}
+		if err := writeAuditLog(ctx, repos, actor, AuditActionTransactionImport, AuditEntityTransaction, transaction.TransactionID, nil, adjustment); err != nil {
+			return nil, false, err
+		}
+	}
+	return created, failed, nil
+}
+
+// addImportRows adds the results of posted rows to report. created holds the
+// transactions of the rows when they were committed, and is nil when they
+// were rolled back.
+func (tu *TransactionUseCase) addImportRows(report *TransactionImportReport, rows []*TransactionImportRow, created []*Transaction) {
+	committed := created != nil
+	for _, row := range rows {
+		report.Total++
+		switch {
+		case row.Status == ImportRowFailed:
+			report.Failed++
+			if row.Code == CodeInsufficientFunds {
+				tu.Metrics.InsufficientFunds()
+			}
+		case row.Status == ImportRowSkipped:
+			report.Skipped++
+		case committed:
+			row.Status = ImportRowApplied
+			report.Applied++
+		default:
+			row.TransactionID = 0
+		}
+	}
+	report.Rows = append(report.Rows, rows...)
+
+	for _, transaction := range created {
+		tu.Metrics.TransactionCreated(transaction.Amount)
+	}
+}
+
+// importReader reads the rows of an import as they arrive. Rows whose fields
+// cannot be parsed are kept with their error; a missing column or a file
+// that is not CSV fails the import.
+type importReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+	maxRows int
+	rows    int
+	// lines is the line of every reference read so far
+	lines map[string]int
+}
+
+func newImportReader(r io.Reader, maxRows int) (*importReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	var parseErr *csv.ParseError
+	header, err := reader.Read()
+	switch {
+	case err == io.EOF:
+		return nil, ValidationError("the import file is empty")
+	case errors.As(err, &parseErr):
+		return nil, ValidationError("the import file is not valid CSV: " + err.Error())
+	case err != nil:
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		// Spreadsheets may start the file with a byte order mark
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range importColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, ValidationError(fmt.Sprintf("the import file has no %q column", name))
+		}
+	}
+	return &importReader{reader: reader, columns: columns, maxRows: maxRows, lines: map[string]int{}}, nil
+}
+
+// readBatch reads up to importBatchSize rows. It returns no rows at the end
+// of the file.
+func (ir *importReader) readBatch() ([]*TransactionImportRow, error) {
+	var rows []*TransactionImportRow
+	for len(rows) < importBatchSize {
+		row, err := ir.next()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+	if ir.rows == 0 {
+		return nil, ValidationError("the import file has no rows")
+	}
+	return rows, nil
+}
+
+// next reads the next row, or returns nil at the end of the file.
+func (ir *importReader) next() (*TransactionImportRow, error) {
+	record, err := ir.reader.Read()
+	var parseErr *csv.ParseError
+	switch {
+	case err == io.EOF:
+		return nil, nil
+	case errors.As(err, &parseErr):
+		return nil, ValidationError("the import file is not valid CSV: " + err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	if ir.maxRows > 0 && ir.rows == ir.maxRows {
+		return nil, LimitExceededError(fmt.Sprintf("the import file has more than %d rows", ir.maxRows))
+	}
+	ir.rows++
+	line, _ := ir.reader.FieldPos(0)
+	field := func(name string) string {
+		if i := ir.columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := &TransactionImportRow{
+		Line:        line,
+		PhoneNumber: field("phone"),
+		Type:        strings.ToLower(field("type")),
+		Reference:   field("reference"),
+	}
+	if amount := field("amount"); amount != "" {
+		if row.Amount, err = strconv.ParseFloat(amount, 64); err != nil || math.IsNaN(row.Amount) || math.IsInf(row.Amount, 0) {
+			row.Amount, row.invalid = 0, ValidationError("amount most be a number")
+		}
+	}
+
+	// A reference identifies one adjustment, so a repeated one is most
+	// likely a copy and paste mistake
+	if row.Reference != "" {
+		if first, ok := ir.lines[row.Reference]; ok {
+			if row.invalid == nil {
+				row.invalid = ValidationError(fmt.Sprintf("reference is already used on line %d", first))
+			}
+		} else {
+			ir.lines[row.Reference] = row.Line
+		}
+	}
+	return row, nil
+}
+
+// validateImportRow checks the format of row. The amount range and the
+// balance are checked when the row is posted.
+func validateImportRow(row *TransactionImportRow) error {
+	switch {
+	case row.invalid != nil:
+		return row.invalid
+	case !validPhoneNumber.MatchString(row.PhoneNumber):
+		return ErrInvalidPhoneNumber
+	case row.Type != ImportTypeCredit && row.Type != ImportTypeDebit:
+		return ValidationError("type most be credit or debit")
+	case row.Amount <= 0:
+		return ValidationError("amount most be bigger than zero")
+	case row.Reference == "":
+		return ValidationError("reference is required")
+	case utf8.RuneCountInString(row.Reference) > maxReferenceLength:
+		return ValidationError(fmt.Sprintf("reference most be at most %d characters", maxReferenceLength))
+	default:
+		return nil
+	}
+}
+
+// fail records the domain error err as the result of row.
+func (row *TransactionImportRow) fail(err error) {
+	row.Status, row.Code, row.Error = ImportRowFailed, CodeValidationFailed, err.Error()
+	var domainErr *Error
+	switch {
+	case errors.Is(err, ErrInsufficientFunds):
+		row.Code = CodeInsufficientFunds
+	case errors.As(err, &domainErr):
+		row.Code = domainErr.Code
+	}
+}
@@ -0,0 +1,227 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// importFile returns a CSV import file with the standard header and lines.
+func importFile(lines ...string) *strings.Reader {
+	return strings.NewReader("phone,amount,type,reference\n" + strings.Join(lines, "\n") + "\n")
+}
+
+func newTestImport() (*TransactionUseCase, *memoryStore) {
+	store := newMemoryStore()
+	store.addUser("09120000001", 100)
+	store.addUser("09120000002", 0)
+	return NewTransactionUseCase(nil, store, nil, nil, nil, NopBusinessMetrics{}), store
+}
+
+// rowStatuses returns the status of every row of report, with the error code
+// of failed rows.
+func rowStatuses(report *TransactionImportReport) []string {
+	statuses := []string{}
+	for _, row := range report.Rows {
+		status := row.Status
+		if row.Code != "" {
+			status += ":" + row.Code
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+func TestImportTransactionsRowErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		code  string
+		error string
+	}{
+		{"invalid phone number", []string{"0912,10,credit,R1"}, ErrInvalidPhoneNumber.Code, ErrInvalidPhoneNumber.Message},
+		{"unknown type", []string{"09120000001,10,refund,R1"}, CodeValidationFailed, "type most be credit or debit"},
+		{"amount that is not a number", []string{"09120000001,ten,credit,R1"}, CodeValidationFailed, "amount most be a number"},
+		{"zero amount", []string{"09120000001,0,credit,R1"}, CodeValidationFailed, "amount most be bigger than zero"},
+		{"negative amount", []string{"09120000001,-10,credit,R1"}, CodeValidationFailed, "amount most be bigger than zero"},
+		{"missing reference", []string{"09120000001,10,credit,"}, CodeValidationFailed, "reference is required"},
+		{"long reference", []string{"09120000001,10,credit," + strings.Repeat("r", maxReferenceLength+1)}, CodeValidationFailed, "reference most be at most 255 characters"},
+		{"short row", []string{"09120000001,10"}, CodeValidationFailed, "type most be credit or debit"},
+		{"repeated reference", []string{"09120000001,10,credit,R1", "09120000001,10,credit,R1"}, CodeValidationFailed, "reference is already used on line 2"},
+		{"amount out of range", []string{"09120000001,2000000,credit,R1"}, CodeValidationFailed, "amount is outside the valid range"},
+		{"unknown user", []string{"09129999999,10,credit,R1"}, CodeNotFound, "user not found"},
+		{"insufficient funds", []string{"09120000001,101,debit,R1"}, CodeInsufficientFunds, ErrInsufficientFunds.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, _ := newTestImport()
+			report, err := uc.ImportTransactions(context.Background(), importFile(test.lines...), TransactionImportOptions{Mode: ImportModeBestEffort}, &Actor{})
+			if err != nil {
+				t.Fatalf("ImportTransactions: %v", err)
+			}
+			row := report.Rows[len(report.Rows)-1]
+			if row.Status != ImportRowFailed || row.Code != test.code || row.Error != test.error {
+				t.Errorf("row = %s %s %q, want failed with %s %q", row.Status, row.Code, row.Error, test.code, test.error)
+			}
+			if row.Line != len(test.lines)+1 {
+				t.Errorf("row line = %d, want %d", row.Line, len(test.lines)+1)
+			}
+		})
+	}
+}
+
+func TestImportTransactionsFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		options TransactionImportOptions
+		kind    error
+		message string
+	}{
+		{"unknown mode", "phone,amount,type,reference\n", TransactionImportOptions{Mode: "partial"}, ErrValidation, "import mode most be atomic or best_effort"},
+		{"empty file", "", TransactionImportOptions{Mode: ImportModeAtomic}, ErrValidation, "the import file is empty"},
+		{"missing column", "phone,amount,type\n09120000001,10,credit\n", TransactionImportOptions{Mode: ImportModeAtomic}, ErrValidation, `the import file has no "reference" column`},
+		{"header only", "phone,amount,type,reference\n", TransactionImportOptions{Mode: ImportModeAtomic}, ErrValidation, "the import file has no rows"},
+		{"invalid CSV", "phone,amount,type,reference\n09120000001,\"10,credit,R1\n", TransactionImportOptions{Mode: ImportModeAtomic}, ErrValidation, ""},
+		{"too many rows", "phone,amount,type,reference\n09120000001,10,credit,R1\n09120000001,10,credit,R2\n", TransactionImportOptions{Mode: ImportModeBestEffort, MaxRows: 1}, ErrLimitExceeded, "the import file has more than 1 rows"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store := newTestImport()
+			_, err := uc.ImportTransactions(context.Background(), strings.NewReader(test.file), test.options, &Actor{})
+			if !errors.Is(err, test.kind) {
+				t.Fatalf("ImportTransactions: err = %v, want %v", err, test.kind)
+			}
+			if test.message != "" && err.Error() != test.message {
+				t.Errorf("ImportTransactions: err = %q, want %q", err, test.message)
+			}
+			if len(store.data.transactions) != 0 {
+				t.Errorf("%d transactions posted, want none", len(store.data.transactions))
+			}
+		})
+	}
+}
+
+func TestImportTransactionsModes(t *testing.T) {
+	// The debit on line 4 only fits after the credit on line 2
+	lines := []string{
+		"09120000002,50,credit,R1",
+		"09120000001,500,debit,R2",
+		"09120000002,30,debit,R3",
+	}
+	tests := []struct {
+		name     string
+		options  TransactionImportOptions
+		statuses []string
+		applied  int
+		balances []float64
+	}{
+		{"atomic", TransactionImportOptions{Mode: ImportModeAtomic}, []string{"valid", "failed:insufficient_funds", "valid"}, 0, []float64{100, 0}},
+		{"best effort", TransactionImportOptions{Mode: ImportModeBestEffort}, []string{"applied", "failed:insufficient_funds", "applied"}, 2, []float64{100, 20}},
+		{"atomic dry run", TransactionImportOptions{Mode: ImportModeAtomic, DryRun: true}, []string{"valid", "failed:insufficient_funds", "valid"}, 0, []float64{100, 0}},
+		{"best effort dry run", TransactionImportOptions{Mode: ImportModeBestEffort, DryRun: true}, []string{"valid", "failed:insufficient_funds", "valid"}, 0, []float64{100, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uc, store := newTestImport()
+			report, err := uc.ImportTransactions(context.Background(), importFile(lines...), test.options, &Actor{Name: "ops"})
+			if err != nil {
+				t.Fatalf("ImportTransactions: %v", err)
+			}
+
+			if statuses := rowStatuses(report); !reflect.DeepEqual(statuses, test.statuses) {
+				t.Errorf("rows = %v, want %v", statuses, test.statuses)
+			}
+			if report.Total != 3 || report.Applied != test.applied || report.Failed != 1 || report.Skipped != 0 {
+				t.Errorf("report = %d total, %d applied, %d failed, %d skipped, want 3, %d, 1, 0",
+					report.Total, report.Applied, report.Failed, report.Skipped, test.applied)
+			}
+			for i, row := range report.Rows {
+				if applied := row.Status == ImportRowApplied; applied != (row.TransactionID != 0) {
+					t.Errorf("row %d = %s with transaction %d, want a transaction only when applied", i, row.Status, row.TransactionID)
+				}
+			}
+
+			for i, balance := range test.balances {
+				if got := store.data.users[i+1].Balance; got != balance {
+					t.Errorf("balance of user %d = %v, want %v", i+1, got, balance)
+				}
+			}
+			// Every applied row is audited with its reference and published
+			if len(store.data.transactions) != test.applied || len(store.data.auditLogs) != test.applied || len(store.data.events) != test.applied ||
+				len(store.data.imports) != test.applied {
+				t.Errorf("%d transactions, %d audit logs, %d events and %d references saved, want %d of each",
+					len(store.data.transactions), len(store.data.auditLogs), len(store.data.events), len(store.data.imports), test.applied)
+			}
+			for _, auditLog := range store.data.auditLogs {
+				if auditLog.Action != AuditActionTransactionImport || auditLog.Actor != "ops" || !strings.Contains(string(auditLog.After), `"reason":"R`) {
+					t.Errorf("audit log = %s by %s with %s, want the import by ops with its reference", auditLog.Action, auditLog.Actor, auditLog.After)
+				}
+			}
+		})
+	}
+}
+
+func TestImportTransactionsSkipsImportedReferences(t *testing.T) {
+	uc, store := newTestImport()
+	ctx := context.Background()
+	options := TransactionImportOptions{Mode: ImportModeAtomic}
+
+	first, err := uc.ImportTransactions(ctx, importFile("09120000001,10,credit,R1", "09120000002,20,credit,R2"), options, &Actor{})
+	if err != nil {
+		t.Fatalf("ImportTransactions: %v", err)
+	}
+
+	// The client retries the same file, with a row added
+	retry, err := uc.ImportTransactions(ctx, importFile("09120000001,10,credit,R1", "09120000002,20,credit,R2", "09120000002,5,credit,R3"), options, &Actor{})
+	if err != nil {
+		t.Fatalf("ImportTransactions again: %v", err)
+	}
+	if statuses := rowStatuses(retry); !reflect.DeepEqual(statuses, []string{"skipped", "skipped", "applied"}) {
+		t.Errorf("rows = %v, want the imported ones skipped", statuses)
+	}
+	if retry.Applied != 1 || retry.Skipped != 2 || retry.Failed != 0 {
+		t.Errorf("report = %d applied, %d skipped, %d failed, want 1, 2, 0", retry.Applied, retry.Skipped, retry.Failed)
+	}
+	for i, row := range retry.Rows[:2] {
+		if row.TransactionID != first.Rows[i].TransactionID {
+			t.Errorf("skipped row %d names transaction %d, want the imported %d", i, row.TransactionID, first.Rows[i].TransactionID)
+		}
+	}
+	if balance := store.data.users[2].Balance; balance != 25 {
+		t.Errorf("balance = %v, want 25 with every reference posted once", balance)
+	}
+}
+
+func TestImportTransactionsBatches(t *testing.T) {
+	lines := make([]string, importBatchSize+1)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("09120000002,1,credit,R%d", i)
+	}
+	tests := []struct {
+		mode         string
+		transactions int
+	}{
+		// A best effort import commits as it goes
+		{ImportModeBestEffort, 2},
+		{ImportModeAtomic, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			uc, store := newTestImport()
+			report, err := uc.ImportTransactions(context.Background(), importFile(lines...), TransactionImportOptions{Mode: test.mode}, &Actor{})
+			if err != nil {
+				t.Fatalf("ImportTransactions: %v", err)
+			}
+			if report.Applied != len(lines) || len(report.Rows) != len(lines) {
+				t.Errorf("%d of %d rows applied, want all %d", report.Applied, len(report.Rows), len(lines))
+			}
+			if store.transactions != test.transactions {
+				t.Errorf("%d database transactions, want %d", store.transactions, test.transactions)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+// internal/usecase/transaction_limiter.go
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Windows of the transaction limits. They are rolling: a transaction counts
+// towards a limit until one window length after it was made.
+const (
+	DailyLimitWindow   = 24 * time.Hour
+	MonthlyLimitWindow = 30 * 24 * time.Hour
+)
+
+// Names of the transaction limits.
+const (
+	LimitDailyDebit    = "daily_debit"
+	LimitDailyCredit   = "daily_credit"
+	LimitDailyCount    = "daily_count"
+	LimitMonthlyDebit  = "monthly_debit"
+	LimitMonthlyCredit = "monthly_credit"
+	LimitMonthlyCount  = "monthly_count"
+)
+
+// TransactionLimits caps the transactions of one user. Debits are the total
+// of the negative amounts, credits the total of the positive ones and counts
+// the number of transactions. Zero means no limit.
+type TransactionLimits struct {
+	DailyDebit    float64 `json:"daily_debit"`
+	DailyCredit   float64 `json:"daily_credit"`
+	DailyCount    int     `json:"daily_count"`
+	MonthlyDebit  float64 `json:"monthly_debit"`
+	MonthlyCredit float64 `json:"monthly_credit"`
+	MonthlyCount  int     `json:"monthly_count"`
+}
+
+// TransactionLimitOverrides replaces some of the default limits for one user.
+// A nil field keeps the default.
+type TransactionLimitOverrides struct {
+	DailyDebit    *float64 `json:"daily_debit,omitempty" binding:"omitempty,gte=0"`
+	DailyCredit   *float64 `json:"daily_credit,omitempty" binding:"omitempty,gte=0"`
+	DailyCount    *int     `json:"daily_count,omitempty" binding:"omitempty,gte=0"`
+	MonthlyDebit  *float64 `json:"monthly_debit,omitempty" binding:"omitempty,gte=0"`
+	MonthlyCredit *float64 `json:"monthly_credit,omitempty" binding:"omitempty,gte=0"`
+	MonthlyCount  *int     `json:"monthly_count,omitempty" binding:"omitempty,gte=0"`
+}
+
+// apply returns limits with the overridden fields replaced.
+func (o *TransactionLimitOverrides) apply(limits TransactionLimits) TransactionLimits {
+	if o.DailyDebit != nil {
+		limits.DailyDebit = *o.DailyDebit
+	}
+	if o.DailyCredit != nil {
+		limits.DailyCredit = *o.DailyCredit
+	}
+	if o.DailyCount != nil {
+		limits.DailyCount = *o.DailyCount
+	}
+	if o.MonthlyDebit != nil {
+		limits.MonthlyDebit = *o.MonthlyDebit
+	}
+	if o.MonthlyCredit != nil {
+		limits.MonthlyCredit = *o.MonthlyCredit
+	}
+	if o.MonthlyCount != nil {
+		limits.MonthlyCount = *o.MonthlyCount
+	}
+	return limits
+}
+
+// TransactionActivity is a transaction as counted by the limits.
+type TransactionActivity struct {
+	Amount    float64
+	Timestamp time.Time
+}
+
+// LimitUsage is how much of one limit a user has used. ResetsAt is when the
+// oldest counted transaction leaves the window, nil when nothing is counted.
+type LimitUsage struct {
+	Limit    string     `json:"limit"`
+	Max      float64    `json:"max"`
+	Used     float64    `json:"used"`
+	ResetsAt *time.Time `json:"resets_at,omitempty"`
+}
+
+// UserTransactionLimits reports the limits of one user and their usage.
+type UserTransactionLimits struct {
+	UserID    int                       `json:"user_id"`
+	Overrides TransactionLimitOverrides `json:"overrides"`
+	Effective TransactionLimits         `json:"effective"`
+	Usage     []*LimitUsage             `json:"usage"`
+}
+
+type TransactionLimitRepository interface {
+	// LockUser locks the user until the database transaction ends, so that
+	// the transactions of one user are checked against the limits one at a
+	// time.
+	LockUser(ctx context.Context, userID int) error
+	// GetActivity returns the transactions of the user made after since,
+	// oldest first, including those committed after the database transaction
+	// started.
+	GetActivity(ctx context.Context, userID int, since time.Time) ([]*TransactionActivity, error)
+	// GetOverrides returns empty overrides when the user has none.
+	GetOverrides(ctx context.Context, userID int) (*TransactionLimitOverrides, error)
+	SetOverrides(ctx context.Context, userID int, overrides *TransactionLimitOverrides) error
+	DeleteOverrides(ctx context.Context, userID int) error
+}
+
+// TransactionLimitError is returned when a transaction would exceed one of
+// the limits of its user. ResetsAt is the earliest time the same transaction
+// fits the limit again; it is zero when the transaction exceeds the limit on
+// its own.
+type TransactionLimitError struct {
+	Limit    string
+	Max      float64
+	ResetsAt time.Time
+}
+
+func (e *TransactionLimitError) Error() string {
+	name := strings.ReplaceAll(e.Limit, "_", " ")
+	if e.ResetsAt.IsZero() {
+		return fmt.Sprintf("transaction exceeds the %s limit of %s on its own", name, formatLimit(e.Max))
+	}
+	return fmt.Sprintf("%s limit of %s reached, it resets at %s", name, formatLimit(e.Max), e.ResetsAt.UTC().Format(time.RFC3339))
+}
+
+func (e *TransactionLimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+func formatLimit(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// limitRule describes one limit: which setting caps it, over which window,
+// and how much a transaction of amount uses of it.
+type limitRule struct {
+	name   string
+	window time.Duration
+	max    func(limits *TransactionLimits) float64
+	uses   func(amount float64) float64
+}
+
+func debit(amount float64) float64 {
+	return math.Max(-amount, 0)
+}
+
+func credit(amount float64) float64 {
+	return math.Max(amount, 0)
+}
+
+func count(amount float64) float64 {
+	return 1
+}
+
+var limitRules = []limitRule{
+	{LimitDailyDebit, DailyLimitWindow, func(l *TransactionLimits) float64 { return l.DailyDebit }, debit},
+	{LimitDailyCredit, DailyLimitWindow, func(l *TransactionLimits) float64 { return l.DailyCredit }, credit},
+	{LimitDailyCount, DailyLimitWindow, func(l *TransactionLimits) float64 { return float64(l.DailyCount) }, count},
+	{LimitMonthlyDebit, MonthlyLimitWindow, func(l *TransactionLimits) float64 { return l.MonthlyDebit }, debit},
+	{LimitMonthlyCredit, MonthlyLimitWindow, func(l *TransactionLimits) float64 { return l.MonthlyCredit }, credit},
+	{LimitMonthlyCount, MonthlyLimitWindow, func(l *TransactionLimits) float64 { return float64(l.MonthlyCount) }, count},
+}
+
+// counted returns the activity that r counts at now.
+func (r *limitRule) counted(activity []*TransactionActivity, now time.Time) ([]*TransactionActivity, float64) {
+	since := now.Add(-r.window)
+	var (
+		entries []*TransactionActivity
+		used    float64
+	)
+	for _, entry := range activity {
+		if entry.Timestamp.After(since) && r.uses(entry.Amount) > 0 {
+			entries = append(entries, entry)
+			used += r.uses(entry.Amount)
+		}
+	}
+	return entries, used
+}
+
+// cents rounds an amount so that sums of DECIMAL(10, 2) values compare
+// exactly.
+func cents(value float64) int64 {
+	return int64(math.Round(value * 100))
+}
+
+// checkLimits checks activity, whose last entry is the transaction being
+// made, against limits. activity must not be empty.
+func checkLimits(limits *TransactionLimits, activity []*TransactionActivity, now time.Time) error {
+	latest := activity[len(activity)-1]
+	for i := range limitRules {
+		rule := &limitRules[i]
+		limit := rule.max(limits)
+		// A limit only rejects the transactions that count towards it, so a
+		// credit is not rejected because of past debits
+		if limit <= 0 || rule.uses(latest.Amount) == 0 {
+			continue
+		}
+
+		entries, used := rule.counted(activity, now)
+		if cents(used) <= cents(limit) {
+			continue
+		}
+
+		// The transaction fits once enough of the older ones have left
+		// the window
+		limitErr := &TransactionLimitError{Limit: rule.name, Max: limit}
+		excess := used - limit
+		for _, entry := range entries[:len(entries)-1] {
+			excess -= rule.uses(entry.Amount)
+			if cents(excess) <= 0 {
+				limitErr.ResetsAt = entry.Timestamp.Add(rule.window)
+				break
+			}
+		}
+		return limitErr
+	}
+	return nil
+}
+
+// limitUsage reports the usage of every limit at now.
+func limitUsage(limits *TransactionLimits, activity []*TransactionActivity, now time.Time) []*LimitUsage {
+	usage := make([]*LimitUsage, 0, len(limitRules))
+	for i := range limitRules {
+		rule := &limitRules[i]
+		entries, used := rule.counted(activity, now)
+		limitUsage := &LimitUsage{Limit: rule.name, Max: rule.max(limits), Used: float64(cents(used)) / 100}
+		if len(entries) > 0 {
+			resetsAt := entries[0].Timestamp.Add(rule.window)
+			limitUsage.ResetsAt = &resetsAt
+		}
+		usage = append(usage, limitUsage)
+	}
+	return usage
+}
+
+// TransactionLimiter enforces rolling daily and monthly limits on the
+// transactions of every user. Defaults returns the limits of users without
+// overrides; it is called for every check so the defaults can change while
+// the server runs.
+type TransactionLimiter struct {
+	Transactor Transactor
+	Defaults   func() TransactionLimits
+	now        func() time.Time
+}
+
+func NewTransactionLimiter(transactor Transactor, defaults func() TransactionLimits) *TransactionLimiter {
+	return &TransactionLimiter{Transactor: transactor, Defaults: defaults, now: time.Now}
+}
+
+// Reserve checks that a transaction of amount by the user stays within the
+// user's limits. It must run in the database transaction that creates the
+// transaction, before creating it, and holds a lock on the user until that
+// database transaction ends.
+func (tl *TransactionLimiter) Reserve(ctx context.Context, repos *Repositories, userID int, amount float64) error {
+	now := tl.now()
+	limits, activity, err := tl.load(ctx, repos, userID, now)
+	if err != nil {
+		return err
+	}
+
+	activity = append(activity, &TransactionActivity{Amount: amount, Timestamp: now})
+	return checkLimits(limits, activity, now)
+}
+
+// Verify checks the limits of the user after the newest transaction of the
+// user was created in the current database transaction. It is used where the
+// user and the transaction are created together, so there is nothing to lock
+// beforehand.
+func (tl *TransactionLimiter) Verify(ctx context.Context, repos *Repositories, userID int) error {
+	now := tl.now()
+	limits, activity, err := tl.load(ctx, repos, userID, now)
+	if err != nil {
+		return err
+	}
+	if len(activity) == 0 {
+		return nil
+	}
+	return checkLimits(limits, activity, now)
+}
+
+// load locks the user and reads the user's limits and the activity of the
+// longest window.
+func (tl *TransactionLimiter) load(ctx context.Context, repos *Repositories, userID int, now time.Time) (*TransactionLimits, []*TransactionActivity, error) {
+	if err := repos.TransactionLimits.LockUser(ctx, userID); err != nil {
+		return nil, nil, err
+	}
+
+	overrides, err := repos.TransactionLimits.GetOverrides(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	limits := overrides.apply(tl.Defaults())
+
+	activity, err := repos.TransactionLimits.GetActivity(ctx, userID, now.Add(-MonthlyLimitWindow))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &limits, activity, nil
+}
+
+func (tl *TransactionLimiter) GetUserLimits(ctx context.Context, userID int) (_ *UserTransactionLimits, err error) {
+	ctx, span := startSpan(ctx, "TransactionLimiter.GetUserLimits")
+	defer endSpan(span, &err)
+
+	var report *UserTransactionLimits
+	err = tl.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		var err error
+		report, err = tl.report(ctx, repos, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// SetUserLimits replaces the overrides of the user.
+func (tl *TransactionLimiter) SetUserLimits(ctx context.Context, userID int, overrides *TransactionLimitOverrides, actor *Actor) (_ *UserTransactionLimits, err error) {
+	ctx, span := startSpan(ctx, "TransactionLimiter.SetUserLimits")
+	defer endSpan(span, &err)
+
+	var report *UserTransactionLimits
+	err = tl.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := tl.report(ctx, repos, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.TransactionLimits.SetOverrides(ctx, userID, overrides); err != nil {
+			return err
+		}
+
+		report, err = tl.report(ctx, repos, userID)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionUserLimitsUpdate, AuditEntityUser, userID, before.Overrides, report.Overrides)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// DeleteUserLimits removes the overrides of the user, so the defaults apply.
+func (tl *TransactionLimiter) DeleteUserLimits(ctx context.Context, userID int, actor *Actor) (err error) {
+	ctx, span := startSpan(ctx, "TransactionLimiter.DeleteUserLimits")
+	defer endSpan(span, &err)
+
+	return tl.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := tl.report(ctx, repos, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := repos.TransactionLimits.DeleteOverrides(ctx, userID); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionUserLimitsDelete, AuditEntityUser, userID, before.Overrides, nil)
+	})
+}
+
+func (tl *TransactionLimiter) report(ctx context.Context, repos *Repositories, userID int) (*UserTransactionLimits, error) {
+	if _, err := repos.Users.GetUserByID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	now := tl.now()
+	overrides, err := repos.TransactionLimits.GetOverrides(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	limits := overrides.apply(tl.Defaults())
+
+	activity, err := repos.TransactionLimits.GetActivity(ctx, userID, now.Add(-MonthlyLimitWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserTransactionLimits{
+		UserID:    userID,
+		Overrides: *overrides,
+		Effective: limits,
+		Usage:     limitUsage(&limits, activity, now),
+	}, nil
+}
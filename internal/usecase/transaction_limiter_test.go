@@ -0,0 +1,146 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var limiterNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// activityAt returns past, oldest first like GetActivity returns it,
+// followed by the transaction of amount being made at limiterNow.
+func activityAt(amount float64, past ...TransactionActivity) []*TransactionActivity {
+	activity := []*TransactionActivity{}
+	for i := range past {
+		activity = append(activity, &past[i])
+	}
+	return append(activity, &TransactionActivity{Amount: amount, Timestamp: limiterNow})
+}
+
+// ago returns a transaction of amount made d before limiterNow.
+func ago(amount float64, d time.Duration) TransactionActivity {
+	return TransactionActivity{Amount: amount, Timestamp: limiterNow.Add(-d)}
+}
+
+func TestCheckLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   TransactionLimits
+		activity []*TransactionActivity
+		limit    string
+		resetsAt time.Time
+	}{
+		{"up to the limit", TransactionLimits{DailyDebit: 100},
+			activityAt(-40, ago(-60, time.Hour)), "", time.Time{}},
+		{"over the limit", TransactionLimits{DailyDebit: 100},
+			activityAt(-20, ago(-60, 2*time.Hour), ago(-30, time.Hour)), LimitDailyDebit, limiterNow.Add(22 * time.Hour)},
+		{"two transactions have to leave", TransactionLimits{DailyDebit: 60},
+			activityAt(-30, ago(-50, 3*time.Hour), ago(-40, 2*time.Hour)), LimitDailyDebit, limiterNow.Add(22 * time.Hour)},
+		{"over the limit on its own", TransactionLimits{DailyDebit: 100},
+			activityAt(-150), LimitDailyDebit, time.Time{}},
+		{"credit after debits", TransactionLimits{DailyDebit: 100},
+			activityAt(50, ago(-100, time.Hour)), "", time.Time{}},
+		{"credits", TransactionLimits{DailyCredit: 100},
+			activityAt(50, ago(60, time.Hour)), LimitDailyCredit, limiterNow.Add(23 * time.Hour)},
+		{"count", TransactionLimits{DailyCount: 2},
+			activityAt(10, ago(-10, 2*time.Hour), ago(10, time.Hour)), LimitDailyCount, limiterNow.Add(22 * time.Hour)},
+		{"no limit", TransactionLimits{},
+			activityAt(-1000, ago(-1000, time.Hour)), "", time.Time{}},
+		{"a window old", TransactionLimits{DailyDebit: 100},
+			activityAt(-50, ago(-100, DailyLimitWindow)), "", time.Time{}},
+		{"just inside the window", TransactionLimits{DailyDebit: 100},
+			activityAt(-50, ago(-100, DailyLimitWindow-time.Nanosecond)), LimitDailyDebit, limiterNow.Add(time.Nanosecond)},
+		{"monthly after the daily window", TransactionLimits{DailyDebit: 100, MonthlyDebit: 100},
+			activityAt(-50, ago(-100, 2*DailyLimitWindow)), LimitMonthlyDebit, limiterNow.Add(MonthlyLimitWindow - 2*DailyLimitWindow)},
+		{"sums in cents", TransactionLimits{DailyDebit: 0.3},
+			activityAt(-0.2, ago(-0.1, time.Hour)), "", time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkLimits(&test.limits, test.activity, limiterNow)
+			if test.limit == "" {
+				if err != nil {
+					t.Fatalf("checkLimits: %v, want no error", err)
+				}
+				return
+			}
+
+			var limitErr *TransactionLimitError
+			if !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("checkLimits: err = %v, want the %s limit", err, test.limit)
+			}
+			if limitErr.Limit != test.limit || !limitErr.ResetsAt.Equal(test.resetsAt) {
+				t.Errorf("checkLimits = %s resetting at %s, want %s resetting at %s", limitErr.Limit, limitErr.ResetsAt, test.limit, test.resetsAt)
+			}
+		})
+	}
+}
+
+// The same transaction fits at ResetsAt and not a moment before.
+func TestCheckLimitsResetsAt(t *testing.T) {
+	past := []TransactionActivity{ago(-5, 10*DailyLimitWindow), ago(-60, 5*time.Hour), ago(-30, time.Hour)}
+	for _, limits := range []*TransactionLimits{{DailyDebit: 100}, {MonthlyCount: 3}} {
+		var limitErr *TransactionLimitError
+		if err := checkLimits(limits, activityAt(-20, past...), limiterNow); !errors.As(err, &limitErr) {
+			t.Fatalf("checkLimits: err = %v, want a limit error", err)
+		}
+		for _, test := range []struct {
+			at   time.Time
+			fits bool
+		}{
+			{limitErr.ResetsAt.Add(-time.Nanosecond), false},
+			{limitErr.ResetsAt, true},
+		} {
+			activity := activityAt(-20, past...)
+			activity[len(activity)-1].Timestamp = test.at
+			err := checkLimits(limits, activity, test.at)
+			if fits := err == nil; fits != test.fits {
+				t.Errorf("%s at %s: err = %v, want fits %v", limitErr.Limit, test.at, err, test.fits)
+			}
+		}
+	}
+}
+
+func TestLimitUsage(t *testing.T) {
+	limits := &TransactionLimits{DailyDebit: 100, MonthlyCredit: 500}
+	activity := []*TransactionActivity{
+		{Amount: 200, Timestamp: limiterNow.Add(-3 * DailyLimitWindow)},
+		{Amount: -30.5, Timestamp: limiterNow.Add(-2 * time.Hour)},
+		{Amount: -10.25, Timestamp: limiterNow.Add(-time.Hour)},
+	}
+
+	usage := map[string]*LimitUsage{}
+	for _, limitUsage := range limitUsage(limits, activity, limiterNow) {
+		usage[limitUsage.Limit] = limitUsage
+	}
+	if len(usage) != len(limitRules) {
+		t.Fatalf("limitUsage reports %d limits, want all %d", len(usage), len(limitRules))
+	}
+
+	tests := []struct {
+		limit    string
+		max      float64
+		used     float64
+		resetsAt *time.Time
+	}{
+		{LimitDailyDebit, 100, 40.75, timeRef(limiterNow.Add(22 * time.Hour))},
+		{LimitDailyCredit, 0, 0, nil},
+		{LimitDailyCount, 0, 2, timeRef(limiterNow.Add(22 * time.Hour))},
+		{LimitMonthlyCredit, 500, 200, timeRef(limiterNow.Add(MonthlyLimitWindow - 3*DailyLimitWindow))},
+		{LimitMonthlyCount, 0, 3, timeRef(limiterNow.Add(MonthlyLimitWindow - 3*DailyLimitWindow))},
+	}
+	for _, test := range tests {
+		got := usage[test.limit]
+		if got.Max != test.max || got.Used != test.used {
+			t.Errorf("%s = %v of %v, want %v of %v", test.limit, got.Used, got.Max, test.used, test.max)
+		}
+		if (got.ResetsAt == nil) != (test.resetsAt == nil) || (got.ResetsAt != nil && !got.ResetsAt.Equal(*test.resetsAt)) {
+			t.Errorf("%s resets at %v, want %v", test.limit, got.ResetsAt, test.resetsAt)
+		}
+	}
+}
+
+func timeRef(t time.Time) *time.Time {
+	return &t
+}
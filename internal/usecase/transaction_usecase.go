@@ -1,6 +1,11 @@
 package usecase
 
-import "time"
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
 
 type Transaction struct {
 	TransactionID int       `json:"transaction_id"`
@@ -16,43 +21,281 @@ type ChargeCodeTransaction struct {
 	Timestamp     time.Time `json:"timestamp"`
 }
 
+// BalanceAdjustment is a manual correction of a user's balance by an
+// operator. The reason is kept in the audit log.
+type BalanceAdjustment struct {
+	PhoneNumber string       `json:"phoneNumber"`
+	Amount      float64      `json:"amount"`
+	Reason      string       `json:"reason"`
+	Transaction *Transaction `json:"transaction,omitempty"`
+}
+
 type TransactionRepository interface {
-	CreateTransaction(transaction *Transaction) (*Transaction, error)
-	CreateChargeTransaction(chargeCodeTransaction *ChargeCodeTransaction) (*ChargeCodeTransaction, error)
-	GetTransactions(page int, pageSize int) ([]*Transaction, error)
-	GetTransactionByID(id int) (*Transaction, error)
-	GetUserTransactionsByUserID(userId int, page int, pageSize int) ([]*Transaction, error)
-	GetUserTotalTransaction(userId int) (int, error)
+	CreateTransaction(ctx context.Context, transaction *Transaction) (*Transaction, error)
+	CreateChargeTransaction(ctx context.Context, chargeCodeTransaction *ChargeCodeTransaction) (*ChargeCodeTransaction, error)
+	GetTransactions(ctx context.Context, page int, pageSize int) ([]*Transaction, error)
+	GetTransactionByID(ctx context.Context, id int) (*Transaction, error)
+	GetUserTransactionsByUserID(ctx context.Context, userId int, page int, pageSize int) ([]*Transaction, error)
+	GetUserTotalTransaction(ctx context.Context, userId int) (int, error)
+	// GetImportedTransactionID returns the transaction an import reference
+	// was posted as, or a not found error.
+	GetImportedTransactionID(ctx context.Context, reference string) (int, error)
+	// CreateImportReference records reference as posted as the transaction.
+	// It returns a conflict error when another import holds the reference.
+	CreateImportReference(ctx context.Context, reference string, transactionID int) error
 }
 
 type TransactionUseCase struct {
 	TransactionRepository TransactionRepository
+	Transactor            Transactor
+	RedemptionGuard       *RedemptionGuard
+	Limiter               *TransactionLimiter
+	Fraud                 *FraudEngine
+	Metrics               BusinessMetrics
+}
+
+func NewTransactionUseCase(transactionRepo TransactionRepository, transactor Transactor, redemptionGuard *RedemptionGuard, limiter *TransactionLimiter, fraud *FraudEngine, metrics BusinessMetrics) *TransactionUseCase {
+	return &TransactionUseCase{TransactionRepository: transactionRepo, Transactor: transactor, RedemptionGuard: redemptionGuard, Limiter: limiter, Fraud: fraud, Metrics: metrics}
+}
+
+func (tu *TransactionUseCase) CreateTransaction(ctx context.Context, transaction *Transaction, actor *Actor) (_ *Transaction, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.CreateTransaction")
+	defer endSpan(span, &err)
+
+	var (
+		created  *Transaction
+		decision *FraudDecision
+	)
+	err = tu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		user, err := repos.Users.GetUserByPhoneNumber(ctx, transaction.PhoneNumber)
+		if err != nil {
+			return err
+		}
+
+		if err := tu.Limiter.Reserve(ctx, repos, user.ID, transaction.Amount); err != nil {
+			return err
+		}
+
+		created, err = repos.Transactions.CreateTransaction(ctx, transaction)
+		if err != nil {
+			return err
+		}
+
+		decision, err = tu.Fraud.Evaluate(ctx, repos.Fraud, &FraudCheck{
+			Kind:        FraudKindTransaction,
+			UserID:      user.ID,
+			PhoneNumber: created.PhoneNumber,
+			Amount:      created.Amount,
+			ClientIP:    actor.ClientIP,
+		}, actor)
+		if err != nil {
+			return err
+		}
+		if decision.Action == FraudActionDeny {
+			return ErrTransactionDenied
+		}
+		decision.EntityID = created.TransactionID
+
+		if err := enqueueEvent(ctx, repos, EventTransactionCreated, userEventKey(created.PhoneNumber), created); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionTransactionCreate, AuditEntityTransaction, created.TransactionID, nil, created)
+	})
+	tu.Fraud.recordOutcome(ctx, decision, err)
+	if err != nil {
+		if errors.Is(err, ErrInsufficientFunds) {
+			tu.Metrics.InsufficientFunds()
+		}
+		return nil, err
+	}
+
+	tu.Metrics.TransactionCreated(created.Amount)
+	return created, nil
+}
+
+// AdjustBalance posts a manual adjustment as a transaction. Unlike
+// CreateTransaction it skips the per-user limits and fraud rules; the amount
+// range still applies and the balance cannot go negative.
+func (tu *TransactionUseCase) AdjustBalance(ctx context.Context, adjustment *BalanceAdjustment, actor *Actor) (_ *BalanceAdjustment, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.AdjustBalance")
+	defer endSpan(span, &err)
+
+	if adjustment.Amount == 0 {
+		return nil, ValidationError("adjustment amount most not be zero")
+	}
+	if adjustment.Reason == "" {
+		return nil, ValidationError("adjustment reason is required")
+	}
+
+	err = tu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		created, err := repos.Transactions.CreateTransaction(ctx, &Transaction{PhoneNumber: adjustment.PhoneNumber, Amount: adjustment.Amount})
+		if err != nil {
+			return err
+		}
+		adjustment.Transaction = created
+
+		if err := enqueueEvent(ctx, repos, EventTransactionCreated, userEventKey(created.PhoneNumber), created); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionTransactionAdjust, AuditEntityTransaction, created.TransactionID, nil, adjustment)
+	})
+	if err != nil {
+		if errors.Is(err, ErrInsufficientFunds) {
+			tu.Metrics.InsufficientFunds()
+		}
+		return nil, err
+	}
+
+	tu.Metrics.TransactionCreated(adjustment.Amount)
+	return adjustment, nil
 }
 
-func NewTransactionUseCase(transactionRepo TransactionRepository) *TransactionUseCase {
-	return &TransactionUseCase{TransactionRepository: transactionRepo}
+func (tu *TransactionUseCase) CreateChargeTransaction(ctx context.Context, chargeCodeTransaction *ChargeCodeTransaction, actor *Actor) (_ *ChargeCodeTransaction, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.CreateChargeTransaction")
+	defer endSpan(span, &err)
+
+	if err := tu.RedemptionGuard.Allow(ctx, chargeCodeTransaction.PhoneNumber, actor.ClientIP); err != nil {
+		tu.Metrics.RedemptionFailed(redemptionFailureReason(err))
+		return nil, err
+	}
+
+	var (
+		created  *ChargeCodeTransaction
+		decision *FraudDecision
+	)
+	err = tu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.ChargeCodes.GetChargeCodeByID(ctx, chargeCodeTransaction.ChargeCodeID)
+		if err != nil {
+			return err
+		}
+
+		created, err = repos.Transactions.CreateChargeTransaction(ctx, chargeCodeTransaction)
+		if err != nil {
+			return err
+		}
+
+		after, err := repos.ChargeCodes.GetChargeCodeByID(ctx, chargeCodeTransaction.ChargeCodeID)
+		if err != nil {
+			return err
+		}
+
+		user, err := repos.Users.GetUserByPhoneNumber(ctx, chargeCodeTransaction.PhoneNumber)
+		if err != nil {
+			return err
+		}
+
+		// The redemption creates the user, so its limits can only be
+		// checked once the credit is in place
+		if err := tu.Limiter.Verify(ctx, repos, user.ID); err != nil {
+			return err
+		}
+
+		decision, err = tu.Fraud.Evaluate(ctx, repos.Fraud, &FraudCheck{
+			Kind:         FraudKindRedemption,
+			UserID:       user.ID,
+			PhoneNumber:  user.PhoneNumber,
+			Amount:       after.Amount,
+			ChargeCodeID: chargeCodeTransaction.ChargeCodeID,
+			ClientIP:     actor.ClientIP,
+		}, actor)
+		if err != nil {
+			return err
+		}
+		if decision.Action == FraudActionDeny {
+			return ErrTransactionDenied
+		}
+		decision.EntityID = chargeCodeTransaction.ChargeCodeID
+
+		if err := enqueueRedemptionEvents(ctx, repos, user, after); err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionChargeCodeRedeem, AuditEntityChargeCode, chargeCodeTransaction.ChargeCodeID, before, after)
+	})
+	tu.Fraud.recordOutcome(ctx, decision, err)
+	if err != nil {
+		tu.Metrics.RedemptionFailed(redemptionFailureReason(err))
+		// A failure still counts when the client disconnects or the request
+		// times out, otherwise aborting requests would evade the lockout.
+		// Not counting it is safer than hiding err behind a guard error.
+		if countsAsRedemptionFailure(err) {
+			if guardErr := tu.RedemptionGuard.RecordFailure(context.WithoutCancel(ctx), chargeCodeTransaction.PhoneNumber, actor.ClientIP); guardErr != nil {
+				slog.ErrorContext(ctx, "error recording failed redemption", "error", guardErr)
+			}
+		}
+		return nil, err
+	}
+
+	tu.Metrics.ChargeCodeRedeemed(chargeCodeTransaction.ChargeCodeID)
+
+	// The redemption is committed, so it succeeded even if its failures
+	// cannot be cleared
+	if err := tu.RedemptionGuard.RecordSuccess(context.WithoutCancel(ctx), chargeCodeTransaction.PhoneNumber); err != nil {
+		slog.ErrorContext(ctx, "error recording successful redemption", "error", err)
+	}
+	return created, nil
 }
 
-func (tu *TransactionUseCase) CreateTransaction(transaction *Transaction) (*Transaction, error) {
-	return tu.TransactionRepository.CreateTransaction(transaction)
+// enqueueRedemptionEvents writes the events of a redemption to the outbox.
+// chargeCode is the charge code after the redemption.
+func enqueueRedemptionEvents(ctx context.Context, repos *Repositories, user *User, chargeCode *ChargeCode) error {
+	// Redeeming a charge code always registers a new user
+	if err := enqueueEvent(ctx, repos, EventUserCreated, userEventKey(user.PhoneNumber), user); err != nil {
+		return err
+	}
+
+	redemption := &ChargeCodeRedemption{
+		ChargeCodeID: chargeCode.ChargeCodeID,
+		Code:         chargeCode.Code,
+		UserID:       user.ID,
+		PhoneNumber:  user.PhoneNumber,
+		Amount:       chargeCode.Amount,
+		CurrentUses:  chargeCode.CurrentUses,
+		MaxUses:      chargeCode.MaxUses,
+	}
+	if err := enqueueEvent(ctx, repos, EventChargeCodeRedeemed, userEventKey(user.PhoneNumber), redemption); err != nil {
+		return err
+	}
+
+	if chargeCode.CurrentUses >= chargeCode.MaxUses {
+		return enqueueEvent(ctx, repos, EventChargeCodeExhausted, chargeCodeEventKey(chargeCode.ChargeCodeID), redemption)
+	}
+	return nil
 }
 
-func (tu *TransactionUseCase) CreateChargeTransaction(chargeCodeTransaction *ChargeCodeTransaction) (*ChargeCodeTransaction, error) {
-	return tu.TransactionRepository.CreateChargeTransaction(chargeCodeTransaction)
+func (tu *TransactionUseCase) GetRedemptionFailureStats(ctx context.Context, page int, pageSize int) (_ []*RedemptionFailureStat, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.GetRedemptionFailureStats")
+	defer endSpan(span, &err)
+
+	return tu.RedemptionGuard.GetFailureStats(ctx, page, pageSize)
 }
 
-func (tu *TransactionUseCase) GetTransactions(page int, pageSize int) ([]*Transaction, error) {
-	return tu.TransactionRepository.GetTransactions(page, pageSize)
+func (tu *TransactionUseCase) GetTransactions(ctx context.Context, page int, pageSize int) (_ []*Transaction, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.GetTransactions")
+	defer endSpan(span, &err)
+
+	return tu.TransactionRepository.GetTransactions(ctx, page, pageSize)
 }
 
-func (tu *TransactionUseCase) GetTransactionByID(id int) (*Transaction, error) {
-	return tu.TransactionRepository.GetTransactionByID(id)
+func (tu *TransactionUseCase) GetTransactionByID(ctx context.Context, id int) (_ *Transaction, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.GetTransactionByID")
+	defer endSpan(span, &err)
+
+	return tu.TransactionRepository.GetTransactionByID(ctx, id)
 }
 
-func (tu *TransactionUseCase) GetUserTransactionsByUserID(userId int, page int, pageSize int) ([]*Transaction, error) {
-	return tu.TransactionRepository.GetUserTransactionsByUserID(userId, page, pageSize)
+func (tu *TransactionUseCase) GetUserTransactionsByUserID(ctx context.Context, userId int, page int, pageSize int) (_ []*Transaction, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.GetUserTransactionsByUserID")
+	defer endSpan(span, &err)
+
+	return tu.TransactionRepository.GetUserTransactionsByUserID(ctx, userId, page, pageSize)
 }
 
-func (tu *TransactionUseCase) GetUserTotalTransaction(userId int) (int, error) {
-	return tu.TransactionRepository.GetUserTotalTransaction(userId)
+func (tu *TransactionUseCase) GetUserTotalTransaction(ctx context.Context, userId int) (_ int, err error) {
+	ctx, span := startSpan(ctx, "TransactionUseCase.GetUserTotalTransaction")
+	defer endSpan(span, &err)
+
+	return tu.TransactionRepository.GetUserTotalTransaction(ctx, userId)
 }
@@ -0,0 +1,26 @@
+// internal/usecase/transactor.go
+package usecase
+
+import "context"
+
+// Repositories groups the repositories that take part in one database
+// transaction.
+type Repositories struct {
+	Users        UserRepository
+	ChargeCodes  ChargeCodeRepository
+	Transactions TransactionRepository
+	Audit        AuditRepository
+	Outbox       OutboxRepository
+	Webhooks     WebhookRepository
+
+	TransactionLimits TransactionLimitRepository
+	Fraud             FraudRepository
+	Reconciliation    ReconciliationRepository
+}
+
+// Transactor runs fn inside a single database transaction. Every repository
+// in repos uses that transaction; it is committed when fn returns nil and
+// rolled back otherwise.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(repos *Repositories) error) error
+}
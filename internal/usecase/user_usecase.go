@@ -1,39 +1,127 @@
 // internal/usecase/user_usecase.go
 package usecase
 
+import "context"
+
 type User struct {
 	ID          int     `json:"id" binding:"required"`
 	PhoneNumber string  `json:"PhoneNumber" binding:"required"`
 	Balance     float64 `json:"Balance" binding:"required"`
+	// Version is incremented by every change to the user, including
+	// transactions. An update has to name the version it was based on.
+	Version int `json:"version"`
+}
+
+// UserPatch is a partial update of a user. Nil fields are left unchanged;
+// the balance is only changed by transactions.
+type UserPatch struct {
+	PhoneNumber *string
 }
 
 type UserRepository interface {
-	GetUserByPhoneNumber(phoneNumber string) (*User, error)
-	UpdateUser(user *User) (*User, error)
-	ListOfUsersUseChargeCode(chargeCodeId int, page int, pageSize int) ([]*User, error)
-	GetUserBalance(userId int) (float64, error)
+	GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (*User, error)
+	GetUserByID(ctx context.Context, id int) (*User, error)
+	UpdateUser(ctx context.Context, user *User) (*User, error)
+	PatchUser(ctx context.Context, id int, version int, patch *UserPatch) (*User, error)
+	ListOfUsersUseChargeCode(ctx context.Context, chargeCodeId int, page int, pageSize int) ([]*User, error)
+	GetUserBalance(ctx context.Context, userId int) (float64, error)
 }
 
 type UserUseCase struct {
 	UserRepository UserRepository
+	Transactor     Transactor
 }
 
-func NewUserUseCase(userRepo UserRepository) *UserUseCase {
-	return &UserUseCase{UserRepository: userRepo}
+func NewUserUseCase(userRepo UserRepository, transactor Transactor) *UserUseCase {
+	return &UserUseCase{UserRepository: userRepo, Transactor: transactor}
 }
 
-func (uc *UserUseCase) GetUserByPhoneNumber(phoneNumber string) (*User, error) {
-	return uc.UserRepository.GetUserByPhoneNumber(phoneNumber)
+func (uc *UserUseCase) GetUserByPhoneNumber(ctx context.Context, phoneNumber string) (_ *User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.GetUserByPhoneNumber")
+	defer endSpan(span, &err)
+
+	return uc.UserRepository.GetUserByPhoneNumber(ctx, phoneNumber)
 }
 
-func (uc *UserUseCase) UpdateUser(user *User) (*User, error) {
-	return uc.UserRepository.UpdateUser(user)
+func (uc *UserUseCase) UpdateUser(ctx context.Context, user *User, actor *Actor) (_ *User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.UpdateUser")
+	defer endSpan(span, &err)
+
+	var updated *User
+	err = uc.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.Users.GetUserByID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if before.Version != user.Version {
+			return ErrVersionMismatch
+		}
+
+		updated, err = repos.Users.UpdateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionUserUpdate, AuditEntityUser, user.ID, before, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
-func (uc *UserUseCase) ListOfUsersUseChargeCode(chargeCodeId int, page int, pageSize int) ([]*User, error) {
-	return uc.UserRepository.ListOfUsersUseChargeCode(chargeCodeId, page, pageSize)
+// PatchUser changes the fields set in patch of the user at version. Only the
+// fields that differ from the current ones are written; when none does,
+// nothing is written and the version stays the same.
+func (uc *UserUseCase) PatchUser(ctx context.Context, id int, version int, patch *UserPatch, actor *Actor) (_ *User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.PatchUser")
+	defer endSpan(span, &err)
+
+	var patched *User
+	err = uc.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.Users.GetUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if before.Version != version {
+			return ErrVersionMismatch
+		}
+
+		changes := &UserPatch{}
+		if patch.PhoneNumber != nil && *patch.PhoneNumber != before.PhoneNumber {
+			if !validPhoneNumber.MatchString(*patch.PhoneNumber) {
+				return ErrInvalidPhoneNumber
+			}
+			changes.PhoneNumber = patch.PhoneNumber
+		}
+		if changes.PhoneNumber == nil {
+			patched = before
+			return nil
+		}
+
+		patched, err = repos.Users.PatchUser(ctx, id, version, changes)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionUserUpdate, AuditEntityUser, id, before, patched)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patched, nil
 }
 
-func (uc *UserUseCase) GetUserBalance(userId int) (float64, error) {
-	return uc.UserRepository.GetUserBalance(userId)
+func (uc *UserUseCase) ListOfUsersUseChargeCode(ctx context.Context, chargeCodeId int, page int, pageSize int) (_ []*User, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.ListOfUsersUseChargeCode")
+	defer endSpan(span, &err)
+
+	return uc.UserRepository.ListOfUsersUseChargeCode(ctx, chargeCodeId, page, pageSize)
+}
+
+func (uc *UserUseCase) GetUserBalance(ctx context.Context, userId int) (_ float64, err error) {
+	ctx, span := startSpan(ctx, "UserUseCase.GetUserBalance")
+	defer endSpan(span, &err)
+
+	return uc.UserRepository.GetUserBalance(ctx, userId)
 }
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name        string
+		phoneNumber *string
+		version     int
+		err         error
+		want        string
+		wantVersion int
+	}{
+		{"phone number", stringRef("09120000003"), 1, nil, "09120000003", 2},
+		{"same phone number", stringRef("09120000001"), 1, nil, "09120000001", 1},
+		{"empty patch", nil, 1, nil, "09120000001", 1},
+		{"invalid phone number", stringRef("0912"), 1, ErrInvalidPhoneNumber, "", 0},
+		{"registered phone number", stringRef("09120000002"), 1, ErrPhoneNumberRegistered, "", 0},
+		{"stale version", stringRef("09120000003"), 2, ErrVersionMismatch, "", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newMemoryStore()
+			store.addUser("09120000001", 100)
+			store.addUser("09120000002", 0)
+			uc := NewUserUseCase(nil, store)
+
+			patched, err := uc.PatchUser(context.Background(), 1, test.version, &UserPatch{PhoneNumber: test.phoneNumber}, &Actor{Name: "ops"})
+			stored := store.data.users[1]
+			if test.err != nil {
+				if !errors.Is(err, test.err) {
+					t.Fatalf("PatchUser: err = %v, want %v", err, test.err)
+				}
+				if stored.PhoneNumber != "09120000001" || stored.Version != 1 || len(store.data.auditLogs) != 0 {
+					t.Errorf("user = %+v with %d audit logs, want it unchanged", stored, len(store.data.auditLogs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PatchUser: %v", err)
+			}
+
+			want := User{ID: 1, PhoneNumber: test.want, Balance: 100, Version: test.wantVersion}
+			if *patched != want || *stored != want {
+				t.Errorf("patched = %+v, stored %+v, want %+v", patched, stored, want)
+			}
+			if audited := len(store.data.auditLogs) == 1; audited != (test.wantVersion == 2) {
+				t.Errorf("%d audit logs, want one for a change", len(store.data.auditLogs))
+			}
+		})
+	}
+}
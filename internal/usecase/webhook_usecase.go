@@ -0,0 +1,440 @@
+// internal/usecase/webhook_usecase.go
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryDead      = "dead"
+)
+
+type WebhookSubscription struct {
+	SubscriptionID int       `json:"subscription_id"`
+	URL            string    `json:"url" binding:"required"`
+	EventTypes     []string  `json:"event_types" binding:"required"`
+	Secret         string    `json:"secret,omitempty"`
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	DeliveryID     int64                     `json:"delivery_id"`
+	SubscriptionID int                       `json:"subscription_id"`
+	EventID        string                    `json:"event_id"`
+	EventType      string                    `json:"event_type"`
+	Payload        json.RawMessage           `json:"payload" swaggertype:"object"`
+	Status         string                    `json:"status"`
+	Attempts       int                       `json:"attempts"`
+	NextAttemptAt  time.Time                 `json:"next_attempt_at"`
+	LastStatusCode int                       `json:"last_status_code,omitempty"`
+	LastError      string                    `json:"last_error,omitempty"`
+	CreatedAt      time.Time                 `json:"created_at"`
+	AttemptLog     []*WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+// WebhookDeliveryAttempt is one entry of the delivery log.
+type WebhookDeliveryAttempt struct {
+	AttemptID   int64     `json:"attempt_id"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int       `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription *WebhookSubscription) (*WebhookSubscription, error)
+	GetSubscriptions(ctx context.Context, page int, pageSize int) ([]*WebhookSubscription, error)
+	GetSubscriptionByID(ctx context.Context, id int) (*WebhookSubscription, error)
+	GetActiveSubscriptions(ctx context.Context) ([]*WebhookSubscription, error)
+	DeactivateSubscription(ctx context.Context, id int) error
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	// ClaimDueDeliveries returns pending deliveries whose next attempt is due
+	// and pushes their next attempt back by lease, so that other instances do
+	// not send them at the same time.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	CreateDeliveryAttempt(ctx context.Context, deliveryID int64, attempt *WebhookDeliveryAttempt) error
+	GetDeliveries(ctx context.Context, subscriptionID int, status string, page int, pageSize int) ([]*WebhookDelivery, error)
+	GetDeliveryByID(ctx context.Context, id int64) (*WebhookDelivery, error)
+}
+
+type WebhookConfig struct {
+	MaxAttempts  int
+	BackoffBase  time.Duration
+	BackoffMax   time.Duration
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// WebhookUseCase manages webhook subscriptions and delivers events to them.
+// Publish only records a pending delivery per subscription; Run sends them in
+// the background, retrying with exponential backoff until MaxAttempts is
+// reached and the delivery is dead-lettered.
+type WebhookUseCase struct {
+	WebhookRepository WebhookRepository
+	Transactor        Transactor
+	Config            WebhookConfig
+	Client            *http.Client
+	Heartbeat         *Heartbeat
+}
+
+func NewWebhookUseCase(webhookRepo WebhookRepository, transactor Transactor, config WebhookConfig) *WebhookUseCase {
+	return &WebhookUseCase{
+		WebhookRepository: webhookRepo,
+		Transactor:        transactor,
+		Config:            config,
+		Client:            &http.Client{Timeout: config.Timeout},
+		Heartbeat:         &Heartbeat{},
+	}
+}
+
+// withoutSecret returns a copy of subscription for the audit log, which must
+// not keep the secret.
+func withoutSecret(subscription *WebhookSubscription) *WebhookSubscription {
+	copied := *subscription
+	copied.Secret = ""
+	return &copied
+}
+
+func (wu *WebhookUseCase) CreateSubscription(ctx context.Context, subscription *WebhookSubscription, actor *Actor) (_ *WebhookSubscription, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.CreateSubscription")
+	defer endSpan(span, &err)
+
+	parsedURL, err := url.Parse(subscription.URL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, ValidationError("webhook url most be an absolute http or https url")
+	}
+
+	if len(subscription.EventTypes) == 0 {
+		return nil, ValidationError("at least one event type is required")
+	}
+	for _, eventType := range subscription.EventTypes {
+		if !isEventType(eventType) {
+			return nil, ValidationError(fmt.Sprintf("unknown event type %q", eventType))
+		}
+	}
+
+	if subscription.Secret == "" {
+		if subscription.Secret, err = randomID(32); err != nil {
+			return nil, err
+		}
+	}
+	subscription.Active = true
+
+	var created *WebhookSubscription
+	err = wu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		created, err = repos.Webhooks.CreateSubscription(ctx, subscription)
+		if err != nil {
+			return err
+		}
+
+		return writeAuditLog(ctx, repos, actor, AuditActionWebhookCreate, AuditEntityWebhook, created.SubscriptionID, nil, withoutSecret(created))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (wu *WebhookUseCase) GetSubscriptions(ctx context.Context, page int, pageSize int) (_ []*WebhookSubscription, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.GetSubscriptions")
+	defer endSpan(span, &err)
+
+	return wu.WebhookRepository.GetSubscriptions(ctx, page, pageSize)
+}
+
+func (wu *WebhookUseCase) GetSubscriptionByID(ctx context.Context, id int) (_ *WebhookSubscription, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.GetSubscriptionByID")
+	defer endSpan(span, &err)
+
+	subscription, err := wu.WebhookRepository.GetSubscriptionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// The secret is only shown once, when the subscription is created
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (wu *WebhookUseCase) DeactivateSubscription(ctx context.Context, id int, actor *Actor) (err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.DeactivateSubscription")
+	defer endSpan(span, &err)
+
+	return wu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.Webhooks.GetSubscriptionByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := repos.Webhooks.DeactivateSubscription(ctx, id); err != nil {
+			return err
+		}
+
+		before = withoutSecret(before)
+		after := *before
+		after.Active = false
+		return writeAuditLog(ctx, repos, actor, AuditActionWebhookDeactivate, AuditEntityWebhook, id, before, &after)
+	})
+}
+
+func (wu *WebhookUseCase) GetDeliveries(ctx context.Context, subscriptionID int, status string, page int, pageSize int) (_ []*WebhookDelivery, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.GetDeliveries")
+	defer endSpan(span, &err)
+
+	return wu.WebhookRepository.GetDeliveries(ctx, subscriptionID, status, page, pageSize)
+}
+
+func (wu *WebhookUseCase) GetDeliveryByID(ctx context.Context, id int64) (_ *WebhookDelivery, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.GetDeliveryByID")
+	defer endSpan(span, &err)
+
+	return wu.WebhookRepository.GetDeliveryByID(ctx, id)
+}
+
+// Redeliver puts a delivery back in the queue with a fresh set of attempts,
+// whatever its current status.
+func (wu *WebhookUseCase) Redeliver(ctx context.Context, id int64, actor *Actor) (_ *WebhookDelivery, err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.Redeliver")
+	defer endSpan(span, &err)
+
+	var delivery *WebhookDelivery
+	err = wu.Transactor.WithinTransaction(ctx, func(repos *Repositories) error {
+		before, err := repos.Webhooks.GetDeliveryByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		delivery = &WebhookDelivery{}
+		*delivery = *before
+		delivery.Status = WebhookDeliveryPending
+		delivery.Attempts = 0
+		delivery.NextAttemptAt = time.Now().UTC()
+		if err := repos.Webhooks.UpdateDelivery(ctx, delivery); err != nil {
+			return err
+		}
+
+		// The payload and the attempts are left out, the status is what changed
+		return writeAuditLog(ctx, repos, actor, AuditActionWebhookRedeliver, AuditEntityDelivery, int(id), deliveryStatus(before), deliveryStatus(delivery))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// deliveryStatus is the part of a delivery that a redelivery changes, as
+// written to the audit log.
+func deliveryStatus(delivery *WebhookDelivery) map[string]interface{} {
+	return map[string]interface{}{
+		"subscription_id": delivery.SubscriptionID,
+		"event_id":        delivery.EventID,
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}
+}
+
+// Publish records a pending delivery of event for every active subscription
+// interested in its type.
+func (wu *WebhookUseCase) Publish(ctx context.Context, event *Event) (err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.Publish")
+	defer endSpan(span, &err)
+
+	subscriptions, err := wu.WebhookRepository.GetActiveSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		if !subscribedTo(subscription, event.Type) {
+			continue
+		}
+		delivery := &WebhookDelivery{
+			SubscriptionID: subscription.SubscriptionID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         WebhookDeliveryPending,
+			NextAttemptAt:  time.Now().UTC(),
+		}
+		if err := wu.WebhookRepository.CreateDelivery(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func subscribedTo(subscription *WebhookSubscription, eventType string) bool {
+	for _, subscribed := range subscription.EventTypes {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Run sends due deliveries every PollInterval until ctx is cancelled.
+func (wu *WebhookUseCase) Run(ctx context.Context) {
+	ticker := time.NewTicker(wu.Config.PollInterval)
+	defer ticker.Stop()
+
+	wu.Heartbeat.Start()
+	defer wu.Heartbeat.Stop()
+
+	for {
+		err := wu.DeliverDue(ctx)
+		if err != nil {
+			slog.Error("error delivering webhooks", "error", err)
+		}
+		wu.Heartbeat.Beat(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliveryBatchSize is how many deliveries DeliverDue claims at once.
+const deliveryBatchSize = 50
+
+// DeliverDue sends every delivery whose next attempt is due.
+func (wu *WebhookUseCase) DeliverDue(ctx context.Context) (err error) {
+	ctx, span := startSpan(ctx, "WebhookUseCase.DeliverDue")
+	defer endSpan(span, &err)
+
+	for {
+		// The lease covers the HTTP timeout of every delivery in the batch
+		lease := wu.Config.Timeout*deliveryBatchSize + time.Minute
+		deliveries, err := wu.WebhookRepository.ClaimDueDeliveries(ctx, time.Now().UTC(), deliveryBatchSize, lease)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err := wu.attempt(ctx, delivery); err != nil {
+				return err
+			}
+		}
+
+		if len(deliveries) < deliveryBatchSize {
+			return nil
+		}
+	}
+}
+
+// attempt sends one delivery and records the outcome in the delivery log.
+func (wu *WebhookUseCase) attempt(ctx context.Context, delivery *WebhookDelivery) error {
+	subscription, err := wu.WebhookRepository.GetSubscriptionByID(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	statusCode, sendErr := wu.send(ctx, subscription, delivery)
+	if ctx.Err() != nil {
+		// Shutting down: leave the delivery claimed, it is retried once the lease expires
+		return nil
+	}
+	attempt := &WebhookDeliveryAttempt{
+		StatusCode: statusCode,
+		DurationMs: int(time.Since(started).Milliseconds()),
+	}
+	if sendErr != nil {
+		attempt.Error = sendErr.Error()
+	}
+	if err := wu.WebhookRepository.CreateDeliveryAttempt(ctx, delivery.DeliveryID, attempt); err != nil {
+		return err
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = attempt.Error
+	switch {
+	case sendErr == nil:
+		delivery.Status = WebhookDeliverySucceeded
+	case !subscription.Active || delivery.Attempts >= wu.Config.MaxAttempts:
+		delivery.Status = WebhookDeliveryDead
+	default:
+		delivery.NextAttemptAt = time.Now().UTC().Add(wu.backoff(delivery.Attempts))
+	}
+	return wu.WebhookRepository.UpdateDelivery(ctx, delivery)
+}
+
+// backoff returns the delay before the next attempt once attempts have
+// failed: BackoffBase doubled for every failure, capped at BackoffMax.
+func (wu *WebhookUseCase) backoff(attempts int) time.Duration {
+	delay := wu.Config.BackoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= wu.Config.BackoffMax {
+			return wu.Config.BackoffMax
+		}
+	}
+	return delay
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature header value for a
+// payload sent at timestamp. Receivers recompute the HMAC-SHA256 of
+// "<timestamp>.<body>" with their secret and compare it to v1.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts the delivery to the subscription URL. Any status outside 2xx
+// counts as a failure.
+func (wu *WebhookUseCase) send(ctx context.Context, subscription *WebhookSubscription, delivery *WebhookDelivery) (int, error) {
+	if !subscription.Active {
+		return 0, errors.New("subscription is not active")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Webhook-Event", delivery.EventType)
+	request.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.DeliveryID, 10))
+	request.Header.Set("X-Webhook-Signature", SignWebhookPayload(subscription.Secret, time.Now().Unix(), delivery.Payload))
+
+	response, err := wu.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,352 @@
+package usecase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeWebhookRepository keeps subscriptions and deliveries in memory. Like the
+// database it hands out copies, so a delivery only changes once it is updated.
+type fakeWebhookRepository struct {
+	subscriptions map[int]*WebhookSubscription
+	deliveries    map[int64]*WebhookDelivery
+	attempts      map[int64][]*WebhookDeliveryAttempt
+}
+
+func newFakeWebhookRepository() *fakeWebhookRepository {
+	return &fakeWebhookRepository{
+		subscriptions: map[int]*WebhookSubscription{},
+		deliveries:    map[int64]*WebhookDelivery{},
+		attempts:      map[int64][]*WebhookDeliveryAttempt{},
+	}
+}
+
+func (r *fakeWebhookRepository) CreateSubscription(ctx context.Context, subscription *WebhookSubscription) (*WebhookSubscription, error) {
+	subscription.SubscriptionID = len(r.subscriptions) + 1
+	r.subscriptions[subscription.SubscriptionID] = subscription
+	return subscription, nil
+}
+
+func (r *fakeWebhookRepository) GetSubscriptions(ctx context.Context, page int, pageSize int) ([]*WebhookSubscription, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) GetSubscriptionByID(ctx context.Context, id int) (*WebhookSubscription, error) {
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return nil, NotFoundError("webhook subscription not found")
+	}
+	copied := *subscription
+	return &copied, nil
+}
+
+func (r *fakeWebhookRepository) GetActiveSubscriptions(ctx context.Context) ([]*WebhookSubscription, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) DeactivateSubscription(ctx context.Context, id int) error {
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return NotFoundError("webhook subscription not found")
+	}
+	subscription.Active = false
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	delivery.DeliveryID = int64(len(r.deliveries) + 1)
+	copied := *delivery
+	r.deliveries[delivery.DeliveryID] = &copied
+	return nil
+}
+
+func (r *fakeWebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	due := []*WebhookDelivery{}
+	for id := int64(1); id <= int64(len(r.deliveries)) && len(due) < limit; id++ {
+		delivery := r.deliveries[id]
+		if delivery.Status != WebhookDeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		delivery.NextAttemptAt = now.Add(lease)
+		copied := *delivery
+		due = append(due, &copied)
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepository) UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	copied := *delivery
+	r.deliveries[delivery.DeliveryID] = &copied
+	return nil
+}
+
+func (r *fakeWebhookRepository) CreateDeliveryAttempt(ctx context.Context, deliveryID int64, attempt *WebhookDeliveryAttempt) error {
+	r.attempts[deliveryID] = append(r.attempts[deliveryID], attempt)
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetDeliveries(ctx context.Context, subscriptionID int, status string, page int, pageSize int) ([]*WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) GetDeliveryByID(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	delivery, ok := r.deliveries[id]
+	if !ok {
+		return nil, NotFoundError("webhook delivery not found")
+	}
+	copied := *delivery
+	return &copied, nil
+}
+
+var testWebhookConfig = WebhookConfig{
+	MaxAttempts: 3,
+	BackoffBase: time.Minute,
+	BackoffMax:  5 * time.Minute,
+	Timeout:     5 * time.Second,
+}
+
+// newTestWebhook returns a usecase with one subscription to receiver and one
+// pending delivery for it.
+func newTestWebhook(t *testing.T, receiver http.HandlerFunc) (*WebhookUseCase, *fakeWebhookRepository) {
+	t.Helper()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	repo := newFakeWebhookRepository()
+	repo.subscriptions[1] = &WebhookSubscription{SubscriptionID: 1, URL: server.URL, Secret: "s3cret", EventTypes: []string{EventUserCreated}, Active: true}
+	repo.CreateDelivery(context.Background(), &WebhookDelivery{
+		SubscriptionID: 1,
+		EventID:        "event-1",
+		EventType:      EventUserCreated,
+		Payload:        []byte(`{"id":"event-1"}`),
+		Status:         WebhookDeliveryPending,
+		NextAttemptAt:  time.Now().UTC(),
+	})
+	store := newMemoryStore()
+	store.webhooks = repo
+	return NewWebhookUseCase(repo, store, testWebhookConfig), repo
+}
+
+// auditLogs returns the audit logs written by uc.
+func auditLogs(uc *WebhookUseCase) []*AuditLog {
+	return uc.Transactor.(*memoryStore).data.auditLogs
+}
+
+// makeDue moves the next attempt of delivery 1 to the past, as if its backoff
+// had passed.
+func makeDue(repo *fakeWebhookRepository) {
+	repo.deliveries[1].NextAttemptAt = time.Now().UTC().Add(-time.Second)
+}
+
+func TestWebhookDeliverDueSignsPayload(t *testing.T) {
+	var signature, timestamp, body, event string
+	uc, repo := newTestWebhook(t, func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		body = string(payload)
+		event = r.Header.Get("X-Webhook-Event")
+		for _, part := range strings.Split(r.Header.Get("X-Webhook-Signature"), ",") {
+			key, value, _ := strings.Cut(part, "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signature = value
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if err := uc.DeliverDue(context.Background()); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+
+	if body != `{"id":"event-1"}` || event != EventUserCreated {
+		t.Errorf("receiver got event %q with body %s, want %s with the payload", event, body, EventUserCreated)
+	}
+	if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Errorf("signature timestamp = %q, want the time of sending", timestamp)
+	}
+	// The receiver's side of the check: the HMAC of "<t>.<body>"
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(timestamp + "." + body))
+	if want := hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature v1 = %q, want %q", signature, want)
+	}
+
+	delivery := repo.deliveries[1]
+	if delivery.Status != WebhookDeliverySucceeded || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusNoContent {
+		t.Errorf("delivery = %+v, want succeeded after 1 attempt with 204", delivery)
+	}
+	if attempts := repo.attempts[1]; len(attempts) != 1 || attempts[0].StatusCode != http.StatusNoContent || attempts[0].Error != "" {
+		t.Errorf("attempt log = %+v, want one successful attempt", attempts)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	uc := NewWebhookUseCase(nil, nil, testWebhookConfig)
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{10, 5 * time.Minute},
+		// Doubling this often would overflow without the cap
+		{100, 5 * time.Minute},
+	}
+	for _, test := range tests {
+		if delay := uc.backoff(test.attempts); delay != test.delay {
+			t.Errorf("backoff(%d) = %s, want %s", test.attempts, delay, test.delay)
+		}
+	}
+}
+
+func TestWebhookDeliverDueDeadLetters(t *testing.T) {
+	uc, repo := newTestWebhook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	ctx := context.Background()
+
+	for attempt := 1; attempt < testWebhookConfig.MaxAttempts; attempt++ {
+		before := time.Now().UTC()
+		if err := uc.DeliverDue(ctx); err != nil {
+			t.Fatalf("DeliverDue: %v", err)
+		}
+		delivery := repo.deliveries[1]
+		if delivery.Status != WebhookDeliveryPending || delivery.Attempts != attempt || delivery.LastStatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("after %d failures: delivery = %+v, want pending", attempt, delivery)
+		}
+		if wait := delivery.NextAttemptAt.Sub(before); wait < uc.backoff(attempt) || wait > uc.backoff(attempt)+time.Minute {
+			t.Errorf("after %d failures: next attempt in %s, want %s", attempt, wait, uc.backoff(attempt))
+		}
+
+		// Not due yet
+		if err := uc.DeliverDue(ctx); err != nil {
+			t.Fatalf("DeliverDue: %v", err)
+		}
+		if len(repo.attempts[1]) != attempt {
+			t.Fatalf("after %d failures: %d attempts sent, want the backoff to hold the next one", attempt, len(repo.attempts[1]))
+		}
+		makeDue(repo)
+	}
+
+	if err := uc.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	if delivery := repo.deliveries[1]; delivery.Status != WebhookDeliveryDead || delivery.Attempts != testWebhookConfig.MaxAttempts {
+		t.Errorf("delivery = %+v, want dead after %d attempts", delivery, testWebhookConfig.MaxAttempts)
+	}
+	if len(repo.attempts[1]) != testWebhookConfig.MaxAttempts {
+		t.Errorf("%d attempts logged, want %d", len(repo.attempts[1]), testWebhookConfig.MaxAttempts)
+	}
+}
+
+func TestWebhookRedeliver(t *testing.T) {
+	status := http.StatusInternalServerError
+	uc, repo := newTestWebhook(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	ctx := context.Background()
+
+	for attempt := 0; attempt < testWebhookConfig.MaxAttempts; attempt++ {
+		makeDue(repo)
+		if err := uc.DeliverDue(ctx); err != nil {
+			t.Fatalf("DeliverDue: %v", err)
+		}
+	}
+	if repo.deliveries[1].Status != WebhookDeliveryDead {
+		t.Fatalf("delivery = %+v, want dead", repo.deliveries[1])
+	}
+
+	delivery, err := uc.Redeliver(ctx, 1, &Actor{Name: "ops"})
+	if err != nil {
+		t.Fatalf("Redeliver: %v", err)
+	}
+	if delivery.Status != WebhookDeliveryPending || delivery.Attempts != 0 || delivery.NextAttemptAt.After(time.Now().UTC()) {
+		t.Errorf("redelivered delivery = %+v, want pending with no attempts and due now", delivery)
+	}
+
+	// The redelivery gets a full set of attempts again
+	status = http.StatusOK
+	if err := uc.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	if delivery := repo.deliveries[1]; delivery.Status != WebhookDeliverySucceeded || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, want succeeded on its first attempt", delivery)
+	}
+	if len(repo.attempts[1]) != testWebhookConfig.MaxAttempts+1 {
+		t.Errorf("%d attempts logged, want the earlier attempts kept", len(repo.attempts[1]))
+	}
+
+	logs := auditLogs(uc)
+	if len(logs) != 1 || logs[0].Action != AuditActionWebhookRedeliver || logs[0].EntityID != 1 || logs[0].Actor != "ops" ||
+		!strings.Contains(string(logs[0].Before), `"status":"dead"`) || !strings.Contains(string(logs[0].After), `"status":"pending"`) {
+		t.Errorf("audit logs = %+v, want the redelivery by ops from dead to pending", logs)
+	}
+
+	if _, err := uc.Redeliver(ctx, 2, &Actor{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Redeliver of a missing delivery: err = %v, want not found", err)
+	}
+}
+
+func TestWebhookSubscriptionsAreAudited(t *testing.T) {
+	uc, repo := newTestWebhook(t, func(w http.ResponseWriter, r *http.Request) {})
+	ctx := context.Background()
+
+	created, err := uc.CreateSubscription(ctx, &WebhookSubscription{URL: "https://example.com/hooks", EventTypes: []string{EventTransactionCreated}}, &Actor{Name: "ops"})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if created.Secret == "" {
+		t.Errorf("created subscription has no secret, want a generated one")
+	}
+	if err := uc.DeactivateSubscription(ctx, created.SubscriptionID, &Actor{Name: "admin"}); err != nil {
+		t.Fatalf("DeactivateSubscription: %v", err)
+	}
+	if repo.subscriptions[created.SubscriptionID].Active {
+		t.Errorf("subscription is still active")
+	}
+
+	logs := auditLogs(uc)
+	if len(logs) != 2 {
+		t.Fatalf("%d audit logs, want 2", len(logs))
+	}
+	tests := []struct {
+		action, actor, before, after string
+	}{
+		{AuditActionWebhookCreate, "ops", "", `"active":true`},
+		{AuditActionWebhookDeactivate, "admin", `"active":true`, `"active":false`},
+	}
+	for i, test := range tests {
+		log := logs[i]
+		if log.Action != test.action || log.Actor != test.actor || log.EntityType != AuditEntityWebhook || log.EntityID != created.SubscriptionID {
+			t.Errorf("audit log %d = %s of %s %d by %s, want %s by %s", i, log.Action, log.EntityType, log.EntityID, log.Actor, test.action, test.actor)
+		}
+		if !strings.Contains(string(log.Before), test.before) || !strings.Contains(string(log.After), test.after) {
+			t.Errorf("audit log %d = %s to %s, want %s to %s", i, log.Before, log.After, test.before, test.after)
+		}
+		// The secret is only returned by CreateSubscription
+		if strings.Contains(string(log.Before)+string(log.After), created.Secret) {
+			t.Errorf("audit log %d contains the secret", i)
+		}
+	}
+
+	if err := uc.DeactivateSubscription(ctx, 99, &Actor{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeactivateSubscription of a missing subscription: err = %v, want not found", err)
+	}
+	if len(auditLogs(uc)) != 2 {
+		t.Errorf("a failed change was audited")
+	}
+}